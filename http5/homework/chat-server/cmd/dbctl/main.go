@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+const ( // todo: config file
+	defaultSnapshotPath = "http5/homework/chat-server/internal/db/db_state.json"
+	defaultWALPath      = "http5/homework/chat-server/internal/db/db_state.wal"
+	defaultSnapshotKeep = 3
+)
+
+const (
+	backupPerm = 0o600
+	dbDirPerm  = 0o755
+)
+
+var errUsage = errors.New("invalid usage")
+
+// command runs a subcommand of dbctl with the arguments following its name.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"migrate": {
+		usage: "upgrade the snapshot file of the inmemory driver to the latest version",
+		run:   migrate,
+	},
+	"backup": {
+		usage: "write a backup of the snapshot and write-ahead log of a stopped inmemory driver",
+		run:   backup,
+	},
+	"restore": {
+		usage: "validate a backup and write it as the snapshot of a new inmemory driver",
+		run:   restore,
+	},
+}
+
+func migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	path := flags.String("snapshot", defaultSnapshotPath, "snapshot file to migrate in place")
+	keep := flags.Int("keep", defaultSnapshotKeep, "previous versions of the snapshot file to keep")
+
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	registry := repository.SnapshotMigrations()
+
+	version, err := inmemory.MigrateSnapshotFile(*path, registry, *keep)
+	if err != nil {
+		return err
+	}
+
+	if version == registry.Latest() {
+		fmt.Printf("%s is already at version %d\n", *path, version)
+		return nil
+	}
+
+	fmt.Printf("%s migrated from version %d to %d\n", *path, version, registry.Latest())
+
+	return nil
+}
+
+// openDB restores the database the way the server does, creating tables and indexes of the repositories,
+// so that restored rows are checked against them. closeDB waits for the database to be closed.
+func openDB(jsonState string, opts ...inmemory.Option) (db *inmemory.InMemDB, closeDB func() error, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	db, savedChan, err := inmemory.NewInMemDBFromJSON(ctx, jsonState, "", append(repository.InMemDBSchema(), opts...)...)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	closeDB = func() error {
+		cancel()
+
+		if res := <-savedChan; res != "ok" {
+			return fmt.Errorf("cannot close database: %v", res)
+		}
+
+		return nil
+	}
+
+	if _, err = repository.NewInMemUserRepo(db); err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+
+	if _, err = repository.NewInMemPrivateMessageRepo(db); err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+
+	if _, err = repository.NewInMemSessionRepo(db); err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+
+	if _, err = repository.NewInMemPublicMessageRepo(db); err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+
+	if _, err = repository.NewInMemRoomRepo(db); err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+
+	if _, err = repository.NewInMemRoomMessageRepo(db); err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+
+	return db, closeDB, nil
+}
+
+func backup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	snapshotPath := flags.String("snapshot", defaultSnapshotPath, "snapshot file of the database")
+	walPath := flags.String("wal", defaultWALPath, "write-ahead log of the database, replayed if it exists")
+	out := flags.String("out", "", "backup file to write")
+
+	if err := flags.Parse(args); err != nil || *out == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	jsonState, err := os.ReadFile(*snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	var opts []inmemory.Option
+
+	if _, err = os.Stat(*walPath); err == nil {
+		wal, err := inmemory.OpenWAL(inmemory.WALConfig{Path: *walPath, Policy: inmemory.SyncAlways})
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, inmemory.WithWAL(wal))
+	}
+
+	db, closeDB, err := openDB(string(jsonState), opts...)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, backupPerm)
+	if err != nil {
+		closeDB()
+		return err
+	}
+
+	err = db.Backup(file)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := closeDB(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	fmt.Printf("backup written to %s\n", *out)
+
+	return nil
+}
+
+func restore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := flags.String("in", "", "backup file to restore")
+	snapshotPath := flags.String("snapshot", defaultSnapshotPath, "snapshot file to create, it must not exist")
+	walPath := flags.String("wal", defaultWALPath, "write-ahead log of the database, it must be empty if it exists")
+
+	if err := flags.Parse(args); err != nil || *in == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	// a log left next to the restored snapshot would be replayed on top of it
+	if info, err := os.Stat(*walPath); err == nil && info.Size() > 0 {
+		return fmt.Errorf("%w: %s is not empty", inmemory.ErrNotEmpty, *walPath)
+	}
+
+	if _, err := os.Stat(*snapshotPath); err == nil {
+		return fmt.Errorf("%w: %s exists", inmemory.ErrNotEmpty, *snapshotPath)
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if err = os.MkdirAll(filepath.Dir(*snapshotPath), dbDirPerm); err != nil {
+		return err
+	}
+
+	db, closeDB, err := openDB("{}")
+	if err != nil {
+		return err
+	}
+
+	err = db.Restore(file)
+	if err == nil {
+		savedChan := make(chan any, 1)
+
+		db.Save(*snapshotPath, savedChan)
+
+		if res := <-savedChan; res != "ok" {
+			err = fmt.Errorf("cannot save snapshot: %v", res)
+		}
+	}
+
+	if closeErr := closeDB(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s restored to %s\n", *in, *snapshotPath)
+
+	return nil
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: dbctl <command> [flags]\n\ncommands:\n")
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(os.Args[2:])
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dbctl %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+type LockoutKind string
+
+const (
+	LockoutKindUsername LockoutKind = "username"
+	LockoutKindAddr     LockoutKind = "addr"
+)
+
+// LoginLockout is the failed logins of a username or of a client address.
+// LockedUntil is zero unless logins are locked.
+type LoginLockout struct {
+	Kind        LockoutKind
+	Subject     string
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
@@ -0,0 +1,82 @@
+package entity
+
+import "time"
+
+// Cursor points at an item of a listing ordered by time and then by ID,
+// At is zero in listings ordered by ID alone.
+type Cursor struct {
+	ID int
+	At time.Time
+}
+
+// Compare returns -1, 0 or +1 if the item of id and at goes before, at or after the cursor.
+func (c Cursor) Compare(id int, at time.Time) int {
+	if cmp := at.Compare(c.At); cmp != 0 {
+		return cmp
+	}
+
+	switch {
+	case id < c.ID:
+		return -1
+	case id > c.ID:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Page is a window of a listing, it holds up to Limit items following After or preceding Before.
+// The first items are listed if neither is set, only one of them is set otherwise.
+type Page struct {
+	After  *Cursor
+	Before *Cursor
+	Limit  int
+}
+
+// Backward reports whether the page is read from its end, that is if it precedes a cursor.
+func (p Page) Backward() bool {
+	return p.Before != nil
+}
+
+// Contains reports whether the item of id and at lies between the cursors of the page, the limit is not checked.
+func (p Page) Contains(id int, at time.Time) bool {
+	if p.After != nil && p.After.Compare(id, at) <= 0 {
+		return false
+	}
+
+	return p.Before == nil || p.Before.Compare(id, at) < 0
+}
+
+// PageCursors point at the items at the edges of a page. Next is nil if no items follow the page
+// and Prev is nil if none precede it.
+type PageCursors struct {
+	Next *Cursor
+	Prev *Cursor
+}
+
+func PublicMessageCursor(msg *PublicMessage) Cursor {
+	return Cursor{ID: msg.ID, At: msg.SentAt}
+}
+
+func PrivateMessageCursor(msg *PrivateMessage) Cursor {
+	return Cursor{ID: msg.ID, At: msg.SentAt}
+}
+
+// UserCursor points at the user in listings of users, they are ordered by ID.
+func UserCursor(user *User) Cursor {
+	return Cursor{ID: user.ID}
+}
+
+// RoomCursor points at the room in listings of rooms, they are ordered by ID.
+func RoomCursor(room *Room) Cursor {
+	return Cursor{ID: room.ID}
+}
+
+// RoomMemberCursor points at the member in listings of members of a room, they are ordered by user ID.
+func RoomMemberCursor(member *RoomMember) Cursor {
+	return Cursor{ID: member.User.ID}
+}
+
+func RoomMessageCursor(msg *RoomMessage) Cursor {
+	return Cursor{ID: msg.ID, At: msg.SentAt}
+}
@@ -0,0 +1,21 @@
+package entity
+
+type AuthMethod string
+
+const (
+	AuthMethodBasic   AuthMethod = "basic"
+	AuthMethodJWT     AuthMethod = "jwt"
+	AuthMethodSession AuthMethod = "session"
+)
+
+// Principal is who a request is authenticated as.
+type Principal struct {
+	UserID     int
+	Username   string
+	Roles      []Role
+	AuthMethod AuthMethod
+}
+
+func (p *Principal) Can(permission Permission) bool {
+	return RolesCan(p.Roles, permission)
+}
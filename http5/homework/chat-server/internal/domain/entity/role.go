@@ -0,0 +1,58 @@
+package entity
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermissionDeleteUsers    Permission = "users:delete"
+	PermissionBanUsers       Permission = "users:ban"
+	PermissionPromoteUsers   Permission = "users:promote"
+	PermissionDeleteMessages Permission = "messages:delete"
+	// PermissionManageServer allows backups, restores, revoking sessions and viewing login lockouts
+	PermissionManageServer Permission = "server:manage"
+)
+
+// rolePermissions is the policy of the chat: what users having a role are allowed to do.
+var rolePermissions = map[Role][]Permission{
+	RoleUser: {},
+	RoleAdmin: {
+		PermissionDeleteUsers,
+		PermissionBanUsers,
+		PermissionPromoteUsers,
+		PermissionDeleteMessages,
+		PermissionManageServer,
+	},
+}
+
+// Valid reports whether the role is known to the policy.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RolesCan reports whether any of the roles grants the permission.
+func RolesCan(roles []Role, permission Permission) bool {
+	for _, role := range roles {
+		if role.Can(permission) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+type RoomVisibility string
+
+const (
+	// RoomPublic rooms are listed to every user and anyone can join them
+	RoomPublic RoomVisibility = "public"
+	// RoomInviteOnly rooms are seen by their members and the users invited to them only
+	RoomInviteOnly RoomVisibility = "invite_only"
+)
+
+func (v RoomVisibility) Valid() bool {
+	return v == RoomPublic || v == RoomInviteOnly
+}
+
+// Room is a named chat, the owner joins it when it is created. Names of rooms are unique.
+type Room struct {
+	ID         int
+	Name       string
+	Visibility RoomVisibility
+	Owner      *User
+	CreatedAt  time.Time
+}
+
+type RoomMemberStatus string
+
+const (
+	RoomMemberInvited RoomMemberStatus = "invited"
+	RoomMemberJoined  RoomMemberStatus = "joined"
+)
+
+// RoomMember is a user invited to a room or joined it, Since is when the status was set.
+type RoomMember struct {
+	RoomID int
+	User   *User
+	Status RoomMemberStatus
+	Since  time.Time
+}
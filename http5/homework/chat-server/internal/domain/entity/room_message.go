@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+type RoomMessage struct {
+	ID       int
+	RoomID   int
+	From     *User
+	Content  string
+	SentAt   time.Time
+	EditedAt time.Time
+}
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// Session is a login of a user. ID is the hash of the token the session was opened with,
+// the token itself is only known to the client.
+type Session struct {
+	ID         string
+	UserID     int
+	UserAgent  string
+	RemoteAddr string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
@@ -1,16 +1,30 @@
 package entity
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoSuchUser is returned by repositories when there is no user asked for,
+// so that services tell a missing user from a failed lookup.
+var ErrNoSuchUser = errors.New("no such user")
 
 type User struct {
 	ID             int
 	Email          string
 	Username       string
 	HashedPassword string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	Role           Role
+	// Banned users can't log in, their sessions and refresh tokens are rejected
+	Banned    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 func (u *User) Equal(other User) bool {
 	return u.Username == other.Username
 }
+
+func (u *User) Can(permission Permission) bool {
+	return !u.Banned && u.Role.Can(permission)
+}
@@ -0,0 +1,292 @@
+// nolint
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/mapper"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/policy"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
+	sliceutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/slice"
+)
+
+// maxBackupSize limits the body of restore requests.
+const maxBackupSize = 256 << 20
+
+type Database interface {
+	Backup(w io.Writer) error
+	Restore(r io.Reader) error
+}
+
+type SessionService interface {
+	RevokeSession(ctx context.Context, id string) error
+	LogoutEverywhere(ctx context.Context, userID int) (int, error)
+}
+
+type LoginLimiter interface {
+	Lockouts() []*entity.LoginLockout
+}
+
+// Handler serves the endpoints of what it is given: DB is nil for drivers without backups,
+// SessionService is nil when requests are not authenticated by sessions
+// and LoginLimiter is nil when logins are not limited.
+// Users are looked up on every request, so a demoted or banned admin is rejected at once.
+type Handler struct {
+	DB             Database
+	Users          policy.UserGetter
+	SessionService SessionService
+	LoginLimiter   LoginLimiter
+	Authenticator  middleware.Authenticator
+	logger         *logrus.Logger
+}
+
+func New(
+	db Database,
+	users policy.UserGetter,
+	sessionService SessionService,
+	loginLimiter LoginLimiter,
+	authenticator middleware.Authenticator,
+	logger *logrus.Logger,
+) *Handler {
+	return &Handler{
+		DB:             db,
+		Users:          users,
+		SessionService: sessionService,
+		LoginLimiter:   loginLimiter,
+		Authenticator:  authenticator,
+		logger:         logger,
+	}
+}
+
+func (h *Handler) Routes() *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(h.Authenticator, h.logger))
+		r.Use(middleware.RequirePermission(entity.PermissionManageServer, h.logger))
+
+		if h.DB != nil {
+			r.Get("/backup", h.Backup)
+			r.Post("/restore", h.Restore)
+		}
+
+		if h.SessionService != nil {
+			r.Delete("/sessions/{id}", h.RevokeSession)
+			r.Delete("/users/{id}/sessions", h.RevokeUserSessions)
+		}
+
+		if h.LoginLimiter != nil {
+			r.Get("/lockouts", h.GetLockouts)
+		}
+	})
+
+	return router
+}
+
+// authorize checks the permission of the user the request is sent by against the stored user,
+// since a token may carry a role the user no longer has. It reports false once it has responded.
+func (h *Handler) authorize(rw http.ResponseWriter, req *http.Request) bool {
+	actorID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return false
+	}
+
+	if _, err = policy.Authorize(req.Context(), h.Users, actorID, entity.PermissionManageServer); err != nil {
+		logMsg := fmt.Sprintf("error occurred authorizing admin request: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusForbidden, logMsg, "forbidden")
+
+		return false
+	}
+
+	return true
+}
+
+// Backup godoc
+//
+//	@Summary		Back up the database
+//	@Description	Stream the state of the database at a single point in time, the backup can be restored with /restore
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{object}	object
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		500	{string}	internal	error
+//	@Router			/api/v1/admin/backup [get]
+func (h *Handler) Backup(rw http.ResponseWriter, req *http.Request) {
+	if !h.authorize(rw, req) {
+		return
+	}
+
+	filename := fmt.Sprintf("chat-backup-%s.json", time.Now().UTC().Format("20060102T150405Z"))
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// headers are sent with the first write, which only happens once the backup is encoded
+	if err := h.DB.Backup(rw); err != nil {
+		logMsg := fmt.Sprintf("error occurred backing up database: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot back up database")
+
+		return
+	}
+
+	h.logger.Infof("database backup %s sent to %s", filename, req.RemoteAddr)
+}
+
+// Restore godoc
+//
+//	@Summary		Restore the database from a backup
+//	@Description	Replace the rows of the database with a backup made with /backup, sessions missing from the backup are closed
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Admin
+//	@Accept			json
+//	@Param			input	body	object	true	"backup"
+//	@Success		204
+//	@Failure		400	{string}	invalid	backup
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		413	{string}	backup		is	too	large
+//	@Failure		500	{string}	internal	error
+//	@Router			/api/v1/admin/restore [post]
+func (h *Handler) Restore(rw http.ResponseWriter, req *http.Request) {
+	if !h.authorize(rw, req) {
+		return
+	}
+
+	err := h.DB.Restore(http.MaxBytesReader(rw, req.Body, maxBackupSize))
+
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case err == nil:
+		h.logger.Infof("database restored from backup sent by %s", req.RemoteAddr)
+		rw.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, inmemory.ErrInvalidBackup):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+	case errors.As(err, &tooLarge):
+		respMsg := fmt.Sprintf("backup is larger than %d bytes", tooLarge.Limit)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusRequestEntityTooLarge, "", respMsg)
+	default:
+		logMsg := fmt.Sprintf("error occurred restoring database: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot restore database")
+	}
+}
+
+// RevokeSession godoc
+//
+//	@Summary		Revoke session
+//	@Description	Close any session by its id
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Admin
+//	@Param			id	path	string	true	"session id"
+//	@Success		204
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		404	{string}	no	such	session
+//	@Router			/api/v1/admin/sessions/{id} [delete]
+func (h *Handler) RevokeSession(rw http.ResponseWriter, req *http.Request) {
+	if !h.authorize(rw, req) {
+		return
+	}
+
+	id := chi.URLParam(req, "id")
+
+	err := h.SessionService.RevokeSession(req.Context(), id)
+
+	switch {
+	case err == nil:
+		h.logger.Infof("session %s revoked by %s", id, req.RemoteAddr)
+		rw.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, service.ErrNoSuchSession):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusNotFound, "", service.ErrNoSuchSession.Error())
+	default:
+		logMsg := fmt.Sprintf("error occurred revoking session: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot revoke session")
+	}
+}
+
+// RevokeUserSessions godoc
+//
+//	@Summary		Revoke sessions of user
+//	@Description	Close all sessions of a user, e.g. of a compromised account
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Admin
+//	@Param			id	path	int	true	"user id"
+//	@Success		204
+//	@Failure		400	{string}	invalid	user	id
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		500	{string}	internal	error
+//	@Router			/api/v1/admin/users/{id}/sessions [delete]
+func (h *Handler) RevokeUserSessions(rw http.ResponseWriter, req *http.Request) {
+	if !h.authorize(rw, req) {
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(req, "id"))
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", "invalid user id")
+		return
+	}
+
+	revoked, err := h.SessionService.LogoutEverywhere(req.Context(), userID)
+	if err != nil {
+		logMsg := fmt.Sprintf("error occurred revoking sessions of user %d: %v", userID, err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot revoke sessions")
+
+		return
+	}
+
+	h.logger.Infof("%d sessions of user %d revoked by %s", revoked, userID, req.RemoteAddr)
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// GetLockouts godoc
+//
+//	@Summary		Get login lockouts
+//	@Description	Get usernames and client addresses having failed logins, locked_until is set for the locked ones
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{object}	[]response.LockoutResponse
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Router			/api/v1/admin/lockouts [get]
+func (h *Handler) GetLockouts(rw http.ResponseWriter, req *http.Request) {
+	if !h.authorize(rw, req) {
+		return
+	}
+
+	lockouts := h.LoginLimiter.Lockouts()
+
+	render.JSON(rw, req, sliceutils.Map(lockouts, mapper.MapLockoutToResponse))
+}
@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+// roleAuthenticator authenticates every request as a user having the role.
+type roleAuthenticator struct {
+	role entity.Role
+}
+
+func (a roleAuthenticator) Authenticate(*http.Request) (*entity.Principal, error) {
+	return &entity.Principal{UserID: 1, Roles: []entity.Role{a.role}, AuthMethod: entity.AuthMethodBasic}, nil
+}
+
+// fakeUsers holds the stored users by their ids.
+type fakeUsers map[int]*entity.User
+
+func (u fakeUsers) GetUserByID(_ context.Context, id int) (*entity.User, error) {
+	user, exists := u[id]
+	if !exists {
+		return nil, repository.ErrNoSuchUser
+	}
+
+	return user, nil
+}
+
+type fakeLoginLimiter struct{}
+
+func (fakeLoginLimiter) Lockouts() []*entity.LoginLockout {
+	return []*entity.LoginLockout{}
+}
+
+func TestRoutesRequireManageServerPermission(t *testing.T) {
+	tests := []struct {
+		name   string
+		role   entity.Role
+		status int
+	}{
+		{name: "user", role: entity.RoleUser, status: http.StatusForbidden},
+		{name: "admin", role: entity.RoleAdmin, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := fakeUsers{1: {ID: 1, Role: tt.role}}
+
+			h := New(nil, users, nil, fakeLoginLimiter{}, roleAuthenticator{role: tt.role}, logrus.New())
+
+			rw := httptest.NewRecorder()
+
+			h.Routes().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/lockouts", nil))
+
+			if rw.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rw.Code, rw.Body)
+			}
+		})
+	}
+}
+
+func TestRestoreReplacesPopulatedDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	db, _ := inmemory.NewInMemDB(ctx, "", repository.InMemDBSchema()...)
+
+	users, err := repository.NewInMemUserRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := repository.NewInMemSessionRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server always has the admin, and the session of the admin in session mode
+	admin, err := users.AddUser(ctx, entity.User{Username: "admin", Email: "admin@mail.com", Role: entity.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sessions.AddSession(ctx, entity.Session{ID: "admin-session", UserID: admin.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(db, users, nil, nil, roleAuthenticator{role: entity.RoleAdmin}, logrus.New())
+
+	rw := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/backup", nil))
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rw.Code, rw.Body)
+	}
+
+	backup := rw.Body.Bytes()
+
+	// made after the backup, so the restore drops it
+	if _, err = users.AddUser(ctx, entity.User{Username: "late", Email: "late@mail.com", Role: entity.RoleUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	rw = httptest.NewRecorder()
+	h.Routes().ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/restore", bytes.NewReader(backup)))
+
+	if rw.Code != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d: %s", http.StatusNoContent, rw.Code, rw.Body)
+	}
+
+	if user, err := users.GetUserByUsername(ctx, "admin"); err != nil || user.ID != admin.ID {
+		t.Fatalf("expected admin %d to be restored, got %v (%v)", admin.ID, user, err)
+	}
+
+	if _, err = users.GetUserByUsername(ctx, "late"); !errors.Is(err, repository.ErrNoSuchUser) {
+		t.Fatalf("expected user added after the backup to be gone, got %v", err)
+	}
+
+	if _, err = sessions.GetSession(ctx, "admin-session"); err != nil {
+		t.Fatalf("expected session to be restored, got %v", err)
+	}
+}
+
+func TestTokenIssuedBeforeDemotionIsForbidden(t *testing.T) {
+	ctx := context.Background()
+
+	db, _ := inmemory.NewInMemDB(ctx, "", repository.InMemDBSchema()...)
+
+	users, err := repository.NewInMemUserRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin, err := users.AddUser(ctx, entity.User{
+		Username:       "admin",
+		Email:          "admin@mail.com",
+		HashedPassword: string(hashed),
+		Role:           entity.RoleAdmin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := service.NewJWTAuthService(users, service.JWTConfig{
+		Keys:       []service.JWTKey{{ID: "test", Secret: []byte(strings.Repeat("k", 32))}},
+		Issuer:     "test",
+		AccessTTL:  time.Hour,
+		RefreshTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := tokens.IssueTokens(ctx, request.LoginRequest{Username: "admin", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(nil, users, nil, fakeLoginLimiter{}, middleware.NewBearerAuthenticator(tokens, entity.AuthMethodJWT), logrus.New())
+
+	getLockouts := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/lockouts", nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+
+		rw := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	if code := getLockouts(); code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, code)
+	}
+
+	// the token still carries the admin role
+	admin.Role = entity.RoleUser
+
+	if _, err = users.UpdateUser(ctx, admin.ID, *admin); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := getLockouts(); code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, code)
+	}
+}
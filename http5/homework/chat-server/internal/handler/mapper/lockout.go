@@ -0,0 +1,21 @@
+package mapper
+
+import (
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/response"
+)
+
+func MapLockoutToResponse(lockout *entity.LoginLockout) response.LockoutResponse {
+	resp := response.LockoutResponse{
+		Kind:        string(lockout.Kind),
+		Subject:     lockout.Subject,
+		Failures:    lockout.Failures,
+		LastFailure: lockout.LastFailure,
+	}
+
+	if !lockout.LockedUntil.IsZero() {
+		resp.LockedUntil = &lockout.LockedUntil
+	}
+
+	return resp
+}
@@ -0,0 +1,37 @@
+package mapper
+
+import (
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/response"
+)
+
+func MapRoomToResponse(room *entity.Room) response.RoomResponse {
+	return response.RoomResponse{
+		ID:            room.ID,
+		Name:          room.Name,
+		Visibility:    string(room.Visibility),
+		OwnerUsername: room.Owner.Username,
+		CreatedAt:     room.CreatedAt,
+	}
+}
+
+func MapRoomMemberToResponse(member *entity.RoomMember) response.RoomMemberResponse {
+	return response.RoomMemberResponse{
+		RoomID:   member.RoomID,
+		UserID:   member.User.ID,
+		Username: member.User.Username,
+		Status:   string(member.Status),
+		Since:    member.Since,
+	}
+}
+
+func MapRoomMessageToResponse(msg *entity.RoomMessage) response.RoomMessageResponse {
+	return response.RoomMessageResponse{
+		ID:           msg.ID,
+		RoomID:       msg.RoomID,
+		FromUsername: msg.From.Username,
+		Content:      msg.Content,
+		SentAt:       msg.SentAt,
+		EditedAt:     msg.EditedAt,
+	}
+}
@@ -0,0 +1,24 @@
+package mapper
+
+import (
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/response"
+)
+
+func MapSessionToResponse(session *entity.Session) response.SessionResponse {
+	return response.SessionResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		RemoteAddr: session.RemoteAddr,
+		CreatedAt:  session.CreatedAt,
+		ExpiresAt:  session.ExpiresAt,
+	}
+}
+
+func MapOpenedSessionToResponse(token string, session *entity.Session) response.OpenSessionResponse {
+	return response.OpenSessionResponse{
+		Token:     token,
+		TokenType: tokenTypeBearer,
+		Session:   MapSessionToResponse(session),
+	}
+}
@@ -0,0 +1,45 @@
+package mapper
+
+import (
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/response"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+)
+
+const socketEventError = "error"
+
+func MapEventToSocketResponse(event hub.Event) response.SocketEventResponse {
+	switch event.Type {
+	case hub.EventPublicMessage:
+		return MapPublicMessageToSocketResponse(event.PublicMessage)
+	case hub.EventPrivateMessage:
+		return MapPrivateMessageToSocketResponse(event.PrivateMessage)
+	default:
+		return response.SocketEventResponse{Type: string(event.Type)}
+	}
+}
+
+func MapPublicMessageToSocketResponse(msg *entity.PublicMessage) response.SocketEventResponse {
+	resp := MapPublicMessageToResponse(msg)
+
+	return response.SocketEventResponse{
+		Type:          string(hub.EventPublicMessage),
+		PublicMessage: &resp,
+	}
+}
+
+func MapPrivateMessageToSocketResponse(msg *entity.PrivateMessage) response.SocketEventResponse {
+	resp := MapPrivateMessageToResponse(msg)
+
+	return response.SocketEventResponse{
+		Type:           string(hub.EventPrivateMessage),
+		PrivateMessage: &resp,
+	}
+}
+
+func MapErrorToSocketResponse(err error) response.SocketEventResponse {
+	return response.SocketEventResponse{
+		Type:  socketEventError,
+		Error: err.Error(),
+	}
+}
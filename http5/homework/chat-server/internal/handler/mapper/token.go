@@ -0,0 +1,18 @@
+package mapper
+
+import (
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/response"
+)
+
+const tokenTypeBearer = "Bearer"
+
+func MapTokenPairToResponse(tokens *entity.TokenPair) response.TokenResponse {
+	return response.TokenResponse{
+		AccessToken:      tokens.AccessToken,
+		AccessExpiresAt:  tokens.AccessExpiresAt,
+		RefreshToken:     tokens.RefreshToken,
+		RefreshExpiresAt: tokens.RefreshExpiresAt,
+		TokenType:        tokenTypeBearer,
+	}
+}
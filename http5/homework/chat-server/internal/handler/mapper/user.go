@@ -11,6 +11,8 @@ func MapUserToUserResponse(user *entity.User) response.GetUserResponse {
 		ID:        user.ID,
 		Username:  user.Username,
 		Email:     user.Email,
+		Role:      string(user.Role),
+		Banned:    user.Banned,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 	}
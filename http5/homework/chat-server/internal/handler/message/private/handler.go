@@ -18,8 +18,10 @@ import (
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/mapper"
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
 
 	messageservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/message"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/policy"
 
 	handlerinternalutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/pkg/utils/handler"
 	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
@@ -30,7 +32,15 @@ type PrivateMessageService interface {
 	SendPrivateMessage(ctx context.Context, fromID, toID int, content string) (*entity.PrivateMessage, error)
 	GetPrivateMessage(ctx context.Context, id int) (*entity.PrivateMessage, error)
 	GetAllPrivateMessages(ctx context.Context, userToID int, offset, limit int) []*entity.PrivateMessage
+	GetPrivateMessagesPage(ctx context.Context, userToID int, page entity.Page) ([]*entity.PrivateMessage, entity.PageCursors)
+	GetPrivateMessagesAfter(ctx context.Context, userToID, afterID, limit int) []*entity.PrivateMessage
 	GetAllPrivateMessagesFromUser(ctx context.Context, toID, fromID int, offset, limit int) ([]*entity.PrivateMessage, error)
+	GetPrivateMessagesFromUserPage(
+		ctx context.Context,
+		toID, fromID int,
+		page entity.Page,
+	) ([]*entity.PrivateMessage, entity.PageCursors, error)
+	DeletePrivateMessage(ctx context.Context, actorID, id int) error
 }
 
 type UserService interface {
@@ -40,17 +50,18 @@ type UserService interface {
 	GetUserByUsername(ctx context.Context, username string) (*entity.User, error)
 	GetAllUsers(ctx context.Context, offset, limit int) []*entity.User
 	UpdateUser(ctx context.Context, id int, updateModel entity.User) (*entity.User, error)
-	DeleteUser(ctx context.Context, id int) (*entity.User, error)
+	DeleteUser(ctx context.Context, actorID, id int) (*entity.User, error)
 }
 
-type AuthService interface {
-	Login(ctx context.Context, loginReq request.LoginRequest) (*entity.User, error)
+type Subscriber interface {
+	Subscribe(userID int) *hub.Subscription
 }
 
 type Handler struct {
 	MessageService PrivateMessageService
 	UserService    UserService
-	AuthService    AuthService
+	Hub            Subscriber
+	Authenticator  middleware.Authenticator
 	logger         *logrus.Logger
 	validator      *validator.Validate
 }
@@ -58,14 +69,16 @@ type Handler struct {
 func New(
 	privateMessageService PrivateMessageService,
 	userService UserService,
-	authService AuthService,
+	hub Subscriber,
+	authenticator middleware.Authenticator,
 	logger *logrus.Logger,
 	validator *validator.Validate,
 ) *Handler {
 	return &Handler{
 		MessageService: privateMessageService,
 		UserService:    userService,
-		AuthService:    authService,
+		Hub:            hub,
+		Authenticator:  authenticator,
 		logger:         logger,
 		validator:      validator,
 	}
@@ -75,12 +88,15 @@ func (h *Handler) Routes() *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware(h.AuthService, h.logger, h.validator))
+		r.Use(middleware.AuthMiddleware(h.Authenticator, h.logger))
 
 		r.Get("/", h.GetAllPrivateMessages)
 		r.Post("/", h.SendPrivateMessage)
+		r.Get("/poll", h.PollPrivateMessages)
 
 		r.Get("/user/{id}", h.GetAllPrivateMessagesFromUser)
+
+		r.With(middleware.RequirePermission(entity.PermissionDeleteMessages, h.logger)).Delete("/{id}", h.DeletePrivateMessage)
 	})
 
 	return router
@@ -93,6 +109,9 @@ func switchByErrorAndWriteResponse(err error, rw http.ResponseWriter, logger *lo
 
 		handlerutils.WriteErrResponseAndLog(rw, logger, http.StatusBadRequest, errMsg, errMsg)
 
+	case errors.Is(err, messageservice.ErrSenderBanned):
+		handlerutils.WriteErrResponseAndLog(rw, logger, http.StatusForbidden, "", err.Error())
+
 	default:
 		errMsg := fmt.Sprintf("error occurred saving private message: %s", err)
 
@@ -105,6 +124,7 @@ func switchByErrorAndWriteResponse(err error, rw http.ResponseWriter, logger *lo
 //	@Summary		Send private message to user
 //	@Description	Send private message to user
 //	@Security		BasicAuth
+//	@Security		BearerAuth
 //	@Tags			Message
 //	@Accept			json
 //	@Produce		json
@@ -115,7 +135,7 @@ func switchByErrorAndWriteResponse(err error, rw http.ResponseWriter, logger *lo
 //	@Failure		500		{string}	internal	error
 //	@Router			/api/v1/messages/private [post]
 func (h *Handler) SendPrivateMessage(rw http.ResponseWriter, req *http.Request) {
-	id, err := handlerutils.GetIntHeaderByKey(req, "id")
+	id, err := middleware.UserIDFromContext(req.Context())
 	if err != nil {
 		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
 		return
@@ -147,6 +167,7 @@ func (h *Handler) SendPrivateMessage(rw http.ResponseWriter, req *http.Request)
 
 	if err != nil {
 		switchByErrorAndWriteResponse(err, rw, h.logger)
+		return
 	}
 
 	render.JSON(rw, req, mapper.MapPrivateMessageToResponse(message))
@@ -156,25 +177,51 @@ func (h *Handler) SendPrivateMessage(rw http.ResponseWriter, req *http.Request)
 // GetAllPrivateMessages godoc
 //
 //	@Summary		Get all private messages
-//	@Description	Get all private messages that were sent to chat
+//	@Description	Get a page of private messages that were sent to the user, in the order they were sent.
+//	@Description	Pages are asked for by the after or before cursor of the Link header, offsets are deprecated.
 //	@Security		BasicAuth
+//	@Security		BearerAuth
 //	@Tags			Message
 //	@Produce		json
-//	@Param			offset	query		int	true	"Offset"
-//	@Param			limit	query		int	true	"Limit"
+//	@Param			after	query		string	false	"cursor of the page following it"
+//	@Param			before	query		string	false	"cursor of the page preceding it"
+//	@Param			offset	query		int		false	"Offset, deprecated"
+//	@Param			limit	query		int		false	"Limit"
 //	@Success		200		{object}	[]response.PrivateMessageResponse
+//	@Header			200		{string}	Link			"URLs of the next and prev pages"
+//	@Header			200		{string}	X-Next-Cursor	"cursor of the next page"
+//	@Header			200		{string}	X-Prev-Cursor	"cursor of the prev page"
+//	@Failure		400		{string}	invalid	cursor
 //	@Failure		401		{string}	Unauthorized
 //	@Router			/api/v1/messages/private [get]
 func (h *Handler) GetAllPrivateMessages(rw http.ResponseWriter, req *http.Request) {
-	id, err := handlerutils.GetIntHeaderByKey(req, "id")
+	id, err := middleware.UserIDFromContext(req.Context())
 	if err != nil {
 		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
 		return
 	}
 
+	if handlerinternalutils.IsOffsetPagination(req) {
+		h.getPrivateMessagesByOffset(rw, req, id)
+		return
+	}
+
+	page, err := handlerinternalutils.GetPageFromQuery(req, handler.DefaultLimit)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	messages, cursors := h.MessageService.GetPrivateMessagesPage(req.Context(), id, page)
+
+	handlerinternalutils.WritePageLinks(rw, req, cursors)
+	render.JSON(rw, req, sliceutils.Map(messages, mapper.MapPrivateMessageToResponse))
+}
+
+func (h *Handler) getPrivateMessagesByOffset(rw http.ResponseWriter, req *http.Request, id int) {
 	paginationOpts := handlerinternalutils.GetPaginationOptsFromQuery(req, handler.DefaultOffset, handler.DefaultLimit)
 
-	if err = paginationOpts.Validate(h.validator); err != nil {
+	if err := paginationOpts.Validate(h.validator); err != nil {
 		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
 
 		return
@@ -189,19 +236,26 @@ func (h *Handler) GetAllPrivateMessages(rw http.ResponseWriter, req *http.Reques
 // GetAllPrivateMessagesFromUser godoc
 //
 //	@Summary		Get all private messages from user
-//	@Description	Get all private messages from user
+//	@Description	Get a page of private messages from user, in the order they were sent.
+//	@Description	Pages are asked for by the after or before cursor of the Link header, offsets are deprecated.
 //	@Security		BasicAuth
+//	@Security		BearerAuth
 //	@Tags			Message
 //	@Produce		json
-//	@Param			offset	query	int	true	"Offset"
-//	@Param			limit	query	int	true	"Limit"
-//	@Param			user_id	path	int	true	"User FromID"
-//	@Para			page query int true "page"
+//	@Param			after	query	string	false	"cursor of the page following it"
+//	@Param			before	query	string	false	"cursor of the page preceding it"
+//	@Param			offset	query	int		false	"Offset, deprecated"
+//	@Param			limit	query	int		false	"Limit"
+//	@Param			user_id	path	int		true	"User FromID"
 //	@Success		200	{object}	[]response.PrivateMessageResponse
+//	@Header			200	{string}	Link			"URLs of the next and prev pages"
+//	@Header			200	{string}	X-Next-Cursor	"cursor of the next page"
+//	@Header			200	{string}	X-Prev-Cursor	"cursor of the prev page"
+//	@Failure		400	{string}	invalid	cursor
 //	@Failure		401	{string}	Unauthorized
 //	@Router			/api/v1/messages/private/user/{user_id} [get]
 func (h *Handler) GetAllPrivateMessagesFromUser(rw http.ResponseWriter, req *http.Request) {
-	id, err := handlerutils.GetIntHeaderByKey(req, "id")
+	id, err := middleware.UserIDFromContext(req.Context())
 	if err != nil {
 		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
 		return
@@ -215,14 +269,39 @@ func (h *Handler) GetAllPrivateMessagesFromUser(rw http.ResponseWriter, req *htt
 		return
 	}
 
+	if handlerinternalutils.IsOffsetPagination(req) {
+		h.getPrivateMessagesFromUserByOffset(rw, req, id, fromID)
+		return
+	}
+
+	page, err := handlerinternalutils.GetPageFromQuery(req, handler.DefaultLimit)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	messages, cursors, err := h.MessageService.GetPrivateMessagesFromUserPage(ctx, id, fromID, page)
+	if err != nil {
+		msg := fmt.Sprintf("error occurred getting private messages from user: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, msg, msg)
+
+		return
+	}
+
+	handlerinternalutils.WritePageLinks(rw, req, cursors)
+	render.JSON(rw, req, sliceutils.Map(messages, mapper.MapPrivateMessageToResponse))
+}
+
+func (h *Handler) getPrivateMessagesFromUserByOffset(rw http.ResponseWriter, req *http.Request, id, fromID int) {
 	paginationOpts := handlerinternalutils.GetPaginationOptsFromQuery(req, handler.DefaultOffset, handler.DefaultLimit)
 
-	if err = paginationOpts.Validate(h.validator); err != nil {
+	if err := paginationOpts.Validate(h.validator); err != nil {
 		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
 		return
 	}
 
-	messages, err := h.MessageService.GetAllPrivateMessagesFromUser(ctx, id, fromID, paginationOpts.Offset, paginationOpts.Limit)
+	messages, err := h.MessageService.GetAllPrivateMessagesFromUser(req.Context(), id, fromID, paginationOpts.Offset, paginationOpts.Limit)
 	if err != nil {
 		msg := fmt.Sprintf("error occurred getting private messages from user: %v", err)
 
@@ -234,3 +313,50 @@ func (h *Handler) GetAllPrivateMessagesFromUser(rw http.ResponseWriter, req *htt
 	render.JSON(rw, req, sliceutils.Map(messages, mapper.MapPrivateMessageToResponse))
 	rw.WriteHeader(http.StatusOK)
 }
+
+// DeletePrivateMessage godoc
+//
+//	@Summary		Delete private message
+//	@Description	Delete a private message, only admins are allowed to
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Message
+//	@Param			id	path	int	true	"message id"
+//	@Success		204
+//	@Failure		400	{string}	invalid	message	id
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		404	{string}	no	such	message
+//	@Router			/api/v1/messages/private/{id} [delete]
+func (h *Handler) DeletePrivateMessage(rw http.ResponseWriter, req *http.Request) {
+	actorID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(req, "id"))
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", "invalid message id")
+		return
+	}
+
+	err = h.MessageService.DeletePrivateMessage(req.Context(), actorID, id)
+
+	switch {
+	case err == nil:
+		h.logger.Infof("private message %d deleted by user %d", id, actorID)
+
+		rw.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, policy.ErrForbidden):
+		logMsg := fmt.Sprintf("error occurred deleting private message: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusForbidden, logMsg, "forbidden")
+	case errors.Is(err, messageservice.ErrNoSuchMessage):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusNotFound, "", messageservice.ErrNoSuchMessage.Error())
+	default:
+		logMsg := fmt.Sprintf("error occurred deleting private message: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot delete message")
+	}
+}
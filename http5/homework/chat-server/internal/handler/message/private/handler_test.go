@@ -0,0 +1,83 @@
+package private
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+// userAuthenticator authenticates every request as user.
+type userAuthenticator struct {
+	user *entity.User
+}
+
+func (a userAuthenticator) Authenticate(*http.Request) (*entity.Principal, error) {
+	return &entity.Principal{UserID: a.user.ID, Username: a.user.Username, AuthMethod: entity.AuthMethodBasic}, nil
+}
+
+type fakeMessageService struct {
+	PrivateMessageService
+
+	toID int
+}
+
+func (s *fakeMessageService) GetAllPrivateMessages(_ context.Context, toID int, _, _ int) []*entity.PrivateMessage {
+	s.toID = toID
+
+	return nil
+}
+
+func (s *fakeMessageService) GetAllPrivateMessagesFromUser(_ context.Context, toID, _ int, _, _ int) ([]*entity.PrivateMessage, error) {
+	s.toID = toID
+
+	return nil, nil
+}
+
+func (s *fakeMessageService) GetPrivateMessagesPage(_ context.Context, toID int, _ entity.Page) ([]*entity.PrivateMessage, entity.PageCursors) {
+	s.toID = toID
+
+	return nil, entity.PageCursors{}
+}
+
+func (s *fakeMessageService) GetPrivateMessagesFromUserPage(
+	_ context.Context,
+	toID, _ int,
+	_ entity.Page,
+) ([]*entity.PrivateMessage, entity.PageCursors, error) {
+	s.toID = toID
+
+	return nil, entity.PageCursors{}, nil
+}
+
+func TestPrivateMessagesIgnoreClientSentID(t *testing.T) {
+	user := &entity.User{ID: 1, Username: "test"}
+
+	for _, path := range []string{"/", "/user/2", "/?offset=0", "/user/2?offset=0"} {
+		t.Run(path, func(t *testing.T) {
+			messages := &fakeMessageService{}
+
+			h := New(messages, nil, nil, userAuthenticator{user: user}, logrus.New(), validator.New())
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("id", "42")
+
+			rw := httptest.NewRecorder()
+
+			h.Routes().ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusOK {
+				t.Fatalf("expected messages, got %d: %s", rw.Code, rw.Body)
+			}
+
+			if messages.toID != user.ID {
+				t.Fatalf("expected messages to user %d, got messages to %d", user.ID, messages.toID)
+			}
+		})
+	}
+}
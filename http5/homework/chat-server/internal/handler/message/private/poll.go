@@ -0,0 +1,134 @@
+// nolint
+package private
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/mapper"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/response"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+
+	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
+	sliceutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/slice"
+)
+
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = time.Minute
+	// pollLimit is how many messages a poll returns at most, the rest are returned by the next one
+	pollLimit = 100
+)
+
+// pollParams returns the cursor and the timeout of a poll, the timeout is a duration like 30s.
+func pollParams(req *http.Request) (int, time.Duration, error) {
+	after, timeout := 0, defaultPollTimeout
+
+	if value := req.URL.Query().Get("after"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 0 {
+			return 0, 0, fmt.Errorf("invalid cursor %q", value)
+		}
+
+		after = id
+	}
+
+	if value := req.URL.Query().Get("timeout"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > maxPollTimeout {
+			return 0, 0, fmt.Errorf("invalid timeout %q, it must be positive and at most %s", value, maxPollTimeout)
+		}
+
+		timeout = d
+	}
+
+	return after, timeout, nil
+}
+
+func writePollResponse(rw http.ResponseWriter, req *http.Request, after int, messages []*entity.PrivateMessage) {
+	if len(messages) > 0 {
+		after = messages[len(messages)-1].ID
+	}
+
+	render.JSON(rw, req, response.PollPrivateMessagesResponse{
+		Messages: sliceutils.Map(messages, mapper.MapPrivateMessageToResponse),
+		After:    after,
+	})
+}
+
+// PollPrivateMessages godoc
+//
+//	@Summary		Poll private messages
+//	@Description	Get private messages sent to the user after the cursor. If there are none, the request is held
+//	@Description	until one is sent or the timeout expires, then no messages and the same cursor are returned.
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Message
+//	@Produce		json
+//	@Param			after	query		int		false	"id of the last message received"
+//	@Param			timeout	query		string	false	"how long to wait, 30s by default and 1m at most"
+//	@Success		200		{object}	response.PollPrivateMessagesResponse
+//	@Failure		400		{string}	invalid	cursor	or	timeout
+//	@Failure		401		{string}	Unauthorized
+//	@Router			/api/v1/messages/private/poll [get]
+func (h *Handler) PollPrivateMessages(rw http.ResponseWriter, req *http.Request) {
+	id, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	after, timeout, err := pollParams(req)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	ctx := req.Context()
+
+	// the subscription is made before messages are read, so that none is sent in between unnoticed
+	sub := h.Hub.Subscribe(id)
+	defer sub.Close()
+
+	messages := h.MessageService.GetPrivateMessagesAfter(ctx, id, after, pollLimit)
+	if len(messages) > 0 {
+		writePollResponse(rw, req, after, messages)
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			writePollResponse(rw, req, after, nil)
+			return
+		case event, ok := <-sub.Events():
+			// the hub is closed on shutdown or when the client is too slow, it polls again
+			if !ok {
+				writePollResponse(rw, req, after, nil)
+				return
+			}
+
+			if event.Type != hub.EventPrivateMessage {
+				continue
+			}
+
+			// messages are read again, so that the ones sent at once are returned together and in order
+			messages = h.MessageService.GetPrivateMessagesAfter(ctx, id, after, pollLimit)
+			if len(messages) > 0 {
+				writePollResponse(rw, req, after, messages)
+				return
+			}
+		}
+	}
+}
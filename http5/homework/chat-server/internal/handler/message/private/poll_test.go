@@ -0,0 +1,147 @@
+package private
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/response"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+)
+
+type storedMessageService struct {
+	PrivateMessageService
+
+	m        sync.Mutex
+	messages []*entity.PrivateMessage
+}
+
+func (s *storedMessageService) add(msg *entity.PrivateMessage) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.messages = append(s.messages, msg)
+}
+
+func (s *storedMessageService) GetPrivateMessagesAfter(_ context.Context, toID, afterID, limit int) []*entity.PrivateMessage {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var after []*entity.PrivateMessage
+
+	for _, msg := range s.messages {
+		if msg.To.ID == toID && msg.ID > afterID && len(after) < limit {
+			after = append(after, msg)
+		}
+	}
+
+	return after
+}
+
+func privateMessage(id, toID int) *entity.PrivateMessage {
+	return &entity.PrivateMessage{
+		ID:   id,
+		From: &entity.User{ID: 3, Username: "test3"},
+		To:   &entity.User{ID: toID, Username: "test"},
+	}
+}
+
+func poll(t *testing.T, h *Handler, ctx context.Context, query string) (*httptest.ResponseRecorder, response.PollPrivateMessagesResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/poll"+query, nil).WithContext(ctx)
+	rw := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(rw, req)
+
+	var resp response.PollPrivateMessagesResponse
+
+	if rw.Code == http.StatusOK && rw.Body.Len() > 0 {
+		if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("error decoding poll response: %v", err)
+		}
+	}
+
+	return rw, resp
+}
+
+func TestPollPrivateMessages(t *testing.T) {
+	user := &entity.User{ID: 1, Username: "test"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messageHub := hub.NewHub(ctx, 8, logrus.New())
+	messages := &storedMessageService{}
+	h := New(messages, nil, messageHub, userAuthenticator{user: user}, logrus.New(), validator.New())
+
+	messages.add(privateMessage(1, user.ID))
+	messages.add(privateMessage(2, 2))
+
+	t.Run("messages after cursor", func(t *testing.T) {
+		_, resp := poll(t, h, ctx, "?after=0")
+		if len(resp.Messages) != 1 || resp.After != 1 {
+			t.Fatalf("expected message 1 at once, got %+v", resp)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		rw, resp := poll(t, h, ctx, "?after=1&timeout=10ms")
+		if rw.Code != http.StatusOK || len(resp.Messages) != 0 || resp.After != 1 {
+			t.Fatalf("expected no messages and the same cursor, got %d: %s", rw.Code, rw.Body)
+		}
+	})
+
+	t.Run("held until message", func(t *testing.T) {
+		done := make(chan response.PollPrivateMessagesResponse)
+
+		go func() {
+			_, resp := poll(t, h, ctx, "?after=1&timeout=10s")
+			done <- resp
+		}()
+
+		// the poll subscribes before it reads messages, so the message is returned whenever it is added,
+		// it is most likely waiting by then
+		time.Sleep(50 * time.Millisecond)
+
+		messageHub.PublishPublicMessage(&entity.PublicMessage{ID: 1, From: user})
+
+		msg := privateMessage(3, user.ID)
+		messages.add(msg)
+		messageHub.PublishPrivateMessage(msg)
+
+		select {
+		case resp := <-done:
+			if len(resp.Messages) != 1 || resp.After != 3 {
+				t.Fatalf("expected message 3, got %+v", resp)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("poll was not answered")
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		pollCtx, pollCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer pollCancel()
+
+		rw, _ := poll(t, h, pollCtx, "?after=3&timeout=10s")
+		if rw.Body.Len() != 0 {
+			t.Fatalf("expected nothing written to canceled poll, got %s", rw.Body)
+		}
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		rw, _ := poll(t, h, ctx, "?timeout=1h")
+		if rw.Code != http.StatusBadRequest {
+			t.Fatalf("expected invalid timeout to be rejected, got %d", rw.Code)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package public
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler"
@@ -11,12 +12,16 @@ import (
 	handlerinternalutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/pkg/utils/handler"
 	"github.com/go-playground/validator/v10"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/sirupsen/logrus"
 
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+	messageservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/message"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/policy"
 
 	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
 	sliceutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/slice"
@@ -26,6 +31,13 @@ type PublicMessageService interface {
 	SendPublicMessage(ctx context.Context, fromID int, content string) (*entity.PublicMessage, error)
 	GetPublicMessage(ctx context.Context, id int) (*entity.PublicMessage, error)
 	GetAllPublicMessages(ctx context.Context, offset, limit int) []*entity.PublicMessage
+	GetPublicMessagesPage(ctx context.Context, page entity.Page) ([]*entity.PublicMessage, entity.PageCursors)
+	GetPublicMessagesAfter(ctx context.Context, afterID, limit int) []*entity.PublicMessage
+	DeletePublicMessage(ctx context.Context, actorID, id int) error
+}
+
+type Subscriber interface {
+	Subscribe(userID int) *hub.Subscription
 }
 
 type UserService interface {
@@ -35,17 +47,14 @@ type UserService interface {
 	GetUserByUsername(ctx context.Context, username string) (*entity.User, error)
 	GetAllUsers(ctx context.Context, offset, limit int) []*entity.User
 	UpdateUser(ctx context.Context, id int, updateModel entity.User) (*entity.User, error)
-	DeleteUser(ctx context.Context, id int) (*entity.User, error)
-}
-
-type AuthService interface {
-	Login(ctx context.Context, loginReq request.LoginRequest) (*entity.User, error)
+	DeleteUser(ctx context.Context, actorID, id int) (*entity.User, error)
 }
 
 type Handler struct {
 	MessageService PublicMessageService
 	UserService    UserService
-	AuthService    AuthService
+	Hub            Subscriber
+	Authenticator  middleware.Authenticator
 	logger         *logrus.Logger
 	validator      *validator.Validate
 }
@@ -53,14 +62,16 @@ type Handler struct {
 func New(
 	publicMessageService PublicMessageService,
 	userService UserService,
-	authService AuthService,
+	hub Subscriber,
+	authenticator middleware.Authenticator,
 	logger *logrus.Logger,
 	validator *validator.Validate,
 ) *Handler {
 	return &Handler{
 		MessageService: publicMessageService,
 		UserService:    userService,
-		AuthService:    authService,
+		Hub:            hub,
+		Authenticator:  authenticator,
 		logger:         logger,
 		validator:      validator,
 	}
@@ -70,10 +81,13 @@ func (h *Handler) Routes() *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware(h.AuthService, h.logger, h.validator))
+		r.Use(middleware.AuthMiddleware(h.Authenticator, h.logger))
 
 		r.Get("/", h.GetAllPublicMessages)
 		r.Post("/", h.SendPublicMessage)
+		r.Get("/stream", h.Stream)
+
+		r.With(middleware.RequirePermission(entity.PermissionDeleteMessages, h.logger)).Delete("/{id}", h.DeletePublicMessage)
 	})
 
 	return router
@@ -82,16 +96,42 @@ func (h *Handler) Routes() *chi.Mux {
 // GetAllPublicMessages godoc
 //
 //	@Summary		Get all public messages
-//	@Description	Get all public messages that were sent to chat
+//	@Description	Get a page of public messages that were sent to chat, in the order they were sent.
+//	@Description	Pages are asked for by the after or before cursor of the Link header, offsets are deprecated.
 //	@Security		BasicAuth
+//	@Security		BearerAuth
 //	@Tags			Message
 //	@Produce		json
-//	@Param			offset	query		int	true	"Offset"
-//	@Param			limit	query		int	true	"Limit"
+//	@Param			after	query		string	false	"cursor of the page following it"
+//	@Param			before	query		string	false	"cursor of the page preceding it"
+//	@Param			offset	query		int		false	"Offset, deprecated"
+//	@Param			limit	query		int		false	"Limit"
 //	@Success		200		{object}	[]response.PublicMessageResponse
+//	@Header			200		{string}	Link			"URLs of the next and prev pages"
+//	@Header			200		{string}	X-Next-Cursor	"cursor of the next page"
+//	@Header			200		{string}	X-Prev-Cursor	"cursor of the prev page"
+//	@Failure		400		{string}	invalid	cursor
 //	@Failure		401		{string}	Unauthorized
 //	@Router			/api/v1/messages/public [get]
 func (h *Handler) GetAllPublicMessages(rw http.ResponseWriter, req *http.Request) {
+	if handlerinternalutils.IsOffsetPagination(req) {
+		h.getPublicMessagesByOffset(rw, req)
+		return
+	}
+
+	page, err := handlerinternalutils.GetPageFromQuery(req, handler.DefaultLimit)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	messages, cursors := h.MessageService.GetPublicMessagesPage(req.Context(), page)
+
+	handlerinternalutils.WritePageLinks(rw, req, cursors)
+	render.JSON(rw, req, sliceutils.Map(messages, mapper.MapPublicMessageToResponse))
+}
+
+func (h *Handler) getPublicMessagesByOffset(rw http.ResponseWriter, req *http.Request) {
 	paginationOpts := handlerinternalutils.GetPaginationOptsFromQuery(req, handler.DefaultOffset, handler.DefaultLimit)
 
 	if err := paginationOpts.Validate(h.validator); err != nil {
@@ -111,6 +151,7 @@ func (h *Handler) GetAllPublicMessages(rw http.ResponseWriter, req *http.Request
 //	@Summary		Send public message to chat
 //	@Description	Send public message to chat
 //	@Security		BasicAuth
+//	@Security		BearerAuth
 //	@Tags			Message
 //	@Accept			json
 //	@Produce		json
@@ -120,7 +161,7 @@ func (h *Handler) GetAllPublicMessages(rw http.ResponseWriter, req *http.Request
 //	@Failure		500		{string}	internal	error
 //	@Router			/api/v1/messages/public [post]
 func (h *Handler) SendPublicMessage(rw http.ResponseWriter, req *http.Request) {
-	id, err := handlerutils.GetIntHeaderByKey(req, "id")
+	id, err := middleware.UserIDFromContext(req.Context())
 	if err != nil {
 		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
 		return
@@ -149,6 +190,11 @@ func (h *Handler) SendPublicMessage(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	message, err := h.MessageService.SendPublicMessage(req.Context(), pubMsgReq.FromID, pubMsgReq.Content)
+	if errors.Is(err, messageservice.ErrSenderBanned) {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusForbidden, "", err.Error())
+		return
+	}
+
 	if err != nil {
 		logMsg := fmt.Sprintf("error occurred saving public message: %s", err)
 
@@ -160,3 +206,50 @@ func (h *Handler) SendPublicMessage(rw http.ResponseWriter, req *http.Request) {
 	render.JSON(rw, req, mapper.MapPublicMessageToResponse(message))
 	rw.WriteHeader(http.StatusCreated)
 }
+
+// DeletePublicMessage godoc
+//
+//	@Summary		Delete public message
+//	@Description	Delete a public message, only admins are allowed to
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Message
+//	@Param			id	path	int	true	"message id"
+//	@Success		204
+//	@Failure		400	{string}	invalid	message	id
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		404	{string}	no	such	message
+//	@Router			/api/v1/messages/public/{id} [delete]
+func (h *Handler) DeletePublicMessage(rw http.ResponseWriter, req *http.Request) {
+	actorID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(req, "id"))
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", "invalid message id")
+		return
+	}
+
+	err = h.MessageService.DeletePublicMessage(req.Context(), actorID, id)
+
+	switch {
+	case err == nil:
+		h.logger.Infof("public message %d deleted by user %d", id, actorID)
+
+		rw.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, policy.ErrForbidden):
+		logMsg := fmt.Sprintf("error occurred deleting public message: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusForbidden, logMsg, "forbidden")
+	case errors.Is(err, messageservice.ErrNoSuchMessage):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusNotFound, "", messageservice.ErrNoSuchMessage.Error())
+	default:
+		logMsg := fmt.Sprintf("error occurred deleting public message: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot delete message")
+	}
+}
@@ -0,0 +1,57 @@
+package public
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+// userAuthenticator authenticates every request as user.
+type userAuthenticator struct {
+	user *entity.User
+}
+
+func (a userAuthenticator) Authenticate(*http.Request) (*entity.Principal, error) {
+	return &entity.Principal{UserID: a.user.ID, Username: a.user.Username, AuthMethod: entity.AuthMethodBasic}, nil
+}
+
+type fakeMessageService struct {
+	PublicMessageService
+
+	fromID int
+}
+
+func (s *fakeMessageService) SendPublicMessage(_ context.Context, fromID int, content string) (*entity.PublicMessage, error) {
+	s.fromID = fromID
+
+	return &entity.PublicMessage{From: &entity.User{ID: fromID}, Content: content}, nil
+}
+
+func TestSendPublicMessageIgnoresClientSentID(t *testing.T) {
+	messages := &fakeMessageService{}
+	user := &entity.User{ID: 1, Username: "test"}
+
+	h := New(messages, nil, nil, userAuthenticator{user: user}, logrus.New(), validator.New())
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"from_id": 42, "content": "hello"}`))
+	req.Header.Set("id", "42")
+
+	rw := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected message to be sent, got %d: %s", rw.Code, rw.Body)
+	}
+
+	if messages.fromID != user.ID {
+		t.Fatalf("expected message from user %d, got %d", user.ID, messages.fromID)
+	}
+}
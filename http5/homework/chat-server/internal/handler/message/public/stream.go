@@ -0,0 +1,177 @@
+// nolint
+package public
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/mapper"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+
+	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
+)
+
+const (
+	// streamReplayBatch is how many missed messages are read from the repository at once
+	streamReplayBatch = 100
+	// streamKeepAlive is how often idle streams get a comment, so that proxies don't close them
+	streamKeepAlive = 30 * time.Second
+	// lastEventIDQuery is read when the Last-Event-ID header can't be set by the client
+	lastEventIDQuery = "last_event_id"
+)
+
+// lastEventID returns the ID of the last message the client got, it reports false for new clients.
+func lastEventID(req *http.Request) (int, bool, error) {
+	value := req.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = req.URL.Query().Get(lastEventIDQuery)
+	}
+
+	if value == "" {
+		return 0, false, nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return 0, false, fmt.Errorf("invalid last event id %q", value)
+	}
+
+	return id, true, nil
+}
+
+func writeEvent(w io.Writer, msg *entity.PublicMessage) error {
+	data, err := json.Marshal(mapper.MapPublicMessageToResponse(msg))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, hub.EventPublicMessage, data)
+
+	return err
+}
+
+// Stream godoc
+//
+//	@Summary		Stream public messages
+//	@Description	Stream new public messages as server-sent events having the message id as event id.
+//	@Description	New clients get messages sent after they connect, clients resuming with the Last-Event-ID header
+//	@Description	or the last_event_id query get every message sent after it first.
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Message
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		int	false	"id of the last message received"
+//	@Param			last_event_id	query		int	false	"id of the last message received"
+//	@Success		200				{object}	response.GetPublicMessageResponse
+//	@Failure		400				{string}	invalid	last	event	id
+//	@Failure		401				{string}	Unauthorized
+//	@Router			/api/v1/messages/public/stream [get]
+func (h *Handler) Stream(rw http.ResponseWriter, req *http.Request) {
+	userID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	lastID, resumed, err := lastEventID(req)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	ctx := req.Context()
+	rc := http.NewResponseController(rw)
+
+	// the subscription is made before missed messages are read, so that none is sent in between unnoticed
+	sub := h.Hub.Subscribe(userID)
+	defer sub.Close()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+
+	// messages sent while missed ones were read are delivered by the hub as well, these are skipped.
+	// Messages may commit out of the order of their IDs, so the IDs of the last replayed messages are kept:
+	// a message among them is sent unless it was replayed, and an older one is taken as replayed.
+	replayed := make(map[int]bool)
+
+	var recent []int
+
+	for resumed {
+		missed := h.MessageService.GetPublicMessagesAfter(ctx, lastID, streamReplayBatch)
+
+		for _, msg := range missed {
+			if err = writeEvent(rw, msg); err != nil {
+				return
+			}
+
+			lastID = msg.ID
+			replayed[msg.ID] = true
+			recent = append(recent, msg.ID)
+
+			if len(recent) > streamReplayBatch {
+				delete(replayed, recent[0])
+				recent = recent[1:]
+			}
+		}
+
+		if len(missed) < streamReplayBatch {
+			break
+		}
+	}
+
+	if err = rc.Flush(); err != nil {
+		h.logger.Errorf("error occurred flushing stream of user %d: %v", userID, err)
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.Events():
+			// the hub is closed on shutdown or when the client is too slow, it resumes by reconnecting
+			if !ok {
+				return
+			}
+
+			if event.Type != hub.EventPublicMessage {
+				continue
+			}
+
+			id := event.PublicMessage.ID
+
+			if id <= lastID && len(recent) > 0 && id < recent[0] {
+				continue
+			}
+
+			// the hub delivers every message once, so a replayed one is skipped only once
+			if replayed[id] {
+				delete(replayed, id)
+				continue
+			}
+
+			err = writeEvent(rw, event.PublicMessage)
+		case <-ticker.C:
+			_, err = io.WriteString(rw, ": keep-alive\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package public
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+)
+
+type storedMessageService struct {
+	PublicMessageService
+
+	messages []*entity.PublicMessage
+}
+
+func (s *storedMessageService) GetPublicMessagesAfter(_ context.Context, afterID, limit int) []*entity.PublicMessage {
+	var after []*entity.PublicMessage
+
+	for _, msg := range s.messages {
+		if msg.ID > afterID && len(after) < limit {
+			after = append(after, msg)
+		}
+	}
+
+	return after
+}
+
+func publicMessage(id int, content string) *entity.PublicMessage {
+	return &entity.PublicMessage{ID: id, From: &entity.User{ID: 2, Username: "test2"}, Content: content}
+}
+
+// nextEventID reads the stream up to the end of the next event and returns its id.
+func nextEventID(t *testing.T, stream *bufio.Reader) string {
+	t.Helper()
+
+	var id string
+
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading stream: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+
+		if line == "" && id != "" {
+			return id
+		}
+
+		if value, found := strings.CutPrefix(line, "id: "); found {
+			id = value
+		}
+	}
+}
+
+func TestStreamResumesAfterLastEventID(t *testing.T) {
+	// the message having the late id is committed after the replay, behind messages having higher ids
+	const lateID = 50
+
+	messages := &storedMessageService{}
+	for id := 1; id <= streamReplayBatch+5; id++ {
+		if id != lateID {
+			messages.messages = append(messages.messages, publicMessage(id, "missed"))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messageHub := hub.NewHub(ctx, 8, logrus.New())
+	user := &entity.User{ID: 1, Username: "test"}
+
+	server := httptest.NewServer(New(messages, nil, messageHub, userAuthenticator{user: user}, logrus.New(), validator.New()).Routes())
+	defer server.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream", nil)
+	req.Header.Set("Last-Event-ID", "3")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+
+	stream := bufio.NewReader(resp.Body)
+
+	// missed messages are replayed in more than one batch
+	for id := 4; id <= streamReplayBatch+5; id++ {
+		if id == lateID {
+			continue
+		}
+
+		if got := nextEventID(t, stream); got != strconv.Itoa(id) {
+			t.Fatalf("expected missed message %d, got %s", id, got)
+		}
+	}
+
+	// a message replayed already is not sent twice when the hub delivers it,
+	// neither when it is older than the replayed messages that are remembered
+	messageHub.PublishPublicMessage(publicMessage(4, "replayed first"))
+	messageHub.PublishPublicMessage(publicMessage(streamReplayBatch+5, "replayed"))
+	messageHub.PublishPublicMessage(publicMessage(lateID, "late"))
+	messageHub.PublishPublicMessage(publicMessage(streamReplayBatch+6, "new"))
+
+	if got := nextEventID(t, stream); got != strconv.Itoa(lateID) {
+		t.Fatalf("expected late message %d, got %s", lateID, got)
+	}
+
+	if got := nextEventID(t, stream); got != strconv.Itoa(streamReplayBatch+6) {
+		t.Fatalf("expected new message %d, got %s", streamReplayBatch+6, got)
+	}
+}
+
+func TestStreamStartsNewClientsAtLiveTail(t *testing.T) {
+	messages := &storedMessageService{messages: []*entity.PublicMessage{publicMessage(1, "old"), publicMessage(2, "old")}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messageHub := hub.NewHub(ctx, 8, logrus.New())
+	user := &entity.User{ID: 1, Username: "test"}
+
+	server := httptest.NewServer(New(messages, nil, messageHub, userAuthenticator{user: user}, logrus.New(), validator.New()).Routes())
+	defer server.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream", nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	messageHub.PublishPublicMessage(publicMessage(3, "new"))
+
+	if got := nextEventID(t, bufio.NewReader(resp.Body)); got != "3" {
+		t.Fatalf("expected only the message sent after connecting, got %s", got)
+	}
+}
+
+func TestStreamRejectsInvalidLastEventID(t *testing.T) {
+	user := &entity.User{ID: 1, Username: "test"}
+	h := New(&storedMessageService{}, nil, nil, userAuthenticator{user: user}, logrus.New(), validator.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/stream?last_event_id=abc", nil)
+	rw := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid last event id to be rejected, got %d", rw.Code)
+	}
+}
@@ -2,9 +2,10 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/sirupsen/logrus"
@@ -16,47 +17,126 @@ import (
 	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
 )
 
+// ErrMalformedCredentials is returned by authenticators when a request has no credentials
+// or they can't be parsed, these requests are rejected with 400 instead of 401.
+var ErrMalformedCredentials = errors.New("malformed credentials")
+
 type Handler = func(http.Handler) http.Handler
 
+// Authenticator returns who a request is sent by.
+type Authenticator interface {
+	Authenticate(req *http.Request) (*entity.Principal, error)
+}
+
 type AuthService interface {
 	Login(ctx context.Context, loginReq request.LoginRequest) (*entity.User, error)
 }
 
-func AuthMiddleware(authService AuthService, logger *logrus.Logger, valid *validator.Validate) Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-			loginReq, err := mapper.MapBasicAuthToLoginRequest(req.BasicAuth())
-			if err != nil {
-				logMsg := fmt.Sprintf("error occurred while logging user: %v", err)
-				respMsg := fmt.Sprintf("error occurred while logging user: %v", err)
+// TokenService returns the user a token was issued to, tokens are either access tokens or session tokens.
+type TokenService interface {
+	Authenticate(ctx context.Context, token string) (*entity.User, error)
+}
 
-				handlerutils.WriteErrResponseAndLog(rw, logger, http.StatusBadRequest, logMsg, respMsg)
+type basicAuthenticator struct {
+	authService AuthService
+	valid       *validator.Validate
+}
 
-				return
-			}
+// NewBasicAuthenticator authenticates requests by the username and password of the basic auth header.
+func NewBasicAuthenticator(authService AuthService, valid *validator.Validate) Authenticator {
+	return &basicAuthenticator{authService: authService, valid: valid}
+}
 
-			if err = loginReq.Validate(valid); err != nil {
-				logMsg := fmt.Sprintf("error occurred while logging user: %v", err)
-				respMsg := fmt.Sprintf("error occurred while logging user: %v", err)
+func (a *basicAuthenticator) Authenticate(req *http.Request) (*entity.Principal, error) {
+	loginReq, err := mapper.MapBasicAuthToLoginRequest(req.BasicAuth())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedCredentials, err)
+	}
+
+	if err = loginReq.Validate(a.valid); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedCredentials, err)
+	}
+
+	loginReq.RemoteAddr = req.RemoteAddr
+
+	user, err := a.authService.Login(req.Context(), *loginReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return principalOf(user, entity.AuthMethodBasic), nil
+}
 
-				handlerutils.WriteErrResponseAndLog(rw, logger, http.StatusBadRequest, logMsg, respMsg)
+const bearerPrefix = "Bearer "
 
+type bearerAuthenticator struct {
+	tokenService TokenService
+	method       entity.AuthMethod
+}
+
+// NewBearerAuthenticator authenticates requests by the token of "Authorization: Bearer <token>" header,
+// method is what kind of tokens the service checks.
+func NewBearerAuthenticator(tokenService TokenService, method entity.AuthMethod) Authenticator {
+	return &bearerAuthenticator{tokenService: tokenService, method: method}
+}
+
+// BearerToken returns the token of "Authorization: Bearer <token>" header.
+func BearerToken(req *http.Request) (string, bool) {
+	token, found := strings.CutPrefix(req.Header.Get("Authorization"), bearerPrefix)
+	return token, found && token != ""
+}
+
+func (a *bearerAuthenticator) Authenticate(req *http.Request) (*entity.Principal, error) {
+	token, ok := BearerToken(req)
+	if !ok {
+		return nil, fmt.Errorf("%w: no bearer token provided", ErrMalformedCredentials)
+	}
+
+	user, err := a.tokenService.Authenticate(req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	return principalOf(user, a.method), nil
+}
+
+func principalOf(user *entity.User, method entity.AuthMethod) *entity.Principal {
+	principal := entity.Principal{
+		UserID:     user.ID,
+		Username:   user.Username,
+		AuthMethod: method,
+	}
+
+	if user.Role != "" {
+		principal.Roles = []entity.Role{user.Role}
+	}
+
+	return &principal
+}
+
+func AuthMiddleware(authenticator Authenticator, logger *logrus.Logger) Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			principal, err := authenticator.Authenticate(req)
+			if WriteLoginLocked(rw, logger, err) {
 				return
 			}
 
-			user, err := authService.Login(req.Context(), *loginReq)
 			if err != nil {
 				logMsg := fmt.Sprintf("error occurred while logging user: %v", err)
 				respMsg := fmt.Sprintf("error occurred while logging user: %v", err)
 
-				handlerutils.WriteErrResponseAndLog(rw, logger, http.StatusUnauthorized, logMsg, respMsg)
+				status := http.StatusUnauthorized
+				if errors.Is(err, ErrMalformedCredentials) {
+					status = http.StatusBadRequest
+				}
+
+				handlerutils.WriteErrResponseAndLog(rw, logger, status, logMsg, respMsg)
 
 				return
 			}
 
-			req.Header.Set("id", strconv.Itoa(user.ID))
-
-			next.ServeHTTP(rw, req)
+			next.ServeHTTP(rw, req.WithContext(ContextWithPrincipal(req.Context(), principal)))
 		})
 	}
 }
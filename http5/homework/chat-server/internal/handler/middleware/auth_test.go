@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service"
+)
+
+var errWrongPassword = errors.New("wrong password")
+
+type fakeAuthService struct{}
+
+func (fakeAuthService) Login(_ context.Context, loginReq request.LoginRequest) (*entity.User, error) {
+	if loginReq.Username == "locked" {
+		return nil, &service.LockedError{Kind: entity.LockoutKindUsername}
+	}
+
+	if loginReq.Username != "test" || loginReq.Password != "test" {
+		return nil, errWrongPassword
+	}
+
+	return &entity.User{ID: 1, Username: "test"}, nil
+}
+
+type fakeTokenService struct{}
+
+func (fakeTokenService) Authenticate(_ context.Context, token string) (*entity.User, error) {
+	if token != "token" {
+		return nil, errWrongPassword
+	}
+
+	return &entity.User{ID: 1, Username: "test"}, nil
+}
+
+// serve sends req through AuthMiddleware and returns the principal the next handler got, if it was called.
+func serve(t *testing.T, authenticator Authenticator, req *http.Request) (*httptest.ResponseRecorder, *entity.Principal) {
+	t.Helper()
+
+	var principal *entity.Principal
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var err error
+
+		principal, err = PrincipalFromContext(req.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	rw := httptest.NewRecorder()
+
+	AuthMiddleware(authenticator, logrus.New())(next).ServeHTTP(rw, req)
+
+	return rw, principal
+}
+
+func TestAuthMiddlewareIgnoresIDHeader(t *testing.T) {
+	authenticators := map[string]struct {
+		authenticator Authenticator
+		authorize     func(req *http.Request)
+		method        entity.AuthMethod
+	}{
+		"basic": {
+			authenticator: NewBasicAuthenticator(fakeAuthService{}, validator.New()),
+			authorize:     func(req *http.Request) { req.SetBasicAuth("test", "test") },
+			method:        entity.AuthMethodBasic,
+		},
+		"bearer": {
+			authenticator: NewBearerAuthenticator(fakeTokenService{}, entity.AuthMethodJWT),
+			authorize:     func(req *http.Request) { req.Header.Set("Authorization", "Bearer token") },
+			method:        entity.AuthMethodJWT,
+		},
+	}
+
+	for name, tc := range authenticators {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("id", "42")
+			tc.authorize(req)
+
+			rw, principal := serve(t, tc.authenticator, req)
+			if rw.Code != http.StatusOK || principal == nil {
+				t.Fatalf("expected request to be authenticated, got %d", rw.Code)
+			}
+
+			if principal.UserID != 1 || principal.Username != "test" || principal.AuthMethod != tc.method {
+				t.Fatalf("unexpected principal %+v", principal)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareRejectsRequests(t *testing.T) {
+	requests := map[string]struct {
+		authorize func(req *http.Request)
+		status    int
+	}{
+		"no credentials":        {authorize: func(*http.Request) {}, status: http.StatusBadRequest},
+		"wrong password":        {authorize: func(req *http.Request) { req.SetBasicAuth("test", "wrong") }, status: http.StatusUnauthorized},
+		"only id header":        {authorize: func(req *http.Request) { req.Header.Set("id", "1") }, status: http.StatusBadRequest},
+		"empty password":        {authorize: func(req *http.Request) { req.SetBasicAuth("test", "") }, status: http.StatusBadRequest},
+		"id header, wrong pass": {authorize: func(req *http.Request) { req.SetBasicAuth("test", "x"); req.Header.Set("id", "1") }, status: http.StatusUnauthorized},
+		"locked":                {authorize: func(req *http.Request) { req.SetBasicAuth("locked", "test") }, status: http.StatusTooManyRequests},
+	}
+
+	for name, tc := range requests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tc.authorize(req)
+
+			rw, principal := serve(t, NewBasicAuthenticator(fakeAuthService{}, validator.New()), req)
+			if rw.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, rw.Code)
+			}
+
+			if principal != nil {
+				t.Fatal("expected request not to reach the handler")
+			}
+		})
+	}
+}
+
+func TestNoPrincipalWithoutMiddleware(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("id", "1")
+
+	if _, err := UserIDFromContext(req.Context()); !errors.Is(err, ErrNoPrincipal) {
+		t.Fatalf("expected ErrNoPrincipal, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service"
+
+	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
+)
+
+// WriteLoginLocked writes 429 with the Retry-After header if the login was rejected because
+// of failed attempts, and reports whether it did.
+func WriteLoginLocked(rw http.ResponseWriter, logger *logrus.Logger, err error) bool {
+	var locked *service.LockedError
+
+	if !errors.As(err, &locked) {
+		return false
+	}
+
+	rw.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter().Seconds())))
+
+	handlerutils.WriteErrResponseAndLog(rw, logger, http.StatusTooManyRequests, "", "too many failed login attempts, try again later")
+
+	return true
+}
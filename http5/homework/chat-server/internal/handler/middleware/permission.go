@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+
+	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
+)
+
+// RequirePermission lets through requests of principals allowed the permission, it must be used after AuthMiddleware.
+// It rejects early by the roles the request is authenticated with, services check the permission again.
+func RequirePermission(permission entity.Permission, logger *logrus.Logger) Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			principal, err := PrincipalFromContext(req.Context())
+			if err != nil {
+				handlerutils.WriteErrResponseAndLog(rw, logger, http.StatusUnauthorized, "", err.Error())
+				return
+			}
+
+			if !principal.Can(permission) {
+				logMsg := fmt.Sprintf("user %d is not allowed to %s", principal.UserID, permission)
+
+				handlerutils.WriteErrResponseAndLog(rw, logger, http.StatusForbidden, logMsg, "forbidden")
+
+				return
+			}
+
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
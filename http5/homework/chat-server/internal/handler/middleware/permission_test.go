@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *entity.Principal
+		status    int
+	}{
+		{name: "no principal", status: http.StatusUnauthorized},
+		{name: "user", principal: &entity.Principal{UserID: 1, Roles: []entity.Role{entity.RoleUser}}, status: http.StatusForbidden},
+		{name: "no roles", principal: &entity.Principal{UserID: 1}, status: http.StatusForbidden},
+		{name: "admin", principal: &entity.Principal{UserID: 1, Roles: []entity.Role{entity.RoleAdmin}}, status: http.StatusOK},
+	}
+
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/1", nil)
+			if tt.principal != nil {
+				req = req.WithContext(ContextWithPrincipal(req.Context(), tt.principal))
+			}
+
+			rw := httptest.NewRecorder()
+
+			RequirePermission(entity.PermissionDeleteUsers, logrus.New())(next).ServeHTTP(rw, req)
+
+			if rw.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, rw.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+var ErrNoPrincipal = errors.New("request is not authenticated")
+
+// principalKey is the context key of the principal, being unexported it can only be set by AuthMiddleware.
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, principal *entity.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal AuthMiddleware authenticated the request as.
+func PrincipalFromContext(ctx context.Context) (*entity.Principal, error) {
+	principal, ok := ctx.Value(principalKey{}).(*entity.Principal)
+	if !ok || principal == nil {
+		return nil, ErrNoPrincipal
+	}
+
+	return principal, nil
+}
+
+// UserIDFromContext returns the ID of the user the request is authenticated as.
+func UserIDFromContext(ctx context.Context) (int, error) {
+	principal, err := PrincipalFromContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	return principal.UserID, nil
+}
@@ -0,0 +1,13 @@
+package request
+
+import "github.com/go-playground/validator/v10"
+
+type CreateRoomRequest struct {
+	Name string `json:"name" validate:"required,min=1,max=64"`
+	// Visibility is public when omitted
+	Visibility string `json:"visibility" validate:"omitempty,oneof=public invite_only"`
+}
+
+func (cr *CreateRoomRequest) Validate(valid *validator.Validate) error {
+	return valid.Struct(cr)
+}
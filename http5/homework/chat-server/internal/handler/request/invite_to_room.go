@@ -0,0 +1,11 @@
+package request
+
+import "github.com/go-playground/validator/v10"
+
+type InviteToRoomRequest struct {
+	UserID int `json:"user_id" validate:"required,min=1"`
+}
+
+func (ir *InviteToRoomRequest) Validate(valid *validator.Validate) error {
+	return valid.Struct(ir)
+}
@@ -5,6 +5,8 @@ import "github.com/go-playground/validator/v10"
 type LoginRequest struct {
 	Username string `json:"username" validate:"required,min=1"`
 	Password string `json:"password" validate:"required,min=1"`
+	// RemoteAddr is the address of the client, set by the server to limit failed logins
+	RemoteAddr string `json:"-"`
 }
 
 func (lr *LoginRequest) Validate(valid *validator.Validate) error {
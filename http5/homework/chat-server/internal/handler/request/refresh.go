@@ -0,0 +1,11 @@
+package request
+
+import "github.com/go-playground/validator/v10"
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func (rr *RefreshRequest) Validate(valid *validator.Validate) error {
+	return valid.Struct(rr)
+}
@@ -0,0 +1,13 @@
+package request
+
+import "github.com/go-playground/validator/v10"
+
+type SendRoomMessageRequest struct {
+	FromID  int    `json:"from_id" validate:"required,min=1"`
+	RoomID  int    `json:"room_id" validate:"required,min=1"`
+	Content string `json:"content" validate:"required,min=1,max=2000"`
+}
+
+func (sm *SendRoomMessageRequest) Validate(valid *validator.Validate) error {
+	return valid.Struct(sm)
+}
@@ -0,0 +1,11 @@
+package request
+
+import "github.com/go-playground/validator/v10"
+
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+func (sr *SetRoleRequest) Validate(valid *validator.Validate) error {
+	return valid.Struct(sr)
+}
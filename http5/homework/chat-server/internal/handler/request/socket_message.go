@@ -0,0 +1,14 @@
+package request
+
+import "github.com/go-playground/validator/v10"
+
+// SocketMessageRequest is a message sent over the websocket, ToID is only set for private messages.
+type SocketMessageRequest struct {
+	Type    string `json:"type" validate:"required,oneof=public_message private_message"`
+	ToID    int    `json:"to_id"`
+	Content string `json:"content"`
+}
+
+func (sm *SocketMessageRequest) Validate(valid *validator.Validate) error {
+	return valid.Struct(sm)
+}
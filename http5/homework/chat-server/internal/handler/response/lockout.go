@@ -0,0 +1,13 @@
+package response
+
+import (
+	"time"
+)
+
+type LockoutResponse struct {
+	Kind        string     `json:"kind"`
+	Subject     string     `json:"subject"`
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
@@ -0,0 +1,7 @@
+package response
+
+type PollPrivateMessagesResponse struct {
+	Messages []GetPrivateMessageResponse `json:"messages"`
+	// After is the cursor of the next poll, it is the ID of the last message or the cursor polled if none came
+	After int `json:"after"`
+}
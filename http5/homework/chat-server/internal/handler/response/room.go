@@ -0,0 +1,28 @@
+package response
+
+import "time"
+
+type RoomResponse struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Visibility    string    `json:"visibility"`
+	OwnerUsername string    `json:"owner_username"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type RoomMemberResponse struct {
+	RoomID   int       `json:"room_id"`
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Status   string    `json:"status"`
+	Since    time.Time `json:"since"`
+}
+
+type RoomMessageResponse struct {
+	ID           int       `json:"id"`
+	RoomID       int       `json:"room_id"`
+	FromUsername string    `json:"from_username"`
+	Content      string    `json:"content"`
+	SentAt       time.Time `json:"sent_at"`
+	EditedAt     time.Time `json:"edited_at"`
+}
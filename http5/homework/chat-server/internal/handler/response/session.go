@@ -0,0 +1,19 @@
+package response
+
+import (
+	"time"
+)
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type OpenSessionResponse struct {
+	Token     string          `json:"token"`
+	TokenType string          `json:"token_type"`
+	Session   SessionResponse `json:"session"`
+}
@@ -0,0 +1,9 @@
+package response
+
+// SocketEventResponse is sent over the websocket, only the field of its type is set.
+type SocketEventResponse struct {
+	Type           string                     `json:"type"`
+	PublicMessage  *GetPublicMessageResponse  `json:"public_message,omitempty"`
+	PrivateMessage *GetPrivateMessageResponse `json:"private_message,omitempty"`
+	Error          string                     `json:"error,omitempty"`
+}
@@ -0,0 +1,490 @@
+// nolint
+package room
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/mapper"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+
+	roomservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/room"
+
+	handlerinternalutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/pkg/utils/handler"
+	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
+	sliceutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/slice"
+)
+
+type RoomService interface {
+	CreateRoom(ctx context.Context, ownerID int, name string, visibility entity.RoomVisibility) (*entity.Room, error)
+	GetRooms(ctx context.Context, userID int, page entity.Page) ([]*entity.Room, entity.PageCursors)
+	GetRoom(ctx context.Context, userID, id int) (*entity.Room, error)
+	JoinRoom(ctx context.Context, userID, roomID int) (*entity.RoomMember, error)
+	LeaveRoom(ctx context.Context, userID, roomID int) error
+	InviteToRoom(ctx context.Context, actorID, roomID, userID int) (*entity.RoomMember, error)
+	GetRoomMembers(ctx context.Context, userID, roomID int, page entity.Page) ([]*entity.RoomMember, entity.PageCursors, error)
+	SendRoomMessage(ctx context.Context, fromID, roomID int, content string) (*entity.RoomMessage, error)
+	GetRoomMessages(ctx context.Context, userID, roomID int, page entity.Page) ([]*entity.RoomMessage, entity.PageCursors, error)
+}
+
+type Handler struct {
+	RoomService   RoomService
+	Authenticator middleware.Authenticator
+	logger        *logrus.Logger
+	validator     *validator.Validate
+}
+
+func New(
+	roomService RoomService,
+	authenticator middleware.Authenticator,
+	logger *logrus.Logger,
+	validator *validator.Validate,
+) *Handler {
+	return &Handler{
+		RoomService:   roomService,
+		Authenticator: authenticator,
+		logger:        logger,
+		validator:     validator,
+	}
+}
+
+func (h *Handler) Routes() *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(h.Authenticator, h.logger))
+
+		r.Get("/", h.GetRooms)
+		r.Post("/", h.CreateRoom)
+		r.Get("/{id}", h.GetRoom)
+		r.Post("/{id}/join", h.JoinRoom)
+		r.Post("/{id}/leave", h.LeaveRoom)
+		r.Post("/{id}/invites", h.InviteToRoom)
+		r.Get("/{id}/members", h.GetRoomMembers)
+		r.Get("/{id}/messages", h.GetRoomMessages)
+		r.Post("/{id}/messages", h.SendRoomMessage)
+	})
+
+	return router
+}
+
+// writeRoomError writes the response to a failed action on a room.
+func (h *Handler) writeRoomError(rw http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, roomservice.ErrNoSuchRoom), errors.Is(err, roomservice.ErrNoSuchInvitee):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusNotFound, "", err.Error())
+	case errors.Is(err, roomservice.ErrNotRoomMember), errors.Is(err, roomservice.ErrUserBanned):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusForbidden, "", err.Error())
+	case errors.Is(err, roomservice.ErrAlreadyRoomMember),
+		errors.Is(err, repository.ErrRoomMemberExists),
+		errors.Is(err, repository.ErrRoomNameExists):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusConflict, "", err.Error())
+	case errors.Is(err, roomservice.ErrUnknownVisibility), errors.Is(err, roomservice.ErrOwnerCantLeave):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+	default:
+		logMsg := fmt.Sprintf("error occurred %s: %v", action, err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot "+action)
+	}
+}
+
+// principalAndRoom returns the ID of the authenticated user and of the room in the path,
+// writing the error response if either is missing.
+func (h *Handler) principalAndRoom(rw http.ResponseWriter, req *http.Request) (int, int, bool) {
+	userID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return 0, 0, false
+	}
+
+	roomID, err := strconv.Atoi(chi.URLParam(req, "id"))
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", "invalid room id")
+		return 0, 0, false
+	}
+
+	return userID, roomID, true
+}
+
+// GetRooms godoc
+//
+//	@Summary		Get rooms
+//	@Description	Get a page of rooms ordered by ID: public rooms and invite-only rooms the user joined or is invited to.
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Produce		json
+//	@Param			after	query		string	false	"cursor of the page following it"
+//	@Param			before	query		string	false	"cursor of the page preceding it"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]response.RoomResponse
+//	@Header			200		{string}	Link			"URLs of the next and prev pages"
+//	@Header			200		{string}	X-Next-Cursor	"cursor of the next page"
+//	@Header			200		{string}	X-Prev-Cursor	"cursor of the prev page"
+//	@Failure		400		{string}	invalid	cursor
+//	@Failure		401		{string}	Unauthorized
+//	@Router			/api/v1/rooms [get]
+func (h *Handler) GetRooms(rw http.ResponseWriter, req *http.Request) {
+	userID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	page, err := handlerinternalutils.GetPageFromQuery(req, handler.DefaultLimit)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	rooms, cursors := h.RoomService.GetRooms(req.Context(), userID, page)
+
+	handlerinternalutils.WritePageLinks(rw, req, cursors)
+	render.JSON(rw, req, sliceutils.Map(rooms, mapper.MapRoomToResponse))
+}
+
+// CreateRoom godoc
+//
+//	@Summary		Create room
+//	@Description	Create a room owned by the user, the owner joins it. Rooms are public unless the visibility is invite_only.
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		request.CreateRoomRequest	true	"room schema"
+//	@Success		201		{object}	response.RoomResponse
+//	@Failure		400		{string}	invalid	room
+//	@Failure		401		{string}	Unauthorized
+//	@Failure		403		{string}	banned
+//	@Failure		409		{string}	room	name	exists
+//	@Router			/api/v1/rooms [post]
+func (h *Handler) CreateRoom(rw http.ResponseWriter, req *http.Request) {
+	ownerID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	var createReq request.CreateRoomRequest
+
+	if err = render.DecodeJSON(req.Body, &createReq); err == nil {
+		err = createReq.Validate(h.validator)
+	}
+
+	if err != nil {
+		logMsg := fmt.Sprintf("error occurred validating CreateRoomRequest struct: %s", err)
+		respMsg := fmt.Sprintf("invalid room provided: %s", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	visibility := entity.RoomPublic
+	if createReq.Visibility != "" {
+		visibility = entity.RoomVisibility(createReq.Visibility)
+	}
+
+	room, err := h.RoomService.CreateRoom(req.Context(), ownerID, createReq.Name, visibility)
+	if err != nil {
+		h.writeRoomError(rw, "create room", err)
+		return
+	}
+
+	render.Status(req, http.StatusCreated)
+	render.JSON(rw, req, mapper.MapRoomToResponse(room))
+}
+
+// GetRoom godoc
+//
+//	@Summary		Get room
+//	@Description	Get a room, invite-only rooms are found by their members and invitees only
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Produce		json
+//	@Param			id	path		int	true	"room id"
+//	@Success		200	{object}	response.RoomResponse
+//	@Failure		400	{string}	invalid	room	id
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		404	{string}	no	such	room
+//	@Router			/api/v1/rooms/{id} [get]
+func (h *Handler) GetRoom(rw http.ResponseWriter, req *http.Request) {
+	userID, roomID, ok := h.principalAndRoom(rw, req)
+	if !ok {
+		return
+	}
+
+	room, err := h.RoomService.GetRoom(req.Context(), userID, roomID)
+	if err != nil {
+		h.writeRoomError(rw, "get room", err)
+		return
+	}
+
+	render.JSON(rw, req, mapper.MapRoomToResponse(room))
+}
+
+// JoinRoom godoc
+//
+//	@Summary		Join room
+//	@Description	Join a public room or an invite-only room the user is invited to
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Produce		json
+//	@Param			id	path		int	true	"room id"
+//	@Success		200	{object}	response.RoomMemberResponse
+//	@Failure		400	{string}	invalid	room	id
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	banned
+//	@Failure		404	{string}	no	such	room
+//	@Failure		409	{string}	already	member
+//	@Router			/api/v1/rooms/{id}/join [post]
+func (h *Handler) JoinRoom(rw http.ResponseWriter, req *http.Request) {
+	userID, roomID, ok := h.principalAndRoom(rw, req)
+	if !ok {
+		return
+	}
+
+	member, err := h.RoomService.JoinRoom(req.Context(), userID, roomID)
+	if err != nil {
+		h.writeRoomError(rw, "join room", err)
+		return
+	}
+
+	render.JSON(rw, req, mapper.MapRoomMemberToResponse(member))
+}
+
+// LeaveRoom godoc
+//
+//	@Summary		Leave room
+//	@Description	Leave a room or decline the invite to it, the owner can't leave the room
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Param			id	path	int	true	"room id"
+//	@Success		204
+//	@Failure		400	{string}	owner	can't	leave
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	not	a	member
+//	@Failure		404	{string}	no	such	room
+//	@Router			/api/v1/rooms/{id}/leave [post]
+func (h *Handler) LeaveRoom(rw http.ResponseWriter, req *http.Request) {
+	userID, roomID, ok := h.principalAndRoom(rw, req)
+	if !ok {
+		return
+	}
+
+	if err := h.RoomService.LeaveRoom(req.Context(), userID, roomID); err != nil {
+		h.writeRoomError(rw, "leave room", err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// InviteToRoom godoc
+//
+//	@Summary		Invite to room
+//	@Description	Invite a user to a room the inviting user joined, the invitee joins the room later
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int							true	"room id"
+//	@Param			input	body		request.InviteToRoomRequest	true	"invitee schema"
+//	@Success		201		{object}	response.RoomMemberResponse
+//	@Failure		400		{string}	invalid	invitee
+//	@Failure		401		{string}	Unauthorized
+//	@Failure		403		{string}	not		a	member
+//	@Failure		404		{string}	no		such	room	or	user
+//	@Failure		409		{string}	already	member
+//	@Router			/api/v1/rooms/{id}/invites [post]
+func (h *Handler) InviteToRoom(rw http.ResponseWriter, req *http.Request) {
+	actorID, roomID, ok := h.principalAndRoom(rw, req)
+	if !ok {
+		return
+	}
+
+	var inviteReq request.InviteToRoomRequest
+
+	err := render.DecodeJSON(req.Body, &inviteReq)
+	if err == nil {
+		err = inviteReq.Validate(h.validator)
+	}
+
+	if err != nil {
+		logMsg := fmt.Sprintf("error occurred validating InviteToRoomRequest struct: %s", err)
+		respMsg := fmt.Sprintf("invalid invitee provided: %s", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	member, err := h.RoomService.InviteToRoom(req.Context(), actorID, roomID, inviteReq.UserID)
+	if err != nil {
+		h.writeRoomError(rw, "invite to room", err)
+		return
+	}
+
+	render.Status(req, http.StatusCreated)
+	render.JSON(rw, req, mapper.MapRoomMemberToResponse(member))
+}
+
+// GetRoomMembers godoc
+//
+//	@Summary		Get room members
+//	@Description	Get a page of users who joined the room, ordered by ID
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Produce		json
+//	@Param			id		path		int		true	"room id"
+//	@Param			after	query		string	false	"cursor of the page following it"
+//	@Param			before	query		string	false	"cursor of the page preceding it"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]response.RoomMemberResponse
+//	@Header			200		{string}	Link			"URLs of the next and prev pages"
+//	@Header			200		{string}	X-Next-Cursor	"cursor of the next page"
+//	@Header			200		{string}	X-Prev-Cursor	"cursor of the prev page"
+//	@Failure		400		{string}	invalid	cursor
+//	@Failure		401		{string}	Unauthorized
+//	@Failure		403		{string}	not	a	member
+//	@Failure		404		{string}	no	such	room
+//	@Router			/api/v1/rooms/{id}/members [get]
+func (h *Handler) GetRoomMembers(rw http.ResponseWriter, req *http.Request) {
+	userID, roomID, ok := h.principalAndRoom(rw, req)
+	if !ok {
+		return
+	}
+
+	page, err := handlerinternalutils.GetPageFromQuery(req, handler.DefaultLimit)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	members, cursors, err := h.RoomService.GetRoomMembers(req.Context(), userID, roomID, page)
+	if err != nil {
+		h.writeRoomError(rw, "get room members", err)
+		return
+	}
+
+	handlerinternalutils.WritePageLinks(rw, req, cursors)
+	render.JSON(rw, req, sliceutils.Map(members, mapper.MapRoomMemberToResponse))
+}
+
+// GetRoomMessages godoc
+//
+//	@Summary		Get room messages
+//	@Description	Get a page of messages of the room, in the order they were sent.
+//	@Description	Messages of invite-only rooms are read by their members only.
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Produce		json
+//	@Param			id		path		int		true	"room id"
+//	@Param			after	query		string	false	"cursor of the page following it"
+//	@Param			before	query		string	false	"cursor of the page preceding it"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]response.RoomMessageResponse
+//	@Header			200		{string}	Link			"URLs of the next and prev pages"
+//	@Header			200		{string}	X-Next-Cursor	"cursor of the next page"
+//	@Header			200		{string}	X-Prev-Cursor	"cursor of the prev page"
+//	@Failure		400		{string}	invalid	cursor
+//	@Failure		401		{string}	Unauthorized
+//	@Failure		403		{string}	not	a	member
+//	@Failure		404		{string}	no	such	room
+//	@Router			/api/v1/rooms/{id}/messages [get]
+func (h *Handler) GetRoomMessages(rw http.ResponseWriter, req *http.Request) {
+	userID, roomID, ok := h.principalAndRoom(rw, req)
+	if !ok {
+		return
+	}
+
+	page, err := handlerinternalutils.GetPageFromQuery(req, handler.DefaultLimit)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	messages, cursors, err := h.RoomService.GetRoomMessages(req.Context(), userID, roomID, page)
+	if err != nil {
+		h.writeRoomError(rw, "get room messages", err)
+		return
+	}
+
+	handlerinternalutils.WritePageLinks(rw, req, cursors)
+	render.JSON(rw, req, sliceutils.Map(messages, mapper.MapRoomMessageToResponse))
+}
+
+// SendRoomMessage godoc
+//
+//	@Summary		Send room message
+//	@Description	Send a message to a room the user joined
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Room
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int								true	"room id"
+//	@Param			input	body		request.SendRoomMessageRequest	true	"room message schema"
+//	@Success		201		{object}	response.RoomMessageResponse
+//	@Failure		400		{string}	invalid	message
+//	@Failure		401		{string}	Unauthorized
+//	@Failure		403		{string}	not	a	member
+//	@Failure		404		{string}	no	such	room
+//	@Router			/api/v1/rooms/{id}/messages [post]
+func (h *Handler) SendRoomMessage(rw http.ResponseWriter, req *http.Request) {
+	fromID, roomID, ok := h.principalAndRoom(rw, req)
+	if !ok {
+		return
+	}
+
+	var msgReq request.SendRoomMessageRequest
+
+	if err := render.DecodeJSON(req.Body, &msgReq); err != nil {
+		logMsg := fmt.Sprintf("error occurred validating SendRoomMessageRequest struct: %s", err)
+		respMsg := fmt.Sprintf("invalid message provided: %s", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	msgReq.FromID = fromID
+	msgReq.RoomID = roomID
+
+	if err := msgReq.Validate(h.validator); err != nil {
+		logMsg := fmt.Sprintf("error occurred validating SendRoomMessageRequest struct: %s", err)
+		respMsg := fmt.Sprintf("invalid message provided: %s", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	msg, err := h.RoomService.SendRoomMessage(req.Context(), msgReq.FromID, msgReq.RoomID, msgReq.Content)
+	if err != nil {
+		h.writeRoomError(rw, "send room message", err)
+		return
+	}
+
+	render.Status(req, http.StatusCreated)
+	render.JSON(rw, req, mapper.MapRoomMessageToResponse(msg))
+}
@@ -0,0 +1,107 @@
+package room
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+
+	roomservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/room"
+)
+
+// userAuthenticator authenticates every request as user.
+type userAuthenticator struct {
+	user *entity.User
+}
+
+func (a userAuthenticator) Authenticate(*http.Request) (*entity.Principal, error) {
+	return &entity.Principal{UserID: a.user.ID, Username: a.user.Username, AuthMethod: entity.AuthMethodBasic}, nil
+}
+
+type fakeRoomService struct {
+	RoomService
+
+	ownerID    int
+	visibility entity.RoomVisibility
+	err        error
+}
+
+func (s *fakeRoomService) CreateRoom(
+	_ context.Context,
+	ownerID int,
+	name string,
+	visibility entity.RoomVisibility,
+) (*entity.Room, error) {
+	s.ownerID = ownerID
+	s.visibility = visibility
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return &entity.Room{ID: 1, Name: name, Visibility: visibility, Owner: &entity.User{ID: ownerID}}, nil
+}
+
+func (s *fakeRoomService) GetRoom(context.Context, int, int) (*entity.Room, error) {
+	return nil, s.err
+}
+
+func serve(h *Handler, method, target, body string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(rw, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	return rw
+}
+
+func TestCreateRoomDefaultsToPublic(t *testing.T) {
+	rooms := &fakeRoomService{}
+	user := &entity.User{ID: 7, Username: "test"}
+
+	h := New(rooms, userAuthenticator{user: user}, logrus.New(), validator.New())
+
+	rw := serve(h, http.MethodPost, "/", `{"name": "lobby"}`)
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("expected room to be created, got %d: %s", rw.Code, rw.Body)
+	}
+
+	if rooms.ownerID != user.ID || rooms.visibility != entity.RoomPublic {
+		t.Fatalf("expected public room of user %d, got %s room of %d", user.ID, rooms.visibility, rooms.ownerID)
+	}
+
+	if rw := serve(h, http.MethodPost, "/", `{"name": "lobby", "visibility": "hidden"}`); rw.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown visibility to be rejected, got %d", rw.Code)
+	}
+}
+
+func TestRoomErrorStatuses(t *testing.T) {
+	user := &entity.User{ID: 7, Username: "test"}
+
+	cases := []struct {
+		err      error
+		method   string
+		target   string
+		body     string
+		expected int
+	}{
+		{err: repository.ErrRoomNameExists, method: http.MethodPost, target: "/", body: `{"name": "lobby"}`, expected: http.StatusConflict},
+		{err: roomservice.ErrUserBanned, method: http.MethodPost, target: "/", body: `{"name": "lobby"}`, expected: http.StatusForbidden},
+		{err: roomservice.ErrNoSuchRoom, method: http.MethodGet, target: "/1", expected: http.StatusNotFound},
+		{method: http.MethodGet, target: "/room", expected: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		h := New(&fakeRoomService{err: c.err}, userAuthenticator{user: user}, logrus.New(), validator.New())
+
+		if rw := serve(h, c.method, c.target, c.body); rw.Code != c.expected {
+			t.Fatalf("expected %d for %s %s failing with %v, got %d: %s", c.expected, c.method, c.target, c.err, rw.Code, rw.Body)
+		}
+	}
+}
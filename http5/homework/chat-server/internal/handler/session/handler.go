@@ -0,0 +1,230 @@
+// nolint
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/mapper"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service"
+
+	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
+	sliceutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/slice"
+)
+
+type SessionService interface {
+	OpenSession(ctx context.Context, loginReq request.LoginRequest, userAgent, remoteAddr string) (string, *entity.Session, error)
+	Sessions(ctx context.Context, userID int) []*entity.Session
+	Logout(ctx context.Context, token string) error
+	CloseSession(ctx context.Context, userID int, id string) error
+	LogoutEverywhere(ctx context.Context, userID int) (int, error)
+}
+
+type Handler struct {
+	SessionService SessionService
+	Authenticator  middleware.Authenticator
+	logger         *logrus.Logger
+	validator      *validator.Validate
+}
+
+func New(
+	sessionService SessionService,
+	authenticator middleware.Authenticator,
+	logger *logrus.Logger,
+	validator *validator.Validate,
+) *Handler {
+	return &Handler{
+		SessionService: sessionService,
+		Authenticator:  authenticator,
+		logger:         logger,
+		validator:      validator,
+	}
+}
+
+func (h *Handler) Routes() *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Group(func(r chi.Router) {
+		r.Post("/", h.Open)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(h.Authenticator, h.logger))
+
+		r.Get("/", h.GetAll)
+		r.Delete("/", h.LogoutEverywhere)
+		r.Delete("/current", h.Logout)
+		r.Delete("/{id}", h.Close)
+	})
+
+	return router
+}
+
+// Open godoc
+//
+//	@Summary		Open session
+//	@Description	Log in and get the token of a new session, requests are authenticated with it until it expires or is closed
+//	@Tags			Session
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		request.LoginRequest	true	"credentials"
+//	@Success		201		{object}	response.OpenSessionResponse
+//	@Failure		400		{string}	invalid	login	data	provided
+//	@Failure		401		{string}	Unauthorized
+//	@Failure		429		{string}	too	many	failed	login	attempts
+//	@Router			/api/v1/sessions [post]
+func (h *Handler) Open(rw http.ResponseWriter, req *http.Request) {
+	var loginReq request.LoginRequest
+
+	if err := render.DecodeJSON(req.Body, &loginReq); err != nil {
+		logMsg := fmt.Sprintf("error occurred decoding request body to LoginRequest struct: %v", err)
+		respMsg := fmt.Sprintf("invalid login data provided: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	if err := loginReq.Validate(h.validator); err != nil {
+		logMsg := fmt.Sprintf("error occurred validating LoginRequest struct: %v", err)
+		respMsg := fmt.Sprintf("invalid login data provided: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	token, session, err := h.SessionService.OpenSession(req.Context(), loginReq, req.UserAgent(), req.RemoteAddr)
+	if middleware.WriteLoginLocked(rw, h.logger, err) {
+		return
+	}
+
+	if err != nil {
+		logMsg := fmt.Sprintf("error occurred opening session: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, logMsg, "invalid username or password")
+
+		return
+	}
+
+	render.Status(req, http.StatusCreated)
+	render.JSON(rw, req, mapper.MapOpenedSessionToResponse(token, session))
+}
+
+// GetAll godoc
+//
+//	@Summary		Get sessions
+//	@Description	Get open sessions of current user
+//	@Security		BearerAuth
+//	@Tags			Session
+//	@Produce		json
+//	@Success		200	{object}	[]response.SessionResponse
+//	@Failure		401	{string}	Unauthorized
+//	@Router			/api/v1/sessions [get]
+func (h *Handler) GetAll(rw http.ResponseWriter, req *http.Request) {
+	id, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	sessions := h.SessionService.Sessions(req.Context(), id)
+
+	render.JSON(rw, req, sliceutils.Map(sessions, mapper.MapSessionToResponse))
+}
+
+// Logout godoc
+//
+//	@Summary		Log out
+//	@Description	Close the session the request is authenticated with
+//	@Security		BearerAuth
+//	@Tags			Session
+//	@Success		204
+//	@Failure		401	{string}	Unauthorized
+//	@Router			/api/v1/sessions/current [delete]
+func (h *Handler) Logout(rw http.ResponseWriter, req *http.Request) {
+	token, _ := middleware.BearerToken(req)
+
+	if err := h.SessionService.Logout(req.Context(), token); err != nil {
+		logMsg := fmt.Sprintf("error occurred closing session: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, logMsg, "session is already closed")
+
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutEverywhere godoc
+//
+//	@Summary		Log out everywhere
+//	@Description	Close all sessions of current user, including the one the request is authenticated with
+//	@Security		BearerAuth
+//	@Tags			Session
+//	@Success		204
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		500	{string}	internal	error
+//	@Router			/api/v1/sessions [delete]
+func (h *Handler) LogoutEverywhere(rw http.ResponseWriter, req *http.Request) {
+	id, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	closed, err := h.SessionService.LogoutEverywhere(req.Context(), id)
+	if err != nil {
+		logMsg := fmt.Sprintf("error occurred closing sessions of user %d: %v", id, err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot close sessions")
+
+		return
+	}
+
+	h.logger.Infof("%d sessions of user %d closed", closed, id)
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// Close godoc
+//
+//	@Summary		Close session
+//	@Description	Close a session of current user by its id
+//	@Security		BearerAuth
+//	@Tags			Session
+//	@Param			id	path	string	true	"session id"
+//	@Success		204
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		404	{string}	no	such	session
+//	@Router			/api/v1/sessions/{id} [delete]
+func (h *Handler) Close(rw http.ResponseWriter, req *http.Request) {
+	id, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	err = h.SessionService.CloseSession(req.Context(), id, chi.URLParam(req, "id"))
+
+	switch {
+	case err == nil:
+		rw.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, service.ErrNoSuchSession):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusNotFound, "", service.ErrNoSuchSession.Error())
+	default:
+		logMsg := fmt.Sprintf("error occurred closing session: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "cannot close session")
+	}
+}
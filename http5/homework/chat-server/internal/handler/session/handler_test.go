@@ -0,0 +1,75 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+// userAuthenticator authenticates every request as user.
+type userAuthenticator struct {
+	user *entity.User
+}
+
+func (a userAuthenticator) Authenticate(*http.Request) (*entity.Principal, error) {
+	return &entity.Principal{UserID: a.user.ID, Username: a.user.Username, AuthMethod: entity.AuthMethodSession}, nil
+}
+
+type fakeSessionService struct {
+	SessionService
+
+	userID int
+}
+
+func (s *fakeSessionService) Sessions(_ context.Context, userID int) []*entity.Session {
+	s.userID = userID
+
+	return nil
+}
+
+func (s *fakeSessionService) LogoutEverywhere(_ context.Context, userID int) (int, error) {
+	s.userID = userID
+
+	return 0, nil
+}
+
+func TestSessionsIgnoreClientSentID(t *testing.T) {
+	user := &entity.User{ID: 1, Username: "test"}
+
+	requests := map[string]struct {
+		method string
+		status int
+	}{
+		"list":       {method: http.MethodGet, status: http.StatusOK},
+		"logout all": {method: http.MethodDelete, status: http.StatusNoContent},
+	}
+
+	for name, tc := range requests {
+		t.Run(name, func(t *testing.T) {
+			sessions := &fakeSessionService{}
+
+			h := New(sessions, userAuthenticator{user: user}, logrus.New(), validator.New())
+
+			req := httptest.NewRequest(tc.method, "/", nil)
+			req.Header.Set("id", "42")
+
+			rw := httptest.NewRecorder()
+
+			h.Routes().ServeHTTP(rw, req)
+
+			if rw.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rw.Code, rw.Body)
+			}
+
+			if sessions.userID != user.ID {
+				t.Fatalf("expected sessions of user %d, got sessions of %d", user.ID, sessions.userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/mapper"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+
+	messageservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/message"
+)
+
+var errCannotSend = errors.New("cannot send message")
+
+// connection is a websocket of a user. The write loop is the only writer of the socket:
+// it writes events of the subscription, replies of the read loop and pings.
+type connection struct {
+	conn    *websocket.Conn
+	sub     *hub.Subscription
+	handler *Handler
+
+	replies    chan any
+	writerDone chan struct{}
+	readerDone chan struct{}
+}
+
+func (c *connection) write(v any) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+
+	return c.conn.WriteJSON(v)
+}
+
+// writeLoop writes until the client goes away, the read loop ends or the subscription is closed,
+// which happens when the server shuts down or the client doesn't keep up with events.
+func (c *connection) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		close(c.writerDone)
+	}()
+
+	for {
+		var err error
+
+		select {
+		case event, ok := <-c.sub.Events():
+			if !ok {
+				msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "subscription closed")
+				_ = c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+
+				return
+			}
+
+			err = c.write(mapper.MapEventToSocketResponse(event))
+		case reply := <-c.replies:
+			err = c.write(reply)
+		case <-ticker.C:
+			err = c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		case <-c.readerDone:
+			return
+		}
+
+		if err != nil {
+			c.handler.logger.Infof("error occurred writing websocket of user %d: %v", c.sub.UserID, err)
+			return
+		}
+	}
+}
+
+// readLoop reads messages sent by the client until the socket is closed.
+func (c *connection) readLoop(ctx context.Context) {
+	defer func() {
+		c.sub.Close()
+		close(c.readerDone)
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				c.handler.logger.Infof("error occurred reading websocket of user %d: %v", c.sub.UserID, err)
+			}
+
+			return
+		}
+
+		reply := c.send(ctx, data)
+		if reply == nil {
+			continue
+		}
+
+		select {
+		case c.replies <- reply:
+		case <-c.writerDone:
+			return
+		}
+	}
+}
+
+// send sends the message read from the socket and returns the reply to it, if there is one.
+// Public messages are not replied to, since they reach the sender as events like any other.
+func (c *connection) send(ctx context.Context, data []byte) any {
+	var msgReq request.SocketMessageRequest
+
+	if err := json.Unmarshal(data, &msgReq); err != nil {
+		return mapper.MapErrorToSocketResponse(err)
+	}
+
+	if err := msgReq.Validate(c.handler.validator); err != nil {
+		return mapper.MapErrorToSocketResponse(err)
+	}
+
+	switch hub.EventType(msgReq.Type) {
+	case hub.EventPublicMessage:
+		pubMsgReq := request.SendPublicMessageRequest{FromID: c.sub.UserID, Content: msgReq.Content}
+
+		if err := pubMsgReq.Validate(c.handler.validator); err != nil {
+			return mapper.MapErrorToSocketResponse(err)
+		}
+
+		if _, err := c.handler.MessageService.SendPublicMessage(ctx, pubMsgReq.FromID, pubMsgReq.Content); err != nil {
+			return c.sendError(err)
+		}
+
+		return nil
+	default:
+		privMsgReq := request.SendPrivateMessageRequest{FromID: c.sub.UserID, ToID: msgReq.ToID, Content: msgReq.Content}
+
+		if err := privMsgReq.Validate(c.handler.validator); err != nil {
+			return mapper.MapErrorToSocketResponse(err)
+		}
+
+		msg, err := c.handler.MessageService.SendPrivateMessage(ctx, privMsgReq.FromID, privMsgReq.ToID, privMsgReq.Content)
+		if err != nil {
+			return c.sendError(err)
+		}
+
+		// the sender gets the message it sent, as the event only reaches the receiver
+		return mapper.MapPrivateMessageToSocketResponse(msg)
+	}
+}
+
+// sendError keeps errors the client can't act on out of the reply.
+func (c *connection) sendError(err error) any {
+	if errors.Is(err, messageservice.ErrNoSuchReceiver) || errors.Is(err, messageservice.ErrSenderBanned) {
+		return mapper.MapErrorToSocketResponse(err)
+	}
+
+	c.handler.logger.Errorf("error occurred sending message of user %d over websocket: %v", c.sub.UserID, err)
+
+	return mapper.MapErrorToSocketResponse(errCannotSend)
+}
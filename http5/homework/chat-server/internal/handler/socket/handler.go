@@ -0,0 +1,121 @@
+// nolint
+package socket
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+
+	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
+)
+
+const (
+	// writeWait is how long a write may take before the client is considered gone
+	writeWait = 10 * time.Second
+	// pongWait is how long the client may stay silent, it has to answer pings sent every pingPeriod
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize fits a message of the longest content allowed
+	maxMessageSize = 16 << 10
+	// replyBufferSize is how many replies to the messages of a client wait to be written
+	replyBufferSize = 16
+)
+
+type Subscriber interface {
+	Subscribe(userID int) *hub.Subscription
+}
+
+type MessageService interface {
+	SendPublicMessage(ctx context.Context, fromID int, content string) (*entity.PublicMessage, error)
+	SendPrivateMessage(ctx context.Context, fromID, toID int, content string) (*entity.PrivateMessage, error)
+}
+
+type Handler struct {
+	Hub            Subscriber
+	MessageService MessageService
+	Authenticator  middleware.Authenticator
+	logger         *logrus.Logger
+	validator      *validator.Validate
+	upgrader       websocket.Upgrader
+}
+
+func New(
+	hub Subscriber,
+	messageService MessageService,
+	authenticator middleware.Authenticator,
+	logger *logrus.Logger,
+	validator *validator.Validate,
+) *Handler {
+	return &Handler{
+		Hub:            hub,
+		MessageService: messageService,
+		Authenticator:  authenticator,
+		logger:         logger,
+		validator:      validator,
+	}
+}
+
+func (h *Handler) Routes() *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(h.Authenticator, h.logger))
+
+		r.Get("/", h.Connect)
+	})
+
+	return router
+}
+
+// Connect godoc
+//
+//	@Summary		Connect to the chat
+//	@Description	Upgrade to a websocket receiving new public messages and private messages sent to current user as {"type", "public_message" or "private_message"} events.
+//	@Description	Messages are sent over it as {"type": "public_message", "content"} or {"type": "private_message", "to_id", "content"}, failed sends are answered with {"type": "error", "error"}.
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			Message
+//	@Success		101
+//	@Failure		400	{string}	not	a	websocket	handshake
+//	@Failure		401	{string}	Unauthorized
+//	@Router			/api/v1/ws [get]
+func (h *Handler) Connect(rw http.ResponseWriter, req *http.Request) {
+	userID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	// the upgrader writes the error response of failed handshakes itself
+	conn, err := h.upgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		h.logger.Errorf("error occurred upgrading connection of user %d: %v", userID, err)
+		return
+	}
+
+	c := &connection{
+		conn:       conn,
+		sub:        h.Hub.Subscribe(userID),
+		handler:    h,
+		replies:    make(chan any, replyBufferSize),
+		writerDone: make(chan struct{}),
+		readerDone: make(chan struct{}),
+	}
+
+	h.logger.Infof("user %d connected over websocket from %s", userID, req.RemoteAddr)
+
+	go c.writeLoop()
+
+	c.readLoop(req.Context())
+
+	h.logger.Infof("websocket of user %d closed", userID)
+}
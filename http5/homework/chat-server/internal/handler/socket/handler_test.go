@@ -0,0 +1,184 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/response"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/hub"
+)
+
+var users = map[string]*entity.User{
+	"alice": {ID: 1, Username: "alice"},
+	"bob":   {ID: 2, Username: "bob"},
+}
+
+var errUnknownUser = errors.New("unknown user")
+
+// usernameAuthenticator authenticates requests as the user of the basic auth username.
+type usernameAuthenticator struct{}
+
+func (usernameAuthenticator) Authenticate(req *http.Request) (*entity.Principal, error) {
+	username, _, _ := req.BasicAuth()
+
+	user, ok := users[username]
+	if !ok {
+		return nil, errUnknownUser
+	}
+
+	return &entity.Principal{UserID: user.ID, Username: user.Username, AuthMethod: entity.AuthMethodBasic}, nil
+}
+
+// hubMessageService publishes sent messages to the hub the way MessageService does.
+type hubMessageService struct {
+	hub *hub.Hub
+}
+
+func (s hubMessageService) SendPublicMessage(_ context.Context, fromID int, content string) (*entity.PublicMessage, error) {
+	msg := &entity.PublicMessage{From: &entity.User{ID: fromID, Username: "sender"}, Content: content}
+	s.hub.PublishPublicMessage(msg)
+
+	return msg, nil
+}
+
+func (s hubMessageService) SendPrivateMessage(_ context.Context, fromID, toID int, content string) (*entity.PrivateMessage, error) {
+	to, ok := map[int]*entity.User{1: users["alice"], 2: users["bob"]}[toID]
+	if !ok {
+		return nil, errUnknownUser
+	}
+
+	msg := &entity.PrivateMessage{From: &entity.User{ID: fromID, Username: "sender"}, To: to, Content: content}
+	s.hub.PublishPrivateMessage(msg)
+
+	return msg, nil
+}
+
+func initServer(t *testing.T) (*httptest.Server, context.CancelFunc) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h := hub.NewHub(ctx, 8, logrus.New())
+	server := httptest.NewServer(New(h, hubMessageService{hub: h}, usernameAuthenticator{}, logrus.New(), validator.New()).Routes())
+
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+
+	return server, cancel
+}
+
+func dial(t *testing.T, server *httptest.Server, username string) *websocket.Conn {
+	t.Helper()
+
+	header := http.Header{}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.SetBasicAuth(username, "password")
+	header.Set("Authorization", req.Header.Get("Authorization"))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func read(t *testing.T, conn *websocket.Conn) response.SocketEventResponse {
+	t.Helper()
+
+	var event response.SocketEventResponse
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	return event
+}
+
+func TestSocketDeliversMessages(t *testing.T) {
+	server, _ := initServer(t)
+
+	alice, bob := dial(t, server, "alice"), dial(t, server, "bob")
+
+	if err := alice.WriteJSON(map[string]any{"type": "public_message", "content": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		if event := read(t, conn); event.Type != "public_message" || event.PublicMessage.Content != "hello" {
+			t.Fatalf("expected public message, got %+v", event)
+		}
+	}
+
+	if err := alice.WriteJSON(map[string]any{"type": "private_message", "to_id": 2, "content": "hi bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sender gets its message as the reply, the receiver as an event
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		if event := read(t, conn); event.Type != "private_message" || event.PrivateMessage.ToUsername != "bob" {
+			t.Fatalf("expected private message to bob, got %+v", event)
+		}
+	}
+}
+
+func TestSocketRepliesWithErrors(t *testing.T) {
+	server, _ := initServer(t)
+
+	alice := dial(t, server, "alice")
+
+	for _, msg := range []string{`not json`, `{"type": "unknown"}`, `{"type": "public_message"}`, `{"type": "private_message", "content": "x"}`} {
+		if err := alice.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+
+		if event := read(t, alice); event.Type != "error" || event.Error == "" {
+			t.Fatalf("expected error for %s, got %+v", msg, event)
+		}
+	}
+}
+
+func TestSocketNeedsAuthentication(t *testing.T) {
+	server, _ := initServer(t)
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", nil)
+	if err == nil {
+		t.Fatal("expected handshake without credentials to fail")
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+}
+
+func TestSocketIsClosedOnShutdown(t *testing.T) {
+	server, cancel := initServer(t)
+
+	alice := dial(t, server, "alice")
+
+	cancel()
+
+	_ = alice.SetReadDeadline(time.Now().Add(time.Second))
+
+	_, _, err := alice.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expected going away close, got %v", err)
+	}
+}
@@ -3,9 +3,11 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
@@ -16,6 +18,9 @@ import (
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/mapper"
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/middleware"
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/policy"
+	userservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/user"
 
 	handlerinternalutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/pkg/utils/handler"
 	handlerutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/handler"
@@ -28,8 +33,11 @@ type UserService interface {
 	GetUserByEmail(ctx context.Context, email string) (*entity.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*entity.User, error)
 	GetAllUsers(ctx context.Context, offset, limit int) []*entity.User
+	GetUsersPage(ctx context.Context, page entity.Page) ([]*entity.User, entity.PageCursors)
 	UpdateUser(ctx context.Context, id int, updateModel entity.User) (*entity.User, error)
-	DeleteUser(ctx context.Context, id int) (*entity.User, error)
+	DeleteUser(ctx context.Context, actorID, id int) (*entity.User, error)
+	BanUser(ctx context.Context, actorID, id int, banned bool) (*entity.User, error)
+	SetUserRole(ctx context.Context, actorID, id int, role entity.Role) (*entity.User, error)
 }
 
 type MessageService interface {
@@ -37,28 +45,33 @@ type MessageService interface {
 	GetAllUsersThatSentMessage(ctx context.Context, toID int, offset, limit int) []*entity.User
 }
 
-type AuthService interface {
-	Login(ctx context.Context, loginReq request.LoginRequest) (*entity.User, error)
+// TokenService issues tokens, it's nil when tokens are not used for authentication.
+type TokenService interface {
+	IssueTokens(ctx context.Context, loginReq request.LoginRequest) (*entity.TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshToken string) (*entity.TokenPair, error)
 }
 
 type Handler struct {
 	UserService    UserService
 	MessageService MessageService
-	AuthService    AuthService
+	Authenticator  middleware.Authenticator
+	TokenService   TokenService
 	logger         *logrus.Logger
 	validator      *validator.Validate
 }
 
 func New(userService UserService,
 	messageService MessageService,
-	authService AuthService,
+	authenticator middleware.Authenticator,
+	tokenService TokenService,
 	logger *logrus.Logger,
 	validator *validator.Validate,
 ) *Handler {
 	return &Handler{
 		UserService:    userService,
 		MessageService: messageService,
-		AuthService:    authService,
+		Authenticator:  authenticator,
+		TokenService:   tokenService,
 		logger:         logger,
 		validator:      validator,
 	}
@@ -69,12 +82,22 @@ func (h *Handler) Routes() *chi.Mux {
 
 	router.Group(func(r chi.Router) {
 		r.Post("/register", h.Register)
+
+		if h.TokenService != nil {
+			r.Post("/login", h.Login)
+			r.Post("/refresh", h.Refresh)
+		}
 	})
 
 	router.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware(h.AuthService, h.logger, h.validator))
+		r.Use(middleware.AuthMiddleware(h.Authenticator, h.logger))
 		r.Get("/all", h.GetAll)
 		r.Get("/messages", h.GetAllUsersThatSentMessage)
+
+		r.With(middleware.RequirePermission(entity.PermissionDeleteUsers, h.logger)).Delete("/{id}", h.Delete)
+		r.With(middleware.RequirePermission(entity.PermissionBanUsers, h.logger)).Post("/{id}/ban", h.Ban)
+		r.With(middleware.RequirePermission(entity.PermissionBanUsers, h.logger)).Delete("/{id}/ban", h.Unban)
+		r.With(middleware.RequirePermission(entity.PermissionPromoteUsers, h.logger)).Put("/{id}/role", h.SetRole)
 	})
 
 	return router
@@ -126,17 +149,142 @@ func (h *Handler) Register(rw http.ResponseWriter, req *http.Request) {
 	rw.WriteHeader(http.StatusCreated)
 }
 
+// Login godoc
+//
+//	@Summary		Log in
+//	@Description	Issue an access token to authenticate requests with and a refresh token to get new tokens with
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		request.LoginRequest	true	"credentials"
+//	@Success		200		{object}	response.TokenResponse
+//	@Failure		400		{string}	invalid	login	data	provided
+//	@Failure		401		{string}	Unauthorized
+//	@Failure		429		{string}	too	many	failed	login	attempts
+//	@Router			/api/v1/users/login [post]
+func (h *Handler) Login(rw http.ResponseWriter, req *http.Request) {
+	var loginReq request.LoginRequest
+
+	if err := render.DecodeJSON(req.Body, &loginReq); err != nil {
+		logMsg := fmt.Sprintf("error occurred decoding request body to LoginRequest struct: %v", err)
+		respMsg := fmt.Sprintf("invalid login data provided: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	if err := loginReq.Validate(h.validator); err != nil {
+		logMsg := fmt.Sprintf("error occurred validating LoginRequest struct: %v", err)
+		respMsg := fmt.Sprintf("invalid login data provided: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	loginReq.RemoteAddr = req.RemoteAddr
+
+	tokens, err := h.TokenService.IssueTokens(req.Context(), loginReq)
+	if middleware.WriteLoginLocked(rw, h.logger, err) {
+		return
+	}
+
+	if err != nil {
+		logMsg := fmt.Sprintf("error occurred while logging user: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, logMsg, "invalid username or password")
+
+		return
+	}
+
+	render.JSON(rw, req, mapper.MapTokenPairToResponse(tokens))
+}
+
+// Refresh godoc
+//
+//	@Summary		Refresh tokens
+//	@Description	Exchange a refresh token for a new pair of tokens
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		request.RefreshRequest	true	"refresh token"
+//	@Success		200		{object}	response.TokenResponse
+//	@Failure		400		{string}	invalid	refresh	data	provided
+//	@Failure		401		{string}	Unauthorized
+//	@Router			/api/v1/users/refresh [post]
+func (h *Handler) Refresh(rw http.ResponseWriter, req *http.Request) {
+	var refreshReq request.RefreshRequest
+
+	if err := render.DecodeJSON(req.Body, &refreshReq); err != nil {
+		logMsg := fmt.Sprintf("error occurred decoding request body to RefreshRequest struct: %v", err)
+		respMsg := fmt.Sprintf("invalid refresh data provided: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	if err := refreshReq.Validate(h.validator); err != nil {
+		logMsg := fmt.Sprintf("error occurred validating RefreshRequest struct: %v", err)
+		respMsg := fmt.Sprintf("invalid refresh data provided: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	tokens, err := h.TokenService.RefreshTokens(req.Context(), refreshReq.RefreshToken)
+	if err != nil {
+		logMsg := fmt.Sprintf("error occurred refreshing tokens: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, logMsg, "invalid refresh token")
+
+		return
+	}
+
+	render.JSON(rw, req, mapper.MapTokenPairToResponse(tokens))
+}
+
 // GetAll godoc
 //
 //	@Summary		Get all users
-//	@Description	Get all users
+//	@Description	Get a page of users ordered by id.
+//	@Description	Pages are asked for by the after or before cursor of the Link header, offsets are deprecated.
 //	@Security		BasicAuth
+//	@Security		BearerAuth
 //	@Tags			User
 //	@Produce		json
-//	@Success		200	{object}	[]response.UserResponse
-//	@Failure		401	{string}	Unauthorized
+//	@Param			after	query		string	false	"cursor of the page following it"
+//	@Param			before	query		string	false	"cursor of the page preceding it"
+//	@Param			offset	query		int		false	"Offset, deprecated"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]response.UserResponse
+//	@Header			200		{string}	Link			"URLs of the next and prev pages"
+//	@Header			200		{string}	X-Next-Cursor	"cursor of the next page"
+//	@Header			200		{string}	X-Prev-Cursor	"cursor of the prev page"
+//	@Failure		400		{string}	invalid	cursor
+//	@Failure		401		{string}	Unauthorized
 //	@Router			/api/v1/users/all [get]
 func (h *Handler) GetAll(rw http.ResponseWriter, req *http.Request) {
+	if handlerinternalutils.IsOffsetPagination(req) {
+		h.getAllByOffset(rw, req)
+		return
+	}
+
+	page, err := handlerinternalutils.GetPageFromQuery(req, handler.DefaultLimit)
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	users, cursors := h.UserService.GetUsersPage(req.Context(), page)
+
+	handlerinternalutils.WritePageLinks(rw, req, cursors)
+	render.JSON(rw, req, sliceutils.Map(users, mapper.MapUserToUserResponse))
+}
+
+func (h *Handler) getAllByOffset(rw http.ResponseWriter, req *http.Request) {
 	paginationOpts := handlerinternalutils.GetPaginationOptsFromQuery(req, handler.DefaultOffset, handler.DefaultLimit)
 
 	if err := paginationOpts.Validate(h.validator); err != nil {
@@ -156,13 +304,14 @@ func (h *Handler) GetAll(rw http.ResponseWriter, req *http.Request) {
 //	@Summary		Get all users that sent message to current user
 //	@Description	Get all users that sent message to current user
 //	@Security		BasicAuth
+//	@Security		BearerAuth
 //	@Tags			User
 //	@Produce		json
 //	@Success		200	{object}	[]response.UserResponse
 //	@Failure		401	{string}	Unauthorized
 //	@Router			/api/v1/users/messages [get]
 func (h *Handler) GetAllUsersThatSentMessage(rw http.ResponseWriter, req *http.Request) {
-	id, err := handlerutils.GetIntHeaderByKey(req, "id")
+	id, err := middleware.UserIDFromContext(req.Context())
 	if err != nil {
 		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
 		return
@@ -175,3 +324,150 @@ func (h *Handler) GetAllUsersThatSentMessage(rw http.ResponseWriter, req *http.R
 	render.JSON(rw, req, sliceutils.Map(users, mapper.MapUserToUserResponse))
 	rw.WriteHeader(http.StatusOK)
 }
+
+// Delete godoc
+//
+//	@Summary		Delete user
+//	@Description	Delete a user, only admins are allowed to
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			User
+//	@Produce		json
+//	@Param			id	path		int	true	"user id"
+//	@Success		200	{object}	response.GetUserResponse
+//	@Failure		400	{string}	invalid	user	id
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		404	{string}	no	such	user
+//	@Router			/api/v1/users/{id} [delete]
+func (h *Handler) Delete(rw http.ResponseWriter, req *http.Request) {
+	h.moderate(rw, req, "deleting", func(ctx context.Context, actorID, id int) (*entity.User, error) {
+		return h.UserService.DeleteUser(ctx, actorID, id)
+	})
+}
+
+// Ban godoc
+//
+//	@Summary		Ban user
+//	@Description	Ban a user, banned users can't log in or send messages. Only admins are allowed to
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			User
+//	@Produce		json
+//	@Param			id	path		int	true	"user id"
+//	@Success		200	{object}	response.GetUserResponse
+//	@Failure		400	{string}	invalid	user	id
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		404	{string}	no	such	user
+//	@Router			/api/v1/users/{id}/ban [post]
+func (h *Handler) Ban(rw http.ResponseWriter, req *http.Request) {
+	h.moderate(rw, req, "banning", func(ctx context.Context, actorID, id int) (*entity.User, error) {
+		return h.UserService.BanUser(ctx, actorID, id, true)
+	})
+}
+
+// Unban godoc
+//
+//	@Summary		Unban user
+//	@Description	Lift the ban of a user, only admins are allowed to
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			User
+//	@Produce		json
+//	@Param			id	path		int	true	"user id"
+//	@Success		200	{object}	response.GetUserResponse
+//	@Failure		400	{string}	invalid	user	id
+//	@Failure		401	{string}	Unauthorized
+//	@Failure		403	{string}	Forbidden
+//	@Failure		404	{string}	no	such	user
+//	@Router			/api/v1/users/{id}/ban [delete]
+func (h *Handler) Unban(rw http.ResponseWriter, req *http.Request) {
+	h.moderate(rw, req, "unbanning", func(ctx context.Context, actorID, id int) (*entity.User, error) {
+		return h.UserService.BanUser(ctx, actorID, id, false)
+	})
+}
+
+// SetRole godoc
+//
+//	@Summary		Set user role
+//	@Description	Promote or demote a user, only admins are allowed to
+//	@Security		BasicAuth
+//	@Security		BearerAuth
+//	@Tags			User
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"user id"
+//	@Param			input	body		request.SetRoleRequest	true	"role"
+//	@Success		200		{object}	response.GetUserResponse
+//	@Failure		400		{string}	invalid	role
+//	@Failure		401		{string}	Unauthorized
+//	@Failure		403		{string}	Forbidden
+//	@Failure		404		{string}	no	such	user
+//	@Router			/api/v1/users/{id}/role [put]
+func (h *Handler) SetRole(rw http.ResponseWriter, req *http.Request) {
+	var roleReq request.SetRoleRequest
+
+	if err := render.DecodeJSON(req.Body, &roleReq); err != nil {
+		logMsg := fmt.Sprintf("error occurred decoding request body to SetRoleRequest struct: %v", err)
+		respMsg := fmt.Sprintf("invalid role provided: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	if err := roleReq.Validate(h.validator); err != nil {
+		logMsg := fmt.Sprintf("error occurred validating SetRoleRequest struct: %v", err)
+		respMsg := fmt.Sprintf("invalid role provided: %v", err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, logMsg, respMsg)
+
+		return
+	}
+
+	h.moderate(rw, req, "setting role of", func(ctx context.Context, actorID, id int) (*entity.User, error) {
+		return h.UserService.SetUserRole(ctx, actorID, id, entity.Role(roleReq.Role))
+	})
+}
+
+// moderate applies action of the current user to the user of the path and writes the changed user.
+func (h *Handler) moderate(
+	rw http.ResponseWriter,
+	req *http.Request,
+	actionName string,
+	action func(ctx context.Context, actorID, id int) (*entity.User, error),
+) {
+	actorID, err := middleware.UserIDFromContext(req.Context())
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusUnauthorized, "", err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(req, "id"))
+	if err != nil {
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", "invalid user id")
+		return
+	}
+
+	user, err := action(req.Context(), actorID, id)
+
+	switch {
+	case err == nil:
+		h.logger.Infof("user %d finished %s user %d", actorID, actionName, id)
+
+		render.JSON(rw, req, mapper.MapUserToUserResponse(user))
+	case errors.Is(err, policy.ErrForbidden):
+		logMsg := fmt.Sprintf("error occurred %s user: %v", actionName, err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusForbidden, logMsg, "forbidden")
+	case errors.Is(err, userservice.ErrSelfAction), errors.Is(err, userservice.ErrUnknownRole):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusBadRequest, "", err.Error())
+	case errors.Is(err, repository.ErrNoSuchUser):
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusNotFound, "", repository.ErrNoSuchUser.Error())
+	default:
+		logMsg := fmt.Sprintf("error occurred %s user: %v", actionName, err)
+
+		handlerutils.WriteErrResponseAndLog(rw, h.logger, http.StatusInternalServerError, logMsg, "internal error")
+	}
+}
@@ -0,0 +1,56 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+// userAuthenticator authenticates every request as user.
+type userAuthenticator struct {
+	user *entity.User
+}
+
+func (a userAuthenticator) Authenticate(*http.Request) (*entity.Principal, error) {
+	return &entity.Principal{UserID: a.user.ID, Username: a.user.Username, AuthMethod: entity.AuthMethodBasic}, nil
+}
+
+type fakeMessageService struct {
+	MessageService
+
+	toID int
+}
+
+func (s *fakeMessageService) GetAllUsersThatSentMessage(_ context.Context, toID int, _, _ int) []*entity.User {
+	s.toID = toID
+
+	return nil
+}
+
+func TestUsersThatSentMessageIgnoreClientSentID(t *testing.T) {
+	messages := &fakeMessageService{}
+	user := &entity.User{ID: 1, Username: "test"}
+
+	h := New(nil, messages, userAuthenticator{user: user}, nil, logrus.New(), validator.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/messages", nil)
+	req.Header.Set("id", "42")
+
+	rw := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected users, got %d: %s", rw.Code, rw.Body)
+	}
+
+	if messages.toID != user.ID {
+		t.Fatalf("expected senders to user %d, got senders to %d", user.ID, messages.toID)
+	}
+}
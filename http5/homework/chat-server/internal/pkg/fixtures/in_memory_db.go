@@ -11,7 +11,9 @@ import (
 	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
 )
 
-func LoadFixtures(db inmemory.InMemoryDB) {
+// LoadFixtures adds test users and messages to the database. The tables are created anew,
+// so fixtures must only be loaded into a new database.
+func LoadFixtures(db inmemory.InMemoryDB) error {
 	now := time.Now()
 
 	users := []entity.User{
@@ -20,6 +22,7 @@ func LoadFixtures(db inmemory.InMemoryDB) {
 			Username:       "test",
 			Email:          "test@mail.ru",
 			HashedPassword: "$2a$10$n1ZupQQL9NBnIDHShSIfwut3wf2cUMtsmzBo/7r29oRo4tYRrmoLS",
+			Role:           entity.RoleUser,
 			CreatedAt:      now,
 			UpdatedAt:      now,
 		},
@@ -28,6 +31,7 @@ func LoadFixtures(db inmemory.InMemoryDB) {
 			Username:       "test2",
 			Email:          "test2@mail.ru",
 			HashedPassword: "$2a$10$O3bRPhNaWgVibnpkUFL.K.xXwmYnDKKMJ1Ak4iavFrSnn8wAsgYPW",
+			Role:           entity.RoleUser,
 			CreatedAt:      now,
 			UpdatedAt:      now,
 		},
@@ -36,17 +40,20 @@ func LoadFixtures(db inmemory.InMemoryDB) {
 			Username:       "test3",
 			Email:          "test3@mail.ru",
 			HashedPassword: "$2a$10$lgQ9a71CwJQkAF1yUcKKl..RGDT4OaGRjyBAVFgGupkdMclmS7wMS",
+			Role:           entity.RoleUser,
 			CreatedAt:      now,
 			UpdatedAt:      now,
 		},
 	}
 
-	db.CreateTable(repository.UserTableName)
+	if err := db.CreateTable(repository.UserTableName); err != nil {
+		return err
+	}
 
 	for _, user := range users {
 		err := db.AddRow(repository.UserTableName, strconv.Itoa(user.ID), user)
 		if err != nil {
-			return
+			return err
 		}
 	}
 
@@ -74,12 +81,14 @@ func LoadFixtures(db inmemory.InMemoryDB) {
 		},
 	}
 
-	db.CreateTable(repository.PublicMessageTableName)
+	if err := db.CreateTable(repository.PublicMessageTableName); err != nil {
+		return err
+	}
 
 	for _, pubMsg := range pubMessages {
 		err := db.AddRow(repository.PublicMessageTableName, strconv.Itoa(pubMsg.ID), pubMsg)
 		if err != nil {
-			return
+			return err
 		}
 	}
 
@@ -118,12 +127,16 @@ func LoadFixtures(db inmemory.InMemoryDB) {
 		},
 	}
 
-	db.CreateTable(repository.PrivateMessageTableName)
+	if err := db.CreateTable(repository.PrivateMessageTableName); err != nil {
+		return err
+	}
 
 	for _, privMsg := range privMessages {
 		err := db.AddRow(repository.PrivateMessageTableName, strconv.Itoa(privMsg.ID), privMsg)
 		if err != nil {
-			return
+			return err
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+const (
+	afterQuery  = "after"
+	beforeQuery = "before"
+	limitQuery  = "limit"
+	offsetQuery = "offset"
+
+	NextCursorHeader = "X-Next-Cursor"
+	PrevCursorHeader = "X-Prev-Cursor"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidLimit  = errors.New("invalid limit")
+)
+
+// EncodeCursor returns the token of the cursor, clients are not expected to read it.
+func EncodeCursor(cursor entity.Cursor) string {
+	token := strconv.Itoa(cursor.ID)
+	if !cursor.At.IsZero() {
+		token += "." + strconv.FormatInt(cursor.At.UnixNano(), 10)
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+func DecodeCursor(token string) (entity.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return entity.Cursor{}, ErrInvalidCursor
+	}
+
+	id, at, hasAt := strings.Cut(string(raw), ".")
+
+	var cursor entity.Cursor
+
+	if cursor.ID, err = strconv.Atoi(id); err != nil {
+		return entity.Cursor{}, ErrInvalidCursor
+	}
+
+	if hasAt {
+		nanos, err := strconv.ParseInt(at, 10, 64)
+		if err != nil {
+			return entity.Cursor{}, ErrInvalidCursor
+		}
+
+		cursor.At = time.Unix(0, nanos).UTC()
+	}
+
+	return cursor, nil
+}
+
+// IsOffsetPagination reports whether the listing is asked for by offset rather than by cursor,
+// offsets are kept for clients written before cursors.
+func IsOffsetPagination(req *http.Request) bool {
+	return req.URL.Query().Has(offsetQuery)
+}
+
+// GetPageFromQuery returns the page following the after cursor or preceding the before one,
+// the first page if the query has neither.
+func GetPageFromQuery(req *http.Request, defaultLimit int) (entity.Page, error) {
+	query := req.URL.Query()
+	page := entity.Page{Limit: defaultLimit}
+
+	if value := query.Get(limitQuery); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return entity.Page{}, fmt.Errorf("%w %q", ErrInvalidLimit, value)
+		}
+
+		page.Limit = limit
+	}
+
+	after, before := query.Get(afterQuery), query.Get(beforeQuery)
+
+	switch {
+	case after != "" && before != "":
+		return entity.Page{}, fmt.Errorf("%w: only one of %s and %s can be given", ErrInvalidCursor, afterQuery, beforeQuery)
+	case after != "":
+		cursor, err := DecodeCursor(after)
+		if err != nil {
+			return entity.Page{}, err
+		}
+
+		page.After = &cursor
+	case before != "":
+		cursor, err := DecodeCursor(before)
+		if err != nil {
+			return entity.Page{}, err
+		}
+
+		page.Before = &cursor
+	}
+
+	return page, nil
+}
+
+// pageURL returns the URL of the request asking for the page after or before the cursor instead.
+func pageURL(req *http.Request, direction string, cursor entity.Cursor) string {
+	query := req.URL.Query()
+
+	query.Del(offsetQuery)
+	query.Del(afterQuery)
+	query.Del(beforeQuery)
+	query.Set(direction, EncodeCursor(cursor))
+
+	return req.URL.Path + "?" + query.Encode()
+}
+
+// WritePageLinks sets headers with the cursors of the pages around the one returned,
+// and the Link header with URLs of these pages.
+func WritePageLinks(rw http.ResponseWriter, req *http.Request, cursors entity.PageCursors) {
+	var links []string
+
+	if cursors.Next != nil {
+		rw.Header().Set(NextCursorHeader, EncodeCursor(*cursors.Next))
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(req, afterQuery, *cursors.Next)))
+	}
+
+	if cursors.Prev != nil {
+		rw.Header().Set(PrevCursorHeader, EncodeCursor(*cursors.Prev))
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(req, beforeQuery, *cursors.Prev)))
+	}
+
+	if len(links) > 0 {
+		rw.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,1171 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	messageservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/message"
+	roomservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/room"
+	userservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/user"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+// repos are the repositories of a single backend sharing one database.
+type repos struct {
+	users           userservice.UserRepo
+	publicMessages  messageservice.PublicMessageRepo
+	privateMessages messageservice.PrivateMessageRepo
+	rooms           roomservice.RoomRepo
+	roomMessages    roomservice.RoomMessageRepo
+}
+
+// reposFactory opens an empty database, closing it when the test is done.
+type reposFactory func(t *testing.T) repos
+
+// backends run the conformance checks, a new backend proves it behaves the same as
+// UserRepoInMemDB by adding its factory here.
+var backends = map[string]reposFactory{
+	"inmemory": func(t *testing.T) repos {
+		return inMemRepos(t)
+	},
+	"inmemory-file": func(t *testing.T) repos {
+		engine, err := inmemory.OpenFileEngine(inmemory.WALConfig{
+			Path:   filepath.Join(t.TempDir(), "db_state.dat"),
+			Policy: inmemory.SyncAlways,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return inMemRepos(t, inmemory.WithEngine(engine))
+	},
+	"sqlite": func(t *testing.T) repos {
+		db := initSQLite(t, filepath.Join(t.TempDir(), "chat.db"))
+
+		return repos{
+			users:           NewSQLiteUserRepo(db),
+			publicMessages:  NewSQLitePublicMessageRepo(db),
+			privateMessages: NewSQLitePrivateMessageRepo(db),
+			rooms:           NewSQLiteRoomRepo(db),
+			roomMessages:    NewSQLiteRoomMessageRepo(db),
+		}
+	},
+	"postgres": func(t *testing.T) repos {
+		db := initPostgres(t)
+
+		return repos{
+			users:           NewPostgresUserRepo(db),
+			publicMessages:  NewPostgresPublicMessageRepo(db),
+			privateMessages: NewPostgresPrivateMessageRepo(db),
+			rooms:           NewPostgresRoomRepo(db),
+			roomMessages:    NewPostgresRoomMessageRepo(db),
+		}
+	},
+}
+
+func inMemRepos(t *testing.T, opts ...inmemory.Option) repos {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	db, savedChan, err := inmemory.NewInMemDBFromEngine(ctx, "", append(InMemDBSchema(), opts...)...)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		cancel()
+
+		if res := <-savedChan; res != "ok" {
+			t.Errorf("cannot close db: %v", res)
+		}
+	})
+
+	users, err := NewInMemUserRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateMessages, err := NewInMemPrivateMessageRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicMessages, err := NewInMemPublicMessageRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rooms, err := NewInMemRoomRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roomMessages, err := NewInMemRoomMessageRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repos{
+		users:           users,
+		publicMessages:  publicMessages,
+		privateMessages: privateMessages,
+		rooms:           rooms,
+		roomMessages:    roomMessages,
+	}
+}
+
+var conformance = map[string]func(t *testing.T, r repos){
+	"user lookups":               checkUserLookups,
+	"user uniqueness":            checkUserUniqueness,
+	"user update":                checkUserUpdate,
+	"user delete":                checkUserDelete,
+	"users pagination":           checkUsersPagination,
+	"public messages":            checkPublicMessages,
+	"private messages":           checkPrivateMessages,
+	"messages pagination":        checkMessagesPagination,
+	"concurrent users":           checkConcurrentUsers,
+	"concurrent unique users":    checkConcurrentUniqueUsers,
+	"concurrent messages":        checkConcurrentMessages,
+	"messages of missing user":   checkMessagesOfMissingUser,
+	"user role and ban":          checkUserRoleAndBan,
+	"messages delete":            checkMessagesDelete,
+	"public messages after":      checkPublicMessagesAfter,
+	"private messages after":     checkPrivateMessagesAfter,
+	"users keyset pagination":    checkUsersKeysetPagination,
+	"messages keyset pagination": checkMessagesKeysetPagination,
+	"rooms":                      checkRooms,
+	"room members":               checkRoomMembers,
+	"room messages":              checkRoomMessages,
+}
+
+func TestRepositoryConformance(t *testing.T) {
+	for backend, factory := range backends {
+		factory := factory
+
+		t.Run(backend, func(t *testing.T) {
+			for name, check := range conformance {
+				check := check
+
+				t.Run(name, func(t *testing.T) {
+					check(t, factory(t))
+				})
+			}
+		})
+	}
+}
+
+func addUsers(t *testing.T, repo userservice.UserRepo, usernames ...string) []*entity.User {
+	t.Helper()
+
+	users := make([]*entity.User, 0, len(usernames))
+
+	for _, username := range usernames {
+		user, err := repo.AddUser(context.Background(), entity.User{
+			Email:          username + "@mail.com",
+			Username:       username,
+			HashedPassword: "NoHash",
+		})
+		if err != nil {
+			t.Fatalf("cannot add user: %v", err)
+		}
+
+		users = append(users, user)
+	}
+
+	return users
+}
+
+// sameUser compares times with Equal, rows read back from a file or a database lose their monotonic clock.
+func sameUser(a, b *entity.User) bool {
+	return a.ID == b.ID &&
+		a.Email == b.Email &&
+		a.Username == b.Username &&
+		a.Role == b.Role &&
+		a.Banned == b.Banned &&
+		a.HashedPassword == b.HashedPassword &&
+		a.CreatedAt.Equal(b.CreatedAt) &&
+		a.UpdatedAt.Equal(b.UpdatedAt)
+}
+
+func expectUser(t *testing.T, expected *entity.User, got *entity.User, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("expected %+v, got %v", expected, err)
+	}
+
+	if !sameUser(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func usernames(users []*entity.User) []string {
+	res := make([]string, 0, len(users))
+
+	for _, user := range users {
+		res = append(res, user.Username)
+	}
+
+	return res
+}
+
+func contents[T entity.PublicMessage | entity.PrivateMessage | entity.RoomMessage](msgs []*T) []string {
+	res := make([]string, 0, len(msgs))
+
+	for _, msg := range msgs {
+		switch msg := any(msg).(type) {
+		case *entity.PublicMessage:
+			res = append(res, msg.Content)
+		case *entity.PrivateMessage:
+			res = append(res, msg.Content)
+		case *entity.RoomMessage:
+			res = append(res, msg.Content)
+		}
+	}
+
+	return res
+}
+
+func expectStrings(t *testing.T, what string, expected, got []string) {
+	t.Helper()
+
+	if fmt.Sprint(expected) != fmt.Sprint(got) {
+		t.Fatalf("expected %s %v, got %v", what, expected, got)
+	}
+}
+
+func checkUserLookups(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second")
+
+	if users[0].ID == users[1].ID {
+		t.Fatalf("expected distinct ids, got %d twice", users[0].ID)
+	}
+
+	if users[1].CreatedAt.IsZero() || !users[1].CreatedAt.Equal(users[1].UpdatedAt) {
+		t.Fatalf("expected creation time to be set, got %+v", users[1])
+	}
+
+	got, err := r.users.GetUserByID(ctx, users[1].ID)
+	expectUser(t, users[1], got, err)
+
+	got, err = r.users.GetUserByEmail(ctx, "first@mail.com")
+	expectUser(t, users[0], got, err)
+
+	got, err = r.users.GetUserByUsername(ctx, "second")
+	expectUser(t, users[1], got, err)
+
+	if _, err = r.users.GetUserByID(ctx, users[1].ID+100); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected ErrNoSuchUser for missing id, got %v", err)
+	}
+
+	if _, err = r.users.GetUserByEmail(ctx, "missing@mail.com"); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected ErrNoSuchUser for missing email, got %v", err)
+	}
+
+	if _, err = r.users.GetUserByUsername(ctx, "missing"); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected ErrNoSuchUser for missing username, got %v", err)
+	}
+}
+
+func checkUserUniqueness(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first")
+
+	_, err := r.users.AddUser(ctx, entity.User{Email: "first@mail.com", Username: "second", HashedPassword: "NoHash"})
+	if !errors.Is(err, ErrEmailExists) {
+		t.Fatalf("expected ErrEmailExists, got %v", err)
+	}
+
+	_, err = r.users.AddUser(ctx, entity.User{Email: "second@mail.com", Username: "first", HashedPassword: "NoHash"})
+	if !errors.Is(err, ErrUsernameExists) {
+		t.Fatalf("expected ErrUsernameExists, got %v", err)
+	}
+
+	if all := r.users.GetAllUsers(ctx, 0, math.MaxInt64); len(all) != 1 {
+		t.Fatalf("expected rejected users not to be added, got %v", usernames(all))
+	}
+
+	if _, err = r.users.DeleteUser(ctx, users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// email and username are free again once their user is deleted
+	addUsers(t, r.users, "first")
+}
+
+func checkUserUpdate(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second")
+
+	updated := entity.User{Email: "renamed@mail.com", Username: "renamed", HashedPassword: "NewHash"}
+
+	old, err := r.users.UpdateUser(ctx, users[0].ID, updated)
+	expectUser(t, users[0], old, err)
+
+	got, err := r.users.GetUserByID(ctx, users[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Email != updated.Email || got.Username != updated.Username || got.HashedPassword != updated.HashedPassword {
+		t.Fatalf("expected %+v, got %+v", updated, got)
+	}
+
+	if !got.CreatedAt.Equal(users[0].CreatedAt) || got.UpdatedAt.Before(users[0].UpdatedAt) {
+		t.Fatalf("expected only update time to change, was %+v, got %+v", users[0], got)
+	}
+
+	if _, err = r.users.GetUserByUsername(ctx, "first"); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected old username to be free, got %v", err)
+	}
+
+	// keeping its own email and username is not a conflict
+	updated.HashedPassword = "NewerHash"
+
+	if _, err = r.users.UpdateUser(ctx, users[0].ID, updated); err != nil {
+		t.Fatalf("cannot update password only: %v", err)
+	}
+
+	_, err = r.users.UpdateUser(ctx, users[1].ID, entity.User{Email: "renamed@mail.com", Username: "second", HashedPassword: "NoHash"})
+	if !errors.Is(err, ErrEmailExists) {
+		t.Fatalf("expected ErrEmailExists, got %v", err)
+	}
+
+	_, err = r.users.UpdateUser(ctx, users[1].ID, entity.User{Email: "second@mail.com", Username: "renamed", HashedPassword: "NoHash"})
+	if !errors.Is(err, ErrUsernameExists) {
+		t.Fatalf("expected ErrUsernameExists, got %v", err)
+	}
+
+	got, err = r.users.GetUserByID(ctx, users[1].ID)
+	expectUser(t, users[1], got, err)
+
+	if _, err = r.users.UpdateUser(ctx, users[1].ID+100, updated); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected ErrNoSuchUser, got %v", err)
+	}
+}
+
+func checkUserDelete(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second")
+
+	deleted, err := r.users.DeleteUser(ctx, users[0].ID)
+	expectUser(t, users[0], deleted, err)
+
+	if _, err = r.users.GetUserByID(ctx, users[0].ID); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected deleted user to be missing, got %v", err)
+	}
+
+	if _, err = r.users.DeleteUser(ctx, users[0].ID); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected ErrNoSuchUser on second delete, got %v", err)
+	}
+
+	expectStrings(t, "users", []string{"second"}, usernames(r.users.GetAllUsers(ctx, 0, math.MaxInt64)))
+
+	// ids of deleted users are not given out again
+	added := addUsers(t, r.users, "third")
+	if added[0].ID == users[0].ID {
+		t.Fatalf("expected a new id, got id %d of deleted user", added[0].ID)
+	}
+}
+
+func checkUsersPagination(t *testing.T, r repos) {
+	ctx := context.Background()
+	addUsers(t, r.users, "u1", "u2", "u3", "u4", "u5")
+
+	pages := []struct {
+		offset, limit int
+		expected      []string
+	}{
+		{offset: 0, limit: math.MaxInt64, expected: []string{"u1", "u2", "u3", "u4", "u5"}},
+		{offset: 0, limit: 2, expected: []string{"u1", "u2"}},
+		{offset: 2, limit: 2, expected: []string{"u3", "u4"}},
+		{offset: 4, limit: 2, expected: []string{"u5"}},
+		{offset: 5, limit: 2, expected: []string{}},
+		{offset: 1, limit: 0, expected: []string{}},
+	}
+
+	for _, page := range pages {
+		expectStrings(t, fmt.Sprintf("users at offset %d limit %d", page.offset, page.limit),
+			page.expected, usernames(r.users.GetAllUsers(ctx, page.offset, page.limit)))
+	}
+}
+
+func checkPublicMessages(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first")
+
+	msg, err := r.publicMessages.AddPublicMessage(ctx, entity.PublicMessage{From: users[0], Content: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.SentAt.IsZero() || !msg.SentAt.Equal(msg.EditedAt) {
+		t.Fatalf("expected send time to be set, got %+v", msg)
+	}
+
+	got, err := r.publicMessages.GetPublicMessage(ctx, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != msg.ID || got.Content != "hello" || !got.SentAt.Equal(msg.SentAt) || !sameUser(got.From, users[0]) {
+		t.Fatalf("expected %+v, got %+v", msg, got)
+	}
+
+	if _, err = r.publicMessages.GetPublicMessage(ctx, msg.ID+100); !errors.Is(err, ErrNoSuchPublicMessage) {
+		t.Fatalf("expected ErrNoSuchPublicMessage, got %v", err)
+	}
+}
+
+func checkPrivateMessages(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second", "third")
+
+	sent := []entity.PrivateMessage{
+		{From: users[0], To: users[1], Content: "first to second"},
+		{From: users[2], To: users[1], Content: "third to second"},
+		{From: users[0], To: users[2], Content: "first to third"},
+		{From: users[0], To: users[1], Content: "first to second again"},
+	}
+
+	for _, msg := range sent {
+		if _, err := r.privateMessages.AddPrivateMessage(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectStrings(t, "messages to second",
+		[]string{"first to second", "third to second", "first to second again"},
+		contents(r.privateMessages.GetAllPrivateMessagesTo(ctx, users[1].ID, 0, 10)))
+
+	expectStrings(t, "messages from first to second",
+		[]string{"first to second", "first to second again"},
+		contents(r.privateMessages.GetAllPrivateMessagesFromUser(ctx, users[1].ID, users[0].ID, 0, 10)))
+
+	expectStrings(t, "messages from second to first",
+		[]string{},
+		contents(r.privateMessages.GetAllPrivateMessagesFromUser(ctx, users[0].ID, users[1].ID, 0, 10)))
+
+	all := r.privateMessages.GetAllPrivateMessages(ctx, 0, 10)
+	if len(all) != len(sent) {
+		t.Fatalf("expected %d messages, got %v", len(sent), contents(all))
+	}
+
+	got, err := r.privateMessages.GetPrivateMessage(ctx, all[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Content != "third to second" || !sameUser(got.From, users[2]) || !sameUser(got.To, users[1]) {
+		t.Fatalf("expected message from third to second, got %+v", got)
+	}
+
+	if _, err = r.privateMessages.GetPrivateMessage(ctx, all[3].ID+100); !errors.Is(err, ErrNoSuchPrivateMessage) {
+		t.Fatalf("expected ErrNoSuchPrivateMessage, got %v", err)
+	}
+}
+
+func checkMessagesPagination(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second")
+
+	for i := 1; i <= 5; i++ {
+		content := fmt.Sprintf("m%d", i)
+
+		if _, err := r.publicMessages.AddPublicMessage(ctx, entity.PublicMessage{From: users[0], Content: content}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := r.privateMessages.AddPrivateMessage(ctx, entity.PrivateMessage{From: users[0], To: users[1], Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages := []struct {
+		offset, limit int
+		expected      []string
+	}{
+		{offset: 0, limit: 2, expected: []string{"m1", "m2"}},
+		{offset: 2, limit: 2, expected: []string{"m3", "m4"}},
+		{offset: 4, limit: 2, expected: []string{"m5"}},
+		{offset: 5, limit: 2, expected: []string{}},
+	}
+
+	for _, page := range pages {
+		what := fmt.Sprintf("messages at offset %d limit %d", page.offset, page.limit)
+
+		expectStrings(t, "public "+what, page.expected,
+			contents(r.publicMessages.GetAllPublicMessages(ctx, page.offset, page.limit)))
+		expectStrings(t, "private "+what, page.expected,
+			contents(r.privateMessages.GetAllPrivateMessages(ctx, page.offset, page.limit)))
+		expectStrings(t, "private "+what+" to second", page.expected,
+			contents(r.privateMessages.GetAllPrivateMessagesTo(ctx, users[1].ID, page.offset, page.limit)))
+		expectStrings(t, "private "+what+" from first to second", page.expected,
+			contents(r.privateMessages.GetAllPrivateMessagesFromUser(ctx, users[1].ID, users[0].ID, page.offset, page.limit)))
+	}
+}
+
+func checkConcurrentUsers(t *testing.T, r repos) {
+	ctx := context.Background()
+
+	const usersCount = 20
+
+	var (
+		wg    sync.WaitGroup
+		m     sync.Mutex
+		added []*entity.User
+	)
+
+	for i := 0; i < usersCount; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			user, err := r.users.AddUser(ctx, entity.User{
+				Email:          fmt.Sprintf("user%d@mail.com", i),
+				Username:       fmt.Sprintf("user%d", i),
+				HashedPassword: "NoHash",
+			})
+			if err != nil {
+				t.Errorf("cannot add user: %v", err)
+				return
+			}
+
+			m.Lock()
+			added = append(added, user)
+			m.Unlock()
+		}(i)
+	}
+
+	wg.Wait()
+
+	got := r.users.GetAllUsers(ctx, 0, math.MaxInt64)
+	if len(added) != usersCount || len(got) != usersCount {
+		t.Fatalf("expected %d users, added %d, got %d", usersCount, len(added), len(got))
+	}
+
+	ids := make(map[int]bool, len(added))
+
+	for _, user := range added {
+		if ids[user.ID] {
+			t.Fatalf("duplicate user id %d", user.ID)
+		}
+
+		ids[user.ID] = true
+
+		stored, err := r.users.GetUserByID(ctx, user.ID)
+		expectUser(t, user, stored, err)
+	}
+}
+
+func checkConcurrentUniqueUsers(t *testing.T, r repos) {
+	ctx := context.Background()
+
+	const attempts = 10
+
+	var (
+		wg    sync.WaitGroup
+		m     sync.Mutex
+		added int
+	)
+
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := r.users.AddUser(ctx, entity.User{
+				Email:          fmt.Sprintf("user%d@mail.com", i),
+				Username:       "same",
+				HashedPassword: "NoHash",
+			})
+			if errors.Is(err, ErrUsernameExists) {
+				return
+			}
+
+			if err != nil {
+				t.Errorf("cannot add user: %v", err)
+				return
+			}
+
+			m.Lock()
+			added++
+			m.Unlock()
+		}(i)
+	}
+
+	wg.Wait()
+
+	if added != 1 {
+		t.Fatalf("expected exactly one user with the same username, added %d", added)
+	}
+
+	if got := r.users.GetAllUsers(ctx, 0, math.MaxInt64); len(got) != 1 {
+		t.Fatalf("expected one user, got %v", usernames(got))
+	}
+}
+
+func checkConcurrentMessages(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second")
+
+	const messagesCount = 20
+
+	var (
+		wg    sync.WaitGroup
+		m     sync.Mutex
+		added = make(map[int]bool, messagesCount)
+	)
+
+	for i := 0; i < messagesCount; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			msg, err := r.privateMessages.AddPrivateMessage(ctx, entity.PrivateMessage{
+				From:    users[i%2],
+				To:      users[(i+1)%2],
+				Content: fmt.Sprintf("m%d", i),
+			})
+			if err != nil {
+				t.Errorf("cannot add message: %v", err)
+				return
+			}
+
+			m.Lock()
+			defer m.Unlock()
+
+			if added[msg.ID] {
+				t.Errorf("duplicate message id %d", msg.ID)
+			}
+
+			added[msg.ID] = true
+		}(i)
+	}
+
+	wg.Wait()
+
+	got := r.privateMessages.GetAllPrivateMessages(ctx, 0, math.MaxInt64)
+	if len(added) != messagesCount || len(got) != messagesCount {
+		t.Fatalf("expected %d messages, added %d, got %d", messagesCount, len(added), len(got))
+	}
+
+	for _, msg := range got {
+		if !added[msg.ID] {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	}
+}
+
+func checkMessagesOfMissingUser(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first")
+	missing := &entity.User{ID: users[0].ID + 100}
+
+	_, err := r.publicMessages.AddPublicMessage(ctx, entity.PublicMessage{From: missing, Content: "hi"})
+	if !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected ErrNoSuchUser for missing sender, got %v", err)
+	}
+
+	_, err = r.privateMessages.AddPrivateMessage(ctx, entity.PrivateMessage{From: missing, To: users[0], Content: "hi"})
+	if !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected ErrNoSuchUser for missing sender, got %v", err)
+	}
+
+	_, err = r.privateMessages.AddPrivateMessage(ctx, entity.PrivateMessage{From: users[0], To: missing, Content: "hi"})
+	if !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected ErrNoSuchUser for missing receiver, got %v", err)
+	}
+
+	if msgs := r.publicMessages.GetAllPublicMessages(ctx, 0, 10); len(msgs) != 0 {
+		t.Fatalf("expected rejected messages not to be added, got %v", contents(msgs))
+	}
+
+	if msgs := r.privateMessages.GetAllPrivateMessages(ctx, 0, 10); len(msgs) != 0 {
+		t.Fatalf("expected rejected messages not to be added, got %v", contents(msgs))
+	}
+}
+
+func checkUserRoleAndBan(t *testing.T, r repos) {
+	ctx := context.Background()
+
+	admin, err := r.users.AddUser(ctx, entity.User{
+		Email:          "admin@mail.com",
+		Username:       "admin",
+		HashedPassword: "NoHash",
+		Role:           entity.RoleAdmin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.users.GetUserByID(ctx, admin.ID)
+	expectUser(t, admin, got, err)
+
+	banned := *got
+	banned.Role = entity.RoleUser
+	banned.Banned = true
+
+	if _, err = r.users.UpdateUser(ctx, admin.ID, banned); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = r.users.GetUserByUsername(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Role != entity.RoleUser || !got.Banned {
+		t.Fatalf("expected demoted and banned user, got %+v", got)
+	}
+}
+
+func checkMessagesDelete(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second")
+
+	public, err := r.publicMessages.AddPublicMessage(ctx, entity.PublicMessage{From: users[0], Content: "public"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private, err := r.privateMessages.AddPrivateMessage(ctx, entity.PrivateMessage{From: users[0], To: users[1], Content: "private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.publicMessages.DeletePublicMessage(ctx, public.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.privateMessages.DeletePrivateMessage(ctx, private.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = r.publicMessages.GetPublicMessage(ctx, public.ID); !errors.Is(err, ErrNoSuchPublicMessage) {
+		t.Fatalf("expected deleted public message to be gone, got %v", err)
+	}
+
+	if _, err = r.privateMessages.GetPrivateMessage(ctx, private.ID); !errors.Is(err, ErrNoSuchPrivateMessage) {
+		t.Fatalf("expected deleted private message to be gone, got %v", err)
+	}
+
+	if err = r.publicMessages.DeletePublicMessage(ctx, public.ID); !errors.Is(err, ErrNoSuchPublicMessage) {
+		t.Fatalf("expected ErrNoSuchPublicMessage, got %v", err)
+	}
+
+	if err = r.privateMessages.DeletePrivateMessage(ctx, private.ID); !errors.Is(err, ErrNoSuchPrivateMessage) {
+		t.Fatalf("expected ErrNoSuchPrivateMessage, got %v", err)
+	}
+}
+
+func checkPublicMessagesAfter(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first")
+
+	ids := make([]int, 0, 4)
+
+	for i := 1; i <= 4; i++ {
+		msg, err := r.publicMessages.AddPublicMessage(ctx, entity.PublicMessage{From: users[0], Content: fmt.Sprintf("m%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, msg.ID)
+	}
+
+	expectStrings(t, "public messages after none", []string{"m1", "m2"},
+		contents(r.publicMessages.GetPublicMessagesAfter(ctx, 0, 2)))
+	expectStrings(t, "public messages after second", []string{"m3", "m4"},
+		contents(r.publicMessages.GetPublicMessagesAfter(ctx, ids[1], 10)))
+	expectStrings(t, "public messages after last", []string{},
+		contents(r.publicMessages.GetPublicMessagesAfter(ctx, ids[3], 10)))
+}
+
+func checkPrivateMessagesAfter(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second")
+
+	ids := make([]int, 0, 4)
+
+	for i := 1; i <= 4; i++ {
+		// every other message goes the other way and is not one of the second user
+		from, to := users[0], users[1]
+		if i%2 == 0 {
+			from, to = users[1], users[0]
+		}
+
+		msg, err := r.privateMessages.AddPrivateMessage(ctx, entity.PrivateMessage{From: from, To: to, Content: fmt.Sprintf("m%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, msg.ID)
+	}
+
+	expectStrings(t, "private messages after none", []string{"m1", "m3"},
+		contents(r.privateMessages.GetPrivateMessagesToAfter(ctx, users[1].ID, 0, 10)))
+	expectStrings(t, "private messages after first", []string{"m3"},
+		contents(r.privateMessages.GetPrivateMessagesToAfter(ctx, users[1].ID, ids[0], 10)))
+	expectStrings(t, "private messages after limit", []string{"m2"},
+		contents(r.privateMessages.GetPrivateMessagesToAfter(ctx, users[0].ID, 0, 1)))
+	expectStrings(t, "private messages after last", []string{},
+		contents(r.privateMessages.GetPrivateMessagesToAfter(ctx, users[1].ID, ids[2], 10)))
+}
+
+func checkUsersKeysetPagination(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "u1", "u2", "u3", "u4", "u5")
+
+	cursor := func(i int) *entity.Cursor {
+		c := entity.UserCursor(users[i])
+		return &c
+	}
+
+	pages := []struct {
+		name     string
+		page     entity.Page
+		expected []string
+	}{
+		{name: "first", page: entity.Page{Limit: 2}, expected: []string{"u1", "u2"}},
+		{name: "after u2", page: entity.Page{After: cursor(1), Limit: 2}, expected: []string{"u3", "u4"}},
+		{name: "after u4", page: entity.Page{After: cursor(3), Limit: 2}, expected: []string{"u5"}},
+		{name: "after u5", page: entity.Page{After: cursor(4), Limit: 2}, expected: []string{}},
+		{name: "before u5", page: entity.Page{Before: cursor(4), Limit: 2}, expected: []string{"u3", "u4"}},
+		{name: "before u2", page: entity.Page{Before: cursor(1), Limit: 2}, expected: []string{"u1"}},
+	}
+
+	for _, page := range pages {
+		expectStrings(t, "users page "+page.name, page.expected, usernames(r.users.GetUsersPage(ctx, page.page)))
+	}
+
+	if _, err := r.users.DeleteUser(ctx, users[2].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStrings(t, "users page after u2 with u3 deleted", []string{"u4", "u5"},
+		usernames(r.users.GetUsersPage(ctx, entity.Page{After: cursor(1), Limit: 2})))
+	expectStrings(t, "users page before u4 with u3 deleted", []string{"u1", "u2"},
+		usernames(r.users.GetUsersPage(ctx, entity.Page{Before: cursor(3), Limit: 2})))
+}
+
+func checkMessagesKeysetPagination(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "first", "second")
+
+	var (
+		public  []entity.Cursor
+		private []entity.Cursor
+	)
+
+	for i := 1; i <= 5; i++ {
+		content := fmt.Sprintf("m%d", i)
+
+		pub, err := r.publicMessages.AddPublicMessage(ctx, entity.PublicMessage{From: users[0], Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		priv, err := r.privateMessages.AddPrivateMessage(ctx, entity.PrivateMessage{From: users[0], To: users[1], Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a message the other way is in none of the pages of messages to second
+		_, err = r.privateMessages.AddPrivateMessage(ctx, entity.PrivateMessage{From: users[1], To: users[0], Content: "back"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		public = append(public, entity.PublicMessageCursor(pub))
+		private = append(private, entity.PrivateMessageCursor(priv))
+	}
+
+	pages := []struct {
+		name     string
+		page     func(cursors []entity.Cursor) entity.Page
+		expected []string
+	}{
+		{
+			name:     "first",
+			page:     func([]entity.Cursor) entity.Page { return entity.Page{Limit: 2} },
+			expected: []string{"m1", "m2"},
+		},
+		{
+			name:     "after m2",
+			page:     func(c []entity.Cursor) entity.Page { return entity.Page{After: &c[1], Limit: 2} },
+			expected: []string{"m3", "m4"},
+		},
+		{
+			name:     "after m4",
+			page:     func(c []entity.Cursor) entity.Page { return entity.Page{After: &c[3], Limit: 2} },
+			expected: []string{"m5"},
+		},
+		{
+			name:     "after m5",
+			page:     func(c []entity.Cursor) entity.Page { return entity.Page{After: &c[4], Limit: 2} },
+			expected: []string{},
+		},
+		{
+			name:     "before m5",
+			page:     func(c []entity.Cursor) entity.Page { return entity.Page{Before: &c[4], Limit: 2} },
+			expected: []string{"m3", "m4"},
+		},
+		{
+			name:     "before m2",
+			page:     func(c []entity.Cursor) entity.Page { return entity.Page{Before: &c[1], Limit: 2} },
+			expected: []string{"m1"},
+		},
+	}
+
+	for _, page := range pages {
+		expectStrings(t, "public messages page "+page.name, page.expected,
+			contents(r.publicMessages.GetPublicMessagesPage(ctx, page.page(public))))
+		expectStrings(t, "private messages page "+page.name+" to second", page.expected,
+			contents(r.privateMessages.GetPrivateMessagesToPage(ctx, users[1].ID, page.page(private))))
+		expectStrings(t, "private messages page "+page.name+" from first to second", page.expected,
+			contents(r.privateMessages.GetPrivateMessagesFromUserPage(ctx, users[1].ID, users[0].ID, page.page(private))))
+	}
+}
+
+func roomNames(rooms []*entity.Room) []string {
+	res := make([]string, 0, len(rooms))
+
+	for _, room := range rooms {
+		res = append(res, room.Name)
+	}
+
+	return res
+}
+
+func memberNames(members []*entity.RoomMember) []string {
+	res := make([]string, 0, len(members))
+
+	for _, member := range members {
+		res = append(res, member.User.Username)
+	}
+
+	return res
+}
+
+func addRoom(t *testing.T, repo roomservice.RoomRepo, owner *entity.User, name string, visibility entity.RoomVisibility) *entity.Room {
+	t.Helper()
+
+	room, err := repo.AddRoom(context.Background(), entity.Room{Name: name, Visibility: visibility, Owner: owner})
+	if err != nil {
+		t.Fatalf("cannot add room: %v", err)
+	}
+
+	return room
+}
+
+func checkRooms(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "owner", "other")
+
+	lobby := addRoom(t, r.rooms, users[0], "lobby", entity.RoomPublic)
+	secret := addRoom(t, r.rooms, users[0], "secret", entity.RoomInviteOnly)
+	addRoom(t, r.rooms, users[1], "games", entity.RoomPublic)
+
+	got, err := r.rooms.GetRoom(ctx, secret.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != "secret" || got.Visibility != entity.RoomInviteOnly || !sameUser(got.Owner, users[0]) {
+		t.Fatalf("expected %+v, got %+v", secret, got)
+	}
+
+	if _, err = r.rooms.GetRoom(ctx, math.MaxInt32); !errors.Is(err, ErrNoSuchRoom) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchRoom, err)
+	}
+
+	if _, err = r.rooms.AddRoom(ctx, entity.Room{Name: "lobby", Visibility: entity.RoomPublic, Owner: users[1]}); !errors.Is(err, ErrRoomNameExists) {
+		t.Fatalf("expected %v, got %v", ErrRoomNameExists, err)
+	}
+
+	if _, err = r.rooms.AddRoom(ctx, entity.Room{Name: "orphan", Visibility: entity.RoomPublic, Owner: &entity.User{ID: math.MaxInt32}}); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchUser, err)
+	}
+
+	owner, err := r.rooms.GetRoomMember(ctx, lobby.ID, users[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if owner.Status != entity.RoomMemberJoined {
+		t.Fatalf("expected the owner to join the room, got %+v", owner)
+	}
+
+	// invite-only rooms are listed to their members only
+	expectStrings(t, "rooms of owner", []string{"lobby", "secret", "games"},
+		roomNames(r.rooms.GetRoomsPage(ctx, users[0].ID, entity.Page{Limit: 10})))
+	expectStrings(t, "rooms of other", []string{"lobby", "games"},
+		roomNames(r.rooms.GetRoomsPage(ctx, users[1].ID, entity.Page{Limit: 10})))
+
+	cursor := entity.RoomCursor(lobby)
+
+	expectStrings(t, "rooms of other after lobby", []string{"games"},
+		roomNames(r.rooms.GetRoomsPage(ctx, users[1].ID, entity.Page{After: &cursor, Limit: 10})))
+
+	if _, err = r.rooms.AddRoomMember(ctx, entity.RoomMember{RoomID: secret.ID, User: users[1], Status: entity.RoomMemberInvited}); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStrings(t, "rooms of invited other", []string{"lobby", "secret", "games"},
+		roomNames(r.rooms.GetRoomsPage(ctx, users[1].ID, entity.Page{Limit: 10})))
+}
+
+func checkRoomMembers(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "owner", "u1", "u2", "u3")
+	room := addRoom(t, r.rooms, users[0], "room", entity.RoomPublic)
+
+	for _, user := range users[1:] {
+		member, err := r.rooms.AddRoomMember(ctx, entity.RoomMember{RoomID: room.ID, User: user, Status: entity.RoomMemberInvited})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if member.Status != entity.RoomMemberInvited || !sameUser(member.User, user) {
+			t.Fatalf("expected %s invited, got %+v", user.Username, member)
+		}
+	}
+
+	_, err := r.rooms.AddRoomMember(ctx, entity.RoomMember{RoomID: room.ID, User: users[1], Status: entity.RoomMemberJoined})
+	if !errors.Is(err, ErrRoomMemberExists) {
+		t.Fatalf("expected %v, got %v", ErrRoomMemberExists, err)
+	}
+
+	_, err = r.rooms.AddRoomMember(ctx, entity.RoomMember{RoomID: math.MaxInt32, User: users[1], Status: entity.RoomMemberJoined})
+	if !errors.Is(err, ErrNoSuchRoom) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchRoom, err)
+	}
+
+	_, err = r.rooms.AddRoomMember(ctx, entity.RoomMember{RoomID: room.ID, User: &entity.User{ID: math.MaxInt32}, Status: entity.RoomMemberJoined})
+	if !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchUser, err)
+	}
+
+	for _, user := range users[1:3] {
+		member, err := r.rooms.SetRoomMemberStatus(ctx, room.ID, user.ID, entity.RoomMemberJoined)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if member.Status != entity.RoomMemberJoined {
+			t.Fatalf("expected %s joined, got %+v", user.Username, member)
+		}
+	}
+
+	if _, err = r.rooms.SetRoomMemberStatus(ctx, math.MaxInt32, users[1].ID, entity.RoomMemberJoined); !errors.Is(err, ErrNoSuchRoomMember) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchRoomMember, err)
+	}
+
+	cursor := func(i int) *entity.Cursor {
+		c := entity.UserCursor(users[i])
+		return &c
+	}
+
+	pages := []struct {
+		name     string
+		status   entity.RoomMemberStatus
+		page     entity.Page
+		expected []string
+	}{
+		{name: "joined", status: entity.RoomMemberJoined, page: entity.Page{Limit: 10}, expected: []string{"owner", "u1", "u2"}},
+		{name: "invited", status: entity.RoomMemberInvited, page: entity.Page{Limit: 10}, expected: []string{"u3"}},
+		{name: "joined after owner", status: entity.RoomMemberJoined, page: entity.Page{After: cursor(0), Limit: 1}, expected: []string{"u1"}},
+		{name: "joined before u2", status: entity.RoomMemberJoined, page: entity.Page{Before: cursor(2), Limit: 1}, expected: []string{"u1"}},
+	}
+
+	for _, page := range pages {
+		expectStrings(t, "members page "+page.name, page.expected,
+			memberNames(r.rooms.GetRoomMembersPage(ctx, room.ID, page.status, page.page)))
+	}
+
+	if err = r.rooms.DeleteRoomMember(ctx, room.ID, users[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.rooms.DeleteRoomMember(ctx, room.ID, users[1].ID); !errors.Is(err, ErrNoSuchRoomMember) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchRoomMember, err)
+	}
+
+	if _, err = r.rooms.GetRoomMember(ctx, room.ID, users[1].ID); !errors.Is(err, ErrNoSuchRoomMember) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchRoomMember, err)
+	}
+
+	expectStrings(t, "members after leaving", []string{"owner", "u2"},
+		memberNames(r.rooms.GetRoomMembersPage(ctx, room.ID, entity.RoomMemberJoined, entity.Page{Limit: 10})))
+}
+
+func checkRoomMessages(t *testing.T, r repos) {
+	ctx := context.Background()
+	users := addUsers(t, r.users, "owner")
+	rooms := []*entity.Room{
+		addRoom(t, r.rooms, users[0], "first", entity.RoomPublic),
+		addRoom(t, r.rooms, users[0], "second", entity.RoomPublic),
+	}
+
+	var cursors []entity.Cursor
+
+	for i := 1; i <= 5; i++ {
+		msg, err := r.roomMessages.AddRoomMessage(ctx, entity.RoomMessage{RoomID: rooms[0].ID, From: users[0], Content: fmt.Sprintf("m%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.RoomID != rooms[0].ID || msg.SentAt.IsZero() {
+			t.Fatalf("expected a message sent to %d, got %+v", rooms[0].ID, msg)
+		}
+
+		// messages of other rooms are in none of the pages
+		_, err = r.roomMessages.AddRoomMessage(ctx, entity.RoomMessage{RoomID: rooms[1].ID, From: users[0], Content: "other"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cursors = append(cursors, entity.RoomMessageCursor(msg))
+	}
+
+	_, err := r.roomMessages.AddRoomMessage(ctx, entity.RoomMessage{RoomID: math.MaxInt32, From: users[0], Content: "lost"})
+	if !errors.Is(err, ErrNoSuchRoom) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchRoom, err)
+	}
+
+	_, err = r.roomMessages.AddRoomMessage(ctx, entity.RoomMessage{RoomID: rooms[0].ID, From: &entity.User{ID: math.MaxInt32}, Content: "lost"})
+	if !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchUser, err)
+	}
+
+	pages := []struct {
+		name     string
+		page     entity.Page
+		expected []string
+	}{
+		{name: "first", page: entity.Page{Limit: 2}, expected: []string{"m1", "m2"}},
+		{name: "after m2", page: entity.Page{After: &cursors[1], Limit: 2}, expected: []string{"m3", "m4"}},
+		{name: "after m5", page: entity.Page{After: &cursors[4], Limit: 2}, expected: []string{}},
+		{name: "before m5", page: entity.Page{Before: &cursors[4], Limit: 2}, expected: []string{"m3", "m4"}},
+		{name: "before m2", page: entity.Page{Before: &cursors[1], Limit: 2}, expected: []string{"m1"}},
+	}
+
+	for _, page := range pages {
+		expectStrings(t, "room messages page "+page.name, page.expected,
+			contents(r.roomMessages.GetRoomMessagesPage(ctx, rooms[0].ID, page.page)))
+	}
+}
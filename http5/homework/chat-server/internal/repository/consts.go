@@ -4,4 +4,20 @@ const (
 	PrivateMessageTableName = "private_messages"
 	PublicMessageTableName  = "public_messages"
 	UserTableName           = "users"
+	SessionTableName        = "sessions"
+	RoomTableName           = "rooms"
+	RoomMemberTableName     = "room_members"
+	RoomMessageTableName    = "room_messages"
+
+	UserEmailIndexName    = "users_email_idx"
+	UserUsernameIndexName = "users_username_idx"
+
+	PrivateMessageToIndexName = "private_messages_to_idx"
+
+	SessionUserIndexName = "sessions_user_idx"
+
+	RoomNameIndexName        = "rooms_name_idx"
+	RoomMemberRoomIndexName  = "room_members_room_idx"
+	RoomMemberUserIndexName  = "room_members_user_idx"
+	RoomMessageRoomIndexName = "room_messages_room_idx"
 )
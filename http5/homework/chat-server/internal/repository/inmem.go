@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+// rowReader is implemented by both inmemory.InMemoryDB and inmemory.Transaction,
+// so helpers reading rows can be used inside and outside of transactions.
+type rowReader interface {
+	GetRow(table string, identifier string) (any, error)
+}
+
+// rowCursor returns the cursor of a row of a listing, it is false for rows of other types.
+type rowCursor func(row any) (entity.Cursor, bool)
+
+func publicMessageRowCursor(row any) (entity.Cursor, bool) {
+	msg, ok := row.(entity.PublicMessage)
+	return entity.PublicMessageCursor(&msg), ok
+}
+
+func privateMessageRowCursor(row any) (entity.Cursor, bool) {
+	msg, ok := row.(entity.PrivateMessage)
+	return entity.PrivateMessageCursor(&msg), ok
+}
+
+func roomMemberRowCursor(row any) (entity.Cursor, bool) {
+	member, ok := row.(entity.RoomMember)
+	if !ok || member.User == nil {
+		return entity.Cursor{}, false
+	}
+
+	return entity.RoomMemberCursor(&member), true
+}
+
+func roomMessageRowCursor(row any) (entity.Cursor, bool) {
+	msg, ok := row.(entity.RoomMessage)
+	return entity.RoomMessageCursor(&msg), ok
+}
+
+// seekInMemPage reads the page of rows of a table keyed by ID matching where, in the order of IDs.
+// Rows are looked up by key from the cursor of the page on, up to the counter of the table,
+// which no key is above, so only the rows up to the end of the page are read.
+func seekInMemPage(db inmemory.InMemoryDB, table string, page entity.Page, where func(row any) bool) []any {
+	var rows []any
+
+	err := db.Tx(func(tx inmemory.Transaction) error {
+		rows = nil
+
+		counter, err := tx.GetTableCounter(table)
+		if err != nil {
+			return err
+		}
+
+		first, last := 1, counter
+		if page.After != nil {
+			first = max(first, page.After.ID+1)
+		}
+
+		if page.Before != nil {
+			last = min(last, page.Before.ID-1)
+		}
+
+		// backward pages are read from their end
+		id, step := first, 1
+		if page.Backward() {
+			id, step = last, -1
+		}
+
+		for ; id >= first && id <= last && (page.Limit <= 0 || len(rows) < page.Limit); id += step {
+			row, err := tx.GetRow(table, strconv.Itoa(id))
+			if errors.Is(err, inmemory.ErrNotExistedRow) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if where == nil || where(row) {
+				rows = append(rows, row)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+
+	if page.Backward() {
+		slices.Reverse(rows)
+	}
+
+	return rows
+}
+
+// queryInMemPage reads the page of rows of the table matching the query, in the order of their cursors.
+// The whole table is scanned and sorted, listings ordered by ID alone are read by seekInMemPage.
+func queryInMemPage(db inmemory.InMemoryDB, table string, q inmemory.Query, page entity.Page, cursorOf rowCursor) []any {
+	where := q.Where
+
+	q.Where = func(row any) bool {
+		cursor, ok := cursorOf(row)
+		return ok && page.Contains(cursor.ID, cursor.At) && (where == nil || where(row))
+	}
+	q.OrderBy = func(a, b any) bool {
+		ca, _ := cursorOf(a)
+		cb, _ := cursorOf(b)
+
+		return cb.Compare(ca.ID, ca.At) < 0
+	}
+	// backward pages are read from their end
+	q.Desc = page.Backward()
+	q.Limit = page.Limit
+
+	res, err := db.Query(table, q)
+	if err != nil {
+		return nil
+	}
+
+	if page.Backward() {
+		slices.Reverse(res.Rows)
+	}
+
+	return res.Rows
+}
@@ -0,0 +1,36 @@
+CREATE TABLE users (
+    id              BIGSERIAL PRIMARY KEY,
+    email           TEXT        NOT NULL,
+    username        TEXT        NOT NULL,
+    hashed_password TEXT        NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    -- named after the in-memory indexes, so violations are mapped the same way
+    CONSTRAINT users_email_idx UNIQUE (email),
+    CONSTRAINT users_username_idx UNIQUE (username)
+);
+
+CREATE TABLE public_messages (
+    id        BIGSERIAL PRIMARY KEY,
+    from_id   BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    content   TEXT        NOT NULL,
+    sent_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    edited_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX public_messages_sent_at_idx ON public_messages (sent_at, id);
+CREATE INDEX public_messages_from_idx ON public_messages (from_id);
+
+CREATE TABLE private_messages (
+    id        BIGSERIAL PRIMARY KEY,
+    from_id   BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    to_id     BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    content   TEXT        NOT NULL,
+    sent_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    edited_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX private_messages_to_idx ON private_messages (to_id, sent_at, id);
+CREATE INDEX private_messages_from_idx ON private_messages (from_id);
+CREATE INDEX private_messages_sent_at_idx ON private_messages (sent_at, id);
@@ -0,0 +1,32 @@
+CREATE TABLE rooms (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    visibility TEXT        NOT NULL,
+    owner_id   BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    -- named after the in-memory index, so violations are mapped the same way
+    CONSTRAINT rooms_name_idx UNIQUE (name)
+);
+
+CREATE TABLE room_members (
+    room_id BIGINT      NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status  TEXT        NOT NULL,
+    since   TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT room_members_pkey PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX room_members_user_idx ON room_members (user_id);
+
+CREATE TABLE room_messages (
+    id        BIGSERIAL PRIMARY KEY,
+    room_id   BIGINT      NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    from_id   BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    content   TEXT        NOT NULL,
+    sent_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    edited_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX room_messages_room_idx ON room_messages (room_id, sent_at, id);
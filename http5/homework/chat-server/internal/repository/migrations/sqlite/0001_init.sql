@@ -0,0 +1,36 @@
+CREATE TABLE users (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    email           TEXT     NOT NULL,
+    username        TEXT     NOT NULL,
+    hashed_password TEXT     NOT NULL,
+    created_at      DATETIME NOT NULL,
+    updated_at      DATETIME NOT NULL
+);
+
+-- named after the in-memory indexes, so violations are mapped the same way
+CREATE UNIQUE INDEX users_email_idx ON users (email);
+CREATE UNIQUE INDEX users_username_idx ON users (username);
+
+CREATE TABLE public_messages (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_id   INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    content   TEXT     NOT NULL,
+    sent_at   DATETIME NOT NULL,
+    edited_at DATETIME NOT NULL
+);
+
+CREATE INDEX public_messages_sent_at_idx ON public_messages (sent_at, id);
+CREATE INDEX public_messages_from_idx ON public_messages (from_id);
+
+CREATE TABLE private_messages (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_id   INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    to_id     INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    content   TEXT     NOT NULL,
+    sent_at   DATETIME NOT NULL,
+    edited_at DATETIME NOT NULL
+);
+
+CREATE INDEX private_messages_to_idx ON private_messages (to_id, sent_at, id);
+CREATE INDEX private_messages_from_idx ON private_messages (from_id, sent_at);
+CREATE INDEX private_messages_sent_at_idx ON private_messages (sent_at, id);
@@ -0,0 +1,31 @@
+CREATE TABLE rooms (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT     NOT NULL,
+    visibility TEXT     NOT NULL,
+    owner_id   INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX rooms_name_idx ON rooms (name);
+
+CREATE TABLE room_members (
+    room_id INTEGER  NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    user_id INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status  TEXT     NOT NULL,
+    since   DATETIME NOT NULL,
+
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX room_members_user_idx ON room_members (user_id);
+
+CREATE TABLE room_messages (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    room_id   INTEGER  NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+    from_id   INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    content   TEXT     NOT NULL,
+    sent_at   DATETIME NOT NULL,
+    edited_at DATETIME NOT NULL
+);
+
+CREATE INDEX room_messages_room_idx ON room_messages (room_id, sent_at, id);
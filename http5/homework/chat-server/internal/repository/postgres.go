@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	// registers the pgx driver for database/sql
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/migrate"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+
+	roomMemberPrimaryKey = "room_members_pkey"
+)
+
+// OpenPostgres connects to the database at dsn and applies the migrations it lacks.
+func OpenPostgres(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	migrations, err := fs.Sub(postgresMigrations, "migrations/postgres")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err = migrate.Up(ctx, db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// postgresKeyset reads pages of rows ordered by the columns in PostgreSQL.
+func postgresKeyset(columns []string) keyset {
+	return keyset{columns: columns, placeholder: func(n int) string { return "$" + strconv.Itoa(n) }}
+}
+
+// mapPostgresError turns constraint violations into the errors the in-memory repositories return.
+func mapPostgresError(err error) error {
+	var pgErr *pgconn.PgError
+
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		switch pgErr.ConstraintName {
+		case UserEmailIndexName:
+			return ErrEmailExists
+		case UserUsernameIndexName:
+			return ErrUsernameExists
+		case RoomNameIndexName:
+			return ErrRoomNameExists
+		case roomMemberPrimaryKey:
+			return ErrRoomMemberExists
+		}
+	case pgForeignKeyViolation:
+		return ErrNoSuchUser
+	}
+
+	return err
+}
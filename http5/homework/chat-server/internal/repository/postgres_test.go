@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+// postgresDSNEnv points the tests to a disposable database, they are skipped without it.
+// All tables of the database are truncated by every test.
+const postgresDSNEnv = "CHAT_TEST_POSTGRES_DSN"
+
+func initPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	db, err := OpenPostgres(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`TRUNCATE users, public_messages, private_messages RESTART IDENTITY CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// messages are removed along with their users, the in-memory repositories keep them
+func TestPostgresDeleteUserRemovesMessages(t *testing.T) {
+	ctx := context.Background()
+	db := initPostgres(t)
+
+	userRepo := NewPostgresUserRepo(db)
+	users := addUsers(t, userRepo, "first", "second")
+	publicRepo := NewPostgresPublicMessageRepo(db)
+	privateRepo := NewPostgresPrivateMessageRepo(db)
+
+	if _, err := publicRepo.AddPublicMessage(ctx, entity.PublicMessage{From: users[0], Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := privateRepo.AddPrivateMessage(ctx, entity.PrivateMessage{From: users[1], To: users[0], Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := userRepo.DeleteUser(ctx, users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if msgs := publicRepo.GetAllPublicMessages(ctx, 0, 10); len(msgs) != 0 {
+		t.Fatalf("expected public messages of deleted user to be removed, got %v", contents(msgs))
+	}
+
+	if msgs := privateRepo.GetAllPrivateMessages(ctx, 0, 10); len(msgs) != 0 {
+		t.Fatalf("expected private messages to deleted user to be removed, got %v", contents(msgs))
+	}
+}
@@ -4,9 +4,7 @@ package repository
 import (
 	"context"
 	"errors"
-	"sort"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
@@ -15,74 +13,173 @@ import (
 )
 
 type PrivateMessageInMemRepo struct {
-	DB    inmemory.InMemoryDB
-	mutex sync.RWMutex
+	DB inmemory.InMemoryDB
 }
 
-func NewInMemPrivateMessageRepo(db inmemory.InMemoryDB) *PrivateMessageInMemRepo {
+func NewInMemPrivateMessageRepo(db inmemory.InMemoryDB) (*PrivateMessageInMemRepo, error) {
 	repo := PrivateMessageInMemRepo{
-		DB:    db,
-		mutex: sync.RWMutex{},
+		DB: db,
 	}
 
 	_, err := repo.DB.GetTable(PrivateMessageTableName)
 	if errors.Is(err, inmemory.ErrNotExistedTable) {
-		repo.DB.CreateTable(PrivateMessageTableName)
+		if err = repo.DB.CreateTable(PrivateMessageTableName); err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.DB.CreateIndex(PrivateMessageTableName, inmemory.IndexSpec{Name: PrivateMessageToIndexName, Key: privateMessageTo})
+	if err != nil {
+		return nil, err
 	}
 
-	return &repo
+	return &repo, nil
 }
 
-func (pr *PrivateMessageInMemRepo) AddPrivateMessage(_ context.Context, msg entity.PrivateMessage) (*entity.PrivateMessage, error) {
-	pr.mutex.Lock()
-	defer pr.mutex.Unlock()
+func privateMessageTo(row any) (string, bool) {
+	msg, ok := row.(entity.PrivateMessage)
+	if !ok || msg.To == nil {
+		return "", false
+	}
 
-	idOffset, err := pr.DB.GetTableCounter(PrivateMessageTableName)
-	if err != nil {
-		return nil, err
+	return strconv.Itoa(msg.To.ID), true
+}
+
+func privateMessagesFromRows(rows []any) []*entity.PrivateMessage {
+	res := make([]*entity.PrivateMessage, 0, len(rows))
+
+	for _, row := range rows {
+		msg, ok := row.(entity.PrivateMessage)
+		if ok {
+			res = append(res, &msg)
+		}
 	}
 
-	now := time.Now()
+	return res
+}
+
+func (pr *PrivateMessageInMemRepo) AddPrivateMessage(_ context.Context, msg entity.PrivateMessage) (*entity.PrivateMessage, error) {
+	err := pr.DB.Tx(func(tx inmemory.Transaction) error {
+		// the message is committed only if both users still exist
+		if _, err := getUserByID(tx, msg.From.ID); err != nil {
+			return err
+		}
+
+		if _, err := getUserByID(tx, msg.To.ID); err != nil {
+			return err
+		}
+
+		id, err := tx.NextID(PrivateMessageTableName)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
 
-	msg.ID = idOffset + 1
-	msg.SentAt = now
-	msg.EditedAt = now
+		msg.ID = id
+		msg.SentAt = now
+		msg.EditedAt = now
 
-	if err = pr.DB.AddRow(PrivateMessageTableName, strconv.Itoa(msg.ID), msg); err != nil {
+		return tx.AddRow(PrivateMessageTableName, strconv.Itoa(msg.ID), msg)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &msg, nil
 }
 
-func (pr *PrivateMessageInMemRepo) getAllPrivateMessages(_ context.Context, offset, limit int) []*entity.PrivateMessage {
-	rows, err := pr.DB.GetAllRows(PrivateMessageTableName, offset, limit)
+func (pr *PrivateMessageInMemRepo) GetAllPrivateMessages(_ context.Context, offset, limit int) []*entity.PrivateMessage {
+	res, err := pr.DB.Query(PrivateMessageTableName, inmemory.Query{
+		OrderBy: inmemory.FieldLess("SentAt"),
+		Offset:  offset,
+		Limit:   limit,
+	})
 	if err != nil {
 		return nil
 	}
 
-	res := make([]*entity.PrivateMessage, 0, len(rows))
+	return privateMessagesFromRows(res.Rows)
+}
 
-	for _, row := range rows {
-		msg, ok := row.(entity.PrivateMessage)
-		if ok {
-			res = append(res, &msg)
-		}
+func (pr *PrivateMessageInMemRepo) GetAllPrivateMessagesTo(_ context.Context, toID int, offset, limit int) []*entity.PrivateMessage {
+	res, err := pr.DB.Query(PrivateMessageTableName, inmemory.Query{
+		Index:      PrivateMessageToIndexName,
+		IndexValue: strconv.Itoa(toID),
+		OrderBy:    inmemory.FieldLess("SentAt"),
+		Offset:     offset,
+		Limit:      limit,
+	})
+	if err != nil {
+		return nil
 	}
 
-	sort.Slice(res, func(i, j int) bool { return res[i].SentAt.Before(res[j].SentAt) })
+	return privateMessagesFromRows(res.Rows)
+}
 
-	return res
+// GetPrivateMessagesToPage returns the page of messages to the user ordered by the time they were sent.
+func (pr *PrivateMessageInMemRepo) GetPrivateMessagesToPage(_ context.Context, toID int, page entity.Page) []*entity.PrivateMessage {
+	rows := queryInMemPage(pr.DB, PrivateMessageTableName, inmemory.Query{
+		Index:      PrivateMessageToIndexName,
+		IndexValue: strconv.Itoa(toID),
+	}, page, privateMessageRowCursor)
+
+	return privateMessagesFromRows(rows)
+}
+
+// GetPrivateMessagesFromUserPage returns the page of messages from one user to another ordered by the time they were sent.
+func (pr *PrivateMessageInMemRepo) GetPrivateMessagesFromUserPage(_ context.Context, toID, fromID int, page entity.Page) []*entity.PrivateMessage {
+	rows := queryInMemPage(pr.DB, PrivateMessageTableName, inmemory.Query{
+		Index:      PrivateMessageToIndexName,
+		IndexValue: strconv.Itoa(toID),
+		Where: func(row any) bool {
+			msg, ok := row.(entity.PrivateMessage)
+			return ok && msg.From != nil && msg.From.ID == fromID
+		},
+	}, page, privateMessageRowCursor)
+
+	return privateMessagesFromRows(rows)
+}
+
+// GetPrivateMessagesToAfter returns up to limit messages to the user having IDs greater than afterID, ordered by ID.
+func (pr *PrivateMessageInMemRepo) GetPrivateMessagesToAfter(_ context.Context, toID, afterID, limit int) []*entity.PrivateMessage {
+	res, err := pr.DB.Query(PrivateMessageTableName, inmemory.Query{
+		Index:      PrivateMessageToIndexName,
+		IndexValue: strconv.Itoa(toID),
+		Where: func(row any) bool {
+			msg, ok := row.(entity.PrivateMessage)
+			return ok && msg.ID > afterID
+		},
+		OrderBy: inmemory.FieldLess("ID"),
+		Limit:   limit,
+	})
+	if err != nil {
+		return nil
+	}
+
+	return privateMessagesFromRows(res.Rows)
 }
 
-func (pr *PrivateMessageInMemRepo) GetAllPrivateMessages(ctx context.Context, offset, limit int) []*entity.PrivateMessage {
-	pr.mutex.RLock()
-	defer pr.mutex.RUnlock()
+func (pr *PrivateMessageInMemRepo) GetAllPrivateMessagesFromUser(_ context.Context, toID, fromID int, offset, limit int) []*entity.PrivateMessage {
+	res, err := pr.DB.Query(PrivateMessageTableName, inmemory.Query{
+		Index:      PrivateMessageToIndexName,
+		IndexValue: strconv.Itoa(toID),
+		Where: func(row any) bool {
+			msg, ok := row.(entity.PrivateMessage)
+			return ok && msg.From != nil && msg.From.ID == fromID
+		},
+		OrderBy: inmemory.FieldLess("SentAt"),
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		return nil
+	}
 
-	return pr.getAllPrivateMessages(ctx, offset, limit)
+	return privateMessagesFromRows(res.Rows)
 }
 
-func (pr *PrivateMessageInMemRepo) getPrivateMessage(_ context.Context, id int) (*entity.PrivateMessage, error) {
+func (pr *PrivateMessageInMemRepo) GetPrivateMessage(_ context.Context, id int) (*entity.PrivateMessage, error) {
 	row, err := pr.DB.GetRow(PrivateMessageTableName, strconv.Itoa(id))
 	if err != nil {
 		return nil, ErrNoSuchPrivateMessage
@@ -96,9 +193,17 @@ func (pr *PrivateMessageInMemRepo) getPrivateMessage(_ context.Context, id int)
 	return &msg, nil
 }
 
-func (pr *PrivateMessageInMemRepo) GetPrivateMessage(ctx context.Context, id int) (*entity.PrivateMessage, error) {
-	pr.mutex.RLock()
-	defer pr.mutex.RUnlock()
+func (pr *PrivateMessageInMemRepo) DeletePrivateMessage(_ context.Context, id int) error {
+	err := pr.DB.Tx(func(tx inmemory.Transaction) error {
+		if _, err := tx.GetRow(PrivateMessageTableName, strconv.Itoa(id)); err != nil {
+			return err
+		}
+
+		return tx.DropRow(PrivateMessageTableName, strconv.Itoa(id))
+	})
+	if err != nil {
+		return ErrNoSuchPrivateMessage
+	}
 
-	return pr.getPrivateMessage(ctx, id)
+	return nil
 }
@@ -0,0 +1,84 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type PrivateMessagePostgresRepo struct {
+	DB *sql.DB
+}
+
+func NewPostgresPrivateMessageRepo(db *sql.DB) *PrivateMessagePostgresRepo {
+	return &PrivateMessagePostgresRepo{
+		DB: db,
+	}
+}
+
+func (pr *PrivateMessagePostgresRepo) AddPrivateMessage(ctx context.Context, msg entity.PrivateMessage) (*entity.PrivateMessage, error) {
+	row := pr.DB.QueryRowContext(ctx,
+		`INSERT INTO private_messages (from_id, to_id, content) VALUES ($1, $2, $3) RETURNING id, sent_at, edited_at`,
+		msg.From.ID, msg.To.ID, msg.Content)
+
+	if err := row.Scan(&msg.ID, &msg.SentAt, &msg.EditedAt); err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	return &msg, nil
+}
+
+func (pr *PrivateMessagePostgresRepo) GetAllPrivateMessages(ctx context.Context, offset, limit int) []*entity.PrivateMessage {
+	return queryRows(ctx, pr.DB, scanPrivateMessage,
+		privateMessagesQuery(`ORDER BY m.sent_at, m.id LIMIT $1 OFFSET $2`), limit, offset)
+}
+
+func (pr *PrivateMessagePostgresRepo) GetAllPrivateMessagesTo(ctx context.Context, toID int, offset, limit int) []*entity.PrivateMessage {
+	return queryRows(ctx, pr.DB, scanPrivateMessage,
+		privateMessagesQuery(`WHERE m.to_id = $1 ORDER BY m.sent_at, m.id LIMIT $2 OFFSET $3`), toID, limit, offset)
+}
+
+func (pr *PrivateMessagePostgresRepo) GetPrivateMessagesToPage(ctx context.Context, toID int, page entity.Page) []*entity.PrivateMessage {
+	return queryPage(ctx, pr.DB, scanPrivateMessage, privateMessagesQuery, postgresKeyset(messageKeyColumns), page,
+		[]string{"m.to_id = $1"}, toID)
+}
+
+func (pr *PrivateMessagePostgresRepo) GetPrivateMessagesFromUserPage(ctx context.Context, toID, fromID int, page entity.Page) []*entity.PrivateMessage {
+	return queryPage(ctx, pr.DB, scanPrivateMessage, privateMessagesQuery, postgresKeyset(messageKeyColumns), page,
+		[]string{"m.to_id = $1", "m.from_id = $2"}, toID, fromID)
+}
+
+func (pr *PrivateMessagePostgresRepo) GetPrivateMessagesToAfter(ctx context.Context, toID, afterID, limit int) []*entity.PrivateMessage {
+	return queryRows(ctx, pr.DB, scanPrivateMessage,
+		privateMessagesQuery(`WHERE m.to_id = $1 AND m.id > $2 ORDER BY m.id LIMIT $3`), toID, afterID, limit)
+}
+
+func (pr *PrivateMessagePostgresRepo) GetAllPrivateMessagesFromUser(ctx context.Context, toID, fromID int, offset, limit int) []*entity.PrivateMessage {
+	return queryRows(ctx, pr.DB, scanPrivateMessage,
+		privateMessagesQuery(`WHERE m.to_id = $1 AND m.from_id = $2 ORDER BY m.sent_at, m.id LIMIT $3 OFFSET $4`),
+		toID, fromID, limit, offset)
+}
+
+func (pr *PrivateMessagePostgresRepo) GetPrivateMessage(ctx context.Context, id int) (*entity.PrivateMessage, error) {
+	msg, err := scanPrivateMessage(pr.DB.QueryRowContext(ctx, privateMessagesQuery(`WHERE m.id = $1`), id))
+	if err != nil {
+		return nil, ErrNoSuchPrivateMessage
+	}
+
+	return msg, nil
+}
+
+func (pr *PrivateMessagePostgresRepo) DeletePrivateMessage(ctx context.Context, id int) error {
+	res, err := pr.DB.ExecContext(ctx, `DELETE FROM private_messages WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := res.RowsAffected(); err != nil || deleted == 0 {
+		return ErrNoSuchPrivateMessage
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type PrivateMessageSQLiteRepo struct {
+	DB *sql.DB
+}
+
+func NewSQLitePrivateMessageRepo(db *sql.DB) *PrivateMessageSQLiteRepo {
+	return &PrivateMessageSQLiteRepo{
+		DB: db,
+	}
+}
+
+func (pr *PrivateMessageSQLiteRepo) AddPrivateMessage(ctx context.Context, msg entity.PrivateMessage) (*entity.PrivateMessage, error) {
+	now := sqliteNow()
+
+	msg.SentAt = now
+	msg.EditedAt = now
+
+	row := pr.DB.QueryRowContext(ctx,
+		`INSERT INTO private_messages (from_id, to_id, content, sent_at, edited_at) VALUES (?, ?, ?, ?, ?) RETURNING id`,
+		msg.From.ID, msg.To.ID, msg.Content, msg.SentAt, msg.EditedAt)
+
+	if err := row.Scan(&msg.ID); err != nil {
+		return nil, mapSQLiteError(err)
+	}
+
+	return &msg, nil
+}
+
+func (pr *PrivateMessageSQLiteRepo) GetAllPrivateMessages(ctx context.Context, offset, limit int) []*entity.PrivateMessage {
+	return queryRows(ctx, pr.DB, scanPrivateMessage,
+		privateMessagesQuery(`ORDER BY m.sent_at, m.id LIMIT ? OFFSET ?`), limit, offset)
+}
+
+func (pr *PrivateMessageSQLiteRepo) GetAllPrivateMessagesTo(ctx context.Context, toID int, offset, limit int) []*entity.PrivateMessage {
+	return queryRows(ctx, pr.DB, scanPrivateMessage,
+		privateMessagesQuery(`WHERE m.to_id = ? ORDER BY m.sent_at, m.id LIMIT ? OFFSET ?`), toID, limit, offset)
+}
+
+func (pr *PrivateMessageSQLiteRepo) GetPrivateMessagesToPage(ctx context.Context, toID int, page entity.Page) []*entity.PrivateMessage {
+	return queryPage(ctx, pr.DB, scanPrivateMessage, privateMessagesQuery, sqliteKeyset(messageKeyColumns), page,
+		[]string{"m.to_id = ?"}, toID)
+}
+
+func (pr *PrivateMessageSQLiteRepo) GetPrivateMessagesFromUserPage(ctx context.Context, toID, fromID int, page entity.Page) []*entity.PrivateMessage {
+	return queryPage(ctx, pr.DB, scanPrivateMessage, privateMessagesQuery, sqliteKeyset(messageKeyColumns), page,
+		[]string{"m.to_id = ?", "m.from_id = ?"}, toID, fromID)
+}
+
+func (pr *PrivateMessageSQLiteRepo) GetPrivateMessagesToAfter(ctx context.Context, toID, afterID, limit int) []*entity.PrivateMessage {
+	return queryRows(ctx, pr.DB, scanPrivateMessage,
+		privateMessagesQuery(`WHERE m.to_id = ? AND m.id > ? ORDER BY m.id LIMIT ?`), toID, afterID, limit)
+}
+
+func (pr *PrivateMessageSQLiteRepo) GetAllPrivateMessagesFromUser(ctx context.Context, toID, fromID int, offset, limit int) []*entity.PrivateMessage {
+	return queryRows(ctx, pr.DB, scanPrivateMessage,
+		privateMessagesQuery(`WHERE m.to_id = ? AND m.from_id = ? ORDER BY m.sent_at, m.id LIMIT ? OFFSET ?`),
+		toID, fromID, limit, offset)
+}
+
+func (pr *PrivateMessageSQLiteRepo) GetPrivateMessage(ctx context.Context, id int) (*entity.PrivateMessage, error) {
+	msg, err := scanPrivateMessage(pr.DB.QueryRowContext(ctx, privateMessagesQuery(`WHERE m.id = ?`), id))
+	if err != nil {
+		return nil, ErrNoSuchPrivateMessage
+	}
+
+	return msg, nil
+}
+
+func (pr *PrivateMessageSQLiteRepo) DeletePrivateMessage(ctx context.Context, id int) error {
+	res, err := pr.DB.ExecContext(ctx, `DELETE FROM private_messages WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := res.RowsAffected(); err != nil || deleted == 0 {
+		return ErrNoSuchPrivateMessage
+	}
+
+	return nil
+}
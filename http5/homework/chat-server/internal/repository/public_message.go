@@ -4,9 +4,7 @@ package repository
 import (
 	"context"
 	"errors"
-	"sort"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
@@ -15,74 +13,116 @@ import (
 )
 
 type PublicMessageInMemRepo struct {
-	DB    inmemory.InMemoryDB
-	mutex sync.RWMutex
+	DB inmemory.InMemoryDB
 }
 
-func NewInMemPublicMessageRepo(db inmemory.InMemoryDB) *PublicMessageInMemRepo {
+func NewInMemPublicMessageRepo(db inmemory.InMemoryDB) (*PublicMessageInMemRepo, error) {
 	repo := PublicMessageInMemRepo{
-		DB:    db,
-		mutex: sync.RWMutex{},
+		DB: db,
 	}
 
 	_, err := repo.DB.GetTable(PublicMessageTableName)
 	if errors.Is(err, inmemory.ErrNotExistedTable) {
-		repo.DB.CreateTable(PublicMessageTableName)
+		if err = repo.DB.CreateTable(PublicMessageTableName); err != nil {
+			return nil, err
+		}
 	}
 
-	return &repo
+	return &repo, nil
 }
 
 func (pr *PublicMessageInMemRepo) AddPublicMessage(_ context.Context, msg entity.PublicMessage) (*entity.PublicMessage, error) {
-	pr.mutex.Lock()
-	defer pr.mutex.Unlock()
+	err := pr.DB.Tx(func(tx inmemory.Transaction) error {
+		// the message is committed only if its sender still exists
+		if _, err := getUserByID(tx, msg.From.ID); err != nil {
+			return err
+		}
 
-	idOffset, err := pr.DB.GetTableCounter(PublicMessageTableName)
-	if err != nil {
-		return nil, err
-	}
+		id, err := tx.NextID(PublicMessageTableName)
+		if err != nil {
+			return err
+		}
 
-	now := time.Now()
+		now := time.Now()
 
-	msg.ID = idOffset + 1
-	msg.SentAt = now
-	msg.EditedAt = now
+		msg.ID = id
+		msg.SentAt = now
+		msg.EditedAt = now
 
-	if err = pr.DB.AddRow(PublicMessageTableName, strconv.Itoa(msg.ID), msg); err != nil {
+		return tx.AddRow(PublicMessageTableName, strconv.Itoa(msg.ID), msg)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &msg, nil
 }
 
-func (pr *PublicMessageInMemRepo) getAllPublicMessages(_ context.Context, offset, limit int) []*entity.PublicMessage {
-	rows, err := pr.DB.GetAllRows(PublicMessageTableName, offset, limit)
+func (pr *PublicMessageInMemRepo) GetAllPublicMessages(_ context.Context, offset, limit int) []*entity.PublicMessage {
+	page, err := pr.DB.Query(PublicMessageTableName, inmemory.Query{
+		OrderBy: inmemory.FieldLess("SentAt"),
+		Offset:  offset,
+		Limit:   limit,
+	})
 	if err != nil {
 		return nil
 	}
 
-	res := make([]*entity.PublicMessage, 0, len(rows))
+	res := make([]*entity.PublicMessage, 0, len(page.Rows))
 
-	for _, row := range rows {
+	for _, row := range page.Rows {
 		msg, ok := row.(entity.PublicMessage)
 		if ok {
 			res = append(res, &msg)
 		}
 	}
 
-	sort.Slice(res, func(i, j int) bool { return res[i].SentAt.Before(res[j].SentAt) })
+	return res
+}
+
+// GetPublicMessagesAfter returns up to limit messages having IDs greater than afterID, ordered by ID.
+func (pr *PublicMessageInMemRepo) GetPublicMessagesAfter(_ context.Context, afterID, limit int) []*entity.PublicMessage {
+	page, err := pr.DB.Query(PublicMessageTableName, inmemory.Query{
+		Where: func(row any) bool {
+			msg, ok := row.(entity.PublicMessage)
+			return ok && msg.ID > afterID
+		},
+		OrderBy: inmemory.FieldLess("ID"),
+		Limit:   limit,
+	})
+	if err != nil {
+		return nil
+	}
+
+	res := make([]*entity.PublicMessage, 0, len(page.Rows))
+
+	for _, row := range page.Rows {
+		msg, ok := row.(entity.PublicMessage)
+		if ok {
+			res = append(res, &msg)
+		}
+	}
 
 	return res
 }
 
-func (pr *PublicMessageInMemRepo) GetAllPublicMessages(ctx context.Context, offset, limit int) []*entity.PublicMessage {
-	pr.mutex.RLock()
-	defer pr.mutex.RUnlock()
+// GetPublicMessagesPage returns the page of messages ordered by the time they were sent.
+func (pr *PublicMessageInMemRepo) GetPublicMessagesPage(_ context.Context, page entity.Page) []*entity.PublicMessage {
+	rows := queryInMemPage(pr.DB, PublicMessageTableName, inmemory.Query{}, page, publicMessageRowCursor)
+
+	res := make([]*entity.PublicMessage, 0, len(rows))
+
+	for _, row := range rows {
+		msg, ok := row.(entity.PublicMessage)
+		if ok {
+			res = append(res, &msg)
+		}
+	}
 
-	return pr.getAllPublicMessages(ctx, offset, limit)
+	return res
 }
 
-func (pr *PublicMessageInMemRepo) getPublicMessage(_ context.Context, id int) (*entity.PublicMessage, error) {
+func (pr *PublicMessageInMemRepo) GetPublicMessage(_ context.Context, id int) (*entity.PublicMessage, error) {
 	row, err := pr.DB.GetRow(PublicMessageTableName, strconv.Itoa(id))
 	if err != nil {
 		return nil, ErrNoSuchPublicMessage
@@ -96,9 +136,17 @@ func (pr *PublicMessageInMemRepo) getPublicMessage(_ context.Context, id int) (*
 	return &msg, nil
 }
 
-func (pr *PublicMessageInMemRepo) GetPublicMessage(ctx context.Context, id int) (*entity.PublicMessage, error) {
-	pr.mutex.RLock()
-	defer pr.mutex.RUnlock()
+func (pr *PublicMessageInMemRepo) DeletePublicMessage(_ context.Context, id int) error {
+	err := pr.DB.Tx(func(tx inmemory.Transaction) error {
+		if _, err := tx.GetRow(PublicMessageTableName, strconv.Itoa(id)); err != nil {
+			return err
+		}
+
+		return tx.DropRow(PublicMessageTableName, strconv.Itoa(id))
+	})
+	if err != nil {
+		return ErrNoSuchPublicMessage
+	}
 
-	return pr.getPublicMessage(ctx, id)
+	return nil
 }
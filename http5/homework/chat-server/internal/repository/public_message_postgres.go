@@ -0,0 +1,65 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type PublicMessagePostgresRepo struct {
+	DB *sql.DB
+}
+
+func NewPostgresPublicMessageRepo(db *sql.DB) *PublicMessagePostgresRepo {
+	return &PublicMessagePostgresRepo{
+		DB: db,
+	}
+}
+
+func (pr *PublicMessagePostgresRepo) AddPublicMessage(ctx context.Context, msg entity.PublicMessage) (*entity.PublicMessage, error) {
+	row := pr.DB.QueryRowContext(ctx,
+		`INSERT INTO public_messages (from_id, content) VALUES ($1, $2) RETURNING id, sent_at, edited_at`,
+		msg.From.ID, msg.Content)
+
+	if err := row.Scan(&msg.ID, &msg.SentAt, &msg.EditedAt); err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	return &msg, nil
+}
+
+func (pr *PublicMessagePostgresRepo) GetAllPublicMessages(ctx context.Context, offset, limit int) []*entity.PublicMessage {
+	return queryRows(ctx, pr.DB, scanPublicMessage, publicMessagesQuery(`ORDER BY m.sent_at, m.id LIMIT $1 OFFSET $2`), limit, offset)
+}
+
+func (pr *PublicMessagePostgresRepo) GetPublicMessagesAfter(ctx context.Context, afterID, limit int) []*entity.PublicMessage {
+	return queryRows(ctx, pr.DB, scanPublicMessage, publicMessagesQuery(`WHERE m.id > $1 ORDER BY m.id LIMIT $2`), afterID, limit)
+}
+
+func (pr *PublicMessagePostgresRepo) GetPublicMessagesPage(ctx context.Context, page entity.Page) []*entity.PublicMessage {
+	return queryPage(ctx, pr.DB, scanPublicMessage, publicMessagesQuery, postgresKeyset(messageKeyColumns), page, nil)
+}
+
+func (pr *PublicMessagePostgresRepo) GetPublicMessage(ctx context.Context, id int) (*entity.PublicMessage, error) {
+	msg, err := scanPublicMessage(pr.DB.QueryRowContext(ctx, publicMessagesQuery(`WHERE m.id = $1`), id))
+	if err != nil {
+		return nil, ErrNoSuchPublicMessage
+	}
+
+	return msg, nil
+}
+
+func (pr *PublicMessagePostgresRepo) DeletePublicMessage(ctx context.Context, id int) error {
+	res, err := pr.DB.ExecContext(ctx, `DELETE FROM public_messages WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := res.RowsAffected(); err != nil || deleted == 0 {
+		return ErrNoSuchPublicMessage
+	}
+
+	return nil
+}
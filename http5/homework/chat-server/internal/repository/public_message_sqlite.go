@@ -0,0 +1,70 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type PublicMessageSQLiteRepo struct {
+	DB *sql.DB
+}
+
+func NewSQLitePublicMessageRepo(db *sql.DB) *PublicMessageSQLiteRepo {
+	return &PublicMessageSQLiteRepo{
+		DB: db,
+	}
+}
+
+func (pr *PublicMessageSQLiteRepo) AddPublicMessage(ctx context.Context, msg entity.PublicMessage) (*entity.PublicMessage, error) {
+	now := sqliteNow()
+
+	msg.SentAt = now
+	msg.EditedAt = now
+
+	row := pr.DB.QueryRowContext(ctx,
+		`INSERT INTO public_messages (from_id, content, sent_at, edited_at) VALUES (?, ?, ?, ?) RETURNING id`,
+		msg.From.ID, msg.Content, msg.SentAt, msg.EditedAt)
+
+	if err := row.Scan(&msg.ID); err != nil {
+		return nil, mapSQLiteError(err)
+	}
+
+	return &msg, nil
+}
+
+func (pr *PublicMessageSQLiteRepo) GetAllPublicMessages(ctx context.Context, offset, limit int) []*entity.PublicMessage {
+	return queryRows(ctx, pr.DB, scanPublicMessage, publicMessagesQuery(`ORDER BY m.sent_at, m.id LIMIT ? OFFSET ?`), limit, offset)
+}
+
+func (pr *PublicMessageSQLiteRepo) GetPublicMessagesAfter(ctx context.Context, afterID, limit int) []*entity.PublicMessage {
+	return queryRows(ctx, pr.DB, scanPublicMessage, publicMessagesQuery(`WHERE m.id > ? ORDER BY m.id LIMIT ?`), afterID, limit)
+}
+
+func (pr *PublicMessageSQLiteRepo) GetPublicMessagesPage(ctx context.Context, page entity.Page) []*entity.PublicMessage {
+	return queryPage(ctx, pr.DB, scanPublicMessage, publicMessagesQuery, sqliteKeyset(messageKeyColumns), page, nil)
+}
+
+func (pr *PublicMessageSQLiteRepo) GetPublicMessage(ctx context.Context, id int) (*entity.PublicMessage, error) {
+	msg, err := scanPublicMessage(pr.DB.QueryRowContext(ctx, publicMessagesQuery(`WHERE m.id = ?`), id))
+	if err != nil {
+		return nil, ErrNoSuchPublicMessage
+	}
+
+	return msg, nil
+}
+
+func (pr *PublicMessageSQLiteRepo) DeletePublicMessage(ctx context.Context, id int) error {
+	res, err := pr.DB.ExecContext(ctx, `DELETE FROM public_messages WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := res.RowsAffected(); err != nil || deleted == 0 {
+		return ErrNoSuchPublicMessage
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+// RoomInMemRepo keeps rooms and their members, members are stored by the room and user IDs together.
+type RoomInMemRepo struct {
+	DB inmemory.InMemoryDB
+}
+
+func NewInMemRoomRepo(db inmemory.InMemoryDB) (*RoomInMemRepo, error) {
+	repo := RoomInMemRepo{
+		DB: db,
+	}
+
+	for _, table := range []string{RoomTableName, RoomMemberTableName} {
+		_, err := repo.DB.GetTable(table)
+		if errors.Is(err, inmemory.ErrNotExistedTable) {
+			if err = repo.DB.CreateTable(table); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err := repo.DB.CreateIndex(RoomTableName, inmemory.IndexSpec{Name: RoomNameIndexName, Unique: true, Key: roomName})
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.DB.CreateIndex(RoomMemberTableName, inmemory.IndexSpec{Name: RoomMemberRoomIndexName, Key: roomMemberRoom})
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.DB.CreateIndex(RoomMemberTableName, inmemory.IndexSpec{Name: RoomMemberUserIndexName, Key: roomMemberUser})
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+func roomName(row any) (string, bool) {
+	room, ok := row.(entity.Room)
+	return room.Name, ok
+}
+
+func roomMemberRoom(row any) (string, bool) {
+	member, ok := row.(entity.RoomMember)
+	return strconv.Itoa(member.RoomID), ok
+}
+
+func roomMemberUser(row any) (string, bool) {
+	member, ok := row.(entity.RoomMember)
+	if !ok || member.User == nil {
+		return "", false
+	}
+
+	return strconv.Itoa(member.User.ID), true
+}
+
+func roomMemberKey(roomID, userID int) string {
+	return strconv.Itoa(roomID) + ":" + strconv.Itoa(userID)
+}
+
+func getRoom(reader rowReader, id int) (*entity.Room, error) {
+	row, err := reader.GetRow(RoomTableName, strconv.Itoa(id))
+	if err != nil {
+		return nil, ErrNoSuchRoom
+	}
+
+	room, ok := row.(entity.Room)
+	if !ok {
+		return nil, ErrNoSuchRoom
+	}
+
+	return &room, nil
+}
+
+func getRoomMember(reader rowReader, roomID, userID int) (*entity.RoomMember, error) {
+	row, err := reader.GetRow(RoomMemberTableName, roomMemberKey(roomID, userID))
+	if err != nil {
+		return nil, ErrNoSuchRoomMember
+	}
+
+	member, ok := row.(entity.RoomMember)
+	if !ok {
+		return nil, ErrNoSuchRoomMember
+	}
+
+	return &member, nil
+}
+
+func (rr *RoomInMemRepo) AddRoom(_ context.Context, room entity.Room) (*entity.Room, error) {
+	err := rr.DB.Tx(func(tx inmemory.Transaction) error {
+		owner, err := getUserByID(tx, room.Owner.ID)
+		if err != nil {
+			return err
+		}
+
+		id, err := tx.NextID(RoomTableName)
+		if err != nil {
+			return err
+		}
+
+		room.ID = id
+		room.Owner = owner
+		room.CreatedAt = time.Now()
+
+		if err = tx.AddRow(RoomTableName, strconv.Itoa(room.ID), room); err != nil {
+			return err
+		}
+
+		owned := entity.RoomMember{RoomID: room.ID, User: owner, Status: entity.RoomMemberJoined, Since: room.CreatedAt}
+
+		return tx.AddRow(RoomMemberTableName, roomMemberKey(room.ID, owner.ID), owned)
+	})
+	if err != nil {
+		return nil, mapUniqueViolation(err)
+	}
+
+	return &room, nil
+}
+
+func (rr *RoomInMemRepo) GetRoom(_ context.Context, id int) (*entity.Room, error) {
+	return getRoom(rr.DB, id)
+}
+
+// GetRoomsPage returns the page of public rooms and rooms the user is a member of or invited to, ordered by ID.
+func (rr *RoomInMemRepo) GetRoomsPage(_ context.Context, userID int, page entity.Page) []*entity.Room {
+	memberships, err := rr.DB.GetRowsByIndex(RoomMemberTableName, RoomMemberUserIndexName, strconv.Itoa(userID))
+	if err != nil {
+		return nil
+	}
+
+	joined := make(map[int]bool, len(memberships))
+
+	for _, row := range memberships {
+		if member, ok := row.(entity.RoomMember); ok {
+			joined[member.RoomID] = true
+		}
+	}
+
+	rows := seekInMemPage(rr.DB, RoomTableName, page, func(row any) bool {
+		room, ok := row.(entity.Room)
+		return ok && (room.Visibility == entity.RoomPublic || joined[room.ID])
+	})
+
+	res := make([]*entity.Room, 0, len(rows))
+
+	for _, row := range rows {
+		room, ok := row.(entity.Room)
+		if ok {
+			res = append(res, &room)
+		}
+	}
+
+	return res
+}
+
+func (rr *RoomInMemRepo) AddRoomMember(_ context.Context, member entity.RoomMember) (*entity.RoomMember, error) {
+	err := rr.DB.Tx(func(tx inmemory.Transaction) error {
+		if _, err := getRoom(tx, member.RoomID); err != nil {
+			return err
+		}
+
+		user, err := getUserByID(tx, member.User.ID)
+		if err != nil {
+			return err
+		}
+
+		member.User = user
+		member.Since = time.Now()
+
+		return tx.AddRow(RoomMemberTableName, roomMemberKey(member.RoomID, user.ID), member)
+	})
+
+	switch {
+	case errors.Is(err, inmemory.ErrExistingKey):
+		return nil, ErrRoomMemberExists
+	case err != nil:
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func (rr *RoomInMemRepo) GetRoomMember(_ context.Context, roomID, userID int) (*entity.RoomMember, error) {
+	return getRoomMember(rr.DB, roomID, userID)
+}
+
+func (rr *RoomInMemRepo) SetRoomMemberStatus(
+	_ context.Context,
+	roomID, userID int,
+	status entity.RoomMemberStatus,
+) (*entity.RoomMember, error) {
+	var member *entity.RoomMember
+
+	err := rr.DB.Tx(func(tx inmemory.Transaction) error {
+		var err error
+
+		member, err = getRoomMember(tx, roomID, userID)
+		if err != nil {
+			return err
+		}
+
+		member.Status = status
+		member.Since = time.Now()
+
+		return tx.AlterRow(RoomMemberTableName, roomMemberKey(roomID, userID), *member)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+func (rr *RoomInMemRepo) DeleteRoomMember(_ context.Context, roomID, userID int) error {
+	err := rr.DB.Tx(func(tx inmemory.Transaction) error {
+		if _, err := getRoomMember(tx, roomID, userID); err != nil {
+			return err
+		}
+
+		return tx.DropRow(RoomMemberTableName, roomMemberKey(roomID, userID))
+	})
+	if err != nil {
+		return ErrNoSuchRoomMember
+	}
+
+	return nil
+}
+
+// GetRoomMembersPage returns the page of members of the room having the status, ordered by user ID.
+func (rr *RoomInMemRepo) GetRoomMembersPage(
+	_ context.Context,
+	roomID int,
+	status entity.RoomMemberStatus,
+	page entity.Page,
+) []*entity.RoomMember {
+	rows := queryInMemPage(rr.DB, RoomMemberTableName, inmemory.Query{
+		Index:      RoomMemberRoomIndexName,
+		IndexValue: strconv.Itoa(roomID),
+		Where: func(row any) bool {
+			member, ok := row.(entity.RoomMember)
+			return ok && member.Status == status
+		},
+	}, page, roomMemberRowCursor)
+
+	res := make([]*entity.RoomMember, 0, len(rows))
+
+	for _, row := range rows {
+		member, ok := row.(entity.RoomMember)
+		if ok {
+			res = append(res, &member)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,10 @@
+package repository
+
+import "errors"
+
+var (
+	ErrNoSuchRoom       = errors.New("no such room")
+	ErrRoomNameExists   = errors.New("room with this name already exists")
+	ErrNoSuchRoomMember = errors.New("no such room member")
+	ErrRoomMemberExists = errors.New("user is already a member of the room or invited to it")
+)
@@ -0,0 +1,92 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+type RoomMessageInMemRepo struct {
+	DB inmemory.InMemoryDB
+}
+
+func NewInMemRoomMessageRepo(db inmemory.InMemoryDB) (*RoomMessageInMemRepo, error) {
+	repo := RoomMessageInMemRepo{
+		DB: db,
+	}
+
+	_, err := repo.DB.GetTable(RoomMessageTableName)
+	if errors.Is(err, inmemory.ErrNotExistedTable) {
+		if err = repo.DB.CreateTable(RoomMessageTableName); err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.DB.CreateIndex(RoomMessageTableName, inmemory.IndexSpec{Name: RoomMessageRoomIndexName, Key: roomMessageRoom})
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+func roomMessageRoom(row any) (string, bool) {
+	msg, ok := row.(entity.RoomMessage)
+	return strconv.Itoa(msg.RoomID), ok
+}
+
+func (mr *RoomMessageInMemRepo) AddRoomMessage(_ context.Context, msg entity.RoomMessage) (*entity.RoomMessage, error) {
+	err := mr.DB.Tx(func(tx inmemory.Transaction) error {
+		// the message is committed only if the room and the sender still exist
+		if _, err := getRoom(tx, msg.RoomID); err != nil {
+			return err
+		}
+
+		if _, err := getUserByID(tx, msg.From.ID); err != nil {
+			return err
+		}
+
+		id, err := tx.NextID(RoomMessageTableName)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		msg.ID = id
+		msg.SentAt = now
+		msg.EditedAt = now
+
+		return tx.AddRow(RoomMessageTableName, strconv.Itoa(msg.ID), msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// GetRoomMessagesPage returns the page of messages of the room ordered by the time they were sent.
+func (mr *RoomMessageInMemRepo) GetRoomMessagesPage(_ context.Context, roomID int, page entity.Page) []*entity.RoomMessage {
+	rows := queryInMemPage(mr.DB, RoomMessageTableName, inmemory.Query{
+		Index:      RoomMessageRoomIndexName,
+		IndexValue: strconv.Itoa(roomID),
+	}, page, roomMessageRowCursor)
+
+	res := make([]*entity.RoomMessage, 0, len(rows))
+
+	for _, row := range rows {
+		msg, ok := row.(entity.RoomMessage)
+		if ok {
+			res = append(res, &msg)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,46 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type RoomMessagePostgresRepo struct {
+	DB *sql.DB
+}
+
+func NewPostgresRoomMessageRepo(db *sql.DB) *RoomMessagePostgresRepo {
+	return &RoomMessagePostgresRepo{
+		DB: db,
+	}
+}
+
+func (mr *RoomMessagePostgresRepo) AddRoomMessage(ctx context.Context, msg entity.RoomMessage) (*entity.RoomMessage, error) {
+	// foreign key violations are reported as missing users, so the room is looked up first
+	var exists bool
+	if err := mr.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM rooms WHERE id = $1)`, msg.RoomID).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrNoSuchRoom
+	}
+
+	row := mr.DB.QueryRowContext(ctx,
+		`INSERT INTO room_messages (room_id, from_id, content) VALUES ($1, $2, $3) RETURNING id, sent_at, edited_at`,
+		msg.RoomID, msg.From.ID, msg.Content)
+
+	if err := row.Scan(&msg.ID, &msg.SentAt, &msg.EditedAt); err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	return &msg, nil
+}
+
+func (mr *RoomMessagePostgresRepo) GetRoomMessagesPage(ctx context.Context, roomID int, page entity.Page) []*entity.RoomMessage {
+	return queryPage(ctx, mr.DB, scanRoomMessage, roomMessagesQuery, postgresKeyset(messageKeyColumns), page,
+		[]string{`m.room_id = $1`}, roomID)
+}
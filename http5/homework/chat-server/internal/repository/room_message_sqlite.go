@@ -0,0 +1,51 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type RoomMessageSQLiteRepo struct {
+	DB *sql.DB
+}
+
+func NewSQLiteRoomMessageRepo(db *sql.DB) *RoomMessageSQLiteRepo {
+	return &RoomMessageSQLiteRepo{
+		DB: db,
+	}
+}
+
+func (mr *RoomMessageSQLiteRepo) AddRoomMessage(ctx context.Context, msg entity.RoomMessage) (*entity.RoomMessage, error) {
+	// foreign key violations are reported as missing users, so the room is looked up first
+	var exists bool
+	if err := mr.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM rooms WHERE id = ?)`, msg.RoomID).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrNoSuchRoom
+	}
+
+	now := sqliteNow()
+
+	msg.SentAt = now
+	msg.EditedAt = now
+
+	row := mr.DB.QueryRowContext(ctx,
+		`INSERT INTO room_messages (room_id, from_id, content, sent_at, edited_at) VALUES (?, ?, ?, ?, ?) RETURNING id`,
+		msg.RoomID, msg.From.ID, msg.Content, msg.SentAt, msg.EditedAt)
+
+	if err := row.Scan(&msg.ID); err != nil {
+		return nil, mapSQLiteError(err)
+	}
+
+	return &msg, nil
+}
+
+func (mr *RoomMessageSQLiteRepo) GetRoomMessagesPage(ctx context.Context, roomID int, page entity.Page) []*entity.RoomMessage {
+	return queryPage(ctx, mr.DB, scanRoomMessage, roomMessagesQuery, sqliteKeyset(messageKeyColumns), page,
+		[]string{`m.room_id = ?`}, roomID)
+}
@@ -0,0 +1,133 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type RoomPostgresRepo struct {
+	DB *sql.DB
+}
+
+func NewPostgresRoomRepo(db *sql.DB) *RoomPostgresRepo {
+	return &RoomPostgresRepo{
+		DB: db,
+	}
+}
+
+func (rr *RoomPostgresRepo) AddRoom(ctx context.Context, room entity.Room) (*entity.Room, error) {
+	tx, err := rr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx,
+		`INSERT INTO rooms (name, visibility, owner_id) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		room.Name, room.Visibility, room.Owner.ID)
+
+	if err = row.Scan(&room.ID, &room.CreatedAt); err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO room_members (room_id, user_id, status, since) VALUES ($1, $2, $3, $4)`,
+		room.ID, room.Owner.ID, entity.RoomMemberJoined, room.CreatedAt)
+	if err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return rr.GetRoom(ctx, room.ID)
+}
+
+func (rr *RoomPostgresRepo) GetRoom(ctx context.Context, id int) (*entity.Room, error) {
+	room, err := scanRoom(rr.DB.QueryRowContext(ctx, roomsQuery(`WHERE r.id = $1`), id))
+	if err != nil {
+		return nil, ErrNoSuchRoom
+	}
+
+	return room, nil
+}
+
+func (rr *RoomPostgresRepo) GetRoomsPage(ctx context.Context, userID int, page entity.Page) []*entity.Room {
+	visible := `(r.visibility = $1 OR EXISTS (SELECT 1 FROM room_members v WHERE v.room_id = r.id AND v.user_id = $2))`
+
+	return queryPage(ctx, rr.DB, scanRoom, roomsQuery, postgresKeyset(roomKeyColumns), page,
+		[]string{visible}, entity.RoomPublic, userID)
+}
+
+func (rr *RoomPostgresRepo) AddRoomMember(ctx context.Context, member entity.RoomMember) (*entity.RoomMember, error) {
+	// foreign key violations are reported as missing users, so the room is looked up first
+	if _, err := rr.GetRoom(ctx, member.RoomID); err != nil {
+		return nil, err
+	}
+
+	_, err := rr.DB.ExecContext(ctx,
+		`INSERT INTO room_members (room_id, user_id, status) VALUES ($1, $2, $3)`,
+		member.RoomID, member.User.ID, member.Status)
+	if err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	return rr.GetRoomMember(ctx, member.RoomID, member.User.ID)
+}
+
+func (rr *RoomPostgresRepo) GetRoomMember(ctx context.Context, roomID, userID int) (*entity.RoomMember, error) {
+	member, err := scanRoomMember(rr.DB.QueryRowContext(ctx,
+		roomMembersQuery(`WHERE rm.room_id = $1 AND rm.user_id = $2`), roomID, userID))
+	if err != nil {
+		return nil, ErrNoSuchRoomMember
+	}
+
+	return member, nil
+}
+
+func (rr *RoomPostgresRepo) SetRoomMemberStatus(
+	ctx context.Context,
+	roomID, userID int,
+	status entity.RoomMemberStatus,
+) (*entity.RoomMember, error) {
+	res, err := rr.DB.ExecContext(ctx,
+		`UPDATE room_members SET status = $1, since = now() WHERE room_id = $2 AND user_id = $3`,
+		status, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated, err := res.RowsAffected(); err != nil || updated == 0 {
+		return nil, ErrNoSuchRoomMember
+	}
+
+	return rr.GetRoomMember(ctx, roomID, userID)
+}
+
+func (rr *RoomPostgresRepo) DeleteRoomMember(ctx context.Context, roomID, userID int) error {
+	res, err := rr.DB.ExecContext(ctx, `DELETE FROM room_members WHERE room_id = $1 AND user_id = $2`, roomID, userID)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := res.RowsAffected(); err != nil || deleted == 0 {
+		return ErrNoSuchRoomMember
+	}
+
+	return nil
+}
+
+func (rr *RoomPostgresRepo) GetRoomMembersPage(
+	ctx context.Context,
+	roomID int,
+	status entity.RoomMemberStatus,
+	page entity.Page,
+) []*entity.RoomMember {
+	return queryPage(ctx, rr.DB, scanRoomMember, roomMembersQuery, postgresKeyset(userKeyColumns), page,
+		[]string{`rm.room_id = $1`, `rm.status = $2`}, roomID, status)
+}
@@ -0,0 +1,135 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type RoomSQLiteRepo struct {
+	DB *sql.DB
+}
+
+func NewSQLiteRoomRepo(db *sql.DB) *RoomSQLiteRepo {
+	return &RoomSQLiteRepo{
+		DB: db,
+	}
+}
+
+func (rr *RoomSQLiteRepo) AddRoom(ctx context.Context, room entity.Room) (*entity.Room, error) {
+	tx, err := rr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	room.CreatedAt = sqliteNow()
+
+	row := tx.QueryRowContext(ctx,
+		`INSERT INTO rooms (name, visibility, owner_id, created_at) VALUES (?, ?, ?, ?) RETURNING id`,
+		room.Name, room.Visibility, room.Owner.ID, room.CreatedAt)
+
+	if err = row.Scan(&room.ID); err != nil {
+		return nil, mapSQLiteError(err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO room_members (room_id, user_id, status, since) VALUES (?, ?, ?, ?)`,
+		room.ID, room.Owner.ID, entity.RoomMemberJoined, room.CreatedAt)
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return rr.GetRoom(ctx, room.ID)
+}
+
+func (rr *RoomSQLiteRepo) GetRoom(ctx context.Context, id int) (*entity.Room, error) {
+	room, err := scanRoom(rr.DB.QueryRowContext(ctx, roomsQuery(`WHERE r.id = ?`), id))
+	if err != nil {
+		return nil, ErrNoSuchRoom
+	}
+
+	return room, nil
+}
+
+func (rr *RoomSQLiteRepo) GetRoomsPage(ctx context.Context, userID int, page entity.Page) []*entity.Room {
+	visible := `(r.visibility = ? OR EXISTS (SELECT 1 FROM room_members v WHERE v.room_id = r.id AND v.user_id = ?))`
+
+	return queryPage(ctx, rr.DB, scanRoom, roomsQuery, sqliteKeyset(roomKeyColumns), page,
+		[]string{visible}, entity.RoomPublic, userID)
+}
+
+func (rr *RoomSQLiteRepo) AddRoomMember(ctx context.Context, member entity.RoomMember) (*entity.RoomMember, error) {
+	// foreign key violations are reported as missing users, so the room is looked up first
+	if _, err := rr.GetRoom(ctx, member.RoomID); err != nil {
+		return nil, err
+	}
+
+	_, err := rr.DB.ExecContext(ctx,
+		`INSERT INTO room_members (room_id, user_id, status, since) VALUES (?, ?, ?, ?)`,
+		member.RoomID, member.User.ID, member.Status, sqliteNow())
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+
+	return rr.GetRoomMember(ctx, member.RoomID, member.User.ID)
+}
+
+func (rr *RoomSQLiteRepo) GetRoomMember(ctx context.Context, roomID, userID int) (*entity.RoomMember, error) {
+	member, err := scanRoomMember(rr.DB.QueryRowContext(ctx,
+		roomMembersQuery(`WHERE rm.room_id = ? AND rm.user_id = ?`), roomID, userID))
+	if err != nil {
+		return nil, ErrNoSuchRoomMember
+	}
+
+	return member, nil
+}
+
+func (rr *RoomSQLiteRepo) SetRoomMemberStatus(
+	ctx context.Context,
+	roomID, userID int,
+	status entity.RoomMemberStatus,
+) (*entity.RoomMember, error) {
+	res, err := rr.DB.ExecContext(ctx,
+		`UPDATE room_members SET status = ?, since = ? WHERE room_id = ? AND user_id = ?`,
+		status, sqliteNow(), roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated, err := res.RowsAffected(); err != nil || updated == 0 {
+		return nil, ErrNoSuchRoomMember
+	}
+
+	return rr.GetRoomMember(ctx, roomID, userID)
+}
+
+func (rr *RoomSQLiteRepo) DeleteRoomMember(ctx context.Context, roomID, userID int) error {
+	res, err := rr.DB.ExecContext(ctx, `DELETE FROM room_members WHERE room_id = ? AND user_id = ?`, roomID, userID)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := res.RowsAffected(); err != nil || deleted == 0 {
+		return ErrNoSuchRoomMember
+	}
+
+	return nil
+}
+
+func (rr *RoomSQLiteRepo) GetRoomMembersPage(
+	ctx context.Context,
+	roomID int,
+	status entity.RoomMemberStatus,
+	page entity.Page,
+) []*entity.RoomMember {
+	return queryPage(ctx, rr.DB, scanRoomMember, roomMembersQuery, sqliteKeyset(userKeyColumns), page,
+		[]string{`rm.room_id = ?`, `rm.status = ?`}, roomID, status)
+}
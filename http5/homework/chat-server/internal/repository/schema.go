@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+// snapshotMigrations upgrade snapshots saved by older versions of the server.
+// A migration reshaping the stored rows is appended whenever a row type of the tables changes.
+var snapshotMigrations = []inmemory.Migration{
+	{
+		Version: 1,
+		Name:    "add role and ban flag to users",
+		Up: func(tables inmemory.SnapshotTables) error {
+			return tables.MapRows(UserTableName, func(row map[string]any) error {
+				if role, _ := row["Role"].(string); role == "" {
+					row["Role"] = entity.RoleUser
+				}
+
+				if _, ok := row["Banned"]; !ok {
+					row["Banned"] = false
+				}
+
+				return nil
+			})
+		},
+	},
+}
+
+// SnapshotMigrations is the registry of migrations of the repository tables.
+// It panics if the migrations skip a version, which is a programming error.
+func SnapshotMigrations() *inmemory.MigrationRegistry {
+	registry, err := inmemory.NewMigrationRegistry(snapshotMigrations...)
+	if err != nil {
+		panic(err)
+	}
+
+	return registry
+}
+
+// InMemDBSchema declares row types of the repository tables, so that InMemDB
+// restores them from snapshots as entities instead of generic maps,
+// upgrading snapshots of older versions first.
+func InMemDBSchema() []inmemory.Option {
+	return []inmemory.Option{
+		inmemory.WithTableSchema(UserTableName, entity.User{}),
+		inmemory.WithTableSchema(PublicMessageTableName, entity.PublicMessage{}),
+		inmemory.WithTableSchema(PrivateMessageTableName, entity.PrivateMessage{}),
+		inmemory.WithTableSchema(SessionTableName, entity.Session{}),
+		inmemory.WithTableSchema(RoomTableName, entity.Room{}),
+		inmemory.WithTableSchema(RoomMemberTableName, entity.RoomMember{}),
+		inmemory.WithTableSchema(RoomMessageTableName, entity.RoomMessage{}),
+		inmemory.WithMigrations(SnapshotMigrations()),
+	}
+}
+
+// PublicMessagesTTL makes InMemDB remove public messages ttl after they were sent.
+func PublicMessagesTTL(ttl time.Duration) inmemory.Option {
+	return inmemory.WithTableTTL(PublicMessageTableName, inmemory.TTLConfig{
+		ExpiresAt: func(row any) (time.Time, bool) {
+			msg, ok := row.(entity.PublicMessage)
+			return msg.SentAt.Add(ttl), ok
+		},
+	})
+}
+
+// SessionsTTL makes InMemDB remove sessions once they expire.
+func SessionsTTL() inmemory.Option {
+	return inmemory.WithTableTTL(SessionTableName, inmemory.TTLConfig{
+		ExpiresAt: func(row any) (time.Time, bool) {
+			session, ok := row.(entity.Session)
+			return session.ExpiresAt, ok
+		},
+	})
+}
@@ -0,0 +1,146 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+// SessionInMemRepo keeps sessions in InMemDB for every database driver: sessions are only
+// looked up by their ID, and expired ones are removed by the TTL of the table.
+type SessionInMemRepo struct {
+	DB inmemory.InMemoryDB
+}
+
+func NewInMemSessionRepo(db inmemory.InMemoryDB) (*SessionInMemRepo, error) {
+	repo := SessionInMemRepo{
+		DB: db,
+	}
+
+	_, err := repo.DB.GetTable(SessionTableName)
+	if errors.Is(err, inmemory.ErrNotExistedTable) {
+		if err = repo.DB.CreateTable(SessionTableName); err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.DB.CreateIndex(SessionTableName, inmemory.IndexSpec{Name: SessionUserIndexName, Key: sessionUser})
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+func sessionUser(row any) (string, bool) {
+	session, ok := row.(entity.Session)
+	return strconv.Itoa(session.UserID), ok
+}
+
+func (sr *SessionInMemRepo) AddSession(_ context.Context, session entity.Session) (*entity.Session, error) {
+	if err := sr.DB.AddRow(SessionTableName, session.ID, session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (sr *SessionInMemRepo) GetSession(_ context.Context, id string) (*entity.Session, error) {
+	row, err := sr.DB.GetRow(SessionTableName, id)
+	if err != nil {
+		return nil, ErrNoSuchSession
+	}
+
+	session, ok := row.(entity.Session)
+	if !ok {
+		return nil, ErrNoSuchSession
+	}
+
+	return &session, nil
+}
+
+func (sr *SessionInMemRepo) GetUserSessions(_ context.Context, userID int) []*entity.Session {
+	res, err := sr.DB.Query(SessionTableName, inmemory.Query{
+		Index:      SessionUserIndexName,
+		IndexValue: strconv.Itoa(userID),
+		OrderBy:    inmemory.FieldLess("CreatedAt"),
+	})
+	if err != nil {
+		return nil
+	}
+
+	sessions := make([]*entity.Session, 0, len(res.Rows))
+
+	for _, row := range res.Rows {
+		session, ok := row.(entity.Session)
+		if ok {
+			sessions = append(sessions, &session)
+		}
+	}
+
+	return sessions
+}
+
+func (sr *SessionInMemRepo) DeleteSession(_ context.Context, id string) error {
+	err := sr.DB.Tx(func(tx inmemory.Transaction) error {
+		if _, err := tx.GetRow(SessionTableName, id); err != nil {
+			return err
+		}
+
+		return tx.DropRow(SessionTableName, id)
+	})
+	if err != nil {
+		return ErrNoSuchSession
+	}
+
+	return nil
+}
+
+// DeleteUserSessions deletes all sessions of the user at once and returns how many there were.
+func (sr *SessionInMemRepo) DeleteUserSessions(_ context.Context, userID int) (int, error) {
+	rows, err := sr.DB.GetRowsByIndex(SessionTableName, SessionUserIndexName, strconv.Itoa(userID))
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+
+	err = sr.DB.Tx(func(tx inmemory.Transaction) error {
+		deleted = 0
+
+		for _, row := range rows {
+			session, ok := row.(entity.Session)
+			if !ok {
+				continue
+			}
+
+			// the session might have expired or been deleted since it was read
+			_, err := tx.GetRow(SessionTableName, session.ID)
+			if errors.Is(err, inmemory.ErrNotExistedRow) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err = tx.DropRow(SessionTableName, session.ID); err != nil {
+				return err
+			}
+
+			deleted++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,5 @@
+package repository
+
+import "errors"
+
+var ErrNoSuchSession = errors.New("no such session")
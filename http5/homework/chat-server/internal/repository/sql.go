@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+// Helpers shared by the SQL repositories, the queries they build are valid in every supported dialect.
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// userColumns lists the columns scanned by scanUser, prefixed with the alias of the users table.
+func userColumns(alias string) string {
+	columns := []string{"id", "email", "username", "hashed_password", "role", "banned", "created_at", "updated_at"}
+
+	for i, column := range columns {
+		columns[i] = alias + "." + column
+	}
+
+	return strings.Join(columns, ", ")
+}
+
+func userFields(user *entity.User) []any {
+	return []any{
+		&user.ID, &user.Email, &user.Username, &user.HashedPassword,
+		&user.Role, &user.Banned, &user.CreatedAt, &user.UpdatedAt,
+	}
+}
+
+func scanUser(row rowScanner) (*entity.User, error) {
+	var user entity.User
+
+	if err := row.Scan(userFields(&user)...); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func publicMessagesQuery(where string) string {
+	return `SELECT m.id, m.content, m.sent_at, m.edited_at, ` + userColumns("f") + `
+		FROM public_messages m JOIN users f ON f.id = m.from_id ` + where
+}
+
+func scanPublicMessage(row rowScanner) (*entity.PublicMessage, error) {
+	msg := entity.PublicMessage{From: &entity.User{}}
+
+	fields := append([]any{&msg.ID, &msg.Content, &msg.SentAt, &msg.EditedAt}, userFields(msg.From)...)
+
+	if err := row.Scan(fields...); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+func privateMessagesQuery(where string) string {
+	return `SELECT m.id, m.content, m.sent_at, m.edited_at, ` + userColumns("f") + `, ` + userColumns("t") + `
+		FROM private_messages m JOIN users f ON f.id = m.from_id JOIN users t ON t.id = m.to_id ` + where
+}
+
+func scanPrivateMessage(row rowScanner) (*entity.PrivateMessage, error) {
+	msg := entity.PrivateMessage{From: &entity.User{}, To: &entity.User{}}
+
+	fields := []any{&msg.ID, &msg.Content, &msg.SentAt, &msg.EditedAt}
+	fields = append(fields, userFields(msg.From)...)
+	fields = append(fields, userFields(msg.To)...)
+
+	if err := row.Scan(fields...); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// queryRows returns the rows of the query scanned by scan. Like the in-memory repositories,
+// listing methods do not report errors, any failure results in nil.
+func queryRows[T any](ctx context.Context, db *sql.DB, scan func(row rowScanner) (*T, error), query string, args ...any) []*T {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil
+	}
+
+	defer rows.Close()
+
+	res := make([]*T, 0)
+
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil
+		}
+
+		res = append(res, item)
+	}
+
+	if rows.Err() != nil {
+		return nil
+	}
+
+	return res
+}
+
+var (
+	// messageKeyColumns order messages in pages, the way cursors of messages are ordered
+	messageKeyColumns = []string{"m.sent_at", "m.id"}
+	// userKeyColumns order users in pages, cursors of users hold IDs alone
+	userKeyColumns = []string{"u.id"}
+	// roomKeyColumns order rooms in pages, cursors of rooms hold IDs alone
+	roomKeyColumns = []string{"r.id"}
+)
+
+// keyset reads pages of rows ordered by its columns, a time column and an ID column or an ID column alone.
+type keyset struct {
+	columns []string
+	// placeholder returns the placeholder of the n-th argument of a query in the dialect
+	placeholder func(n int) string
+}
+
+// pageClauses returns the WHERE, ORDER BY and LIMIT clauses reading the page of rows
+// matching the conditions, args of the conditions go first.
+func (k keyset) pageClauses(page entity.Page, conds []string, args []any) (string, []any) {
+	columns := strings.Join(k.columns, ", ")
+
+	cursor, op, order := page.After, ">", columns
+	if page.Backward() {
+		cursor, op, order = page.Before, "<", strings.Join(k.columns, " DESC, ")+" DESC"
+	}
+
+	if cursor != nil {
+		values := []any{cursor.ID}
+		if len(k.columns) == 2 {
+			values = []any{cursor.At.UTC(), cursor.ID}
+		}
+
+		placeholders := make([]string, 0, len(values))
+
+		for _, value := range values {
+			args = append(args, value)
+			placeholders = append(placeholders, k.placeholder(len(args)))
+		}
+
+		conds = append(conds, fmt.Sprintf("(%s) %s (%s)", columns, op, strings.Join(placeholders, ", ")))
+	}
+
+	args = append(args, page.Limit)
+	clauses := fmt.Sprintf("ORDER BY %s LIMIT %s", order, k.placeholder(len(args)))
+
+	if len(conds) > 0 {
+		clauses = "WHERE " + strings.Join(conds, " AND ") + " " + clauses
+	}
+
+	return clauses, args
+}
+
+// queryPage reads the page of rows of the query built by query from the page clauses, in the order of the listing.
+func queryPage[T any](
+	ctx context.Context,
+	db *sql.DB,
+	scan func(row rowScanner) (*T, error),
+	query func(clauses string) string,
+	k keyset,
+	page entity.Page,
+	conds []string,
+	args ...any,
+) []*T {
+	clauses, args := k.pageClauses(page, conds, args)
+
+	res := queryRows(ctx, db, scan, query(clauses), args...)
+
+	// backward pages are read from their end
+	if page.Backward() {
+		slices.Reverse(res)
+	}
+
+	return res
+}
+
+func usersQuery(clauses string) string {
+	return `SELECT ` + userColumns("u") + ` FROM users u ` + clauses
+}
+
+func roomsQuery(clauses string) string {
+	return `SELECT r.id, r.name, r.visibility, r.created_at, ` + userColumns("o") + `
+		FROM rooms r JOIN users o ON o.id = r.owner_id ` + clauses
+}
+
+func scanRoom(row rowScanner) (*entity.Room, error) {
+	room := entity.Room{Owner: &entity.User{}}
+
+	fields := append([]any{&room.ID, &room.Name, &room.Visibility, &room.CreatedAt}, userFields(room.Owner)...)
+
+	if err := row.Scan(fields...); err != nil {
+		return nil, err
+	}
+
+	return &room, nil
+}
+
+// roomMembersQuery selects members of rooms, the users table is aliased u so members are paged by user ID.
+func roomMembersQuery(clauses string) string {
+	return `SELECT rm.room_id, rm.status, rm.since, ` + userColumns("u") + `
+		FROM room_members rm JOIN users u ON u.id = rm.user_id ` + clauses
+}
+
+func scanRoomMember(row rowScanner) (*entity.RoomMember, error) {
+	member := entity.RoomMember{User: &entity.User{}}
+
+	fields := append([]any{&member.RoomID, &member.Status, &member.Since}, userFields(member.User)...)
+
+	if err := row.Scan(fields...); err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func roomMessagesQuery(clauses string) string {
+	return `SELECT m.id, m.room_id, m.content, m.sent_at, m.edited_at, ` + userColumns("f") + `
+		FROM room_messages m JOIN users f ON f.id = m.from_id ` + clauses
+}
+
+func scanRoomMessage(row rowScanner) (*entity.RoomMessage, error) {
+	msg := entity.RoomMessage{From: &entity.User{}}
+
+	fields := append([]any{&msg.ID, &msg.RoomID, &msg.Content, &msg.SentAt, &msg.EditedAt}, userFields(msg.From)...)
+
+	if err := row.Scan(fields...); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/migrate"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteParams enable foreign keys, which SQLite leaves off by default, and make concurrent
+// writers wait for each other. Transactions take the write lock right away, so a transaction
+// reading a row it then updates never fails to upgrade its lock.
+const sqliteParams = "?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
+// OpenSQLite opens the database file at path, creating it if needed, and applies the migrations it lacks.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+sqliteParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	migrations, err := fs.Sub(sqliteMigrations, "migrations/sqlite")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err = migrate.Up(ctx, db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// mapSQLiteError turns constraint violations into the errors the in-memory repositories return.
+// SQLite does not report names of violated unique indexes, only the columns they cover.
+func mapSQLiteError(err error) error {
+	var sqliteErr sqlite3.Error
+
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique:
+		switch {
+		case strings.Contains(sqliteErr.Error(), "users.email"):
+			return ErrEmailExists
+		case strings.Contains(sqliteErr.Error(), "users.username"):
+			return ErrUsernameExists
+		case strings.Contains(sqliteErr.Error(), "rooms.name"):
+			return ErrRoomNameExists
+		}
+	case sqlite3.ErrConstraintPrimaryKey:
+		if strings.Contains(sqliteErr.Error(), "room_members.") {
+			return ErrRoomMemberExists
+		}
+	case sqlite3.ErrConstraintForeignKey:
+		return ErrNoSuchUser
+	}
+
+	return err
+}
+
+// sqliteKeyset reads pages of rows ordered by the columns in SQLite.
+func sqliteKeyset(columns []string) keyset {
+	return keyset{columns: columns, placeholder: func(int) string { return "?" }}
+}
+
+// sqliteNow is the time written by the SQLite repositories. SQLite has no time type, times
+// are stored as text in UTC, so the returned time equals the one read back from the database.
+func sqliteNow() time.Time {
+	return time.Now().UTC().Round(0)
+}
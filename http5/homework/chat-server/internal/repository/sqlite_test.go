@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+func initSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	db, err := OpenSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// messages are removed along with their users, the in-memory repositories keep them
+func TestSQLiteDeleteUserRemovesMessages(t *testing.T) {
+	ctx := context.Background()
+	db := initSQLite(t, filepath.Join(t.TempDir(), "chat.db"))
+
+	userRepo := NewSQLiteUserRepo(db)
+	users := addUsers(t, userRepo, "first", "second")
+	publicRepo := NewSQLitePublicMessageRepo(db)
+	privateRepo := NewSQLitePrivateMessageRepo(db)
+
+	if _, err := publicRepo.AddPublicMessage(ctx, entity.PublicMessage{From: users[0], Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := privateRepo.AddPrivateMessage(ctx, entity.PrivateMessage{From: users[1], To: users[0], Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := userRepo.DeleteUser(ctx, users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if msgs := publicRepo.GetAllPublicMessages(ctx, 0, 10); len(msgs) != 0 {
+		t.Fatalf("expected public messages of deleted user to be removed, got %v", contents(msgs))
+	}
+
+	if msgs := privateRepo.GetAllPrivateMessages(ctx, 0, 10); len(msgs) != 0 {
+		t.Fatalf("expected private messages to deleted user to be removed, got %v", contents(msgs))
+	}
+}
+
+func TestSQLiteSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "chat.db")
+
+	db := initSQLite(t, path)
+	users := addUsers(t, NewSQLiteUserRepo(db), "first")
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// migrations already applied to the file are skipped
+	got, err := NewSQLiteUserRepo(initSQLite(t, path)).GetUserByID(ctx, users[0].ID)
+	if err != nil || *got != *users[0] {
+		t.Fatalf("expected %+v after reopen, got %+v (%v)", users[0], got, err)
+	}
+}
@@ -4,37 +4,73 @@ package repository
 import (
 	"context"
 	"errors"
-	"math"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
 
 	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
-	sliceutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/slice"
 )
 
 type UserRepoInMemDB struct {
-	mutex sync.RWMutex
-	DB    inmemory.InMemoryDB
+	DB inmemory.InMemoryDB
 }
 
-func NewInMemUserRepo(db inmemory.InMemoryDB) *UserRepoInMemDB {
+func NewInMemUserRepo(db inmemory.InMemoryDB) (*UserRepoInMemDB, error) {
 	repo := UserRepoInMemDB{
-		DB:    db,
-		mutex: sync.RWMutex{},
+		DB: db,
 	}
 
 	_, err := repo.DB.GetTable(UserTableName)
 	if errors.Is(err, inmemory.ErrNotExistedTable) {
-		repo.DB.CreateTable(UserTableName)
+		if err = repo.DB.CreateTable(UserTableName); err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.DB.CreateIndex(UserTableName, inmemory.IndexSpec{Name: UserEmailIndexName, Unique: true, Key: userEmail})
+	if err != nil {
+		return nil, err
 	}
 
-	return &repo
+	err = repo.DB.CreateIndex(UserTableName, inmemory.IndexSpec{Name: UserUsernameIndexName, Unique: true, Key: userUsername})
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+func userEmail(row any) (string, bool) {
+	user, ok := row.(entity.User)
+	return user.Email, ok
+}
+
+func userUsername(row any) (string, bool) {
+	user, ok := row.(entity.User)
+	return user.Username, ok
+}
+
+func mapUniqueViolation(err error) error {
+	var violation *inmemory.UniqueViolationError
+
+	if !errors.As(err, &violation) {
+		return err
+	}
+
+	switch violation.Index {
+	case UserEmailIndexName:
+		return ErrEmailExists
+	case UserUsernameIndexName:
+		return ErrUsernameExists
+	case RoomNameIndexName:
+		return ErrRoomNameExists
+	default:
+		return err
+	}
 }
 
-func (ur *UserRepoInMemDB) getAllUsers(_ context.Context, offset, limit int) []*entity.User {
+func (ur *UserRepoInMemDB) GetAllUsers(_ context.Context, offset, limit int) []*entity.User {
 	rows, err := ur.DB.GetAllRows(UserTableName, offset, limit)
 	if err != nil {
 		return nil
@@ -52,37 +88,46 @@ func (ur *UserRepoInMemDB) getAllUsers(_ context.Context, offset, limit int) []*
 	return res
 }
 
-func (ur *UserRepoInMemDB) GetAllUsers(ctx context.Context, offset, limit int) []*entity.User {
-	ur.mutex.RLock()
-	defer ur.mutex.RUnlock()
+// GetUsersPage returns the page of users ordered by ID.
+func (ur *UserRepoInMemDB) GetUsersPage(_ context.Context, page entity.Page) []*entity.User {
+	rows := seekInMemPage(ur.DB, UserTableName, page, nil)
+
+	res := make([]*entity.User, 0, len(rows))
+
+	for _, row := range rows {
+		user, ok := row.(entity.User)
+		if ok {
+			res = append(res, &user)
+		}
+	}
 
-	return ur.getAllUsers(ctx, offset, limit)
+	return res
 }
 
 func (ur *UserRepoInMemDB) AddUser(_ context.Context, user entity.User) (*entity.User, error) {
-	ur.mutex.Lock()
-	defer ur.mutex.Unlock()
-
-	idOffset, err := ur.DB.GetTableCounter(UserTableName)
-	if err != nil {
-		return nil, err
-	}
+	err := ur.DB.Tx(func(tx inmemory.Transaction) error {
+		id, err := tx.NextID(UserTableName)
+		if err != nil {
+			return err
+		}
 
-	now := time.Now()
+		now := time.Now()
 
-	user.ID = idOffset + 1
-	user.CreatedAt = now
-	user.UpdatedAt = now
+		user.ID = id
+		user.CreatedAt = now
+		user.UpdatedAt = now
 
-	if err = ur.DB.AddRow(UserTableName, strconv.Itoa(user.ID), user); err != nil {
-		return nil, err
+		return tx.AddRow(UserTableName, strconv.Itoa(user.ID), user)
+	})
+	if err != nil {
+		return nil, mapUniqueViolation(err)
 	}
 
 	return &user, nil
 }
 
-func (ur *UserRepoInMemDB) getUserByID(_ context.Context, id int) (*entity.User, error) {
-	row, err := ur.DB.GetRow(UserTableName, strconv.Itoa(id))
+func getUserByID(reader rowReader, id int) (*entity.User, error) {
+	row, err := reader.GetRow(UserTableName, strconv.Itoa(id))
 	if err != nil {
 		return nil, ErrNoSuchUser
 	}
@@ -95,110 +140,80 @@ func (ur *UserRepoInMemDB) getUserByID(_ context.Context, id int) (*entity.User,
 	return &user, nil
 }
 
-func (ur *UserRepoInMemDB) GetUserByID(ctx context.Context, id int) (*entity.User, error) {
-	ur.mutex.RLock()
-	defer ur.mutex.RUnlock()
-
-	return ur.getUserByID(ctx, id)
+func (ur *UserRepoInMemDB) GetUserByID(_ context.Context, id int) (*entity.User, error) {
+	return getUserByID(ur.DB, id)
 }
 
-func (ur *UserRepoInMemDB) getUserByEmail(ctx context.Context, email string) (*entity.User, error) {
-	users := ur.getAllUsers(ctx, 0, math.MaxInt64)
-	if len(users) == 0 {
+func (ur *UserRepoInMemDB) getUserByIndex(_ context.Context, index, value string) (*entity.User, error) {
+	row, err := ur.DB.GetRowByIndex(UserTableName, index, value)
+	if errors.Is(err, inmemory.ErrNotExistedRow) {
 		return nil, ErrNoSuchUser
 	}
 
-	filtered := sliceutils.Filter(users, func(u *entity.User) bool { return u.Email == email })
-	if len(filtered) == 0 {
-		return nil, ErrNoSuchUser
+	if err != nil {
+		return nil, err
 	}
 
-	user := filtered[0]
+	user, ok := row.(entity.User)
+	if !ok {
+		return nil, ErrNoSuchUser
+	}
 
-	return user, nil
+	return &user, nil
 }
 
 func (ur *UserRepoInMemDB) GetUserByEmail(ctx context.Context, email string) (*entity.User, error) {
-	ur.mutex.RLock()
-	defer ur.mutex.RUnlock()
-
-	return ur.getUserByEmail(ctx, email)
+	return ur.getUserByIndex(ctx, UserEmailIndexName, email)
 }
 
-func (ur *UserRepoInMemDB) getUserByUsername(ctx context.Context, username string) (*entity.User, error) {
-	users := ur.getAllUsers(ctx, 0, math.MaxInt64)
-	if len(users) == 0 {
-		return nil, ErrNoSuchUser
-	}
-
-	filtered := sliceutils.Filter(users, func(u *entity.User) bool { return u.Username == username })
-
-	if len(filtered) == 0 {
-		return nil, ErrNoSuchUser
-	}
-
-	user := filtered[0]
-
-	return user, nil
+func (ur *UserRepoInMemDB) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	return ur.getUserByIndex(ctx, UserUsernameIndexName, username)
 }
 
-func (ur *UserRepoInMemDB) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
-	ur.mutex.RLock()
-	defer ur.mutex.RUnlock()
+func (ur *UserRepoInMemDB) DeleteUser(_ context.Context, id int) (*entity.User, error) {
+	var user *entity.User
 
-	return ur.getUserByUsername(ctx, username)
-}
+	err := ur.DB.Tx(func(tx inmemory.Transaction) error {
+		var err error
 
-func (ur *UserRepoInMemDB) DeleteUser(ctx context.Context, id int) (*entity.User, error) {
-	ur.mutex.Lock()
-	defer ur.mutex.Unlock()
+		user, err = getUserByID(tx, id)
+		if err != nil {
+			return err
+		}
 
-	user, err := ur.getUserByID(ctx, id)
+		return tx.DropRow(UserTableName, strconv.Itoa(id))
+	})
 	if err != nil {
-		return nil, err
-	}
-
-	if err = ur.DB.DropRow(UserTableName, strconv.Itoa(id)); err != nil {
 		return nil, ErrNoSuchUser
 	}
 
 	return user, nil
 }
 
-func (ur *UserRepoInMemDB) UpdateUser(ctx context.Context, id int, updated entity.User) (*entity.User, error) {
-	ur.mutex.Lock()
-	defer ur.mutex.Unlock()
-
-	user, err := ur.getUserByID(ctx, id)
-	if err != nil {
-		return nil, err
-	}
+func (ur *UserRepoInMemDB) UpdateUser(_ context.Context, id int, updated entity.User) (*entity.User, error) {
+	var user *entity.User
 
-	updated.ID = id
-	updated.CreatedAt = user.CreatedAt
-	updated.UpdatedAt = time.Now()
-
-	err = ur.DB.AlterRow(UserTableName, strconv.Itoa(id), updated)
-	if err != nil {
-		return nil, ErrNoSuchUser
-	}
+	err := ur.DB.Tx(func(tx inmemory.Transaction) error {
+		var err error
 
-	return user, nil
-}
+		user, err = getUserByID(tx, id)
+		if err != nil {
+			return err
+		}
 
-func (ur *UserRepoInMemDB) CheckUniqueConstraints(ctx context.Context, email, username string) error {
-	ur.mutex.RLock()
-	defer ur.mutex.RUnlock()
+		updated.ID = id
+		updated.CreatedAt = user.CreatedAt
+		updated.UpdatedAt = time.Now()
 
-	got, err := ur.getUserByEmail(ctx, email)
-	if got != nil || err == nil {
-		return ErrEmailExists
+		return tx.AlterRow(UserTableName, strconv.Itoa(id), updated)
+	})
+	if errors.Is(err, inmemory.ErrUniqueViolation) {
+		return nil, mapUniqueViolation(err)
 	}
 
-	got, err = ur.getUserByUsername(ctx, username)
-	if got != nil || err == nil {
-		return ErrUsernameExists
+	if err != nil {
+		return nil, ErrNoSuchUser
 	}
 
-	return nil
+	return user, nil
 }
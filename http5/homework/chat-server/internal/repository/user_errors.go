@@ -1,9 +1,13 @@
 package repository
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
 
 var (
-	ErrNoSuchUser     = errors.New("no such user")
+	ErrNoSuchUser     = entity.ErrNoSuchUser
 	ErrEmailExists    = errors.New("user with this email already exists")
 	ErrUsernameExists = errors.New("user with this username already exists")
 )
@@ -0,0 +1,114 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type UserPostgresRepo struct {
+	DB *sql.DB
+}
+
+func NewPostgresUserRepo(db *sql.DB) *UserPostgresRepo {
+	return &UserPostgresRepo{
+		DB: db,
+	}
+}
+
+func (ur *UserPostgresRepo) GetAllUsers(ctx context.Context, offset, limit int) []*entity.User {
+	return queryRows(ctx, ur.DB, scanUser, `SELECT `+userColumns("u")+` FROM users u ORDER BY u.id LIMIT $1 OFFSET $2`, limit, offset)
+}
+
+func (ur *UserPostgresRepo) GetUsersPage(ctx context.Context, page entity.Page) []*entity.User {
+	return queryPage(ctx, ur.DB, scanUser, usersQuery, postgresKeyset(userKeyColumns), page, nil)
+}
+
+func (ur *UserPostgresRepo) AddUser(ctx context.Context, user entity.User) (*entity.User, error) {
+	row := ur.DB.QueryRowContext(ctx,
+		`INSERT INTO users (email, username, hashed_password, role, banned) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`,
+		user.Email, user.Username, user.HashedPassword, user.Role, user.Banned)
+
+	if err := row.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	return &user, nil
+}
+
+func (ur *UserPostgresRepo) getUserBy(ctx context.Context, column string, value any) (*entity.User, error) {
+	row := ur.DB.QueryRowContext(ctx, `SELECT `+userColumns("u")+` FROM users u WHERE u.`+column+` = $1`, value)
+
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSuchUser
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (ur *UserPostgresRepo) GetUserByID(ctx context.Context, id int) (*entity.User, error) {
+	return ur.getUserBy(ctx, "id", id)
+}
+
+func (ur *UserPostgresRepo) GetUserByEmail(ctx context.Context, email string) (*entity.User, error) {
+	return ur.getUserBy(ctx, "email", email)
+}
+
+func (ur *UserPostgresRepo) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	return ur.getUserBy(ctx, "username", username)
+}
+
+func (ur *UserPostgresRepo) DeleteUser(ctx context.Context, id int) (*entity.User, error) {
+	row := ur.DB.QueryRowContext(ctx, `DELETE FROM users u WHERE u.id = $1 RETURNING `+userColumns("u"), id)
+
+	user, err := scanUser(row)
+	if err != nil {
+		return nil, ErrNoSuchUser
+	}
+
+	return user, nil
+}
+
+// UpdateUser returns the user as it was before the update, the same as UserRepoInMemDB does.
+func (ur *UserPostgresRepo) UpdateUser(ctx context.Context, id int, updated entity.User) (*entity.User, error) {
+	tx, err := ur.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// rolling back a committed transaction is a no-op
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRowContext(ctx,
+		`SELECT `+userColumns("u")+` FROM users u WHERE u.id = $1 FOR UPDATE`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSuchUser
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET email = $1, username = $2, hashed_password = $3, role = $4, banned = $5, updated_at = now()
+		WHERE id = $6`,
+		updated.Email, updated.Username, updated.HashedPassword, updated.Role, updated.Banned, id)
+	if err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,117 @@
+// nolint
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type UserSQLiteRepo struct {
+	DB *sql.DB
+}
+
+func NewSQLiteUserRepo(db *sql.DB) *UserSQLiteRepo {
+	return &UserSQLiteRepo{
+		DB: db,
+	}
+}
+
+func (ur *UserSQLiteRepo) GetAllUsers(ctx context.Context, offset, limit int) []*entity.User {
+	return queryRows(ctx, ur.DB, scanUser, `SELECT `+userColumns("u")+` FROM users u ORDER BY u.id LIMIT ? OFFSET ?`, limit, offset)
+}
+
+func (ur *UserSQLiteRepo) GetUsersPage(ctx context.Context, page entity.Page) []*entity.User {
+	return queryPage(ctx, ur.DB, scanUser, usersQuery, sqliteKeyset(userKeyColumns), page, nil)
+}
+
+func (ur *UserSQLiteRepo) AddUser(ctx context.Context, user entity.User) (*entity.User, error) {
+	now := sqliteNow()
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	row := ur.DB.QueryRowContext(ctx,
+		`INSERT INTO users (email, username, hashed_password, role, banned, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		user.Email, user.Username, user.HashedPassword, user.Role, user.Banned, user.CreatedAt, user.UpdatedAt)
+
+	if err := row.Scan(&user.ID); err != nil {
+		return nil, mapSQLiteError(err)
+	}
+
+	return &user, nil
+}
+
+func (ur *UserSQLiteRepo) getUserBy(ctx context.Context, column string, value any) (*entity.User, error) {
+	row := ur.DB.QueryRowContext(ctx, `SELECT `+userColumns("u")+` FROM users u WHERE u.`+column+` = ?`, value)
+
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSuchUser
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (ur *UserSQLiteRepo) GetUserByID(ctx context.Context, id int) (*entity.User, error) {
+	return ur.getUserBy(ctx, "id", id)
+}
+
+func (ur *UserSQLiteRepo) GetUserByEmail(ctx context.Context, email string) (*entity.User, error) {
+	return ur.getUserBy(ctx, "email", email)
+}
+
+func (ur *UserSQLiteRepo) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	return ur.getUserBy(ctx, "username", username)
+}
+
+func (ur *UserSQLiteRepo) DeleteUser(ctx context.Context, id int) (*entity.User, error) {
+	row := ur.DB.QueryRowContext(ctx, `DELETE FROM users WHERE id = ? RETURNING `+userColumns("users"), id)
+
+	user, err := scanUser(row)
+	if err != nil {
+		return nil, ErrNoSuchUser
+	}
+
+	return user, nil
+}
+
+// UpdateUser returns the user as it was before the update, the same as UserRepoInMemDB does.
+func (ur *UserSQLiteRepo) UpdateUser(ctx context.Context, id int, updated entity.User) (*entity.User, error) {
+	tx, err := ur.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// rolling back a committed transaction is a no-op
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns("u")+` FROM users u WHERE u.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSuchUser
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET email = ?, username = ?, hashed_password = ?, role = ?, banned = ?, updated_at = ? WHERE id = ?`,
+		updated.Email, updated.Username, updated.HashedPassword, updated.Role, updated.Banned, sqliteNow(), id)
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
+	"sync"
 	"testing"
 
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
@@ -14,7 +17,9 @@ import (
 func initRepo(ctx context.Context) *UserRepoInMemDB {
 	db, _ := inmemory.NewInMemDB(ctx, "")
 
-	return NewInMemUserRepo(db)
+	repo, _ := NewInMemUserRepo(db)
+
+	return repo
 }
 
 func isEqualCreateModelToUser(createModel *entity.User, user *entity.User) bool {
@@ -183,3 +188,131 @@ func TestGetUserByUsernamePositive(t *testing.T) {
 		t.Fatal("cannot delete user")
 	}
 }
+
+func TestAddUserDuplicatesNegative(t *testing.T) {
+	ctx := context.Background()
+	repo := initRepo(ctx)
+
+	created, err := repo.AddUser(ctx, entity.User{Email: "test@mail.com", Username: "test", HashedPassword: "NoHash"})
+	if err != nil {
+		t.Fatalf("cannot add user")
+	}
+
+	_, err = repo.AddUser(ctx, entity.User{Email: "test@mail.com", Username: "test2", HashedPassword: "NoHash"})
+	if !errors.Is(err, ErrEmailExists) {
+		t.Fatalf("expected ErrEmailExists, got %v", err)
+	}
+
+	_, err = repo.AddUser(ctx, entity.User{Email: "test2@mail.com", Username: "test", HashedPassword: "NoHash"})
+	if !errors.Is(err, ErrUsernameExists) {
+		t.Fatalf("expected ErrUsernameExists, got %v", err)
+	}
+
+	_, err = repo.DeleteUser(ctx, created.ID)
+	if err != nil {
+		t.Fatal("cannot delete user")
+	}
+
+	_, err = repo.AddUser(ctx, entity.User{Email: "test@mail.com", Username: "test", HashedPassword: "NoHash"})
+	if err != nil {
+		t.Fatalf("cannot add user after deleting its duplicate: %v", err)
+	}
+}
+
+func TestAddUsersConcurrentlyPositive(t *testing.T) {
+	ctx := context.Background()
+	repo := initRepo(ctx)
+
+	const usersCount = 20
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < usersCount; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			toCreate := entity.User{
+				Email:          fmt.Sprintf("test%d@mail.com", i),
+				Username:       fmt.Sprintf("test%d", i),
+				HashedPassword: "NoHash",
+			}
+
+			if _, err := repo.AddUser(ctx, toCreate); err != nil {
+				t.Errorf("cannot add user: %v", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	got := repo.GetAllUsers(ctx, 0, math.MaxInt64)
+	if len(got) != usersCount {
+		t.Fatalf("expected %d users, got %d", usersCount, len(got))
+	}
+
+	ids := make(map[int]bool, len(got))
+
+	for _, user := range got {
+		if ids[user.ID] {
+			t.Fatalf("duplicate user id %d", user.ID)
+		}
+
+		ids[user.ID] = true
+	}
+}
+
+func TestSnapshotMigrationGivesUsersRole(t *testing.T) {
+	// snapshots saved before users had roles are version 0, having bare tables
+	old := `{"users": {"1": {"ID": 1, "Username": "test", "Email": "test@mail.com"}}}`
+
+	db, _, err := inmemory.NewInMemDBFromJSON(context.Background(), old, "", InMemDBSchema()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewInMemUserRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := repo.GetUserByID(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Role != entity.RoleUser || user.Banned {
+		t.Fatalf("expected unbanned user with role %s, got role %q banned %v", entity.RoleUser, user.Role, user.Banned)
+	}
+}
+
+func TestGetUsersPageListsUsersAddedAfterFailedAdd(t *testing.T) {
+	ctx := context.Background()
+	repo := initRepo(ctx)
+
+	if _, err := repo.AddUser(ctx, entity.User{Email: "first@mail.com", Username: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the identifier allocated for the duplicate is not used by any user
+	if _, err := repo.AddUser(ctx, entity.User{Email: "first@mail.com", Username: "duplicate"}); !errors.Is(err, ErrEmailExists) {
+		t.Fatalf("expected %v, got %v", ErrEmailExists, err)
+	}
+
+	if _, err := repo.AddUser(ctx, entity.User{Email: "second@mail.com", Username: "second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	users := repo.GetUsersPage(ctx, entity.Page{Limit: 10})
+	if len(users) != 2 || users[0].Username != "first" || users[1].Username != "second" {
+		t.Fatalf("expected users first and second, got %v", usernames(users))
+	}
+
+	last := entity.UserCursor(users[1])
+
+	users = repo.GetUsersPage(ctx, entity.Page{Before: &last, Limit: 10})
+	if len(users) != 1 || users[0].Username != "first" {
+		t.Fatalf("expected user first before second, got %v", usernames(users))
+	}
+}
@@ -13,24 +13,42 @@ import (
 
 type AuthBasicService struct {
 	UserRepo userservice.UserRepo
+
+	// limiter locks logins after failed attempts, it's nil when logins are not limited
+	limiter *LoginLimiter
 }
 
-func NewBasicAuthService(ur userservice.UserRepo) *AuthBasicService {
+func NewBasicAuthService(ur userservice.UserRepo, limiter *LoginLimiter) *AuthBasicService {
 	return &AuthBasicService{
 		UserRepo: ur,
+		limiter:  limiter,
 	}
 }
 
 func (as *AuthBasicService) Login(ctx context.Context, loginReq request.LoginRequest) (*entity.User, error) {
+	// locked logins are rejected before the costly password comparison
+	if err := as.limiter.Check(loginReq.Username, loginReq.RemoteAddr); err != nil {
+		return nil, err
+	}
+
 	user, err := as.UserRepo.GetUserByUsername(ctx, loginReq.Username)
 	if err != nil {
+		as.limiter.Fail(loginReq.Username, loginReq.RemoteAddr)
 		return nil, err
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(loginReq.Password))
 	if err != nil {
+		as.limiter.Fail(loginReq.Username, loginReq.RemoteAddr)
 		return nil, err
 	}
 
+	as.limiter.Succeed(loginReq.Username)
+
+	// the password is checked first, so that the ban is only revealed to the user
+	if user.Banned {
+		return nil, ErrUserBanned
+	}
+
 	return user, nil
 }
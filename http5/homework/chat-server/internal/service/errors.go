@@ -0,0 +1,12 @@
+package service
+
+import "errors"
+
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrNoSigningKey  = errors.New("no key to sign tokens with")
+	ErrInvalidJWTKey = errors.New("invalid jwt key")
+	ErrNoSuchSession = errors.New("no such session")
+	ErrUserBanned    = errors.New("user is banned")
+	ErrLoginLocked   = errors.New("login is locked after too many failed attempts")
+)
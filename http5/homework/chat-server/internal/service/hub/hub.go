@@ -0,0 +1,168 @@
+package hub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+type EventType string
+
+const (
+	EventPublicMessage  EventType = "public_message"
+	EventPrivateMessage EventType = "private_message"
+)
+
+// Event is a message sent to the chat, only one of the messages is set by the type of the event.
+type Event struct {
+	Type           EventType
+	PublicMessage  *entity.PublicMessage
+	PrivateMessage *entity.PrivateMessage
+}
+
+// visibleTo reports whether the user is allowed to receive the event: public messages are delivered
+// to everyone and private ones only to their receiver.
+func (e Event) visibleTo(userID int) bool {
+	switch e.Type {
+	case EventPublicMessage:
+		return true
+	case EventPrivateMessage:
+		return e.PrivateMessage.To != nil && e.PrivateMessage.To.ID == userID
+	default:
+		return false
+	}
+}
+
+// Subscription receives events visible to its user until it is closed by the subscriber,
+// by the hub when the subscriber is too slow, or when the hub is closed.
+type Subscription struct {
+	UserID int
+
+	events chan Event
+	hub    *Hub
+}
+
+// Events is closed once the subscription is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops the delivery of events, it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// Hub delivers events to subscribers of connected users. Every subscription has a buffer
+// of bufferSize events, subscribers not keeping up with it are disconnected, so that a slow
+// client neither delays others nor makes the hub hold events without a limit.
+type Hub struct {
+	bufferSize int
+	logger     *logrus.Logger
+
+	m      sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub returns a hub which is closed with all of its subscriptions when ctx is done.
+func NewHub(ctx context.Context, bufferSize int, logger *logrus.Logger) *Hub {
+	h := &Hub{
+		bufferSize: bufferSize,
+		logger:     logger,
+		subs:       make(map[*Subscription]struct{}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		h.Close()
+	}()
+
+	return h
+}
+
+// Subscribe returns a subscription of the user, its events are closed at once if the hub is closed.
+func (h *Hub) Subscribe(userID int) *Subscription {
+	s := &Subscription{
+		UserID: userID,
+		events: make(chan Event, h.bufferSize),
+		hub:    h,
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.closed {
+		close(s.events)
+		return s
+	}
+
+	h.subs[s] = struct{}{}
+
+	return s
+}
+
+func (h *Hub) unsubscribe(s *Subscription) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+
+	delete(h.subs, s)
+	close(s.events)
+}
+
+// Publish delivers the event to subscribers it is visible to without waiting for them.
+func (h *Hub) Publish(event Event) {
+	var slow []*Subscription
+
+	h.m.RLock()
+
+	for s := range h.subs {
+		if !event.visibleTo(s.UserID) {
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		default:
+			slow = append(slow, s)
+		}
+	}
+
+	h.m.RUnlock()
+
+	for _, s := range slow {
+		h.logger.Warnf("subscription of user %d is disconnected, its buffer of %d events is full", s.UserID, h.bufferSize)
+		s.Close()
+	}
+}
+
+func (h *Hub) PublishPublicMessage(msg *entity.PublicMessage) {
+	h.Publish(Event{Type: EventPublicMessage, PublicMessage: msg})
+}
+
+func (h *Hub) PublishPrivateMessage(msg *entity.PrivateMessage) {
+	h.Publish(Event{Type: EventPrivateMessage, PrivateMessage: msg})
+}
+
+// Close closes all subscriptions, subscriptions made after it are closed at once.
+func (h *Hub) Close() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.closed = true
+
+	for s := range h.subs {
+		delete(h.subs, s)
+		close(s.events)
+	}
+}
@@ -0,0 +1,98 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+func receive(t *testing.T, sub *Subscription) (Event, bool) {
+	t.Helper()
+
+	select {
+	case event, ok := <-sub.Events():
+		return event, ok
+	case <-time.After(time.Second):
+		t.Fatal("expected event or closed subscription")
+		return Event{}, false
+	}
+}
+
+func expectNoEvent(t *testing.T, sub *Subscription) {
+	t.Helper()
+
+	select {
+	case event := <-sub.Events():
+		t.Fatalf("expected no event, got %+v", event)
+	default:
+	}
+}
+
+func TestHubDeliversPrivateMessagesToReceiverOnly(t *testing.T) {
+	h := NewHub(context.Background(), 4, logrus.New())
+
+	alice, bob := h.Subscribe(1), h.Subscribe(2)
+
+	h.PublishPublicMessage(&entity.PublicMessage{ID: 1, From: &entity.User{ID: 1}})
+	h.PublishPrivateMessage(&entity.PrivateMessage{ID: 1, From: &entity.User{ID: 1}, To: &entity.User{ID: 2}})
+
+	for _, sub := range []*Subscription{alice, bob} {
+		if event, _ := receive(t, sub); event.Type != EventPublicMessage {
+			t.Fatalf("expected public message for user %d, got %+v", sub.UserID, event)
+		}
+	}
+
+	if event, _ := receive(t, bob); event.Type != EventPrivateMessage || event.PrivateMessage.ID != 1 {
+		t.Fatalf("expected private message for receiver, got %+v", event)
+	}
+
+	expectNoEvent(t, alice)
+}
+
+func TestHubDisconnectsSlowSubscription(t *testing.T) {
+	h := NewHub(context.Background(), 2, logrus.New())
+
+	slow, fast := h.Subscribe(1), h.Subscribe(2)
+
+	for i := 1; i <= 3; i++ {
+		h.PublishPublicMessage(&entity.PublicMessage{ID: i})
+
+		if _, ok := receive(t, fast); !ok {
+			t.Fatal("expected subscription keeping up to stay connected")
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, ok := receive(t, slow); !ok {
+			t.Fatal("expected buffered events to be delivered before the subscription is closed")
+		}
+	}
+
+	if _, ok := receive(t, slow); ok {
+		t.Fatal("expected slow subscription to be closed")
+	}
+
+	// closing twice is fine
+	slow.Close()
+}
+
+func TestHubIsClosedWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h := NewHub(ctx, 1, logrus.New())
+	sub := h.Subscribe(1)
+
+	cancel()
+
+	if _, ok := receive(t, sub); ok {
+		t.Fatal("expected subscription to be closed with the hub")
+	}
+
+	if _, ok := receive(t, h.Subscribe(1)); ok {
+		t.Fatal("expected subscriptions of closed hub to be closed at once")
+	}
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+
+	userservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/user"
+)
+
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+
+	// minJWTKeyLen is the length of HS256 keys recommended by RFC 7518
+	minJWTKeyLen = 32
+)
+
+// JWTKey is a key tokens are signed with, ID is sent in the kid header of the tokens it signed.
+type JWTKey struct {
+	ID     string
+	Secret []byte
+}
+
+type JWTConfig struct {
+	// Keys verify tokens, the first one also signs new ones. A key is rotated by putting
+	// a new key first and keeping the old one until tokens signed by it expire.
+	Keys       []JWTKey
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// Limiter locks logins after failed attempts, logins are not limited without one
+	Limiter *LoginLimiter
+}
+
+type tokenClaims struct {
+	Username string      `json:"username"`
+	Role     entity.Role `json:"role"`
+	Type     string      `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// AuthJWTService checks passwords only on login and issues signed tokens,
+// requests are then authenticated by access tokens alone.
+type AuthJWTService struct {
+	UserRepo userservice.UserRepo
+
+	// passwords are checked the same way basic auth checks them
+	passwords *AuthBasicService
+
+	cfg  JWTConfig
+	keys map[string][]byte
+	m    sync.RWMutex
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewJWTAuthService(ur userservice.UserRepo, cfg JWTConfig) (*AuthJWTService, error) {
+	s := &AuthJWTService{
+		UserRepo:  ur,
+		passwords: NewBasicAuthService(ur, cfg.Limiter),
+		cfg:       cfg,
+		now:       time.Now,
+	}
+
+	if err := s.SetKeys(cfg.Keys); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetKeys replaces the keys of the service, tokens signed by keys no longer present become invalid.
+func (s *AuthJWTService) SetKeys(keys []JWTKey) error {
+	if len(keys) == 0 {
+		return ErrNoSigningKey
+	}
+
+	byID := make(map[string][]byte, len(keys))
+
+	for _, key := range keys {
+		if key.ID == "" || len(key.Secret) < minJWTKeyLen {
+			return fmt.Errorf("%w: key %q must have an id and at least %d bytes", ErrInvalidJWTKey, key.ID, minJWTKeyLen)
+		}
+
+		byID[key.ID] = key.Secret
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.cfg.Keys = keys
+	s.keys = byID
+
+	return nil
+}
+
+func (s *AuthJWTService) Login(ctx context.Context, loginReq request.LoginRequest) (*entity.User, error) {
+	return s.passwords.Login(ctx, loginReq)
+}
+
+// IssueTokens checks the password of the user and issues a new pair of tokens.
+func (s *AuthJWTService) IssueTokens(ctx context.Context, loginReq request.LoginRequest) (*entity.TokenPair, error) {
+	user, err := s.Login(ctx, loginReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issue(user)
+}
+
+// RefreshTokens issues a new pair of tokens for the user the refresh token was issued to.
+// The user is looked up again, so a deleted user can't refresh.
+func (s *AuthJWTService) RefreshTokens(ctx context.Context, refreshToken string) (*entity.TokenPair, error) {
+	claims, err := s.parse(refreshToken, tokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	user, err := s.UserRepo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Banned {
+		return nil, ErrUserBanned
+	}
+
+	return s.issue(user)
+}
+
+// Authenticate returns the user the access token was issued to, only its ID, username and role are set.
+// Roles and bans apply to access tokens once they are refreshed, services check them again for privileged actions.
+func (s *AuthJWTService) Authenticate(_ context.Context, accessToken string) (*entity.User, error) {
+	claims, err := s.parse(accessToken, tokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return &entity.User{ID: id, Username: claims.Username, Role: claims.Role}, nil
+}
+
+func (s *AuthJWTService) issue(user *entity.User) (*entity.TokenPair, error) {
+	now := s.now()
+
+	access, err := s.sign(user, tokenTypeAccess, now, now.Add(s.cfg.AccessTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := s.sign(user, tokenTypeRefresh, now, now.Add(s.cfg.RefreshTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.TokenPair{
+		AccessToken:      access,
+		AccessExpiresAt:  now.Add(s.cfg.AccessTTL),
+		RefreshToken:     refresh,
+		RefreshExpiresAt: now.Add(s.cfg.RefreshTTL),
+	}, nil
+}
+
+func (s *AuthJWTService) sign(user *entity.User, tokenType string, issuedAt, expiresAt time.Time) (string, error) {
+	jti := make([]byte, 16)
+
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		Type:     tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        hex.EncodeToString(jti),
+		},
+	})
+
+	s.m.RLock()
+	key := s.cfg.Keys[0]
+	s.m.RUnlock()
+
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Secret)
+}
+
+func (s *AuthJWTService) parse(tokenString string, tokenType string) (*tokenClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(s.now),
+	)
+
+	var claims tokenClaims
+
+	_, err := parser.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		s.m.RLock()
+		key, ok := s.keys[kid]
+		s.m.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	// a refresh token must not be accepted as an access token and the other way round
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("%w: expected %s token, got %q", ErrInvalidToken, tokenType, claims.Type)
+	}
+
+	return &claims, nil
+}
+
+// LoadJWTKeys reads keys from a file with a "<id> <secret>" line per key, the first key signs tokens.
+// Empty lines and lines starting with # are skipped.
+func LoadJWTKeys(path string) ([]JWTKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var keys []JWTKey
+
+	scanner := bufio.NewScanner(file)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		id, secret, found := strings.Cut(text, " ")
+		if !found {
+			return nil, fmt.Errorf("%w: line %d is not \"<id> <secret>\"", ErrInvalidJWTKey, line)
+		}
+
+		keys = append(keys, JWTKey{ID: id, Secret: []byte(strings.TrimSpace(secret))})
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
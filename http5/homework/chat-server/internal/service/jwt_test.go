@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+const testPassword = "password"
+
+var (
+	oldKey = JWTKey{ID: "old", Secret: []byte(strings.Repeat("o", minJWTKeyLen))}
+	newKey = JWTKey{ID: "new", Secret: []byte(strings.Repeat("n", minJWTKeyLen))}
+)
+
+func initJWTService(t *testing.T, keys ...JWTKey) (*AuthJWTService, *entity.User) {
+	t.Helper()
+
+	db, _ := inmemory.NewInMemDB(context.Background(), "", repository.InMemDBSchema()...)
+
+	users, err := repository.NewInMemUserRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := users.AddUser(context.Background(), entity.User{
+		Username:       "test",
+		Email:          "test@mail.com",
+		HashedPassword: string(hashed),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewJWTAuthService(users, JWTConfig{
+		Keys:       keys,
+		Issuer:     "test",
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, user
+}
+
+func issueTokens(t *testing.T, s *AuthJWTService) *entity.TokenPair {
+	t.Helper()
+
+	tokens, err := s.IssueTokens(context.Background(), request.LoginRequest{Username: "test", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokens
+}
+
+func TestJWTAccessTokenAuthenticatesUser(t *testing.T) {
+	s, user := initJWTService(t, newKey)
+
+	tokens := issueTokens(t, s)
+
+	got, err := s.Authenticate(context.Background(), tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != user.ID || got.Username != user.Username {
+		t.Fatalf("expected user %d %s, got %d %s", user.ID, user.Username, got.ID, got.Username)
+	}
+}
+
+func TestJWTWrongPasswordIssuesNoTokens(t *testing.T) {
+	s, _ := initJWTService(t, newKey)
+
+	_, err := s.IssueTokens(context.Background(), request.LoginRequest{Username: "test", Password: "wrong"})
+	if err == nil {
+		t.Fatal("expected error for wrong password")
+	}
+}
+
+func TestJWTTokenExpires(t *testing.T) {
+	s, _ := initJWTService(t, newKey)
+
+	tokens := issueTokens(t, s)
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+
+	if _, err := s.Authenticate(context.Background(), tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected expired access token to be invalid, got %v", err)
+	}
+
+	// the refresh token lives longer
+	if _, err := s.RefreshTokens(context.Background(), tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTTokenTypesAreNotInterchangeable(t *testing.T) {
+	s, _ := initJWTService(t, newKey)
+
+	tokens := issueTokens(t, s)
+
+	if _, err := s.Authenticate(context.Background(), tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected refresh token to be rejected as access token, got %v", err)
+	}
+
+	if _, err := s.RefreshTokens(context.Background(), tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected access token to be rejected as refresh token, got %v", err)
+	}
+}
+
+func TestJWTTamperedTokenIsInvalid(t *testing.T) {
+	s, _ := initJWTService(t, newKey)
+
+	tokens := issueTokens(t, s)
+
+	parts := strings.Split(tokens.AccessToken, ".")
+	parts[1] = parts[1][:len(parts[1])-2] + "xx"
+
+	if _, err := s.Authenticate(context.Background(), strings.Join(parts, ".")); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected tampered token to be invalid, got %v", err)
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	s, _ := initJWTService(t, oldKey)
+
+	oldTokens := issueTokens(t, s)
+
+	// the new key signs, the old one still verifies
+	if err := s.SetKeys([]JWTKey{newKey, oldKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	newTokens := issueTokens(t, s)
+
+	for _, token := range []string{oldTokens.AccessToken, newTokens.AccessToken} {
+		if _, err := s.Authenticate(context.Background(), token); err != nil {
+			t.Fatalf("expected token to be valid during rotation, got %v", err)
+		}
+	}
+
+	if err := s.SetKeys([]JWTKey{newKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Authenticate(context.Background(), oldTokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected token of removed key to be invalid, got %v", err)
+	}
+
+	if _, err := s.Authenticate(context.Background(), newTokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTShortKeyIsRejected(t *testing.T) {
+	s, _ := initJWTService(t, newKey)
+
+	err := s.SetKeys([]JWTKey{{ID: "short", Secret: []byte("secret")}})
+	if !errors.Is(err, ErrInvalidJWTKey) {
+		t.Fatalf("expected ErrInvalidJWTKey, got %v", err)
+	}
+
+	if err = s.SetKeys(nil); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("expected ErrNoSigningKey, got %v", err)
+	}
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt.keys")
+
+	content := "# signing key first\n" + "new " + string(newKey.Secret) + "\n\n" + "old " + string(oldKey.Secret) + "\n"
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadJWTKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0].ID != "new" || string(keys[1].Secret) != string(oldKey.Secret) {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+
+	if err = os.WriteFile(path, []byte("no-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = LoadJWTKeys(path); !errors.Is(err, ErrInvalidJWTKey) {
+		t.Fatalf("expected ErrInvalidJWTKey, got %v", err)
+	}
+}
+
+func TestJWTBannedUserCantRefresh(t *testing.T) {
+	s, user := initJWTService(t, newKey)
+
+	tokens := issueTokens(t, s)
+
+	user.Banned = true
+
+	if _, err := s.UserRepo.UpdateUser(context.Background(), user.ID, *user); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RefreshTokens(context.Background(), tokens.RefreshToken); !errors.Is(err, ErrUserBanned) {
+		t.Fatalf("expected ErrUserBanned, got %v", err)
+	}
+}
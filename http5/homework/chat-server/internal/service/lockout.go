@@ -0,0 +1,244 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+// maxDelayShift keeps doubling of the lockout delay from overflowing.
+const maxDelayShift = 30
+
+// LockoutConfig is how failed logins are limited. Usernames and client addresses are limited
+// separately: a username is locked by its failures from any address, so spreading guesses over
+// addresses doesn't help, and an address by failures of any usernames, so spraying a password
+// over usernames doesn't either. Addresses are allowed more failures since clients may share one.
+type LockoutConfig struct {
+	// UsernameAttempts and AddrAttempts are failures allowed before logins are locked
+	UsernameAttempts int
+	AddrAttempts     int
+	// BaseDelay is the first lockout, it doubles with every failure after it up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Forget is how long failures are remembered after the last one
+	Forget time.Duration
+}
+
+// LockedError is returned for logins of locked usernames and addresses, no password is compared for them.
+type LockedError struct {
+	Kind  entity.LockoutKind
+	Until time.Time
+	wait  time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s: %s is locked for %s", ErrLoginLocked, e.Kind, e.RetryAfter())
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLoginLocked
+}
+
+// RetryAfter is how long the login stays locked, rounded up to seconds.
+func (e *LockedError) RetryAfter() time.Duration {
+	return (e.wait + time.Second - 1).Truncate(time.Second)
+}
+
+type lockoutKey struct {
+	kind    entity.LockoutKind
+	subject string
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginLimiter tracks failed logins and locks usernames and addresses having too many of them
+// with exponential backoff. A nil limiter allows every login.
+type LoginLimiter struct {
+	cfg    LockoutConfig
+	logger *logrus.Logger
+
+	m         sync.Mutex
+	attempts  map[lockoutKey]*loginAttempts
+	lastPrune time.Time
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewLoginLimiter(cfg LockoutConfig, logger *logrus.Logger) *LoginLimiter {
+	return &LoginLimiter{
+		cfg:      cfg,
+		logger:   logger,
+		attempts: make(map[lockoutKey]*loginAttempts),
+		now:      time.Now,
+	}
+}
+
+// clientAddr drops the port of a remote address, so that the address is limited as a whole.
+func clientAddr(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return host
+}
+
+func (l *LoginLimiter) keys(username, remoteAddr string) []lockoutKey {
+	keys := []lockoutKey{{kind: entity.LockoutKindUsername, subject: username}}
+
+	if addr := clientAddr(remoteAddr); addr != "" {
+		keys = append(keys, lockoutKey{kind: entity.LockoutKindAddr, subject: addr})
+	}
+
+	return keys
+}
+
+// Check returns LockedError if either the username or the address is locked.
+func (l *LoginLimiter) Check(username, remoteAddr string) error {
+	if l == nil {
+		return nil
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := l.now()
+
+	for _, key := range l.keys(username, remoteAddr) {
+		attempts, ok := l.attempts[key]
+		if ok && now.Before(attempts.lockedUntil) {
+			l.logger.Infof("login of %s %q rejected, locked until %s", key.kind, key.subject, attempts.lockedUntil.Format(time.RFC3339))
+
+			return &LockedError{Kind: key.kind, Until: attempts.lockedUntil, wait: attempts.lockedUntil.Sub(now)}
+		}
+	}
+
+	return nil
+}
+
+// Fail records a failed login of the username from the address, locking them once they have too many.
+func (l *LoginLimiter) Fail(username, remoteAddr string) {
+	if l == nil {
+		return
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := l.now()
+
+	l.prune(now)
+
+	for _, key := range l.keys(username, remoteAddr) {
+		attempts, ok := l.attempts[key]
+		if !ok || now.Sub(attempts.lastFailure) > l.cfg.Forget {
+			attempts = &loginAttempts{}
+			l.attempts[key] = attempts
+		}
+
+		attempts.failures++
+		attempts.lastFailure = now
+
+		allowed := l.cfg.UsernameAttempts
+		if key.kind == entity.LockoutKindAddr {
+			allowed = l.cfg.AddrAttempts
+		}
+
+		if attempts.failures < allowed {
+			l.logger.Infof("failed login of %s %q, %d failed attempts", key.kind, key.subject, attempts.failures)
+			continue
+		}
+
+		delay := l.cfg.BaseDelay << min(attempts.failures-allowed, maxDelayShift)
+		if delay > l.cfg.MaxDelay || delay <= 0 {
+			delay = l.cfg.MaxDelay
+		}
+
+		attempts.lockedUntil = now.Add(delay)
+
+		l.logger.Warnf("login of %s %q locked for %s after %d failed attempts", key.kind, key.subject, delay, attempts.failures)
+	}
+}
+
+// Succeed forgets failed logins of the username. Failures of the address are kept,
+// so that knowing one password doesn't reset guesses of other usernames.
+func (l *LoginLimiter) Succeed(username string) {
+	if l == nil {
+		return
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	delete(l.attempts, lockoutKey{kind: entity.LockoutKindUsername, subject: username})
+}
+
+// prune drops attempts which are forgotten, so that guessed usernames don't pile up.
+// It runs at most once per Forget.
+func (l *LoginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.cfg.Forget {
+		return
+	}
+
+	l.lastPrune = now
+
+	for key, attempts := range l.attempts {
+		if now.Sub(attempts.lastFailure) > l.cfg.Forget && !now.Before(attempts.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+// Lockouts returns usernames and addresses having failed logins which are not forgotten yet,
+// ordered by kind and subject.
+func (l *LoginLimiter) Lockouts() []*entity.LoginLockout {
+	if l == nil {
+		return nil
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := l.now()
+	lockouts := make([]*entity.LoginLockout, 0, len(l.attempts))
+
+	for key, attempts := range l.attempts {
+		if now.Sub(attempts.lastFailure) > l.cfg.Forget && !now.Before(attempts.lockedUntil) {
+			continue
+		}
+
+		lockout := entity.LoginLockout{
+			Kind:        key.kind,
+			Subject:     key.subject,
+			Failures:    attempts.failures,
+			LastFailure: attempts.lastFailure,
+		}
+
+		if now.Before(attempts.lockedUntil) {
+			lockout.LockedUntil = attempts.lockedUntil
+		}
+
+		lockouts = append(lockouts, &lockout)
+	}
+
+	sort.Slice(lockouts, func(i, j int) bool {
+		if lockouts[i].Kind != lockouts[j].Kind {
+			return lockouts[i].Kind > lockouts[j].Kind // usernames first
+		}
+
+		return lockouts[i].Subject < lockouts[j].Subject
+	})
+
+	return lockouts
+}
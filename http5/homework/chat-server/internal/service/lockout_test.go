@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+)
+
+var testLockoutConfig = LockoutConfig{
+	UsernameAttempts: 3,
+	AddrAttempts:     5,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	Forget:           time.Hour,
+}
+
+// initLimiter returns a limiter with a clock which only moves when the returned function is called.
+func initLimiter() (*LoginLimiter, func(d time.Duration)) {
+	l := NewLoginLimiter(testLockoutConfig, logrus.New())
+
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func lockedFor(t *testing.T, err error) time.Duration {
+	t.Helper()
+
+	var locked *LockedError
+
+	if !errors.As(err, &locked) || !errors.Is(err, ErrLoginLocked) {
+		t.Fatalf("expected LockedError, got %v", err)
+	}
+
+	return locked.RetryAfter()
+}
+
+func TestLoginLimiterBacksOffExponentially(t *testing.T) {
+	l, advance := initLimiter()
+
+	for i := 0; i < testLockoutConfig.UsernameAttempts-1; i++ {
+		l.Fail("test", "1.1.1.1:1000")
+	}
+
+	if err := l.Check("test", "1.1.1.1:1000"); err != nil {
+		t.Fatalf("expected login to be allowed before the limit, got %v", err)
+	}
+
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		// another port of the address is still the same client
+		l.Fail("test", "1.1.1.1:2000")
+
+		if got := lockedFor(t, l.Check("test", "1.1.1.1:3000")); got != expected {
+			t.Fatalf("expected lockout of %s, got %s", expected, got)
+		}
+
+		advance(expected)
+
+		if err := l.Check("test", "1.1.1.1:1000"); err != nil {
+			t.Fatalf("expected lockout to end, got %v", err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		l.Fail("test", "2.2.2.2:1000")
+	}
+
+	if got := lockedFor(t, l.Check("test", "3.3.3.3:1000")); got != testLockoutConfig.MaxDelay {
+		t.Fatalf("expected lockout to be capped at %s, got %s", testLockoutConfig.MaxDelay, got)
+	}
+}
+
+func TestLoginLimiterLocksAddrAcrossUsernames(t *testing.T) {
+	l, _ := initLimiter()
+
+	for _, username := range []string{"a", "b", "c", "d", "e"} {
+		l.Fail(username, "1.1.1.1:1000")
+	}
+
+	lockedFor(t, l.Check("f", "1.1.1.1:1000"))
+
+	if err := l.Check("f", "2.2.2.2:1000"); err != nil {
+		t.Fatalf("expected other addresses to be allowed, got %v", err)
+	}
+
+	// knowing one password doesn't unlock the address
+	l.Succeed("f")
+
+	lockedFor(t, l.Check("f", "1.1.1.1:1000"))
+}
+
+func TestLoginLimiterSuccessForgetsUsername(t *testing.T) {
+	l, advance := initLimiter()
+
+	for i := 0; i < testLockoutConfig.UsernameAttempts-1; i++ {
+		l.Fail("test", "1.1.1.1:1000")
+	}
+
+	l.Succeed("test")
+	l.Fail("test", "2.2.2.2:1000")
+
+	if err := l.Check("test", "2.2.2.2:1000"); err != nil {
+		t.Fatalf("expected failures to be forgotten after success, got %v", err)
+	}
+
+	lockouts := l.Lockouts()
+	if len(lockouts) != 3 || lockouts[0].Kind != entity.LockoutKindUsername || lockouts[0].Failures != 1 {
+		t.Fatalf("unexpected lockouts %+v", lockouts)
+	}
+
+	advance(testLockoutConfig.Forget + time.Second)
+
+	if lockouts = l.Lockouts(); len(lockouts) != 0 {
+		t.Fatalf("expected failures to be forgotten, got %+v", lockouts)
+	}
+}
+
+func TestLoginIsLockedAfterFailedAttempts(t *testing.T) {
+	s, _ := initJWTService(t, newKey)
+
+	limiter, _ := initLimiter()
+	s.passwords.limiter = limiter
+
+	wrong := request.LoginRequest{Username: "test", Password: "wrong", RemoteAddr: "1.1.1.1:1000"}
+
+	for i := 0; i < testLockoutConfig.UsernameAttempts; i++ {
+		if _, err := s.Login(context.Background(), wrong); err == nil || errors.Is(err, ErrLoginLocked) {
+			t.Fatalf("expected wrong password error, got %v", err)
+		}
+	}
+
+	// the right password doesn't help while the username is locked
+	right := request.LoginRequest{Username: "test", Password: testPassword, RemoteAddr: "2.2.2.2:1000"}
+
+	if _, err := s.Login(context.Background(), right); !errors.Is(err, ErrLoginLocked) {
+		t.Fatalf("expected ErrLoginLocked, got %v", err)
+	}
+}
@@ -3,22 +3,33 @@ package message
 import (
 	"context"
 	"errors"
-	"math"
+	"fmt"
 
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/pagination"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/policy"
 	sliceutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/slice"
 )
 
 type PrivateMessageRepo interface {
 	AddPrivateMessage(ctx context.Context, msg entity.PrivateMessage) (*entity.PrivateMessage, error)
 	GetAllPrivateMessages(ctx context.Context, offset, limit int) []*entity.PrivateMessage
+	GetAllPrivateMessagesTo(ctx context.Context, toID int, offset, limit int) []*entity.PrivateMessage
+	GetPrivateMessagesToAfter(ctx context.Context, toID, afterID, limit int) []*entity.PrivateMessage
+	GetPrivateMessagesToPage(ctx context.Context, toID int, page entity.Page) []*entity.PrivateMessage
+	GetPrivateMessagesFromUserPage(ctx context.Context, toID, fromID int, page entity.Page) []*entity.PrivateMessage
+	GetAllPrivateMessagesFromUser(ctx context.Context, toID, fromID int, offset, limit int) []*entity.PrivateMessage
 	GetPrivateMessage(ctx context.Context, id int) (*entity.PrivateMessage, error)
+	DeletePrivateMessage(ctx context.Context, id int) error
 }
 
 type PublicMessageRepo interface {
 	AddPublicMessage(ctx context.Context, msg entity.PublicMessage) (*entity.PublicMessage, error)
 	GetAllPublicMessages(ctx context.Context, offset, limit int) []*entity.PublicMessage
+	GetPublicMessagesAfter(ctx context.Context, afterID, limit int) []*entity.PublicMessage
+	GetPublicMessagesPage(ctx context.Context, page entity.Page) []*entity.PublicMessage
 	GetPublicMessage(ctx context.Context, id int) (*entity.PublicMessage, error)
+	DeletePublicMessage(ctx context.Context, id int) error
 }
 
 type UserRepo interface {
@@ -29,25 +40,35 @@ type UserRepo interface {
 	GetAllUsers(ctx context.Context, offset, limit int) []*entity.User
 	DeleteUser(ctx context.Context, id int) (*entity.User, error)
 	UpdateUser(ctx context.Context, id int, updateModel entity.User) (*entity.User, error)
-	CheckUniqueConstraints(ctx context.Context, email, username string) error
+}
+
+// Publisher delivers sent messages to connected clients.
+type Publisher interface {
+	PublishPublicMessage(msg *entity.PublicMessage)
+	PublishPrivateMessage(msg *entity.PrivateMessage)
 }
 
 var (
 	ErrNoSuchReceiver = errors.New("no such receiver")
 	ErrNoSuchSender   = errors.New("no such sender")
+	ErrSenderBanned   = errors.New("sender is banned")
+	ErrNoSuchMessage  = errors.New("no such message")
 )
 
 type MessageService struct {
 	PrivateMessageRepo PrivateMessageRepo
 	PublicMessageRepo  PublicMessageRepo
 	UserRepo           UserRepo
+	// Publisher is nil when messages are only read from the repositories
+	Publisher Publisher
 }
 
-func NewMessageService(pr PrivateMessageRepo, pb PublicMessageRepo, ur UserRepo) *MessageService {
+func NewMessageService(pr PrivateMessageRepo, pb PublicMessageRepo, ur UserRepo, publisher Publisher) *MessageService {
 	return &MessageService{
 		PrivateMessageRepo: pr,
 		PublicMessageRepo:  pb,
 		UserRepo:           ur,
+		Publisher:          publisher,
 	}
 }
 
@@ -57,6 +78,10 @@ func (ms *MessageService) SendPrivateMessage(ctx context.Context, fromID, toID i
 		return nil, ErrNoSuchSender
 	}
 
+	if userFrom.Banned {
+		return nil, ErrSenderBanned
+	}
+
 	userTo, err := ms.UserRepo.GetUserByID(ctx, toID)
 	if err != nil {
 		return nil, ErrNoSuchReceiver
@@ -73,6 +98,10 @@ func (ms *MessageService) SendPrivateMessage(ctx context.Context, fromID, toID i
 		return nil, err
 	}
 
+	if ms.Publisher != nil {
+		ms.Publisher.PublishPrivateMessage(created)
+	}
+
 	return created, nil
 }
 
@@ -82,6 +111,10 @@ func (ms *MessageService) SendPublicMessage(ctx context.Context, fromID int, con
 		return nil, err
 	}
 
+	if userFrom.Banned {
+		return nil, ErrSenderBanned
+	}
+
 	msg := entity.PublicMessage{
 		From:    userFrom,
 		Content: content,
@@ -92,6 +125,10 @@ func (ms *MessageService) SendPublicMessage(ctx context.Context, fromID int, con
 		return nil, err
 	}
 
+	if ms.Publisher != nil {
+		ms.Publisher.PublishPublicMessage(created)
+	}
+
 	return created, nil
 }
 
@@ -106,12 +143,44 @@ func (ms *MessageService) GetPrivateMessage(ctx context.Context, id int) (*entit
 }
 
 func (ms *MessageService) GetAllPrivateMessages(ctx context.Context, userToID int, offset, limit int) []*entity.PrivateMessage {
-	messages := ms.PrivateMessageRepo.GetAllPrivateMessages(ctx, 0, math.MaxInt64)
+	return ms.PrivateMessageRepo.GetAllPrivateMessagesTo(ctx, userToID, offset, limit)
+}
+
+// GetPrivateMessagesPage returns the page of private messages to the user, ordered by the time they were sent,
+// with cursors of the pages around it.
+func (ms *MessageService) GetPrivateMessagesPage(
+	ctx context.Context,
+	userToID int,
+	page entity.Page,
+) ([]*entity.PrivateMessage, entity.PageCursors) {
+	return pagination.Read(page, func(page entity.Page) []*entity.PrivateMessage {
+		return ms.PrivateMessageRepo.GetPrivateMessagesToPage(ctx, userToID, page)
+	}, entity.PrivateMessageCursor)
+}
+
+// GetPrivateMessagesFromUserPage returns the page of private messages from one user to another,
+// ordered by the time they were sent, with cursors of the pages around it.
+func (ms *MessageService) GetPrivateMessagesFromUserPage(
+	ctx context.Context,
+	toID, fromID int,
+	page entity.Page,
+) ([]*entity.PrivateMessage, entity.PageCursors, error) {
+	_, err := ms.UserRepo.GetUserByID(ctx, fromID)
+	if err != nil {
+		return nil, entity.PageCursors{}, err
+	}
 
-	// return only messages that were sent to current user
-	messages = sliceutils.Filter(messages, func(msg *entity.PrivateMessage) bool { return msg.To.ID == userToID })
+	messages, cursors := pagination.Read(page, func(page entity.Page) []*entity.PrivateMessage {
+		return ms.PrivateMessageRepo.GetPrivateMessagesFromUserPage(ctx, toID, fromID, page)
+	}, entity.PrivateMessageCursor)
 
-	return sliceutils.Slice(messages, offset, limit)
+	return messages, cursors, nil
+}
+
+// GetPrivateMessagesAfter returns up to limit private messages to the user sent after the one of afterID,
+// in the order they were sent.
+func (ms *MessageService) GetPrivateMessagesAfter(ctx context.Context, userToID, afterID, limit int) []*entity.PrivateMessage {
+	return ms.PrivateMessageRepo.GetPrivateMessagesToAfter(ctx, userToID, afterID, limit)
 }
 
 func (ms *MessageService) GetAllPrivateMessagesFromUser(ctx context.Context, toID, fromID int, offset, limit int) ([]*entity.PrivateMessage, error) {
@@ -120,10 +189,12 @@ func (ms *MessageService) GetAllPrivateMessagesFromUser(ctx context.Context, toI
 		return nil, err
 	}
 
-	messages := ms.PrivateMessageRepo.GetAllPrivateMessages(ctx, 0, math.MaxInt64)
-	messages = sliceutils.Filter(messages, func(msg *entity.PrivateMessage) bool { return msg.From.ID == fromID && msg.To.ID == toID })
+	return ms.PrivateMessageRepo.GetAllPrivateMessagesFromUser(ctx, toID, fromID, offset, limit), nil
+}
 
-	return sliceutils.Slice(messages, offset, limit), nil
+// GetPublicMessagesAfter returns up to limit public messages sent after the one of afterID, in the order they were sent.
+func (ms *MessageService) GetPublicMessagesAfter(ctx context.Context, afterID, limit int) []*entity.PublicMessage {
+	return ms.PublicMessageRepo.GetPublicMessagesAfter(ctx, afterID, limit)
 }
 
 func (ms *MessageService) GetPublicMessage(ctx context.Context, id int) (*entity.PublicMessage, error) {
@@ -139,9 +210,41 @@ func (ms *MessageService) GetAllPublicMessages(ctx context.Context, offset, limi
 	return ms.PublicMessageRepo.GetAllPublicMessages(ctx, offset, limit)
 }
 
+// GetPublicMessagesPage returns the page of public messages ordered by the time they were sent,
+// with cursors of the pages around it.
+func (ms *MessageService) GetPublicMessagesPage(ctx context.Context, page entity.Page) ([]*entity.PublicMessage, entity.PageCursors) {
+	return pagination.Read(page, func(page entity.Page) []*entity.PublicMessage {
+		return ms.PublicMessageRepo.GetPublicMessagesPage(ctx, page)
+	}, entity.PublicMessageCursor)
+}
+
 func (ms *MessageService) GetAllUsersThatSentMessage(ctx context.Context, toID int, offset, limit int) []*entity.User {
 	messages := ms.GetAllPrivateMessages(ctx, toID, offset, limit)
 	usersDuplicates := sliceutils.Map(messages, func(msg *entity.PrivateMessage) *entity.User { return msg.From })
 
 	return sliceutils.Unique(usersDuplicates)
 }
+
+func (ms *MessageService) DeletePublicMessage(ctx context.Context, actorID, id int) error {
+	if _, err := policy.Authorize(ctx, ms.UserRepo, actorID, entity.PermissionDeleteMessages); err != nil {
+		return err
+	}
+
+	if err := ms.PublicMessageRepo.DeletePublicMessage(ctx, id); err != nil {
+		return fmt.Errorf("%w: %w", ErrNoSuchMessage, err)
+	}
+
+	return nil
+}
+
+func (ms *MessageService) DeletePrivateMessage(ctx context.Context, actorID, id int) error {
+	if _, err := policy.Authorize(ctx, ms.UserRepo, actorID, entity.PermissionDeleteMessages); err != nil {
+		return err
+	}
+
+	if err := ms.PrivateMessageRepo.DeletePrivateMessage(ctx, id); err != nil {
+		return fmt.Errorf("%w: %w", ErrNoSuchMessage, err)
+	}
+
+	return nil
+}
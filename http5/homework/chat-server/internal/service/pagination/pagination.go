@@ -0,0 +1,41 @@
+package pagination
+
+import (
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+// Read reads the page by read and returns its items with cursors around them. read gets one more item
+// than the page holds to tell whether more items follow the page in the direction it is read,
+// it returns items in the order of the listing.
+func Read[T any](page entity.Page, read func(page entity.Page) []*T, cursorOf func(item *T) entity.Cursor) ([]*T, entity.PageCursors) {
+	ask := page
+	ask.Limit++
+
+	items := read(ask)
+
+	more := len(items) > page.Limit
+	if more && page.Backward() {
+		items = items[len(items)-page.Limit:]
+	} else if more {
+		items = items[:page.Limit]
+	}
+
+	var cursors entity.PageCursors
+
+	if len(items) == 0 {
+		return items, cursors
+	}
+
+	first, last := cursorOf(items[0]), cursorOf(items[len(items)-1])
+
+	// the cursor a page is read from points at an item on the other side of it
+	if more || page.Backward() {
+		cursors.Next = &last
+	}
+
+	if more && page.Backward() || page.After != nil {
+		cursors.Prev = &first
+	}
+
+	return items, cursors
+}
@@ -0,0 +1,91 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+func TestRead(t *testing.T) {
+	start := time.Now()
+
+	var listing []*entity.PublicMessage
+	for id := 1; id <= 5; id++ {
+		listing = append(listing, &entity.PublicMessage{ID: id, SentAt: start.Add(time.Duration(id) * time.Second)})
+	}
+
+	// read lists the page the way repositories do
+	read := func(page entity.Page) []*entity.PublicMessage {
+		var items []*entity.PublicMessage
+
+		for _, msg := range listing {
+			if page.Contains(msg.ID, msg.SentAt) {
+				items = append(items, msg)
+			}
+		}
+
+		if page.Backward() && len(items) > page.Limit {
+			return items[len(items)-page.Limit:]
+		}
+
+		if len(items) > page.Limit {
+			return items[:page.Limit]
+		}
+
+		return items
+	}
+
+	cursor := func(id int) *entity.Cursor {
+		c := entity.PublicMessageCursor(listing[id-1])
+		return &c
+	}
+
+	tests := []struct {
+		name       string
+		page       entity.Page
+		ids        []int
+		next, prev int
+	}{
+		{name: "first", page: entity.Page{Limit: 2}, ids: []int{1, 2}, next: 2},
+		{name: "middle", page: entity.Page{After: cursor(2), Limit: 2}, ids: []int{3, 4}, next: 4, prev: 3},
+		{name: "last", page: entity.Page{After: cursor(4), Limit: 2}, ids: []int{5}, prev: 5},
+		{name: "past last", page: entity.Page{After: cursor(5), Limit: 2}},
+		{name: "whole", page: entity.Page{Limit: 5}, ids: []int{1, 2, 3, 4, 5}},
+		{name: "before middle", page: entity.Page{Before: cursor(4), Limit: 2}, ids: []int{2, 3}, next: 3, prev: 2},
+		{name: "before second", page: entity.Page{Before: cursor(2), Limit: 2}, ids: []int{1}, next: 1},
+	}
+
+	cursorID := func(c *entity.Cursor) int {
+		if c == nil {
+			return 0
+		}
+
+		return c.ID
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, cursors := Read(tt.page, read, entity.PublicMessageCursor)
+
+			ids := make([]int, 0, len(items))
+			for _, msg := range items {
+				ids = append(ids, msg.ID)
+			}
+
+			if len(ids) != len(tt.ids) {
+				t.Fatalf("expected items %v, got %v", tt.ids, ids)
+			}
+
+			for i := range ids {
+				if ids[i] != tt.ids[i] {
+					t.Fatalf("expected items %v, got %v", tt.ids, ids)
+				}
+			}
+
+			if next, prev := cursorID(cursors.Next), cursorID(cursors.Prev); next != tt.next || prev != tt.prev {
+				t.Fatalf("expected next %d and prev %d cursors, got %d and %d", tt.next, tt.prev, next, prev)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+)
+
+var ErrForbidden = errors.New("action is not permitted")
+
+type UserGetter interface {
+	GetUserByID(ctx context.Context, id int) (*entity.User, error)
+}
+
+// Authorize returns the user acting if they are allowed the permission. The user is looked up
+// on every check, so a changed role or a ban applies at once, even to tokens issued before.
+func Authorize(ctx context.Context, users UserGetter, actorID int, permission entity.Permission) (*entity.User, error) {
+	actor, err := users.GetUserByID(ctx, actorID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrForbidden, err)
+	}
+
+	if !actor.Can(permission) {
+		return nil, fmt.Errorf("%w: user %d can't %s", ErrForbidden, actorID, permission)
+	}
+
+	return actor, nil
+}
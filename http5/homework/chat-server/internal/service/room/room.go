@@ -0,0 +1,266 @@
+package room
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/pagination"
+)
+
+type RoomRepo interface {
+	// AddRoom adds the room and its owner as a joined member of it
+	AddRoom(ctx context.Context, room entity.Room) (*entity.Room, error)
+	GetRoom(ctx context.Context, id int) (*entity.Room, error)
+	// GetRoomsPage returns the page of rooms the user can see, public ones and the ones the user is a member of or invited to
+	GetRoomsPage(ctx context.Context, userID int, page entity.Page) []*entity.Room
+	AddRoomMember(ctx context.Context, member entity.RoomMember) (*entity.RoomMember, error)
+	GetRoomMember(ctx context.Context, roomID, userID int) (*entity.RoomMember, error)
+	SetRoomMemberStatus(ctx context.Context, roomID, userID int, status entity.RoomMemberStatus) (*entity.RoomMember, error)
+	DeleteRoomMember(ctx context.Context, roomID, userID int) error
+	GetRoomMembersPage(ctx context.Context, roomID int, status entity.RoomMemberStatus, page entity.Page) []*entity.RoomMember
+}
+
+type RoomMessageRepo interface {
+	AddRoomMessage(ctx context.Context, msg entity.RoomMessage) (*entity.RoomMessage, error)
+	GetRoomMessagesPage(ctx context.Context, roomID int, page entity.Page) []*entity.RoomMessage
+}
+
+type UserRepo interface {
+	GetUserByID(ctx context.Context, id int) (*entity.User, error)
+}
+
+var (
+	ErrNoSuchRoom        = errors.New("no such room")
+	ErrNoSuchInvitee     = errors.New("no such user to invite")
+	ErrUnknownVisibility = errors.New("unknown room visibility")
+	ErrNotRoomMember     = errors.New("user is not a member of the room")
+	ErrAlreadyRoomMember = errors.New("user is already a member of the room or invited to it")
+	ErrOwnerCantLeave    = errors.New("owner can't leave the room")
+	ErrUserBanned        = errors.New("banned users can't take part in rooms")
+)
+
+// RoomService manages rooms beyond the public chat. Public rooms can be read and joined by everyone,
+// invite-only rooms are hidden from everyone but their members and invitees, and only members read them.
+type RoomService struct {
+	RoomRepo        RoomRepo
+	RoomMessageRepo RoomMessageRepo
+	UserRepo        UserRepo
+}
+
+func NewRoomService(rr RoomRepo, mr RoomMessageRepo, ur UserRepo) *RoomService {
+	return &RoomService{
+		RoomRepo:        rr,
+		RoomMessageRepo: mr,
+		UserRepo:        ur,
+	}
+}
+
+// activeUser returns the user unless the user is banned.
+func (rs *RoomService) activeUser(ctx context.Context, id int) (*entity.User, error) {
+	user, err := rs.UserRepo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Banned {
+		return nil, ErrUserBanned
+	}
+
+	return user, nil
+}
+
+// visibleRoom returns the room and the membership of the user in it, which is nil if the user is neither
+// a member nor invited. Invite-only rooms of others are not found, so that they are not revealed.
+func (rs *RoomService) visibleRoom(ctx context.Context, userID, roomID int) (*entity.Room, *entity.RoomMember, error) {
+	room, err := rs.RoomRepo.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, nil, ErrNoSuchRoom
+	}
+
+	member, err := rs.RoomRepo.GetRoomMember(ctx, roomID, userID)
+	if err != nil {
+		member = nil
+	}
+
+	if room.Visibility != entity.RoomPublic && member == nil {
+		return nil, nil, ErrNoSuchRoom
+	}
+
+	return room, member, nil
+}
+
+// readableRoom returns the room if the user can read its messages and members.
+func (rs *RoomService) readableRoom(ctx context.Context, userID, roomID int) (*entity.Room, error) {
+	room, member, err := rs.visibleRoom(ctx, userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if room.Visibility != entity.RoomPublic && member.Status != entity.RoomMemberJoined {
+		return nil, ErrNotRoomMember
+	}
+
+	return room, nil
+}
+
+// joinedRoom returns the room if the user has joined it.
+func (rs *RoomService) joinedRoom(ctx context.Context, userID, roomID int) (*entity.Room, error) {
+	room, member, err := rs.visibleRoom(ctx, userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if member == nil || member.Status != entity.RoomMemberJoined {
+		return nil, ErrNotRoomMember
+	}
+
+	return room, nil
+}
+
+func (rs *RoomService) CreateRoom(
+	ctx context.Context,
+	ownerID int,
+	name string,
+	visibility entity.RoomVisibility,
+) (*entity.Room, error) {
+	if !visibility.Valid() {
+		return nil, ErrUnknownVisibility
+	}
+
+	owner, err := rs.activeUser(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return rs.RoomRepo.AddRoom(ctx, entity.Room{
+		Name:       name,
+		Visibility: visibility,
+		Owner:      owner,
+	})
+}
+
+// GetRooms returns the page of rooms the user can see, ordered by ID, with cursors of the pages around it.
+func (rs *RoomService) GetRooms(ctx context.Context, userID int, page entity.Page) ([]*entity.Room, entity.PageCursors) {
+	return pagination.Read(page, func(page entity.Page) []*entity.Room {
+		return rs.RoomRepo.GetRoomsPage(ctx, userID, page)
+	}, entity.RoomCursor)
+}
+
+func (rs *RoomService) GetRoom(ctx context.Context, userID, id int) (*entity.Room, error) {
+	room, _, err := rs.visibleRoom(ctx, userID, id)
+
+	return room, err
+}
+
+// JoinRoom makes the user a member of a public room or of an invite-only room the user is invited to.
+func (rs *RoomService) JoinRoom(ctx context.Context, userID, roomID int) (*entity.RoomMember, error) {
+	_, member, err := rs.visibleRoom(ctx, userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := rs.activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case member == nil:
+		return rs.RoomRepo.AddRoomMember(ctx, entity.RoomMember{RoomID: roomID, User: user, Status: entity.RoomMemberJoined})
+	case member.Status == entity.RoomMemberInvited:
+		return rs.RoomRepo.SetRoomMemberStatus(ctx, roomID, userID, entity.RoomMemberJoined)
+	default:
+		return nil, ErrAlreadyRoomMember
+	}
+}
+
+// LeaveRoom ends the membership of the user in the room, an invite is declined the same way.
+// The owner can't leave the room.
+func (rs *RoomService) LeaveRoom(ctx context.Context, userID, roomID int) error {
+	room, member, err := rs.visibleRoom(ctx, userID, roomID)
+	if err != nil {
+		return err
+	}
+
+	if member == nil {
+		return ErrNotRoomMember
+	}
+
+	if room.Owner != nil && room.Owner.ID == userID {
+		return ErrOwnerCantLeave
+	}
+
+	return rs.RoomRepo.DeleteRoomMember(ctx, roomID, userID)
+}
+
+// InviteToRoom invites the user to the room on behalf of a member of it, the user joins the room later.
+func (rs *RoomService) InviteToRoom(ctx context.Context, actorID, roomID, userID int) (*entity.RoomMember, error) {
+	if _, err := rs.joinedRoom(ctx, actorID, roomID); err != nil {
+		return nil, err
+	}
+
+	if _, err := rs.activeUser(ctx, actorID); err != nil {
+		return nil, err
+	}
+
+	invitee, err := rs.UserRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrNoSuchInvitee
+	}
+
+	if _, err = rs.RoomRepo.GetRoomMember(ctx, roomID, userID); err == nil {
+		return nil, ErrAlreadyRoomMember
+	}
+
+	return rs.RoomRepo.AddRoomMember(ctx, entity.RoomMember{RoomID: roomID, User: invitee, Status: entity.RoomMemberInvited})
+}
+
+// GetRoomMembers returns the page of users who joined the room, ordered by ID, with cursors of the pages around it.
+func (rs *RoomService) GetRoomMembers(
+	ctx context.Context,
+	userID, roomID int,
+	page entity.Page,
+) ([]*entity.RoomMember, entity.PageCursors, error) {
+	if _, err := rs.readableRoom(ctx, userID, roomID); err != nil {
+		return nil, entity.PageCursors{}, err
+	}
+
+	members, cursors := pagination.Read(page, func(page entity.Page) []*entity.RoomMember {
+		return rs.RoomRepo.GetRoomMembersPage(ctx, roomID, entity.RoomMemberJoined, page)
+	}, entity.RoomMemberCursor)
+
+	return members, cursors, nil
+}
+
+// SendRoomMessage sends a message to a room the sender has joined.
+func (rs *RoomService) SendRoomMessage(ctx context.Context, fromID, roomID int, content string) (*entity.RoomMessage, error) {
+	if _, err := rs.joinedRoom(ctx, fromID, roomID); err != nil {
+		return nil, err
+	}
+
+	from, err := rs.activeUser(ctx, fromID)
+	if err != nil {
+		return nil, err
+	}
+
+	return rs.RoomMessageRepo.AddRoomMessage(ctx, entity.RoomMessage{RoomID: roomID, From: from, Content: content})
+}
+
+// GetRoomMessages returns the page of messages of the room, ordered by the time they were sent,
+// with cursors of the pages around it.
+func (rs *RoomService) GetRoomMessages(
+	ctx context.Context,
+	userID, roomID int,
+	page entity.Page,
+) ([]*entity.RoomMessage, entity.PageCursors, error) {
+	if _, err := rs.readableRoom(ctx, userID, roomID); err != nil {
+		return nil, entity.PageCursors{}, err
+	}
+
+	messages, cursors := pagination.Read(page, func(page entity.Page) []*entity.RoomMessage {
+		return rs.RoomMessageRepo.GetRoomMessagesPage(ctx, roomID, page)
+	}, entity.RoomMessageCursor)
+
+	return messages, cursors, nil
+}
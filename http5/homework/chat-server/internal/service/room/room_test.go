@@ -0,0 +1,170 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+// initRoomService returns the service along with users registered to it, the first one owns its rooms.
+func initRoomService(t *testing.T, usernames ...string) (*RoomService, []*entity.User) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	db, _ := inmemory.NewInMemDB(ctx, "", repository.InMemDBSchema()...)
+
+	users, err := repository.NewInMemUserRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rooms, err := repository.NewInMemRoomRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roomMessages, err := repository.NewInMemRoomMessageRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered := make([]*entity.User, 0, len(usernames))
+
+	for _, username := range usernames {
+		user, err := users.AddUser(ctx, entity.User{Username: username, Email: username + "@mail.com", HashedPassword: username})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		registered = append(registered, user)
+	}
+
+	return NewRoomService(rooms, roomMessages, users), registered
+}
+
+func expectErr(t *testing.T, expected, got error) {
+	t.Helper()
+
+	if !errors.Is(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestPublicRoomIsReadByEveryoneAndWrittenByMembers(t *testing.T) {
+	ctx := context.Background()
+	rs, users := initRoomService(t, "owner", "guest")
+	owner, guest := users[0], users[1]
+
+	room, err := rs.CreateRoom(ctx, owner.ID, "lobby", entity.RoomPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = rs.SendRoomMessage(ctx, owner.ID, room.ID, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, _, err := rs.GetRoomMessages(ctx, guest.ID, room.ID, entity.Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 1 || messages[0].Content != "hello" {
+		t.Fatalf("expected the message of the owner, got %v", messages)
+	}
+
+	_, err = rs.SendRoomMessage(ctx, guest.ID, room.ID, "hi")
+	expectErr(t, ErrNotRoomMember, err)
+
+	if _, err = rs.JoinRoom(ctx, guest.ID, room.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = rs.JoinRoom(ctx, guest.ID, room.ID)
+	expectErr(t, ErrAlreadyRoomMember, err)
+
+	if _, err = rs.SendRoomMessage(ctx, guest.ID, room.ID, "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = rs.LeaveRoom(ctx, guest.ID, room.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	expectErr(t, ErrOwnerCantLeave, rs.LeaveRoom(ctx, owner.ID, room.ID))
+	expectErr(t, ErrNotRoomMember, rs.LeaveRoom(ctx, guest.ID, room.ID))
+}
+
+func TestInviteOnlyRoomIsHiddenUntilInvited(t *testing.T) {
+	ctx := context.Background()
+	rs, users := initRoomService(t, "owner", "guest", "stranger")
+	owner, guest, stranger := users[0], users[1], users[2]
+
+	room, err := rs.CreateRoom(ctx, owner.ID, "secret", entity.RoomInviteOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = rs.GetRoom(ctx, stranger.ID, room.ID)
+	expectErr(t, ErrNoSuchRoom, err)
+
+	_, err = rs.JoinRoom(ctx, stranger.ID, room.ID)
+	expectErr(t, ErrNoSuchRoom, err)
+
+	if rooms, _ := rs.GetRooms(ctx, stranger.ID, entity.Page{Limit: 10}); len(rooms) != 0 {
+		t.Fatalf("expected no rooms listed to a stranger, got %v", rooms)
+	}
+
+	// only members invite others
+	_, err = rs.InviteToRoom(ctx, stranger.ID, room.ID, guest.ID)
+	expectErr(t, ErrNoSuchRoom, err)
+
+	invite, err := rs.InviteToRoom(ctx, owner.ID, room.ID, guest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invite.Status != entity.RoomMemberInvited {
+		t.Fatalf("expected guest to be invited, got %s", invite.Status)
+	}
+
+	_, err = rs.InviteToRoom(ctx, owner.ID, room.ID, guest.ID)
+	expectErr(t, ErrAlreadyRoomMember, err)
+
+	_, err = rs.InviteToRoom(ctx, owner.ID, room.ID, 1000)
+	expectErr(t, ErrNoSuchInvitee, err)
+
+	// an invitee sees the room but reads it only after joining
+	if _, err = rs.GetRoom(ctx, guest.ID, room.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = rs.GetRoomMessages(ctx, guest.ID, room.ID, entity.Page{Limit: 10})
+	expectErr(t, ErrNotRoomMember, err)
+
+	if _, err = rs.JoinRoom(ctx, guest.ID, room.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	members, _, err := rs.GetRoomMembers(ctx, guest.ID, room.ID, entity.Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 2 || members[0].User.ID != owner.ID || members[1].User.ID != guest.ID {
+		t.Fatalf("expected owner and guest to be members, got %v", members)
+	}
+}
+
+func TestCreateRoomRejectsUnknownVisibility(t *testing.T) {
+	rs, users := initRoomService(t, "owner")
+
+	_, err := rs.CreateRoom(context.Background(), users[0].ID, "room", entity.RoomVisibility("secret"))
+	expectErr(t, ErrUnknownVisibility, err)
+}
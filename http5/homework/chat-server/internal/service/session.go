@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+
+	userservice "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/user"
+)
+
+// sessionTokenLen is the number of random bytes in a session token
+const sessionTokenLen = 32
+
+type SessionRepo interface {
+	AddSession(ctx context.Context, session entity.Session) (*entity.Session, error)
+	GetSession(ctx context.Context, id string) (*entity.Session, error)
+	GetUserSessions(ctx context.Context, userID int) []*entity.Session
+	DeleteSession(ctx context.Context, id string) error
+	DeleteUserSessions(ctx context.Context, userID int) (int, error)
+}
+
+// AuthSessionService checks passwords only when a session is opened, requests are then
+// authenticated by the opaque token of the session until it expires or is closed.
+type AuthSessionService struct {
+	UserRepo    userservice.UserRepo
+	SessionRepo SessionRepo
+
+	// passwords are checked the same way basic auth checks them
+	passwords *AuthBasicService
+	ttl       time.Duration
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewSessionAuthService(
+	ur userservice.UserRepo,
+	sr SessionRepo,
+	ttl time.Duration,
+	limiter *LoginLimiter,
+) *AuthSessionService {
+	return &AuthSessionService{
+		UserRepo:    ur,
+		SessionRepo: sr,
+		passwords:   NewBasicAuthService(ur, limiter),
+		ttl:         ttl,
+		now:         time.Now,
+	}
+}
+
+// sessionID is what a session is stored by, so that tokens can't be read back from the repository.
+func sessionID(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// OpenSession checks the password of the user and returns the token of a new session.
+// userAgent and remoteAddr are kept for the user to tell sessions apart when they are listed.
+func (s *AuthSessionService) OpenSession(
+	ctx context.Context,
+	loginReq request.LoginRequest,
+	userAgent, remoteAddr string,
+) (string, *entity.Session, error) {
+	loginReq.RemoteAddr = remoteAddr
+
+	user, err := s.passwords.Login(ctx, loginReq)
+	if err != nil {
+		return "", nil, err
+	}
+
+	raw := make([]byte, sessionTokenLen)
+
+	if _, err = rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := s.now()
+
+	session, err := s.SessionRepo.AddSession(ctx, entity.Session{
+		ID:         sessionID(token),
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		RemoteAddr: remoteAddr,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.ttl),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, session, nil
+}
+
+func (s *AuthSessionService) getSession(ctx context.Context, token string) (*entity.Session, error) {
+	session, err := s.SessionRepo.GetSession(ctx, sessionID(token))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	// the table janitor removes expired sessions only periodically
+	if !s.now().Before(session.ExpiresAt) {
+		return nil, fmt.Errorf("%w: session expired", ErrInvalidToken)
+	}
+
+	return session, nil
+}
+
+// Authenticate returns the user of the session the token belongs to.
+func (s *AuthSessionService) Authenticate(ctx context.Context, token string) (*entity.User, error) {
+	session, err := s.getSession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserRepo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Banned {
+		return nil, ErrUserBanned
+	}
+
+	return user, nil
+}
+
+// Sessions returns open sessions of the user, the oldest first.
+func (s *AuthSessionService) Sessions(ctx context.Context, userID int) []*entity.Session {
+	sessions := s.SessionRepo.GetUserSessions(ctx, userID)
+
+	open := sessions[:0]
+
+	for _, session := range sessions {
+		if s.now().Before(session.ExpiresAt) {
+			open = append(open, session)
+		}
+	}
+
+	return open
+}
+
+// Logout closes the session the token belongs to.
+func (s *AuthSessionService) Logout(ctx context.Context, token string) error {
+	session, err := s.getSession(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	return s.RevokeSession(ctx, session.ID)
+}
+
+// CloseSession closes a session of the user by its ID, sessions of other users are not found.
+func (s *AuthSessionService) CloseSession(ctx context.Context, userID int, id string) error {
+	session, err := s.SessionRepo.GetSession(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNoSuchSession, err)
+	}
+
+	if session.UserID != userID {
+		return ErrNoSuchSession
+	}
+
+	return s.RevokeSession(ctx, id)
+}
+
+// LogoutEverywhere closes all sessions of the user and returns how many were closed.
+func (s *AuthSessionService) LogoutEverywhere(ctx context.Context, userID int) (int, error) {
+	return s.SessionRepo.DeleteUserSessions(ctx, userID)
+}
+
+// RevokeSession closes any session by its ID, it is used by admins.
+func (s *AuthSessionService) RevokeSession(ctx context.Context, id string) error {
+	if err := s.SessionRepo.DeleteSession(ctx, id); err != nil {
+		return fmt.Errorf("%w: %w", ErrNoSuchSession, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/handler/request"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+func initSessionService(t *testing.T, usernames ...string) (*AuthSessionService, []*entity.User) {
+	t.Helper()
+
+	db, _ := inmemory.NewInMemDB(context.Background(), "", repository.InMemDBSchema()...)
+
+	userRepo, err := repository.NewInMemUserRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionRepo, err := repository.NewInMemSessionRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := make([]*entity.User, 0, len(usernames))
+
+	for _, username := range usernames {
+		user, err := userRepo.AddUser(context.Background(), entity.User{
+			Username:       username,
+			Email:          username + "@mail.com",
+			HashedPassword: string(hashed),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		users = append(users, user)
+	}
+
+	return NewSessionAuthService(userRepo, sessionRepo, time.Hour, nil), users
+}
+
+func openSession(t *testing.T, s *AuthSessionService, username string) (string, *entity.Session) {
+	t.Helper()
+
+	token, session, err := s.OpenSession(context.Background(), request.LoginRequest{Username: username, Password: testPassword}, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token, session
+}
+
+func expectSessionUser(t *testing.T, s *AuthSessionService, token string, user *entity.User) {
+	t.Helper()
+
+	got, err := s.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != user.ID {
+		t.Fatalf("expected user %d, got %d", user.ID, got.ID)
+	}
+}
+
+func expectClosed(t *testing.T, s *AuthSessionService, token string) {
+	t.Helper()
+
+	if _, err := s.Authenticate(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected session to be closed, got %v", err)
+	}
+}
+
+func TestSessionTokenIsNotStored(t *testing.T) {
+	s, users := initSessionService(t, "test")
+
+	token, session := openSession(t, s, "test")
+
+	if session.ID == token {
+		t.Fatal("expected session to be stored by the hash of its token")
+	}
+
+	expectSessionUser(t, s, token, users[0])
+}
+
+func TestSessionWrongPasswordOpensNothing(t *testing.T) {
+	s, users := initSessionService(t, "test")
+
+	_, _, err := s.OpenSession(context.Background(), request.LoginRequest{Username: "test", Password: "wrong"}, "", "")
+	if err == nil {
+		t.Fatal("expected error for wrong password")
+	}
+
+	if sessions := s.Sessions(context.Background(), users[0].ID); len(sessions) != 0 {
+		t.Fatalf("expected no sessions, got %d", len(sessions))
+	}
+}
+
+func TestSessionExpires(t *testing.T) {
+	s, users := initSessionService(t, "test")
+
+	token, _ := openSession(t, s, "test")
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	expectClosed(t, s, token)
+
+	if sessions := s.Sessions(context.Background(), users[0].ID); len(sessions) != 0 {
+		t.Fatalf("expected expired session not to be listed, got %d", len(sessions))
+	}
+}
+
+func TestSessionLogout(t *testing.T) {
+	s, users := initSessionService(t, "test")
+
+	token, _ := openSession(t, s, "test")
+	other, _ := openSession(t, s, "test")
+
+	if err := s.Logout(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+
+	expectClosed(t, s, token)
+	expectSessionUser(t, s, other, users[0])
+
+	if err := s.Logout(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected closed session to be invalid, got %v", err)
+	}
+}
+
+func TestSessionLogoutEverywhere(t *testing.T) {
+	s, users := initSessionService(t, "test", "other")
+
+	first, _ := openSession(t, s, "test")
+	second, _ := openSession(t, s, "test")
+	foreign, _ := openSession(t, s, "other")
+
+	if sessions := s.Sessions(context.Background(), users[0].ID); len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	closed, err := s.LogoutEverywhere(context.Background(), users[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if closed != 2 {
+		t.Fatalf("expected 2 sessions to be closed, got %d", closed)
+	}
+
+	expectClosed(t, s, first)
+	expectClosed(t, s, second)
+	expectSessionUser(t, s, foreign, users[1])
+}
+
+func TestSessionCloseOnlyOwnSession(t *testing.T) {
+	s, users := initSessionService(t, "test", "other")
+
+	token, session := openSession(t, s, "test")
+
+	if err := s.CloseSession(context.Background(), users[1].ID, session.ID); !errors.Is(err, ErrNoSuchSession) {
+		t.Fatalf("expected ErrNoSuchSession, got %v", err)
+	}
+
+	expectSessionUser(t, s, token, users[0])
+
+	if err := s.CloseSession(context.Background(), users[0].ID, session.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	expectClosed(t, s, token)
+}
+
+func TestSessionRevoke(t *testing.T) {
+	s, _ := initSessionService(t, "test")
+
+	token, session := openSession(t, s, "test")
+
+	if err := s.RevokeSession(context.Background(), session.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	expectClosed(t, s, token)
+
+	if err := s.RevokeSession(context.Background(), session.ID); !errors.Is(err, ErrNoSuchSession) {
+		t.Fatalf("expected ErrNoSuchSession, got %v", err)
+	}
+}
@@ -2,10 +2,20 @@ package user
 
 import (
 	"context"
+	"errors"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/pagination"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/policy"
+)
+
+var (
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrSelfAction is returned when admins try to ban, demote or delete themselves,
+	// so that the last admin can't lock everyone out
+	ErrSelfAction = errors.New("action can't be applied to yourself")
 )
 
 type UserRepo interface {
@@ -14,9 +24,9 @@ type UserRepo interface {
 	GetUserByEmail(ctx context.Context, email string) (*entity.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*entity.User, error)
 	GetAllUsers(ctx context.Context, offset, limit int) []*entity.User
+	GetUsersPage(ctx context.Context, page entity.Page) []*entity.User
 	DeleteUser(ctx context.Context, id int) (*entity.User, error)
 	UpdateUser(ctx context.Context, id int, updateModel entity.User) (*entity.User, error)
-	CheckUniqueConstraints(ctx context.Context, email, username string) error
 }
 
 type UserService struct {
@@ -28,12 +38,7 @@ func NewUserService(ur UserRepo) *UserService {
 }
 
 func (us *UserService) RegisterUser(ctx context.Context, user entity.User) (*entity.User, error) {
-	// ensure that user with this email and username does not exist
-	err := us.UserRepo.CheckUniqueConstraints(ctx, user.Email, user.Username)
-	if err != nil {
-		return nil, err
-	}
-
+	// uniqueness of email and username is enforced by the repository on insert
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.HashedPassword), bcrypt.DefaultCost) // user model sent with plain password
 	if err != nil {
 		return nil, err
@@ -41,6 +46,11 @@ func (us *UserService) RegisterUser(ctx context.Context, user entity.User) (*ent
 
 	user.HashedPassword = string(hash)
 
+	// roles are only granted by admins and the admin bootstrap
+	if user.Role == "" {
+		user.Role = entity.RoleUser
+	}
+
 	created, err := us.UserRepo.AddUser(ctx, user)
 	if err != nil {
 		return nil, err
@@ -80,6 +90,13 @@ func (us *UserService) GetAllUsers(ctx context.Context, offset, limit int) []*en
 	return us.UserRepo.GetAllUsers(ctx, offset, limit)
 }
 
+// GetUsersPage returns the page of users ordered by ID with cursors of the pages around it.
+func (us *UserService) GetUsersPage(ctx context.Context, page entity.Page) ([]*entity.User, entity.PageCursors) {
+	return pagination.Read(page, func(page entity.Page) []*entity.User {
+		return us.UserRepo.GetUsersPage(ctx, page)
+	}, entity.UserCursor)
+}
+
 func (us *UserService) UpdateUser(ctx context.Context, id int, updateModel entity.User) (*entity.User, error) {
 	updated, err := us.UserRepo.UpdateUser(ctx, id, updateModel)
 	if err != nil {
@@ -89,7 +106,15 @@ func (us *UserService) UpdateUser(ctx context.Context, id int, updateModel entit
 	return updated, nil
 }
 
-func (us *UserService) DeleteUser(ctx context.Context, id int) (*entity.User, error) { // todo: authorize admin rights
+func (us *UserService) DeleteUser(ctx context.Context, actorID, id int) (*entity.User, error) {
+	if actorID == id {
+		return nil, ErrSelfAction
+	}
+
+	if _, err := policy.Authorize(ctx, us.UserRepo, actorID, entity.PermissionDeleteUsers); err != nil {
+		return nil, err
+	}
+
 	deleted, err := us.UserRepo.DeleteUser(ctx, id)
 	if err != nil {
 		return nil, err
@@ -97,3 +122,72 @@ func (us *UserService) DeleteUser(ctx context.Context, id int) (*entity.User, er
 
 	return deleted, nil
 }
+
+// update applies change to the user and returns the updated user.
+func (us *UserService) update(ctx context.Context, id int, change func(user *entity.User)) (*entity.User, error) {
+	user, err := us.UserRepo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	change(user)
+
+	if _, err = us.UserRepo.UpdateUser(ctx, id, *user); err != nil {
+		return nil, err
+	}
+
+	return us.UserRepo.GetUserByID(ctx, id)
+}
+
+func (us *UserService) BanUser(ctx context.Context, actorID, id int, banned bool) (*entity.User, error) {
+	if actorID == id {
+		return nil, ErrSelfAction
+	}
+
+	if _, err := policy.Authorize(ctx, us.UserRepo, actorID, entity.PermissionBanUsers); err != nil {
+		return nil, err
+	}
+
+	return us.update(ctx, id, func(user *entity.User) {
+		user.Banned = banned
+	})
+}
+
+func (us *UserService) SetUserRole(ctx context.Context, actorID, id int, role entity.Role) (*entity.User, error) {
+	if !role.Valid() {
+		return nil, ErrUnknownRole
+	}
+
+	if actorID == id {
+		return nil, ErrSelfAction
+	}
+
+	if _, err := policy.Authorize(ctx, us.UserRepo, actorID, entity.PermissionPromoteUsers); err != nil {
+		return nil, err
+	}
+
+	return us.update(ctx, id, func(user *entity.User) {
+		user.Role = role
+	})
+}
+
+// BootstrapAdmin makes sure the admin from the config exists: it is registered if there is
+// no user with its username, otherwise the user is made an admin and unbanned.
+// The password of an existing user is left as it is.
+func (us *UserService) BootstrapAdmin(ctx context.Context, admin entity.User) (*entity.User, error) {
+	existing, err := us.UserRepo.GetUserByUsername(ctx, admin.Username)
+	if errors.Is(err, entity.ErrNoSuchUser) {
+		admin.Role = entity.RoleAdmin
+
+		return us.RegisterUser(ctx, admin)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return us.update(ctx, existing.ID, func(user *entity.User) {
+		user.Role = entity.RoleAdmin
+		user.Banned = false
+	})
+}
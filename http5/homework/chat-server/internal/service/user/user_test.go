@@ -0,0 +1,148 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/repository"
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/service/policy"
+
+	inmemory "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/db/in-memory"
+)
+
+// initUserService returns the service along with an admin and a user registered to it.
+func initUserService(t *testing.T) (*UserService, *entity.User, *entity.User) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	db, _ := inmemory.NewInMemDB(ctx, "", repository.InMemDBSchema()...)
+
+	users, err := repository.NewInMemUserRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us := NewUserService(users)
+
+	admin, err := us.BootstrapAdmin(ctx, entity.User{Username: "admin", Email: "admin@mail.com", HashedPassword: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := us.RegisterUser(ctx, entity.User{Username: "test", Email: "test@mail.com", HashedPassword: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return us, admin, user
+}
+
+func TestRegisteredUserIsNotAdmin(t *testing.T) {
+	us, admin, user := initUserService(t)
+
+	if user.Role != entity.RoleUser {
+		t.Fatalf("expected role %s, got %s", entity.RoleUser, user.Role)
+	}
+
+	if _, err := us.BanUser(context.Background(), user.ID, admin.ID, true); !errors.Is(err, policy.ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+
+	if _, err := us.DeleteUser(context.Background(), user.ID, admin.ID); !errors.Is(err, policy.ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestAdminBansAndPromotes(t *testing.T) {
+	us, admin, user := initUserService(t)
+
+	banned, err := us.BanUser(context.Background(), admin.ID, user.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !banned.Banned {
+		t.Fatal("expected user to be banned")
+	}
+
+	promoted, err := us.SetUserRole(context.Background(), admin.ID, user.ID, entity.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a banned admin is allowed nothing
+	if _, err = us.DeleteUser(context.Background(), promoted.ID, admin.ID); !errors.Is(err, policy.ErrForbidden) {
+		t.Fatalf("expected ErrForbidden for banned admin, got %v", err)
+	}
+
+	if _, err = us.SetUserRole(context.Background(), admin.ID, user.ID, "owner"); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("expected ErrUnknownRole, got %v", err)
+	}
+}
+
+func TestAdminCantActOnThemselves(t *testing.T) {
+	us, admin, _ := initUserService(t)
+
+	if _, err := us.BanUser(context.Background(), admin.ID, admin.ID, true); !errors.Is(err, ErrSelfAction) {
+		t.Fatalf("expected ErrSelfAction, got %v", err)
+	}
+
+	if _, err := us.SetUserRole(context.Background(), admin.ID, admin.ID, entity.RoleUser); !errors.Is(err, ErrSelfAction) {
+		t.Fatalf("expected ErrSelfAction, got %v", err)
+	}
+}
+
+func TestBootstrapAdminPromotesExistingUser(t *testing.T) {
+	us, admin, user := initUserService(t)
+
+	if _, err := us.BanUser(context.Background(), admin.ID, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	promoted, err := us.BootstrapAdmin(context.Background(), entity.User{Username: user.Username, HashedPassword: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if promoted.ID != user.ID || promoted.Role != entity.RoleAdmin || promoted.Banned {
+		t.Fatalf("expected user %d to be an unbanned admin, got %+v", user.ID, promoted)
+	}
+
+	if promoted.HashedPassword != user.HashedPassword {
+		t.Fatal("expected password of existing user to be kept")
+	}
+}
+
+// failingUserRepo fails every lookup of a user as a broken database would.
+type failingUserRepo struct {
+	UserRepo
+
+	added bool
+}
+
+var errLookupFailed = errors.New("lookup failed")
+
+func (r *failingUserRepo) GetUserByUsername(context.Context, string) (*entity.User, error) {
+	return nil, errLookupFailed
+}
+
+func (r *failingUserRepo) AddUser(_ context.Context, user entity.User) (*entity.User, error) {
+	r.added = true
+	return &user, nil
+}
+
+func TestBootstrapAdminReportsFailedLookup(t *testing.T) {
+	repo := &failingUserRepo{}
+
+	_, err := NewUserService(repo).BootstrapAdmin(context.Background(), entity.User{Username: "admin", HashedPassword: "admin"})
+	if !errors.Is(err, errLookupFailed) {
+		t.Fatalf("expected failed lookup to be returned, got %v", err)
+	}
+
+	if repo.added {
+		t.Fatal("expected no user to be registered when the lookup failed")
+	}
+}
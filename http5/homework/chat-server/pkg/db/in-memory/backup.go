@@ -0,0 +1,118 @@
+package in_memory
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Backup writes the state of the database at a single point in time to w, in the same
+// format as snapshots. The state is encoded under the locks of all tables, so a backup
+// never has a part of a transaction, and it is written to w once the locks are released.
+func (db *InMemDB) Backup(w io.Writer) error {
+	db.m.RLock()
+
+	unlock := db.lockShardsNotLocking(db.shardNames(), nil)
+
+	state, err := db.marshalStateNotLocking()
+
+	unlock()
+	db.m.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(state)
+
+	return err
+}
+
+// Restore replaces the rows of the database with the backup. The backup is upgraded by
+// the migrations of the database and its rows are checked against table schemas and unique
+// indexes. The rows of all tables are dropped and the backed up ones are added in a single
+// transaction along with the counters of their tables, so either the whole backup is restored
+// or nothing is changed. Counters never go back, so identifiers handed out before the restore
+// are not allocated again, and tables missing from the backup are left empty.
+func (db *InMemDB) Restore(r io.Reader) error {
+	state, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	tables, counters, err := db.decodeTables(string(state))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+
+	names := make([]string, 0, len(tables))
+
+	for name := range tables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err = db.GetTable(name); errors.Is(err, ErrNotExistedTable) {
+			if err = db.CreateTable(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	db.m.RLock()
+	existing := db.shardNames()
+	db.m.RUnlock()
+
+	err = db.Tx(func(tx Transaction) error {
+		current := make(map[string]int, len(existing))
+
+		for _, name := range existing {
+			counter, err := tx.GetTableCounter(name)
+			if err != nil {
+				return err
+			}
+
+			current[name] = counter
+
+			keys, err := tx.(*Tx).keys(name)
+			if err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				if err = tx.DropRow(name, key); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, name := range names {
+			var addErr error
+
+			err := tables[name].Range(func(key string, row any) bool {
+				addErr = tx.AddRow(name, key, row)
+				return addErr == nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if addErr != nil {
+				return addErr
+			}
+
+			// deleted rows leave the counter of the backed up table above its rows
+			tx.(*Tx).setCounter(name, max(current[name], counters[name], highestKey(tables[name])))
+		}
+
+		return nil
+	})
+	if errors.Is(err, ErrUniqueViolation) || errors.Is(err, ErrInvalidRowType) {
+		return fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+
+	return err
+}
@@ -0,0 +1,214 @@
+package in_memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// initRestoreTarget is a fresh database with the unique email index, the way a server creates its tables on start.
+func initRestoreTarget(t *testing.T, opts ...Option) *InMemDB {
+	t.Helper()
+
+	db, _ := NewInMemDB(context.Background(), "", opts...)
+
+	db.CreateTable("users")
+
+	if err := db.CreateIndex("users", IndexSpec{Name: emailIndex, Unique: true, Key: emailKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestBackupRestoresIntoFreshDB(t *testing.T) {
+	db := initIndexedDB(t)
+
+	if err := db.AddRow("users", "2", "second@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.CreateTable("messages")
+	addMessages(t, db, 1, 3)
+
+	var backup bytes.Buffer
+
+	if err := db.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := initRestoreTarget(t)
+
+	if err := restored.Restore(&backup); err != nil {
+		t.Fatalf("cannot restore backup: %v", err)
+	}
+
+	expectRows(t, restored, "users", "first@mail.com", "second@mail.com")
+	expectRows(t, restored, "messages", "message 1", "message 2", "message 3")
+
+	// restored rows are indexed
+	if row, err := restored.GetRowByIndex("users", emailIndex, "second@mail.com"); err != nil || row != "second@mail.com" {
+		t.Fatalf("expected indexed row, got %v (%v)", row, err)
+	}
+}
+
+func TestRestoreIsPersistedByEngine(t *testing.T) {
+	db := initIndexedDB(t)
+
+	var backup bytes.Buffer
+
+	if err := db.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "db_state.dat")
+
+	restored, closeDB := openFileDB(t, path)
+	restored.CreateTable("users")
+
+	if err := restored.Restore(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	closeDB()
+
+	reopened, closeDB := openFileDB(t, path)
+	defer closeDB()
+
+	expectRows(t, reopened, "users", "first@mail.com")
+}
+
+func TestRestoreReplacesRows(t *testing.T) {
+	db := initIndexedDB(t)
+
+	db.CreateTable("messages")
+	addMessages(t, db, 1, 2)
+
+	var backup bytes.Buffer
+
+	if err := db.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	target := initRestoreTarget(t)
+	target.CreateTable("sessions")
+
+	// the first row holds the email of the backed up one, which must be gone before the backup is added
+	for i, email := range []string{"first@mail.com", "second@mail.com", "third@mail.com"} {
+		if err := target.AddRow("users", strconv.Itoa(i+7), email); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := target.AddRow("sessions", "s1", "session"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := target.Restore(&backup); err != nil {
+		t.Fatalf("cannot restore backup: %v", err)
+	}
+
+	expectRows(t, target, "users", "first@mail.com")
+	expectRows(t, target, "messages", "message 1", "message 2")
+	expectRows(t, target, "sessions")
+
+	// identifiers handed out before the restore are not allocated again
+	if counter, _ := target.GetTableCounter("users"); counter != 9 {
+		t.Fatalf("expected counter 9, got %d", counter)
+	}
+}
+
+func TestInvalidBackupIsNotRestored(t *testing.T) {
+	backups := map[string]string{
+		"malformed":        `{"version": 0, "tables": `,
+		"unknown version":  `{"version": 1, "tables": {}}`,
+		"wrong row type":   `{"version": 0, "tables": {"users": {"1": 42}}}`,
+		"unique violation": `{"version": 0, "tables": {"users": {"1": "same@mail.com", "2": "same@mail.com"}}}`,
+	}
+
+	for name, backup := range backups {
+		t.Run(name, func(t *testing.T) {
+			target := initRestoreTarget(t, WithTableSchema("users", ""))
+
+			err := target.Restore(strings.NewReader(backup))
+			if !errors.Is(err, ErrInvalidBackup) {
+				t.Fatalf("expected ErrInvalidBackup, got %v", err)
+			}
+
+			expectRows(t, target, "users")
+		})
+	}
+}
+
+func TestRestoreKeepsCounters(t *testing.T) {
+	db, _ := NewInMemDB(context.Background(), "")
+
+	db.CreateTable("messages")
+	addMessages(t, db, 1, 3)
+
+	// the deleted row is the last one, so the counter is above every key left
+	if err := db.DropRow("messages", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	var backup bytes.Buffer
+
+	if err := db.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	walPath := filepath.Join(t.TempDir(), "db.wal")
+	wal := openTestWAL(t, walPath)
+
+	restored, _ := NewInMemDB(context.Background(), "", WithWAL(wal))
+
+	if err := restored.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if counter, _ := restored.GetTableCounter("messages"); counter != 3 {
+		t.Fatalf("expected counter 3, got %d", counter)
+	}
+
+	addMessages(t, restored, 4, 4)
+
+	wal.Close()
+
+	// the restored counter is replayed from the log
+	replayed, _, err := NewInMemDBFromJSON(context.Background(), "{}", "", WithWAL(openTestWAL(t, walPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if counter, _ := replayed.GetTableCounter("messages"); counter != 4 {
+		t.Fatalf("expected counter 4 after replay, got %d", counter)
+	}
+
+	// and so it is by the file engine
+	path := filepath.Join(t.TempDir(), "db_state.dat")
+
+	engineDB, _ := openFileDB(t, path)
+	engineDB.CreateTable("messages")
+
+	if err = engineDB.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	// the process is gone without compacting the file
+	engineDB.engine.(*FileEngine).log.Close()
+
+	reopened, closeDB := openFileDB(t, path)
+	defer closeDB()
+
+	expectRows(t, reopened, "messages", "message 1", "message 2")
+
+	if counter, _ := reopened.GetTableCounter("messages"); counter != 3 {
+		t.Fatalf("expected counter 3 after reopening, got %d", counter)
+	}
+
+	addMessages(t, reopened, 4, 4)
+}
@@ -1,5 +1,10 @@
 package in_memory
 
+import "time"
+
 const (
 	writePerm = 0o664
+
+	defaultWALSyncInterval = time.Second
+	defaultJanitorInterval = time.Second
 )
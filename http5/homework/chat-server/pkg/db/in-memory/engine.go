@@ -0,0 +1,151 @@
+package in_memory
+
+import (
+	"encoding/json"
+
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+type WriteOp string
+
+const (
+	OpCreateTable WriteOp = "create_table"
+	OpDropTable   WriteOp = "drop_table"
+	OpClear       WriteOp = "clear"
+	OpAddRow      WriteOp = "add_row"
+	OpAlterRow    WriteOp = "alter_row"
+	OpDropRow     WriteOp = "drop_row"
+)
+
+// Write is a single change of the database. Row is set for OpAddRow and OpAlterRow only.
+type Write struct {
+	Op    WriteOp
+	Table string
+	Key   string
+	Row   any
+}
+
+// Table stores rows of a table in insertion order. InMemDB calls it under the table lock only.
+type Table interface {
+	Get(key string) (any, bool, error)
+	// Set appends a new row to the end of the table and replaces an existing one in place.
+	Set(key string, row any) error
+	Delete(key string) (any, bool, error)
+	Len() int
+	// Range calls fn for rows from the oldest to the newest until it returns false.
+	Range(fn func(key string, row any) bool) error
+	// Next returns the key of the row following the row stored under key.
+	Next(key string) (string, bool)
+	MoveBefore(key, mark string) error
+}
+
+// countedTable is a Table keeping the counter of the table, tables restored by an engine
+// cannot be counted otherwise since their deleted rows are gone.
+type countedTable interface {
+	Counter() int
+	// SetCounter is called with the counter of the table before the engine is compacted.
+	SetCounter(counter int)
+}
+
+// RowDecoder restores a row of the table from its JSON encoding.
+type RowDecoder func(table string, raw json.RawMessage) (any, error)
+
+// Engine stores the tables of InMemDB. Indexes, transactions, subscriptions and
+// expiry are kept by InMemDB on top of any engine.
+type Engine interface {
+	// Open returns the tables the engine already holds.
+	Open(decode RowDecoder) (map[string]Table, error)
+	// NewTable returns an empty table. It is called on every CreateTable after the write was persisted.
+	NewTable(name string) Table
+	// Persist makes writes durable before they are applied to tables.
+	// Writes passed at once are persisted atomically.
+	Persist(writes []Write) error
+	// Compact reclaims space taken by overwritten and dropped rows.
+	Compact() error
+	Close() error
+}
+
+// WithEngine makes the database keep its tables in the engine instead of memory.
+func WithEngine(engine Engine) Option {
+	return func(db *InMemDB) {
+		db.engine = engine
+	}
+}
+
+// MemoryEngine keeps the tables in memory only. Durability of InMemDB backed by it
+// is provided by the write-ahead log and snapshots.
+type MemoryEngine struct{}
+
+func (MemoryEngine) Open(RowDecoder) (map[string]Table, error) {
+	return map[string]Table{}, nil
+}
+
+func (MemoryEngine) NewTable(string) Table {
+	return newMemTable()
+}
+
+func (MemoryEngine) Persist([]Write) error {
+	return nil
+}
+
+func (MemoryEngine) Compact() error {
+	return nil
+}
+
+func (MemoryEngine) Close() error {
+	return nil
+}
+
+type memTable struct {
+	rows *orderedmap.OrderedMap[string, any]
+}
+
+func newMemTable() *memTable {
+	return &memTable{rows: orderedmap.New[string, any]()}
+}
+
+func (t *memTable) Get(key string) (any, bool, error) {
+	row, exists := t.rows.Get(key)
+	return row, exists, nil
+}
+
+func (t *memTable) Set(key string, row any) error {
+	t.rows.Set(key, row)
+	return nil
+}
+
+func (t *memTable) Delete(key string) (any, bool, error) {
+	row, existed := t.rows.Delete(key)
+	return row, existed, nil
+}
+
+func (t *memTable) Len() int {
+	return t.rows.Len()
+}
+
+func (t *memTable) Range(fn func(key string, row any) bool) error {
+	for pair := t.rows.Oldest(); pair != nil; pair = pair.Next() {
+		if !fn(pair.Key, pair.Value) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (t *memTable) Next(key string) (string, bool) {
+	pair := t.rows.GetPair(key)
+	if pair == nil || pair.Next() == nil {
+		return "", false
+	}
+
+	return pair.Next().Key, true
+}
+
+func (t *memTable) MoveBefore(key, mark string) error {
+	return t.rows.MoveBefore(key, mark)
+}
+
+func (t *memTable) MarshalJSON() ([]byte, error) {
+	return t.rows.MarshalJSON()
+}
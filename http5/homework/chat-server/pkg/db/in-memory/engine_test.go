@@ -0,0 +1,353 @@
+package in_memory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type engineFactory func(t *testing.T) Engine
+
+var engines = map[string]engineFactory{
+	"memory": func(*testing.T) Engine {
+		return MemoryEngine{}
+	},
+	"file": func(t *testing.T) Engine {
+		t.Helper()
+
+		engine, err := OpenFileEngine(WALConfig{Path: filepath.Join(t.TempDir(), "db_state.dat"), Policy: SyncNever})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { engine.Close() })
+
+		return engine
+	},
+}
+
+// conformance holds the behaviour every engine must keep.
+var conformance = map[string]func(t *testing.T, db *InMemDB){
+	"rows keep insertion order": func(t *testing.T, db *InMemDB) {
+		addRows(t, db, "users", "first@mail.com", "second@mail.com", "third@mail.com")
+
+		if err := db.AlterRow("users", "1", "edited@mail.com"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.DropRow("users", "2"); err != nil {
+			t.Fatal(err)
+		}
+
+		expectRows(t, db, "users", "edited@mail.com", "third@mail.com")
+
+		rows, err := db.GetAllRows("users", 1, 1)
+		if err != nil || !reflect.DeepEqual(rows, []any{"third@mail.com"}) {
+			t.Fatalf("expected a page past the offset, got %v (%v)", rows, err)
+		}
+
+		if counter, _ := db.GetTableCounter("users"); counter != 3 {
+			t.Fatalf("expected counter to count every added row, got %d", counter)
+		}
+	},
+	"row errors": func(t *testing.T, db *InMemDB) {
+		addRows(t, db, "users", "first@mail.com")
+
+		if err := db.AddRow("users", "1", "again@mail.com"); !errors.Is(err, ErrExistingKey) {
+			t.Fatalf("expected existing key, got %v", err)
+		}
+
+		if err := db.AlterRow("users", "2", "missing@mail.com"); !errors.Is(err, ErrNotExistedRow) {
+			t.Fatalf("expected missing row, got %v", err)
+		}
+
+		if _, err := db.GetRow("users", "2"); !errors.Is(err, ErrNotExistedRow) {
+			t.Fatalf("expected missing row, got %v", err)
+		}
+
+		if err := db.AddRow("messages", "1", "hi"); !errors.Is(err, ErrNotExistedTable) {
+			t.Fatalf("expected missing table, got %v", err)
+		}
+	},
+	"tables": func(t *testing.T, db *InMemDB) {
+		addRows(t, db, "users", "first@mail.com")
+
+		// recreated table is empty
+		db.CreateTable("users")
+		expectRows(t, db, "users")
+
+		addRows(t, db, "messages", "hi")
+		db.DropTable("messages")
+
+		if _, err := db.GetRowsCount("messages"); !errors.Is(err, ErrNotExistedTable) {
+			t.Fatalf("expected dropped table to be missing, got %v", err)
+		}
+
+		db.Clear()
+
+		if _, err := db.GetRowsCount("users"); !errors.Is(err, ErrNotExistedTable) {
+			t.Fatalf("expected cleared table to be missing, got %v", err)
+		}
+	},
+	"unique index": func(t *testing.T, db *InMemDB) {
+		addRows(t, db, "users", "first@mail.com", "second@mail.com")
+
+		if err := db.CreateIndex("users", IndexSpec{Name: emailIndex, Unique: true, Key: emailKey}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.AlterRow("users", "2", "first@mail.com"); !errors.Is(err, ErrUniqueViolation) {
+			t.Fatalf("expected unique violation, got %v", err)
+		}
+
+		row, err := db.GetRowByIndex("users", emailIndex, "second@mail.com")
+		if err != nil || row != "second@mail.com" {
+			t.Fatalf("expected indexed row, got %v (%v)", row, err)
+		}
+	},
+	"transactions": func(t *testing.T, db *InMemDB) {
+		addRows(t, db, "users", "first@mail.com", "second@mail.com")
+
+		if err := db.CreateIndex("users", IndexSpec{Name: emailIndex, Unique: true, Key: emailKey}); err != nil {
+			t.Fatal(err)
+		}
+
+		err := db.Tx(func(tx Transaction) error {
+			if err := tx.AlterRow("users", "1", "edited@mail.com"); err != nil {
+				return err
+			}
+
+			return tx.AddRow("users", "3", "third@mail.com")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx := db.Begin()
+
+		if err = tx.DropRow("users", "1"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = tx.AlterRow("users", "2", "third@mail.com"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = tx.Commit(); !errors.Is(err, ErrUniqueViolation) {
+			t.Fatalf("expected unique violation, got %v", err)
+		}
+
+		expectRows(t, db, "users", "edited@mail.com", "second@mail.com", "third@mail.com")
+	},
+	"query": func(t *testing.T, db *InMemDB) {
+		addRows(t, db, "users", "c@mail.com", "a@mail.com", "b@mail.com")
+
+		less := func(a, b any) bool { return a.(string) < b.(string) }
+
+		res, err := db.Query("users", Query{OrderBy: less, Limit: 2})
+		if err != nil || !reflect.DeepEqual(res.Rows, []any{"a@mail.com", "b@mail.com"}) || res.NextCursor != "3" {
+			t.Fatalf("unexpected first page %v with cursor %q (%v)", res.Rows, res.NextCursor, err)
+		}
+	},
+}
+
+func addRows(t *testing.T, db *InMemDB, table string, rows ...string) {
+	t.Helper()
+
+	if _, err := db.GetRowsCount(table); err != nil {
+		db.CreateTable(table)
+	}
+
+	count, _ := db.GetTableCounter(table)
+
+	for i, row := range rows {
+		if err := db.AddRow(table, strconv.Itoa(count+i+1), row); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expectRows(t *testing.T, db *InMemDB, table string, expected ...string) {
+	t.Helper()
+
+	rows, err := db.GetAllRows(table, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0, len(rows))
+
+	for _, row := range rows {
+		got = append(got, row.(string))
+	}
+
+	if !reflect.DeepEqual(got, append([]string{}, expected...)) {
+		t.Fatalf("expected rows %v in %s, got %v", expected, table, got)
+	}
+}
+
+func TestEngineConformance(t *testing.T) {
+	for engineName, newEngine := range engines {
+		for name, check := range conformance {
+			t.Run(engineName+"/"+name, func(t *testing.T) {
+				db, _, err := NewInMemDBFromEngine(context.Background(), "", WithEngine(newEngine(t)))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				check(t, db)
+			})
+		}
+	}
+}
+
+func openFileDB(t *testing.T, path string) (*InMemDB, func()) {
+	t.Helper()
+
+	engine, err := OpenFileEngine(WALConfig{Path: path, Policy: SyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	db, savedChan, err := NewInMemDBFromEngine(ctx, "", WithEngine(engine))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, func() {
+		cancel()
+
+		if res := <-savedChan; res != "ok" {
+			t.Fatalf("cannot close db: %v", res)
+		}
+	}
+}
+
+func TestFileEngineSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_state.dat")
+
+	db, _ := openFileDB(t, path)
+
+	addRows(t, db, "users", "first@mail.com", "second@mail.com", "third@mail.com")
+	addRows(t, db, "messages", "hi")
+
+	err := db.Tx(func(tx Transaction) error {
+		if err := tx.DropRow("users", "1"); err != nil {
+			return err
+		}
+
+		return tx.AlterRow("users", "2", "edited@mail.com")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.DropTable("messages")
+
+	// the process is gone without compacting the file
+	db.engine.(*FileEngine).log.Close()
+
+	restarted, closeDB := openFileDB(t, path)
+	defer closeDB()
+
+	expectRows(t, restarted, "users", "edited@mail.com", "third@mail.com")
+
+	if _, err = restarted.GetRowsCount("messages"); !errors.Is(err, ErrNotExistedTable) {
+		t.Fatalf("expected dropped table to stay dropped, got %v", err)
+	}
+}
+
+func TestFileEngineCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_state.dat")
+
+	db, closeDB := openFileDB(t, path)
+
+	addRows(t, db, "users", "first@mail.com", "second@mail.com")
+
+	for i := 0; i < 100; i++ {
+		if err := db.AlterRow("users", "1", "edited@mail.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Size() >= before.Size()/10 {
+		t.Fatalf("expected overwritten rows to be reclaimed, file shrank from %d to %d bytes", before.Size(), after.Size())
+	}
+
+	// rows are read from their new place
+	expectRows(t, db, "users", "edited@mail.com", "second@mail.com")
+
+	if err = db.AddRow("users", "3", "third@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	closeDB()
+
+	db, closeDB = openFileDB(t, path)
+	defer closeDB()
+
+	expectRows(t, db, "users", "edited@mail.com", "second@mail.com", "third@mail.com")
+}
+
+func TestFileEngineKeepsCounter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_state.dat")
+
+	db, closeDB := openFileDB(t, path)
+
+	addRows(t, db, "users", "first@mail.com", "second@mail.com", "third@mail.com")
+
+	// the deleted row is the last one, so the counter is above every key left
+	if err := db.DropRow("users", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing compacts the file, which keeps the live rows only
+	closeDB()
+
+	db, closeDB = openFileDB(t, path)
+
+	if counter, _ := db.GetTableCounter("users"); counter != 3 {
+		t.Fatalf("expected counter 3 after compaction, got %d", counter)
+	}
+
+	addRows(t, db, "users", "fourth@mail.com")
+
+	if err := db.DropRow("users", "4"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the process is gone without compacting the file
+	db.engine.(*FileEngine).log.Close()
+
+	db, closeDB = openFileDB(t, path)
+	defer closeDB()
+
+	counter, err := db.GetTableCounter("users")
+	if err != nil || counter != 4 {
+		t.Fatalf("expected counter 4 after replay, got %d (%v)", counter, err)
+	}
+
+	if err = db.AddRow("users", strconv.Itoa(counter+1), "fifth@mail.com"); err != nil {
+		t.Fatalf("cannot add row after restart: %v", err)
+	}
+}
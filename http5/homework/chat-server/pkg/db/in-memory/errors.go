@@ -3,7 +3,20 @@ package in_memory
 import "errors"
 
 var (
-	ErrNotExistedRow   = errors.New("no such row")
-	ErrNotExistedTable = errors.New("no such table")
-	ErrExistingKey     = errors.New("key already exists")
+	ErrNotExistedRow    = errors.New("no such row")
+	ErrNotExistedTable  = errors.New("no such table")
+	ErrExistingKey      = errors.New("key already exists")
+	ErrCorruptedWAL     = errors.New("write-ahead log cannot be replayed")
+	ErrInvalidRowType   = errors.New("row type does not match table schema")
+	ErrNotExistedIndex  = errors.New("no such index")
+	ErrUniqueViolation  = errors.New("unique constraint violated")
+	ErrTxConflict       = errors.New("transaction conflicts with a concurrent write")
+	ErrTxDone           = errors.New("transaction has already been committed or rolled back")
+	ErrInvalidCursor    = errors.New("cursor does not point to a row matching the query")
+	ErrSlowSubscriber   = errors.New("subscriber was disconnected for not keeping up with events")
+	ErrSnapshotVersion  = errors.New("snapshot version is not supported")
+	ErrInvalidMigration = errors.New("invalid snapshot migration")
+	ErrMigrationFailed  = errors.New("snapshot migration failed")
+	ErrInvalidBackup    = errors.New("backup cannot be restored")
+	ErrNotEmpty         = errors.New("database is not empty")
 )
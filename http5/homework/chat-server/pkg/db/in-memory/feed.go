@@ -0,0 +1,272 @@
+package in_memory
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventInsert EventType = "insert"
+	EventUpdate EventType = "update"
+	EventDelete EventType = "delete"
+	// EventTruncate is sent when all rows of the table are removed at once by CreateTable, DropTable or Clear.
+	EventTruncate EventType = "truncate"
+)
+
+// Event describes a committed change of a table row. Seq is increasing across all tables
+// of the database, events of one transaction share it. Row is the new row or the removed one for deletes.
+type Event struct {
+	Seq   uint64
+	Type  EventType
+	Table string
+	Key   string
+	Row   any
+}
+
+// BackpressurePolicy decides what happens to events that do not fit into the buffer of a slow subscriber.
+type BackpressurePolicy int
+
+const (
+	// DropOldest discards the oldest buffered event to make room for the new one.
+	DropOldest BackpressurePolicy = iota
+	// DropNewest discards the new event.
+	DropNewest
+	// Block makes the writer wait for the subscriber up to BlockTimeout and disconnects the subscriber after it.
+	// The table lock is held while waiting, so a blocked subscriber stalls all writes to the table,
+	// while writes to other tables and subscribing go on.
+	Block
+	// Disconnect closes the subscription.
+	Disconnect
+)
+
+const (
+	defaultSubscriptionBuffer       = 64
+	defaultSubscriptionBlockTimeout = time.Second
+)
+
+type SubscriptionConfig struct {
+	// Buffer is the number of events held for the subscriber, 64 by default.
+	Buffer       int
+	Policy       BackpressurePolicy
+	BlockTimeout time.Duration
+}
+
+type Subscription struct {
+	db     *InMemDB
+	table  string
+	cfg    SubscriptionConfig
+	events chan Event
+
+	dropped      atomic.Uint64
+	disconnected atomic.Bool
+
+	// sendM guards sending events against closing them once the subscription is removed
+	sendM        sync.Mutex
+	unsubscribed bool
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Subscribe returns a subscription to the changes of the table committed after the call.
+// The table does not have to exist yet. The subscription must be closed once it is not needed.
+func (db *InMemDB) Subscribe(table string, cfg SubscriptionConfig) *Subscription {
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = defaultSubscriptionBuffer
+	}
+
+	if cfg.BlockTimeout <= 0 {
+		cfg.BlockTimeout = defaultSubscriptionBlockTimeout
+	}
+
+	sub := &Subscription{
+		db:     db,
+		table:  table,
+		cfg:    cfg,
+		events: make(chan Event, cfg.Buffer),
+		closed: make(chan struct{}),
+	}
+
+	db.subsM.Lock()
+	defer db.subsM.Unlock()
+
+	if db.subs[table] == nil {
+		db.subs[table] = make(map[*Subscription]struct{})
+	}
+
+	db.subs[table][sub] = struct{}{}
+
+	return sub
+}
+
+// Events is closed when the subscription is closed or disconnected.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events lost because the subscriber was too slow.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Err returns ErrSlowSubscriber if the subscription was disconnected by its backpressure policy.
+func (s *Subscription) Err() error {
+	if s.disconnected.Load() {
+		return ErrSlowSubscriber
+	}
+
+	return nil
+}
+
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		// unblocks the writer waiting for the subscriber before taking the lock it holds
+		close(s.closed)
+
+		s.db.subsM.Lock()
+		defer s.db.subsM.Unlock()
+
+		s.db.unsubscribeNotLocking(s)
+	})
+}
+
+func (db *InMemDB) unsubscribeNotLocking(sub *Subscription) {
+	subs, exists := db.subs[sub.table]
+	if !exists {
+		return
+	}
+
+	if _, subscribed := subs[sub]; !subscribed {
+		return
+	}
+
+	delete(subs, sub)
+
+	if len(subs) == 0 {
+		delete(db.subs, sub.table)
+	}
+
+	// a writer waiting for the subscriber is released by its closed channel first
+	sub.sendM.Lock()
+	defer sub.sendM.Unlock()
+
+	sub.unsubscribed = true
+
+	close(sub.events)
+}
+
+// stageEventNotLocking keeps the event until the write producing it is committed.
+// The table must be locked for writing.
+func (db *InMemDB) stageEventNotLocking(sh *shard, typ EventType, identifier string, row any) {
+	db.subsM.RLock()
+	subscribed := len(db.subs[sh.name]) > 0
+	db.subsM.RUnlock()
+
+	if !subscribed {
+		return
+	}
+
+	sh.events = append(sh.events, Event{Seq: sh.version, Type: typ, Table: sh.name, Key: identifier, Row: row})
+}
+
+func (db *InMemDB) discardEventsNotLocking(sh *shard) {
+	sh.events = sh.events[:0]
+}
+
+// publishEventsNotLocking sends the staged events of the table. Events of a table are sent only
+// by the writer holding its lock, so subscribers get them in order.
+func (db *InMemDB) publishEventsNotLocking(sh *shard) {
+	if len(sh.events) == 0 {
+		return
+	}
+
+	db.subsM.RLock()
+
+	subs := make([]*Subscription, 0, len(db.subs[sh.name]))
+
+	for sub := range db.subs[sh.name] {
+		subs = append(subs, sub)
+	}
+
+	db.subsM.RUnlock()
+
+	var disconnected []*Subscription
+
+	// subscribers are waited for without the lock of subscriptions, so a blocked one stalls only its table
+	for _, event := range sh.events {
+		for _, sub := range subs {
+			if !sub.disconnected.Load() && !sub.deliver(event) {
+				sub.disconnected.Store(true)
+				disconnected = append(disconnected, sub)
+			}
+		}
+	}
+
+	db.discardEventsNotLocking(sh)
+
+	if len(disconnected) == 0 {
+		return
+	}
+
+	db.subsM.Lock()
+	defer db.subsM.Unlock()
+
+	for _, sub := range disconnected {
+		db.unsubscribeNotLocking(sub)
+	}
+}
+
+// deliver reports false if the subscriber has to be disconnected.
+// Only the writer holding the lock sends events, so room made in the buffer cannot be taken by another sender.
+func (s *Subscription) deliver(event Event) bool {
+	s.sendM.Lock()
+	defer s.sendM.Unlock()
+
+	// closed after the subscribers were listed
+	if s.unsubscribed {
+		return true
+	}
+
+	select {
+	case s.events <- event:
+		return true
+	default:
+	}
+
+	switch s.cfg.Policy {
+	case DropOldest:
+		select {
+		case <-s.events:
+			s.dropped.Add(1)
+		default:
+		}
+
+		select {
+		case s.events <- event:
+		default:
+			s.dropped.Add(1)
+		}
+
+		return true
+	case DropNewest:
+		s.dropped.Add(1)
+		return true
+	case Block:
+		timer := time.NewTimer(s.cfg.BlockTimeout)
+		defer timer.Stop()
+
+		select {
+		case s.events <- event:
+			return true
+		case <-s.closed:
+			return true
+		case <-timer.C:
+			return false
+		}
+	default:
+		return false
+	}
+}
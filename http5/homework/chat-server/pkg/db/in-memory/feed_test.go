@@ -0,0 +1,212 @@
+package in_memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func initFeedDB(t *testing.T) *InMemDB {
+	t.Helper()
+
+	db, _ := NewInMemDB(context.Background(), "")
+
+	db.CreateTable("messages")
+
+	return db
+}
+
+func receiveEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("subscription was closed")
+		}
+
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+
+	return Event{}
+}
+
+func TestSubscriptionReceivesWrites(t *testing.T) {
+	db := initFeedDB(t)
+
+	sub := db.Subscribe("messages", SubscriptionConfig{})
+	defer sub.Close()
+
+	other := db.Subscribe("users", SubscriptionConfig{})
+	defer other.Close()
+
+	addMessages(t, db, 1, 1)
+
+	if err := db.AlterRow("messages", "1", "edited"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DropRow("messages", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Event{
+		{Type: EventInsert, Key: "1", Row: "message 1"},
+		{Type: EventUpdate, Key: "1", Row: "edited"},
+		{Type: EventDelete, Key: "1", Row: "edited"},
+	}
+
+	var lastSeq uint64
+
+	for _, want := range expected {
+		got := receiveEvent(t, sub)
+
+		if got.Type != want.Type || got.Table != "messages" || got.Key != want.Key || got.Row != want.Row {
+			t.Fatalf("expected %+v, got %+v", want, got)
+		}
+
+		if got.Seq <= lastSeq {
+			t.Fatalf("sequence number %d does not increase after %d", got.Seq, lastSeq)
+		}
+
+		lastSeq = got.Seq
+	}
+
+	if len(other.Events()) != 0 {
+		t.Fatal("subscriber of another table received events")
+	}
+}
+
+func TestSubscriptionSeesOnlyCommittedTx(t *testing.T) {
+	db := initFeedDB(t)
+
+	if err := db.CreateIndex("messages", IndexSpec{Name: emailIndex, Unique: true, Key: emailKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	addMessages(t, db, 1, 1)
+
+	sub := db.Subscribe("messages", SubscriptionConfig{})
+	defer sub.Close()
+
+	tx := db.Begin()
+
+	if err := tx.AddRow("messages", "2", "message 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.AddRow("messages", "3", "message 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("expected unique violation, got %v", err)
+	}
+
+	if len(sub.Events()) != 0 {
+		t.Fatalf("failed transaction published %d events", len(sub.Events()))
+	}
+
+	err := db.Tx(func(tx Transaction) error {
+		return tx.AddRow("messages", "2", "message 2")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event := receiveEvent(t, sub); event.Type != EventInsert || event.Key != "2" {
+		t.Fatalf("expected insert of committed row, got %+v", event)
+	}
+}
+
+func TestSubscriptionBackpressure(t *testing.T) {
+	db := initFeedDB(t)
+
+	dropOldest := db.Subscribe("messages", SubscriptionConfig{Buffer: 2, Policy: DropOldest})
+	defer dropOldest.Close()
+
+	dropNewest := db.Subscribe("messages", SubscriptionConfig{Buffer: 2, Policy: DropNewest})
+	defer dropNewest.Close()
+
+	disconnect := db.Subscribe("messages", SubscriptionConfig{Buffer: 2, Policy: Disconnect})
+
+	block := db.Subscribe("messages", SubscriptionConfig{Buffer: 2, Policy: Block, BlockTimeout: 10 * time.Millisecond})
+
+	addMessages(t, db, 1, 3)
+
+	if event := receiveEvent(t, dropOldest); event.Key != "2" || dropOldest.Dropped() != 1 {
+		t.Fatalf("expected oldest event to be dropped, got %+v with %d dropped", event, dropOldest.Dropped())
+	}
+
+	if event := receiveEvent(t, dropNewest); event.Key != "1" || dropNewest.Dropped() != 1 {
+		t.Fatalf("expected newest event to be dropped, got %+v with %d dropped", event, dropNewest.Dropped())
+	}
+
+	for _, sub := range []*Subscription{disconnect, block} {
+		received := 0
+
+		for range sub.Events() {
+			received++
+		}
+
+		if received != 2 || !errors.Is(sub.Err(), ErrSlowSubscriber) {
+			t.Fatalf("expected disconnect after buffered events, got %d events (%v)", received, sub.Err())
+		}
+
+		// closing a disconnected subscription is a no-op
+		sub.Close()
+	}
+}
+
+func TestBlockedSubscriberStallsOnlyItsTable(t *testing.T) {
+	db := initFeedDB(t)
+	db.CreateTable("users")
+
+	block := db.Subscribe("messages", SubscriptionConfig{Buffer: 1, Policy: Block, BlockTimeout: time.Minute})
+
+	addMessages(t, db, 1, 1)
+
+	// waits for the subscriber until it is closed
+	written := make(chan error, 1)
+
+	go func() {
+		written <- db.AddRow("messages", "2", "message 2")
+	}()
+
+	// gives the writer time to get blocked on the full buffer
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+
+	go func() {
+		sub := db.Subscribe("users", SubscriptionConfig{})
+		defer sub.Close()
+
+		if err := db.AddRow("users", "1", "user"); err != nil {
+			done <- err
+			return
+		}
+
+		<-sub.Events()
+
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("writes to another table are stalled by a blocked subscriber")
+	}
+
+	block.Close()
+
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+}
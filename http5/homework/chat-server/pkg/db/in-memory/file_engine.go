@@ -0,0 +1,485 @@
+package in_memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// FileEngine keeps the tables in an append-only file in the spirit of Bitcask: every
+// write is appended to the file and memory holds only the location of the latest
+// version of every row, rows themselves are read from the file on demand.
+// Overwritten and dropped rows are reclaimed by Compact, which InMemDB runs on every snapshot.
+type FileEngine struct {
+	log    *WAL
+	decode RowDecoder
+	tables map[string]*fileTable
+
+	// m is taken for writing by operations changing the set of tables and by compaction,
+	// which moves every row. Rows of a table are guarded by the lock of its shard.
+	m sync.RWMutex
+}
+
+// OpenFileEngine opens the file at cfg.Path, creating it if needed. The sync policy
+// of the config defines durability of writes the same way it does for the write-ahead log.
+func OpenFileEngine(cfg WALConfig) (*FileEngine, error) {
+	log, err := OpenWAL(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileEngine{
+		log:    log,
+		tables: make(map[string]*fileTable),
+	}, nil
+}
+
+// rowLoc is where the latest version of a row is stored.
+type rowLoc struct {
+	offset int64
+	size   int64
+	// op is the position of the write in a transaction record, -1 for a record of a single write
+	op int
+
+	// rows set with no persisted write, such as a row a transaction writes more than once,
+	// are kept in memory until compaction
+	persisted bool
+	row       any
+}
+
+func (e *FileEngine) Open(decode RowDecoder) (map[string]Table, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.decode = decode
+
+	err := e.log.replayAt(func(rec walRecord, offset, size int64) error {
+		return e.applyRecord(rec, offset, size, -1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string]Table, len(e.tables))
+
+	for name, t := range e.tables {
+		tables[name] = t
+	}
+
+	return tables, nil
+}
+
+// applyRecord points rows of the tables to the record appended at offset. op is the position
+// of the record in a transaction, -1 for a record of its own. The engine must be locked for writing.
+func (e *FileEngine) applyRecord(rec walRecord, offset, size int64, op int) error {
+	switch rec.Op {
+	case OpCreateTable:
+		e.tables[rec.Table] = e.newFileTable(rec.Table)
+	case OpDropTable:
+		delete(e.tables, rec.Table)
+	case OpClear:
+		e.tables = make(map[string]*fileTable)
+	case OpAddRow, OpAlterRow:
+		t, exists := e.tables[rec.Table]
+		if !exists {
+			return fmt.Errorf("%w: table %s", ErrNotExistedTable, rec.Table)
+		}
+
+		if _, exists = t.keys.Get(rec.Key); !exists {
+			t.counter++
+		}
+
+		t.keys.Set(rec.Key, &rowLoc{offset: offset, size: size, op: op, persisted: true})
+	case OpDropRow:
+		if t, exists := e.tables[rec.Table]; exists {
+			t.keys.Delete(rec.Key)
+		}
+	case opSetCounter:
+		t, exists := e.tables[rec.Table]
+		if !exists {
+			return fmt.Errorf("%w: table %s", ErrNotExistedTable, rec.Table)
+		}
+
+		if err := json.Unmarshal(rec.Row, &t.counter); err != nil {
+			return err
+		}
+	case opTx:
+		for i, txOp := range rec.Ops {
+			if err := e.applyRecord(txOp, offset, size, i); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", rec.Op)
+	}
+
+	return nil
+}
+
+func (e *FileEngine) NewTable(name string) Table {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	t, exists := e.tables[name]
+	if !exists {
+		t = e.newFileTable(name)
+		e.tables[name] = t
+	}
+
+	return t
+}
+
+// Persist appends the writes as a single record. A table write takes effect right away,
+// a row write is remembered and completes when InMemDB sets the row in the table.
+func (e *FileEngine) Persist(writes []Write) error {
+	if len(writes) == 0 {
+		return nil
+	}
+
+	rec, err := newRowRecord(writes[0].Op, writes[0].Table, writes[0].Key, writes[0].Row)
+	if len(writes) > 1 {
+		rec, err = newTxRecord(writes)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if isTableOp(writes[0].Op) {
+		e.m.Lock()
+		defer e.m.Unlock()
+	} else {
+		e.m.RLock()
+		defer e.m.RUnlock()
+	}
+
+	offset, size, err := e.log.append(rec)
+	if err != nil {
+		return err
+	}
+
+	if isTableOp(writes[0].Op) {
+		return e.applyRecord(rec, offset, size, -1)
+	}
+
+	// only the last write of a row in the record matters
+	last := make(map[string]map[string]int)
+
+	for i, w := range writes {
+		// counters are kept by InMemDB until compaction and read back from the record on replay
+		if w.Op == opSetCounter {
+			continue
+		}
+
+		if last[w.Table] == nil {
+			last[w.Table] = make(map[string]int)
+		}
+
+		last[w.Table][w.Key] = i
+	}
+
+	for table, keys := range last {
+		t, exists := e.tables[table]
+		if !exists {
+			continue
+		}
+
+		t.pending = make(map[string]rowLoc)
+
+		for key, i := range keys {
+			if writes[i].Op == OpDropRow {
+				continue
+			}
+
+			loc := rowLoc{offset: offset, size: size, op: -1, persisted: true}
+			if len(writes) > 1 {
+				loc.op = i
+			}
+
+			t.pending[key] = loc
+		}
+	}
+
+	return nil
+}
+
+func isTableOp(op WriteOp) bool {
+	return op == OpCreateTable || op == OpDropTable || op == OpClear
+}
+
+// Compact rewrites the file with the live rows only. It must not run while a write is
+// half done, InMemDB calls it holding the locks of all tables.
+func (e *FileEngine) Compact() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.log.m.Lock()
+	defer e.log.m.Unlock()
+
+	if e.log.err != nil {
+		return e.log.err
+	}
+
+	names := make([]string, 0, len(e.tables))
+
+	for name := range e.tables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	// rows are moved only once the new file is in place
+	moved := make(map[*rowLoc]rowLoc)
+
+	err := e.log.rewrite(func(emit func(rec walRecord) (int64, int64, error)) error {
+		for _, name := range names {
+			t := e.tables[name]
+
+			if _, _, err := emit(walRecord{Op: OpCreateTable, Table: name}); err != nil {
+				return err
+			}
+
+			for pair := t.keys.Oldest(); pair != nil; pair = pair.Next() {
+				rec, err := t.rowRecord(pair.Key, pair.Value)
+				if err != nil {
+					return err
+				}
+
+				offset, size, err := emit(rec)
+				if err != nil {
+					return err
+				}
+
+				moved[pair.Value] = rowLoc{offset: offset, size: size, op: -1, persisted: true}
+			}
+
+			// the counter follows the rows, which count themselves on replay
+			rec, err := newRowRecord(opSetCounter, name, "", t.counter)
+			if err != nil {
+				return err
+			}
+
+			if _, _, err = emit(rec); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for loc, newLoc := range moved {
+		*loc = newLoc
+	}
+
+	for _, t := range e.tables {
+		t.pending = make(map[string]rowLoc)
+	}
+
+	return nil
+}
+
+func (e *FileEngine) Close() error {
+	return e.log.Close()
+}
+
+type fileTable struct {
+	engine *FileEngine
+	name   string
+	keys   *orderedmap.OrderedMap[string, *rowLoc]
+
+	// pending are locations of rows persisted but not set yet
+	pending map[string]rowLoc
+
+	// counter is the counter of the table as of the last replay or compaction
+	counter int
+}
+
+func (e *FileEngine) newFileTable(name string) *fileTable {
+	return &fileTable{
+		engine:  e,
+		name:    name,
+		keys:    orderedmap.New[string, *rowLoc](),
+		pending: make(map[string]rowLoc),
+	}
+}
+
+// rowRecord returns a record writing the row stored at loc. The log must be locked.
+func (t *fileTable) rowRecord(key string, loc *rowLoc) (walRecord, error) {
+	if !loc.persisted {
+		return newRowRecord(OpAddRow, t.name, key, loc.row)
+	}
+
+	raw, err := t.readRaw(loc, t.engine.log.readAtNotLocking)
+	if err != nil {
+		return walRecord{}, err
+	}
+
+	return walRecord{Op: OpAddRow, Table: t.name, Key: key, Row: raw}, nil
+}
+
+func (t *fileTable) readRaw(loc *rowLoc, readAt func(offset, size int64) (walRecord, error)) (json.RawMessage, error) {
+	rec, err := readAt(loc.offset, loc.size)
+	if err != nil {
+		return nil, err
+	}
+
+	if loc.op < 0 {
+		return rec.Row, nil
+	}
+
+	if loc.op >= len(rec.Ops) {
+		return nil, fmt.Errorf("%w: record at %d has no write %d", ErrCorruptedWAL, loc.offset, loc.op)
+	}
+
+	return rec.Ops[loc.op].Row, nil
+}
+
+func (t *fileTable) read(loc *rowLoc) (any, error) {
+	if !loc.persisted {
+		return loc.row, nil
+	}
+
+	raw, err := t.readRaw(loc, t.engine.log.readAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.engine.decode(t.name, raw)
+}
+
+func (t *fileTable) Get(key string) (any, bool, error) {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	loc, exists := t.keys.Get(key)
+	if !exists {
+		return nil, false, nil
+	}
+
+	row, err := t.read(loc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return row, true, nil
+}
+
+func (t *fileTable) Set(key string, row any) error {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	loc, persisted := t.pending[key]
+	if !persisted {
+		loc = rowLoc{row: row}
+	}
+
+	delete(t.pending, key)
+
+	if set, exists := t.keys.Get(key); exists {
+		*set = loc
+		return nil
+	}
+
+	t.keys.Set(key, &loc)
+
+	return nil
+}
+
+func (t *fileTable) Delete(key string) (any, bool, error) {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	delete(t.pending, key)
+
+	loc, exists := t.keys.Get(key)
+	if !exists {
+		return nil, false, nil
+	}
+
+	row, err := t.read(loc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	t.keys.Delete(key)
+
+	return row, true, nil
+}
+
+func (t *fileTable) Len() int {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	return t.keys.Len()
+}
+
+func (t *fileTable) Range(fn func(key string, row any) bool) error {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	for pair := t.keys.Oldest(); pair != nil; pair = pair.Next() {
+		row, err := t.read(pair.Value)
+		if err != nil {
+			return err
+		}
+
+		if !fn(pair.Key, row) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (t *fileTable) Next(key string) (string, bool) {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	pair := t.keys.GetPair(key)
+	if pair == nil || pair.Next() == nil {
+		return "", false
+	}
+
+	return pair.Next().Key, true
+}
+
+func (t *fileTable) MoveBefore(key, mark string) error {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	return t.keys.MoveBefore(key, mark)
+}
+
+func (t *fileTable) Counter() int {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	return t.counter
+}
+
+func (t *fileTable) SetCounter(counter int) {
+	t.engine.m.RLock()
+	defer t.engine.m.RUnlock()
+
+	t.counter = counter
+}
+
+func (t *fileTable) MarshalJSON() ([]byte, error) {
+	rows := orderedmap.New[string, any]()
+
+	err := t.Range(func(key string, row any) bool {
+		rows.Set(key, row)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows.MarshalJSON()
+}
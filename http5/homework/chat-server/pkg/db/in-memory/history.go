@@ -0,0 +1,258 @@
+package in_memory
+
+import "sort"
+
+// rowVersion is the value the row had before the write numbered seq.
+type rowVersion struct {
+	seq      uint64
+	row      any
+	existed  bool
+	inserted uint64
+}
+
+// counterVersion is the counter the table had before the write numbered seq.
+type counterVersion struct {
+	seq     uint64
+	counter int
+}
+
+// takeSnapshot returns the sequence number of the last write, a transaction reads the database as of it
+// until the snapshot is released. Writes made after the oldest taken snapshot keep the values they replace.
+func (db *InMemDB) takeSnapshot() uint64 {
+	// a writer that sees no running transaction has numbered its write before the snapshot is taken
+	db.runningTxs.Add(1)
+
+	db.txSnapshotsM.Lock()
+	defer db.txSnapshotsM.Unlock()
+
+	snapshot := db.seq.Load()
+	db.txSnapshots[snapshot]++
+
+	return snapshot
+}
+
+func (db *InMemDB) releaseSnapshot(snapshot uint64) {
+	db.txSnapshotsM.Lock()
+
+	if db.txSnapshots[snapshot]--; db.txSnapshots[snapshot] == 0 {
+		delete(db.txSnapshots, snapshot)
+	}
+
+	db.txSnapshotsM.Unlock()
+
+	db.runningTxs.Add(-1)
+}
+
+// oldestSnapshot returns the oldest snapshot of the running transactions.
+func (db *InMemDB) oldestSnapshot() (uint64, bool) {
+	if db.runningTxs.Load() == 0 {
+		return 0, false
+	}
+
+	db.txSnapshotsM.Lock()
+	defer db.txSnapshotsM.Unlock()
+
+	oldest, found := uint64(0), false
+
+	for snapshot := range db.txSnapshots {
+		if !found || snapshot < oldest {
+			oldest, found = snapshot, true
+		}
+	}
+
+	return oldest, found
+}
+
+// keepVersionNotLocking saves the value the row had before the write, if a running transaction
+// reads the table as of an older snapshot. The table must be locked for writing.
+func (db *InMemDB) keepVersionNotLocking(sh *shard, identifier string, v rowVersion) {
+	oldest, running := db.oldestSnapshot()
+	sh.pruneHistory(oldest, running)
+
+	if running && oldest < v.seq {
+		sh.history[identifier] = append(sh.history[identifier], v)
+	}
+}
+
+// keepCounterNotLocking saves the counter of the table before the write numbered seq changes it.
+func (db *InMemDB) keepCounterNotLocking(sh *shard, seq uint64) {
+	oldest, running := db.oldestSnapshot()
+	sh.pruneHistory(oldest, running)
+
+	if running && oldest < seq {
+		sh.counters = append(sh.counters, counterVersion{seq: seq, counter: sh.counter})
+	}
+}
+
+// pruneHistory drops the versions no running transaction reads anymore.
+func (sh *shard) pruneHistory(oldest uint64, running bool) {
+	if !running {
+		if len(sh.history) > 0 {
+			sh.history = make(map[string][]rowVersion)
+		}
+
+		sh.counters = nil
+
+		return
+	}
+
+	for key, versions := range sh.history {
+		kept := sort.Search(len(versions), func(i int) bool { return versions[i].seq > oldest })
+
+		if kept == len(versions) {
+			delete(sh.history, key)
+		} else {
+			sh.history[key] = versions[kept:]
+		}
+	}
+
+	sh.counters = sh.counters[sort.Search(len(sh.counters), func(i int) bool { return sh.counters[i].seq > oldest }):]
+}
+
+// versionAt returns the value the row had as of the snapshot, false if it is the current one.
+func (sh *shard) versionAt(identifier string, snapshot uint64) (rowVersion, bool) {
+	for _, v := range sh.history[identifier] {
+		if v.seq > snapshot {
+			return v, true
+		}
+	}
+
+	return rowVersion{}, false
+}
+
+func (sh *shard) rowAt(identifier string, snapshot uint64) (any, bool, error) {
+	if v, old := sh.versionAt(identifier, snapshot); old {
+		return v.row, v.existed, nil
+	}
+
+	return sh.rows.Get(identifier)
+}
+
+func (sh *shard) counterAt(snapshot uint64) int {
+	for _, v := range sh.counters {
+		if v.seq > snapshot {
+			return v.counter
+		}
+	}
+
+	return sh.counter
+}
+
+// rangeAt calls fn for the rows the table had as of the snapshot, from the oldest to the newest, until it returns false.
+func (sh *shard) rangeAt(snapshot uint64, fn func(key string, row any) bool) error {
+	// rows dropped, or dropped and added again, after the snapshot are not in their place among the current rows
+	type displacedRow struct {
+		key string
+		rowVersion
+	}
+
+	var displaced []displacedRow
+
+	for key := range sh.history {
+		v, old := sh.versionAt(key, snapshot)
+		if !old || !v.existed {
+			continue
+		}
+
+		if inserted, present := sh.inserted[key]; present && inserted == v.inserted {
+			continue
+		}
+
+		displaced = append(displaced, displacedRow{key: key, rowVersion: v})
+	}
+
+	sort.Slice(displaced, func(i, j int) bool { return displaced[i].inserted < displaced[j].inserted })
+
+	next, stopped := 0, false
+
+	err := sh.rows.Range(func(key string, row any) bool {
+		inserted := sh.inserted[key]
+
+		for ; next < len(displaced) && displaced[next].inserted < inserted; next++ {
+			if !fn(displaced[next].key, displaced[next].row) {
+				stopped = true
+				return false
+			}
+		}
+
+		if v, old := sh.versionAt(key, snapshot); old {
+			if !v.existed || v.inserted != inserted {
+				return true
+			}
+
+			row = v.row
+		}
+
+		if !fn(key, row) {
+			stopped = true
+			return false
+		}
+
+		return true
+	})
+	if err != nil || stopped {
+		return err
+	}
+
+	for ; next < len(displaced); next++ {
+		if !fn(displaced[next].key, displaced[next].row) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// keyByIndexAt returns the key of the oldest row having the value in the index as of the snapshot.
+func (sh *shard) keyByIndexAt(idx *index, value string, snapshot uint64) (string, bool, error) {
+	ids, exists := idx.entries[value]
+
+	if len(sh.history) == 0 {
+		if !exists {
+			return "", false, nil
+		}
+
+		return ids.Oldest().Key, true, nil
+	}
+
+	// rows written after the snapshot may have had the value before, so they are looked at as well
+	candidates := make([]string, 0, len(sh.history))
+
+	if exists {
+		for pair := ids.Oldest(); pair != nil; pair = pair.Next() {
+			candidates = append(candidates, pair.Key)
+		}
+	}
+
+	for key := range sh.history {
+		candidates = append(candidates, key)
+	}
+
+	found, foundInserted, ok := "", uint64(0), false
+
+	for _, key := range candidates {
+		row, existed, err := sh.rowAt(key, snapshot)
+		if err != nil {
+			return "", false, err
+		}
+
+		if !existed {
+			continue
+		}
+
+		if rowValue, indexed := idx.spec.Key(row); !indexed || rowValue != value {
+			continue
+		}
+
+		inserted := sh.inserted[key]
+		if v, old := sh.versionAt(key, snapshot); old {
+			inserted = v.inserted
+		}
+
+		if !ok || inserted < foundInserted {
+			found, foundInserted, ok = key, inserted, true
+		}
+	}
+
+	return found, ok, nil
+}
@@ -3,18 +3,18 @@ package in_memory
 import (
 	"context"
 	"encoding/json"
-	"os"
+	"fmt"
+	"reflect"
+	"strconv"
 	"sync"
-
-	orderedmap "github.com/wk8/go-ordered-map/v2"
-
-	jsonutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/json"
+	"sync/atomic"
+	"time"
 )
 
 type InMemoryDB interface {
-	CreateTable(name string)
+	CreateTable(name string) error
 	GetTable(name string) (Table, error)
-	DropTable(name string)
+	DropTable(name string) error
 
 	AddRow(table string, identifier string, row any) error
 	AlterRow(table string, identifier string, newRow any) error
@@ -25,73 +25,223 @@ type InMemoryDB interface {
 	GetRowsCount(table string) (int, error)
 	GetTableCounter(table string) (int, error)
 
-	Clear()
-}
+	CreateIndex(table string, spec IndexSpec) error
+	GetRowByIndex(table, index, value string) (any, error)
+	GetRowsByIndex(table, index, value string) ([]any, error)
 
-type Table = *orderedmap.OrderedMap[string, any]
+	Query(table string, q Query) (QueryResult, error)
 
-type InMemDB struct {
-	Tables   map[string]Table
-	counters map[string]int
+	Subscribe(table string, cfg SubscriptionConfig) *Subscription
 
+	Begin() Transaction
+	Tx(fn func(tx Transaction) error) error
+
+	Clear() error
+}
+
+type InMemDB struct {
+	shards  map[string]*shard
+	schemas map[string]reflect.Type
+
+	// seq numbers writes across all tables, all writes of a transaction share a number
+	seq atomic.Uint64
+
+	// txSnapshots counts running transactions by their snapshots, see takeSnapshot
+	txSnapshots  map[uint64]int
+	txSnapshotsM sync.Mutex
+	runningTxs   atomic.Int64
+
+	engine Engine
+	wal    *WAL
+
+	subs  map[string]map[*Subscription]struct{}
+	subsM sync.RWMutex
+
+	ttls            map[string]TTLConfig
+	expiries        expiryQueue
+	expiriesM       sync.Mutex
+	janitorInterval time.Duration
+	janitorDone     chan struct{}
+
+	migrations      *MigrationRegistry
+	savePath        string
+	snapshotCfg     SnapshotConfig
+	dirty           atomic.Int64
+	snapshotReq     chan struct{}
+	snapshotMu      sync.Mutex
+	snapshotterDone chan struct{}
+
+	// m is the catalog lock guarding the set of tables, every table has its own lock
 	m *sync.RWMutex
 }
 
-func NewInMemDB(ctx context.Context, savePath string) (*InMemDB, <-chan any) {
+type Option func(db *InMemDB)
+
+// WithWAL makes the database log every write to wal before applying it.
+// The log is closed by the database once its final state is saved.
+func WithWAL(wal *WAL) Option {
+	return func(db *InMemDB) {
+		db.wal = wal
+	}
+}
+
+func newInMemDB(savePath string, opts []Option) *InMemDB {
 	db := InMemDB{
-		Tables:   make(map[string]Table),
-		counters: make(map[string]int),
-		m:        &sync.RWMutex{},
+		shards:          make(map[string]*shard),
+		schemas:         make(map[string]reflect.Type),
+		txSnapshots:     make(map[uint64]int),
+		engine:          MemoryEngine{},
+		subs:            make(map[string]map[*Subscription]struct{}),
+		ttls:            make(map[string]TTLConfig),
+		janitorInterval: defaultJanitorInterval,
+		janitorDone:     make(chan struct{}),
+		savePath:        savePath,
+		snapshotReq:     make(chan struct{}, 1),
+		snapshotterDone: make(chan struct{}),
+		m:               &sync.RWMutex{},
 	}
 
+	for _, opt := range opts {
+		opt(&db)
+	}
+
+	return &db
+}
+
+func NewInMemDB(ctx context.Context, savePath string, opts ...Option) (*InMemDB, <-chan any) {
+	db := newInMemDB(savePath, opts)
+
 	savedChan := make(chan any, 1)
 
-	go func() {
-		<-ctx.Done()
-		db.Save(savePath, savedChan)
-	}()
+	db.start(ctx, savedChan)
 
-	return &db, savedChan
+	return db, savedChan
 }
 
-func NewInMemDBFromJSON(ctx context.Context, jsonState string, savePath string) (*InMemDB, <-chan any, error) {
-	tables := make(map[string]Table)
+// NewInMemDBFromJSON restores the database from the snapshot and then replays
+// the write-ahead log, if one is provided, on top of it. Snapshots of older versions
+// are upgraded with the registry set by WithMigrations before rows are restored.
+// Rows of tables declared with WithTableSchema are restored as values of the declared type.
+func NewInMemDBFromJSON(ctx context.Context, jsonState string, savePath string, opts ...Option) (*InMemDB, <-chan any, error) {
+	db := newInMemDB(savePath, opts)
 
-	err := json.Unmarshal([]byte(jsonState), &tables) // todo: not unmarshalls embedded map
+	tables, counters, err := db.decodeTables(jsonState)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	counters := make(map[string]int)
+	for name, rows := range tables {
+		db.addShardNotLocking(name, rows, counters[name])
+	}
 
-	for name, table := range tables {
-		counters[name] = table.Len()
+	if db.wal != nil {
+		if err = db.wal.replay(db.applyRecord); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	db := InMemDB{
-		Tables:   tables,
-		counters: counters,
-		m:        &sync.RWMutex{},
+	// replayed rows are scheduled again along with the restored ones
+	db.expiries = db.expiries[:0]
+
+	if err = db.scheduleTablesNotLocking(); err != nil {
+		return nil, nil, err
 	}
 
 	savedChan := make(chan any)
 
-	go func() {
-		<-ctx.Done()
-		db.Save(savePath, savedChan)
-	}()
+	db.start(ctx, savedChan)
 
-	return &db, savedChan, nil
+	return db, savedChan, nil
 }
 
-func (db *InMemDB) Save(path string, doneChan chan any) {
-	bytes, err := json.Marshal(db.Tables)
+// NewInMemDBFromEngine opens the database over the tables held by the engine set with WithEngine.
+func NewInMemDBFromEngine(ctx context.Context, savePath string, opts ...Option) (*InMemDB, <-chan any, error) {
+	db := newInMemDB(savePath, opts)
+
+	tables, err := db.engine.Open(db.decodeRow)
 	if err != nil {
-		doneChan <- err
-		return // todo: log?
+		return nil, nil, err
+	}
+
+	for name, rows := range tables {
+		counter := 0
+
+		if counted, ok := rows.(countedTable); ok {
+			counter = counted.Counter()
+		}
+
+		db.addShardNotLocking(name, rows, counter)
+	}
+
+	if err = db.scheduleTablesNotLocking(); err != nil {
+		return nil, nil, err
+	}
+
+	savedChan := make(chan any, 1)
+
+	db.start(ctx, savedChan)
+
+	return db, savedChan, nil
+}
+
+// addShardNotLocking adds the restored table with its saved counter. Snapshots saved without
+// counters leave it unknown, then the counter is made to reach past the highest numeric key,
+// so that identifiers allocated from it do not collide with the restored rows.
+func (db *InMemDB) addShardNotLocking(name string, rows Table, counter int) {
+	sh := newShard(name, rows, nil)
+	sh.counter = max(counter, rows.Len(), highestKey(rows))
+
+	db.shards[name] = sh
+}
+
+// highestKey returns the highest of the keys of the table that are numbers.
+func highestKey(rows Table) int {
+	highest := 0
+
+	_ = rows.Range(func(key string, _ any) bool {
+		if id, err := strconv.Atoi(key); err == nil {
+			highest = max(highest, id)
+		}
+
+		return true
+	})
+
+	return highest
+}
+
+func (db *InMemDB) start(ctx context.Context, savedChan chan any) {
+	if db.snapshotCfg.Interval > 0 || db.snapshotCfg.DirtyThreshold > 0 {
+		go db.runSnapshotter(ctx)
+	} else {
+		close(db.snapshotterDone)
+	}
+
+	if len(db.ttls) > 0 {
+		go db.runJanitor(ctx)
+	} else {
+		close(db.janitorDone)
+	}
+
+	go db.saveOnDone(ctx, savedChan)
+}
+
+func (db *InMemDB) saveOnDone(ctx context.Context, doneChan chan any) {
+	<-ctx.Done()
+	<-db.snapshotterDone
+	<-db.janitorDone
+
+	err := db.Snapshot()
+
+	if db.wal != nil {
+		if closeErr := db.wal.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if closeErr := db.engine.Close(); err == nil {
+		err = closeErr
 	}
 
-	err = os.WriteFile(path, []byte(jsonutils.PrettifyJSON(string(bytes))), writePerm)
 	if err != nil {
 		doneChan <- err
 		return
@@ -100,102 +250,354 @@ func (db *InMemDB) Save(path string, doneChan chan any) {
 	doneChan <- "ok"
 }
 
-func (db *InMemDB) CreateTable(name string) {
-	db.m.Lock()
-	defer db.m.Unlock()
+func (db *InMemDB) Save(path string, doneChan chan any) {
+	if err := db.save(path); err != nil {
+		doneChan <- err
+		return // todo: log?
+	}
+
+	doneChan <- "ok"
+}
+
+// applyRecord applies a replayed log record. Replay may run over a snapshot that
+// already contains some of the records, so row writes are applied as upserts.
+// It runs before the database is shared, so no locks are taken.
+func (db *InMemDB) applyRecord(rec walRecord) error {
+	switch rec.Op {
+	case OpCreateTable:
+		db.createTableNotLocking(rec.Table)
+	case OpDropTable:
+		db.dropTableNotLocking(rec.Table)
+	case OpClear:
+		db.clearNotLocking()
+	case OpAddRow, OpAlterRow:
+		sh, err := db.getShardNotLocking(rec.Table)
+		if err != nil {
+			return err
+		}
+
+		row, err := db.decodeRow(rec.Table, rec.Row)
+		if err != nil {
+			return err
+		}
+
+		return db.setRowNotLocking(sh, rec.Key, row, db.seq.Add(1))
+	case OpDropRow:
+		sh, err := db.getShardNotLocking(rec.Table)
+		if err != nil {
+			return err
+		}
+
+		return db.deleteRowNotLocking(sh, rec.Key, db.seq.Add(1))
+	case opSetCounter:
+		var counter int
+
+		if err := json.Unmarshal(rec.Row, &counter); err != nil {
+			return err
+		}
+
+		return db.setCounterNotLocking(rec.Table, counter, db.seq.Add(1))
+	case opTx:
+		for _, op := range rec.Ops {
+			if err := db.applyRecord(op); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", rec.Op)
+	}
+
+	return nil
+}
+
+// recordWrite logs the write ahead of applying it and marks the state as changed since the last snapshot.
+func (db *InMemDB) recordWrite(op WriteOp, table, key string, row any) error {
+	if db.wal != nil {
+		if err := db.wal.appendRow(op, table, key, row); err != nil {
+			return err
+		}
+	}
+
+	if err := db.engine.Persist([]Write{{Op: op, Table: table, Key: key, Row: row}}); err != nil {
+		return err
+	}
 
-	db.Tables[name] = orderedmap.New[string, any]()
-	db.counters[name] = 0
+	db.markDirty()
+
+	return nil
 }
 
-func (db *InMemDB) getTableNotLocking(name string) (Table, error) {
-	t, ok := db.Tables[name]
+func (db *InMemDB) getShardNotLocking(name string) (*shard, error) {
+	sh, ok := db.shards[name]
 	if ok {
-		return t, nil
+		return sh, nil
 	}
 
 	return nil, ErrNotExistedTable
 }
 
+// createTableNotLocking, dropTableNotLocking and clearNotLocking require the catalog lock to be held for writing.
+func (db *InMemDB) createTableNotLocking(name string) {
+	old, existed := db.shards[name]
+
+	var indexes map[string]*index
+
+	if existed {
+		indexes = old.indexes
+	}
+
+	sh := newShard(name, db.engine.NewTable(name), indexes)
+	sh.version = db.seq.Add(1)
+	sh.created = sh.version
+
+	db.shards[name] = sh
+
+	if existed {
+		db.stageEventNotLocking(sh, EventTruncate, "", nil)
+		db.publishEventsNotLocking(sh)
+	}
+}
+
+func (db *InMemDB) dropTableNotLocking(name string) {
+	sh, existed := db.shards[name]
+	if !existed {
+		return
+	}
+
+	delete(db.shards, name)
+
+	// a transaction that read the table sees it missing on commit and fails with a conflict
+	sh.version = db.seq.Add(1)
+	db.stageEventNotLocking(sh, EventTruncate, "", nil)
+	db.publishEventsNotLocking(sh)
+}
+
+func (db *InMemDB) clearNotLocking() {
+	for name := range db.shards {
+		db.dropTableNotLocking(name)
+	}
+}
+
+func (db *InMemDB) bumpRowVersionNotLocking(sh *shard, identifier string, seq uint64) {
+	sh.version = seq
+	sh.versions[identifier] = seq
+}
+
+// setRowNotLocking inserts or replaces the row keeping indexes and the table counter up to date.
+// An inserted row having a numeric key moves the counter up to the key, like restored rows do,
+// so no row has a numeric key above the counter.
+// The write is numbered by seq, which must be taken while the table is locked for writing.
+func (db *InMemDB) setRowNotLocking(sh *shard, identifier string, row any, seq uint64) error {
+	old, existed, err := sh.rows.Get(identifier)
+	if err != nil {
+		return err
+	}
+
+	if err = sh.rows.Set(identifier, row); err != nil {
+		return err
+	}
+
+	db.keepVersionNotLocking(sh, identifier, rowVersion{seq: seq, row: old, existed: existed, inserted: sh.inserted[identifier]})
+
+	if existed {
+		sh.unindexRow(identifier, old)
+	} else {
+		db.keepCounterNotLocking(sh, seq)
+		sh.counter++
+
+		if id, err := strconv.Atoi(identifier); err == nil {
+			sh.counter = max(sh.counter, id)
+		}
+
+		sh.order++
+		sh.inserted[identifier] = sh.order
+	}
+
+	sh.indexRow(identifier, row)
+	db.bumpRowVersionNotLocking(sh, identifier, seq)
+	db.scheduleExpiryNotLocking(sh, identifier, row)
+
+	if existed {
+		db.stageEventNotLocking(sh, EventUpdate, identifier, row)
+	} else {
+		db.stageEventNotLocking(sh, EventInsert, identifier, row)
+	}
+
+	return nil
+}
+
+func (db *InMemDB) deleteRowNotLocking(sh *shard, identifier string, seq uint64) error {
+	old, existed, err := sh.rows.Delete(identifier)
+	if err != nil {
+		return err
+	}
+
+	if existed {
+		db.keepVersionNotLocking(sh, identifier, rowVersion{seq: seq, row: old, existed: true, inserted: sh.inserted[identifier]})
+		delete(sh.inserted, identifier)
+
+		sh.unindexRow(identifier, old)
+		db.bumpRowVersionNotLocking(sh, identifier, seq)
+		db.stageEventNotLocking(sh, EventDelete, identifier, old)
+	}
+
+	return nil
+}
+
+// CreateTable, DropTable and Clear change nothing if the change cannot be logged.
+func (db *InMemDB) CreateTable(name string) error {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if err := db.recordWrite(OpCreateTable, name, "", nil); err != nil {
+		return err
+	}
+
+	db.createTableNotLocking(name)
+
+	return nil
+}
+
+// GetTable returns the rows of the table. They are not guarded by any lock
+// once returned, so the table must not be read while it is written.
 func (db *InMemDB) GetTable(name string) (Table, error) {
 	db.m.RLock()
 	defer db.m.RUnlock()
 
-	return db.getTableNotLocking(name)
+	sh, err := db.getShardNotLocking(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return sh.rows, nil
 }
 
-func (db *InMemDB) DropTable(name string) {
+func (db *InMemDB) DropTable(name string) error {
 	db.m.Lock()
 	defer db.m.Unlock()
 
-	delete(db.Tables, name)
+	if err := db.recordWrite(OpDropTable, name, "", nil); err != nil {
+		return err
+	}
+
+	db.dropTableNotLocking(name)
+
+	return nil
 }
 
-func (db *InMemDB) Clear() {
+func (db *InMemDB) Clear() error {
 	db.m.Lock()
 	defer db.m.Unlock()
 
-	db.Tables = make(map[string]Table)
+	if err := db.recordWrite(OpClear, "", "", nil); err != nil {
+		return err
+	}
+
+	db.clearNotLocking()
+
+	return nil
 }
 
 func (db *InMemDB) AddRow(table string, identifier string, row any) error {
-	db.m.Lock()
-	defer db.m.Unlock()
+	sh, unlock, err := db.lockShard(table, true)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
 
-	t, err := db.getTableNotLocking(table)
+	_, exists, err := sh.rows.Get(identifier)
 	if err != nil {
 		return err
 	}
 
-	if _, exists := t.Get(identifier); exists {
+	if exists {
 		return ErrExistingKey
 	}
 
-	t.Set(identifier, row)
+	if err = db.checkRowType(table, row); err != nil {
+		return err
+	}
+
+	if err = sh.checkUnique(identifier, row); err != nil {
+		return err
+	}
 
-	db.counters[table]++
+	if err = db.recordWrite(OpAddRow, table, identifier, row); err != nil {
+		return err
+	}
+
+	if err = db.setRowNotLocking(sh, identifier, row, db.seq.Add(1)); err != nil {
+		return err
+	}
+
+	db.publishEventsNotLocking(sh)
 
 	return nil
 }
 
 func (db *InMemDB) AlterRow(table string, identifier string, newRow any) error {
-	db.m.Lock()
-	defer db.m.Unlock()
+	sh, unlock, err := db.lockShard(table, true)
+	if err != nil {
+		return err
+	}
 
-	t, err := db.GetTable(table)
+	defer unlock()
+
+	_, existed, err := sh.rows.Get(identifier)
 	if err != nil {
 		return err
 	}
 
-	_, existed := t.Get(identifier)
 	if !existed {
 		return ErrNotExistedRow
 	}
 
-	t.Set(identifier, newRow) // todo: test if it's replaces existing value
+	if err = db.checkRowType(table, newRow); err != nil {
+		return err
+	}
+
+	if err = sh.checkUnique(identifier, newRow); err != nil {
+		return err
+	}
+
+	if err = db.recordWrite(OpAlterRow, table, identifier, newRow); err != nil {
+		return err
+	}
+
+	if err = db.setRowNotLocking(sh, identifier, newRow, db.seq.Add(1)); err != nil {
+		return err
+	}
+
+	db.publishEventsNotLocking(sh)
 
 	return nil
 }
 
 func (db *InMemDB) GetTableCounter(table string) (int, error) {
-	counter, exists := db.counters[table]
-	if !exists {
-		return -1, ErrNotExistedTable
+	sh, unlock, err := db.lockShard(table, false)
+	if err != nil {
+		return -1, err
 	}
 
-	return counter, nil
+	defer unlock()
+
+	return sh.counter, nil
 }
 
 func (db *InMemDB) GetRow(table string, identifier string) (any, error) {
-	db.m.RLock()
-	defer db.m.RUnlock()
-
-	t, err := db.getTableNotLocking(table)
+	sh, unlock, err := db.lockShard(table, false)
 	if err != nil {
 		return 0, err
 	}
 
-	row, exist := t.Get(identifier)
+	defer unlock()
+
+	row, exist, err := sh.rows.Get(identifier)
+	if err != nil {
+		return nil, err
+	}
+
 	if !exist {
 		return nil, ErrNotExistedRow
 	}
@@ -204,56 +606,63 @@ func (db *InMemDB) GetRow(table string, identifier string) (any, error) {
 }
 
 func (db *InMemDB) GetAllRows(table string, offset, limit int) ([]any, error) {
-	db.m.RLock()
-	defer db.m.RUnlock()
-
-	t, err := db.getTableNotLocking(table)
+	sh, unlock, err := db.lockShard(table, false)
 	if err != nil {
 		return nil, err
 	}
 
-	res := make([]any, 0, t.Len())
+	defer unlock()
+
+	res := make([]any, 0, sh.rows.Len())
 
 	count := 0
 
-	// iterating pairs from oldest to newest:
-	for pair := t.Oldest(); pair != nil; pair = pair.Next() {
+	// iterating rows from oldest to newest:
+	err = sh.rows.Range(func(_ string, row any) bool {
 		if count >= offset {
-			res = append(res, pair.Value)
+			res = append(res, row)
 		}
 
 		if len(res) == limit {
-			break
+			return false
 		}
 
 		count++
-	}
 
-	return res, nil
+		return true
+	})
+
+	return res, err
 }
 
 func (db *InMemDB) GetRowsCount(table string) (int, error) {
-	db.m.RLock()
-	defer db.m.RUnlock()
-
-	t, err := db.getTableNotLocking(table)
+	sh, unlock, err := db.lockShard(table, false)
 	if err != nil {
 		return 0, err
 	}
 
-	return t.Len(), nil
+	defer unlock()
+
+	return sh.rows.Len(), nil
 }
 
 func (db *InMemDB) DropRow(table string, identifier string) error {
-	db.m.Lock()
-	defer db.m.Unlock()
-
-	t, err := db.getTableNotLocking(table)
+	sh, unlock, err := db.lockShard(table, true)
 	if err != nil {
 		return err
 	}
 
-	t.Delete(identifier)
+	defer unlock()
+
+	if err = db.recordWrite(OpDropRow, table, identifier, nil); err != nil {
+		return err
+	}
+
+	if err = db.deleteRowNotLocking(sh, identifier, db.seq.Add(1)); err != nil {
+		return err
+	}
+
+	db.publishEventsNotLocking(sh)
 
 	return nil
 }
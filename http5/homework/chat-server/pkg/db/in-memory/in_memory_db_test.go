@@ -2,7 +2,18 @@ package in_memory
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/internal/domain/entity"
 )
 
 func initDB() *InMemDB {
@@ -21,7 +32,7 @@ func TestTableCreated(t *testing.T) {
 
 	inMemDB.CreateTable(tableName)
 
-	if _, ok := inMemDB.Tables[tableName]; !ok {
+	if _, ok := inMemDB.shards[tableName]; !ok {
 		t.Fatal()
 	}
 }
@@ -49,3 +60,223 @@ func TestGetExistingTable(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestTypedRowsSurviveRestart(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "db_state.json")
+	now := time.Date(2024, time.February, 1, 12, 0, 0, 0, time.UTC)
+
+	schema := []Option{
+		WithTableSchema("users", entity.User{}),
+		WithTableSchema("public_messages", entity.PublicMessage{}),
+		WithTableSchema("private_messages", entity.PrivateMessage{}),
+	}
+
+	user1 := entity.User{ID: 1, Email: "test@mail.com", Username: "test", HashedPassword: "hash", CreatedAt: now, UpdatedAt: now}
+	user2 := entity.User{ID: 2, Email: "test2@mail.com", Username: "test2", HashedPassword: "hash2", CreatedAt: now, UpdatedAt: now}
+	pubMsg := entity.PublicMessage{ID: 1, From: &user1, Content: "hello", SentAt: now, EditedAt: now}
+	privMsg := entity.PrivateMessage{ID: 1, From: &user1, To: &user2, Content: "hi", SentAt: now, EditedAt: now}
+
+	ctx := context.Background()
+	inMemDB, _ := NewInMemDB(ctx, "", schema...)
+
+	rows := map[string]any{
+		"users":            user1,
+		"public_messages":  pubMsg,
+		"private_messages": privMsg,
+	}
+
+	for table, row := range rows {
+		inMemDB.CreateTable(table)
+
+		if err := inMemDB.AddRow(table, "1", row); err != nil {
+			t.Fatalf("cannot add row to %s: %v", table, err)
+		}
+	}
+
+	savedChan := make(chan any, 1)
+
+	inMemDB.Save(savePath, savedChan)
+
+	if res := <-savedChan; res != "ok" {
+		t.Fatalf("cannot save db: %v", res)
+	}
+
+	jsonState, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _, err := NewInMemDBFromJSON(ctx, string(jsonState), "", schema...)
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	for table, expected := range rows {
+		got, err := restored.GetRow(table, "1")
+		if err != nil {
+			t.Fatalf("cannot get row from %s: %v", table, err)
+		}
+
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %#v in %s, got %#v", expected, table, got)
+		}
+	}
+
+	if err = restored.AddRow("users", "2", &user2); !errors.Is(err, ErrInvalidRowType) {
+		t.Fatalf("expected row of wrong type to be rejected, got %v", err)
+	}
+}
+
+func TestAlterRowDoesNotDeadlock(t *testing.T) {
+	inMemDB := initDB()
+
+	inMemDB.CreateTable("users")
+
+	if err := inMemDB.AddRow("users", "1", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- inMemDB.AlterRow("users", "1", "altered")
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AlterRow deadlocked")
+	}
+}
+
+func TestWriteDoesNotBlockOtherTables(t *testing.T) {
+	inMemDB := initDB()
+
+	inMemDB.CreateTable("users")
+	inMemDB.CreateTable("private_messages")
+
+	if err := inMemDB.AddRow("users", "1", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// hold the lock of private_messages as a long write would
+	sh, unlock, err := inMemDB.lockShard("private_messages", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer unlock()
+
+	sh.counter++
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := inMemDB.GetRow("users", "1")
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read of users was blocked by write to private_messages")
+	}
+}
+
+const benchTables = 8
+
+func initBenchDB(b *testing.B) *InMemDB {
+	b.Helper()
+
+	inMemDB := initDB()
+
+	for i := 0; i < benchTables; i++ {
+		inMemDB.CreateTable("table_" + strconv.Itoa(i))
+	}
+
+	return inMemDB
+}
+
+func benchmarkParallelWrites(b *testing.B, tables int) {
+	inMemDB := initBenchDB(b)
+
+	var writer atomic.Int64
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		id := writer.Add(1)
+		table := "table_" + strconv.Itoa(int(id)%tables)
+		key := strconv.Itoa(int(id))
+
+		for i := 0; pb.Next(); i++ {
+			row := key + "_" + strconv.Itoa(i)
+
+			if err := inMemDB.AddRow(table, row, row); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// writes to the same table are serialised as they were with the single database lock
+func BenchmarkParallelWritesSameTable(b *testing.B) {
+	benchmarkParallelWrites(b, 1)
+}
+
+func BenchmarkParallelWritesDistinctTables(b *testing.B) {
+	benchmarkParallelWrites(b, benchTables)
+}
+
+func benchmarkReadsDuringWrites(b *testing.B, writtenTable string) {
+	inMemDB := initBenchDB(b)
+
+	if err := inMemDB.AddRow("table_0", "1", "row"); err != nil {
+		b.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; ctx.Err() == nil; i++ {
+				key := strconv.Itoa(w) + "_" + strconv.Itoa(i)
+				_ = inMemDB.AddRow(writtenTable, key, key)
+			}
+		}(w)
+	}
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := inMemDB.GetRow("table_0", "1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.StopTimer()
+	cancel()
+	wg.Wait()
+}
+
+func BenchmarkReadsDuringWritesToSameTable(b *testing.B) {
+	benchmarkReadsDuringWrites(b, "table_0")
+}
+
+func BenchmarkReadsDuringWritesToOtherTable(b *testing.B) {
+	benchmarkReadsDuringWrites(b, "table_1")
+}
@@ -0,0 +1,257 @@
+package in_memory
+
+import (
+	"fmt"
+
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// IndexKeyFunc extracts the indexed value from a row.
+// Rows for which it returns false are left out of the index.
+type IndexKeyFunc func(row any) (string, bool)
+
+type IndexSpec struct {
+	Name   string
+	Unique bool
+	Key    IndexKeyFunc
+}
+
+// UniqueViolationError is returned when a write would put two rows under the same value of a unique index.
+type UniqueViolationError struct {
+	Table string
+	Index string
+	Value string
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("%s: index %s of table %s already has value %q", ErrUniqueViolation, e.Index, e.Table, e.Value)
+}
+
+func (e *UniqueViolationError) Is(target error) bool {
+	return target == ErrUniqueViolation
+}
+
+type index struct {
+	spec IndexSpec
+	// identifiers of rows by indexed value, in the order rows got the value
+	entries map[string]*orderedmap.OrderedMap[string, struct{}]
+}
+
+func newIndex(spec IndexSpec) *index {
+	return &index{
+		spec:    spec,
+		entries: make(map[string]*orderedmap.OrderedMap[string, struct{}]),
+	}
+}
+
+func (idx *index) add(identifier string, row any) {
+	value, ok := idx.spec.Key(row)
+	if !ok {
+		return
+	}
+
+	ids, exists := idx.entries[value]
+	if !exists {
+		ids = orderedmap.New[string, struct{}]()
+		idx.entries[value] = ids
+	}
+
+	ids.Set(identifier, struct{}{})
+}
+
+func (idx *index) remove(identifier string, row any) {
+	value, ok := idx.spec.Key(row)
+	if !ok {
+		return
+	}
+
+	ids, exists := idx.entries[value]
+	if !exists {
+		return
+	}
+
+	ids.Delete(identifier)
+
+	if ids.Len() == 0 {
+		delete(idx.entries, value)
+	}
+}
+
+// conflict returns the value that row would duplicate, ignoring the row stored under identifier itself.
+func (idx *index) conflict(identifier string, row any) (string, bool) {
+	if !idx.spec.Unique {
+		return "", false
+	}
+
+	value, ok := idx.spec.Key(row)
+	if !ok {
+		return "", false
+	}
+
+	ids, exists := idx.entries[value]
+	if !exists {
+		return "", false
+	}
+
+	_, sameRow := ids.Get(identifier)
+
+	return value, ids.Len() > 1 || !sameRow
+}
+
+// conflictAfter is conflict for a row written after the writes, the latest writes of rows by their keys.
+func (idx *index) conflictAfter(identifier string, row any, writes map[string]Write) (string, bool) {
+	if !idx.spec.Unique {
+		return "", false
+	}
+
+	value, ok := idx.spec.Key(row)
+	if !ok {
+		return "", false
+	}
+
+	// rows rewritten by the writes hold the values the writes gave them
+	if ids, exists := idx.entries[value]; exists {
+		for pair := ids.Oldest(); pair != nil; pair = pair.Next() {
+			if _, rewritten := writes[pair.Key]; pair.Key != identifier && !rewritten {
+				return value, true
+			}
+		}
+	}
+
+	for key, w := range writes {
+		if key == identifier || w.Op == OpDropRow {
+			continue
+		}
+
+		if written, ok := idx.spec.Key(w.Row); ok && written == value {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// CreateIndex declares a secondary index on the table and builds it from the existing rows.
+// Indexes are not persisted, so they are expected to be declared on every start.
+func (db *InMemDB) CreateIndex(table string, spec IndexSpec) error {
+	sh, unlock, err := db.lockShard(table, true)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	idx := newIndex(spec)
+
+	var violation error
+
+	err = sh.rows.Range(func(key string, row any) bool {
+		if value, dup := idx.conflict(key, row); dup {
+			violation = &UniqueViolationError{Table: table, Index: spec.Name, Value: value}
+			return false
+		}
+
+		idx.add(key, row)
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if violation != nil {
+		return violation
+	}
+
+	sh.indexes[spec.Name] = idx
+
+	return nil
+}
+
+func (sh *shard) getIndex(name string) (*index, error) {
+	idx, ok := sh.indexes[name]
+	if !ok {
+		return nil, ErrNotExistedIndex
+	}
+
+	return idx, nil
+}
+
+// GetRowByIndex returns the first row having the value in the index.
+func (db *InMemDB) GetRowByIndex(table, index, value string) (any, error) {
+	sh, unlock, err := db.lockShard(table, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	idx, err := sh.getIndex(index)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, exists := idx.entries[value]
+	if !exists {
+		return nil, ErrNotExistedRow
+	}
+
+	row, _, err := sh.rows.Get(ids.Oldest().Key)
+
+	return row, err
+}
+
+// GetRowsByIndex returns all rows having the value in the index.
+func (db *InMemDB) GetRowsByIndex(table, index, value string) ([]any, error) {
+	sh, unlock, err := db.lockShard(table, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	idx, err := sh.getIndex(index)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, exists := idx.entries[value]
+	if !exists {
+		return []any{}, nil
+	}
+
+	res := make([]any, 0, ids.Len())
+
+	for pair := ids.Oldest(); pair != nil; pair = pair.Next() {
+		row, _, err := sh.rows.Get(pair.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, row)
+	}
+
+	return res, nil
+}
+
+func (sh *shard) checkUnique(identifier string, row any) error {
+	for name, idx := range sh.indexes {
+		if value, dup := idx.conflict(identifier, row); dup {
+			return &UniqueViolationError{Table: sh.name, Index: name, Value: value}
+		}
+	}
+
+	return nil
+}
+
+func (sh *shard) indexRow(identifier string, row any) {
+	for _, idx := range sh.indexes {
+		idx.add(identifier, row)
+	}
+}
+
+func (sh *shard) unindexRow(identifier string, row any) {
+	for _, idx := range sh.indexes {
+		idx.remove(identifier, row)
+	}
+}
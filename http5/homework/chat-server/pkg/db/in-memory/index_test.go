@@ -0,0 +1,148 @@
+package in_memory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	emailIndex  = "email_idx"
+	domainIndex = "domain_idx"
+)
+
+func emailKey(row any) (string, bool) {
+	email, ok := row.(string)
+	return email, ok
+}
+
+func domainKey(row any) (string, bool) {
+	email, ok := row.(string)
+	if !ok {
+		return "", false
+	}
+
+	_, domain, found := strings.Cut(email, "@")
+
+	return domain, found
+}
+
+func initIndexedDB(t *testing.T) *InMemDB {
+	t.Helper()
+
+	db, _ := NewInMemDB(context.Background(), "")
+
+	db.CreateTable("users")
+
+	if err := db.AddRow("users", "1", "first@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateIndex("users", IndexSpec{Name: emailIndex, Unique: true, Key: emailKey}); err != nil {
+		t.Fatalf("cannot create index: %v", err)
+	}
+
+	if err := db.CreateIndex("users", IndexSpec{Name: domainIndex, Key: domainKey}); err != nil {
+		t.Fatalf("cannot create index: %v", err)
+	}
+
+	return db
+}
+
+func TestIndexBuiltFromExistingRows(t *testing.T) {
+	db := initIndexedDB(t)
+
+	row, err := db.GetRowByIndex("users", emailIndex, "first@mail.com")
+	if err != nil || row != "first@mail.com" {
+		t.Fatalf("expected indexed row, got %v (%v)", row, err)
+	}
+}
+
+func TestUniqueIndexRejectsDuplicates(t *testing.T) {
+	db := initIndexedDB(t)
+
+	if err := db.AddRow("users", "2", "second@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.AddRow("users", "3", "first@mail.com")
+
+	var violation *UniqueViolationError
+
+	if !errors.As(err, &violation) || violation.Index != emailIndex {
+		t.Fatalf("expected unique violation on %s, got %v", emailIndex, err)
+	}
+
+	if err = db.AlterRow("users", "2", "first@mail.com"); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("expected unique violation on alter, got %v", err)
+	}
+
+	// row may be altered to its own value
+	if err = db.AlterRow("users", "2", "second@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _ := db.GetRowsCount("users"); count != 2 {
+		t.Fatalf("rejected write changed the table, got %d rows", count)
+	}
+}
+
+func TestIndexFollowsWrites(t *testing.T) {
+	db := initIndexedDB(t)
+
+	if err := db.AddRow("users", "2", "second@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AddRow("users", "3", "third@other.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.GetRowsByIndex("users", domainIndex, "mail.com")
+	if err != nil || len(rows) != 2 || rows[0] != "first@mail.com" || rows[1] != "second@mail.com" {
+		t.Fatalf("expected both mail.com rows in insertion order, got %v (%v)", rows, err)
+	}
+
+	if err = db.AlterRow("users", "1", "first@other.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.DropRow("users", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.GetRowByIndex("users", emailIndex, "first@mail.com"); !errors.Is(err, ErrNotExistedRow) {
+		t.Fatalf("expected old value to be unindexed, got %v", err)
+	}
+
+	if _, err = db.GetRowByIndex("users", emailIndex, "third@other.com"); !errors.Is(err, ErrNotExistedRow) {
+		t.Fatalf("expected dropped row to be unindexed, got %v", err)
+	}
+
+	rows, err = db.GetRowsByIndex("users", domainIndex, "other.com")
+	if err != nil || len(rows) != 1 || rows[0] != "first@other.com" {
+		t.Fatalf("expected altered row under new value, got %v (%v)", rows, err)
+	}
+
+	if err = db.AddRow("users", "4", "third@other.com"); err != nil {
+		t.Fatalf("value of dropped row should be free again: %v", err)
+	}
+}
+
+func TestCreateUniqueIndexOverDuplicates(t *testing.T) {
+	db := initIndexedDB(t)
+
+	if err := db.AddRow("users", "2", "second@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.CreateIndex("users", IndexSpec{Name: "unique_domain_idx", Unique: true, Key: domainKey})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("expected unique violation, got %v", err)
+	}
+
+	if _, err = db.GetRowByIndex("users", "unique_domain_idx", "mail.com"); !errors.Is(err, ErrNotExistedIndex) {
+		t.Fatalf("index with violations must not be created, got %v", err)
+	}
+}
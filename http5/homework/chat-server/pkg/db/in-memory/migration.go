@@ -0,0 +1,215 @@
+package in_memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+
+	jsonutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/json"
+)
+
+// SnapshotTables are the tables of a snapshot as they are stored. Rows are kept
+// undecoded, so migrations can reshape them before they are restored.
+type SnapshotTables map[string]*orderedmap.OrderedMap[string, json.RawMessage]
+
+// MapRows replaces every row of the table with the one changed by fn. Rows are passed
+// to fn decoded into JSON objects, numbers are kept as json.Number.
+func (t SnapshotTables) MapRows(table string, fn func(row map[string]any) error) error {
+	rows, ok := t[table]
+	if !ok {
+		return nil
+	}
+
+	for pair := rows.Oldest(); pair != nil; pair = pair.Next() {
+		decoder := json.NewDecoder(bytes.NewReader(pair.Value))
+		decoder.UseNumber()
+
+		var row map[string]any
+
+		if err := decoder.Decode(&row); err != nil {
+			return fmt.Errorf("table %s, row %s: %w", table, pair.Key, err)
+		}
+
+		if err := fn(row); err != nil {
+			return fmt.Errorf("table %s, row %s: %w", table, pair.Key, err)
+		}
+
+		raw, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+
+		pair.Value = raw
+	}
+
+	return nil
+}
+
+// RenameTable moves rows of the table to a new name, replacing the table having it.
+func (t SnapshotTables) RenameTable(name, newName string) {
+	rows, ok := t[name]
+	if !ok {
+		return
+	}
+
+	delete(t, name)
+	t[newName] = rows
+}
+
+// Migration upgrades snapshots of version Version-1 to Version.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tables SnapshotTables) error
+}
+
+// MigrationRegistry holds migrations of every snapshot version, starting with
+// version 1. Snapshots saved before snapshots had versions are version 0.
+type MigrationRegistry struct {
+	migrations []Migration
+}
+
+// NewMigrationRegistry orders migrations by version and checks that no version is missing.
+func NewMigrationRegistry(migrations ...Migration) (*MigrationRegistry, error) {
+	sorted := append([]Migration(nil), migrations...)
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("%w: expected version %d, got %d (%s)", ErrInvalidMigration, i+1, m.Version, m.Name)
+		}
+
+		if m.Up == nil {
+			return nil, fmt.Errorf("%w: version %d (%s) has no Up function", ErrInvalidMigration, m.Version, m.Name)
+		}
+	}
+
+	return &MigrationRegistry{migrations: sorted}, nil
+}
+
+// Latest is the version snapshots are migrated to and saved with. It is 0 for a nil registry.
+func (r *MigrationRegistry) Latest() int {
+	if r == nil {
+		return 0
+	}
+
+	return len(r.migrations)
+}
+
+// Migrate upgrades tables of the given version to the latest one, one version at a time.
+func (r *MigrationRegistry) Migrate(tables SnapshotTables, version int) error {
+	latest := r.Latest()
+
+	if version < 0 || version > latest {
+		return fmt.Errorf("%w: snapshot version %d, latest known version %d", ErrSnapshotVersion, version, latest)
+	}
+
+	if version == latest {
+		return nil
+	}
+
+	for _, m := range r.migrations[version:] {
+		if err := m.Up(tables); err != nil {
+			return fmt.Errorf("%w: version %d (%s): %w", ErrMigrationFailed, m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// WithMigrations makes the database upgrade snapshots it is restored from with the registry
+// and save snapshots with its latest version. Without a registry snapshots are saved as version 0.
+func WithMigrations(r *MigrationRegistry) Option {
+	return func(db *InMemDB) {
+		db.migrations = r
+	}
+}
+
+// snapshot is the layout of snapshot files, tables are stored along with their version.
+// Counters of tables are stored too, since deleted rows leave them above the number of rows.
+type snapshot[T any] struct {
+	Version  int            `json:"version"`
+	Tables   map[string]T   `json:"tables"`
+	Counters map[string]int `json:"counters,omitempty"`
+}
+
+type rawSnapshot = snapshot[*orderedmap.OrderedMap[string, json.RawMessage]]
+
+// decodeSnapshot reads both versioned snapshots and the bare table maps saved before
+// snapshots had versions.
+func decodeSnapshot(jsonState []byte) (rawSnapshot, error) {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(jsonState, &fields); err != nil {
+		return rawSnapshot{}, err
+	}
+
+	_, hasVersion := fields["version"]
+	_, hasTables := fields["tables"]
+	_, hasCounters := fields["counters"]
+
+	known := 2
+	if hasCounters {
+		known++
+	}
+
+	if len(fields) != known || !hasVersion || !hasTables {
+		var tables SnapshotTables
+
+		err := json.Unmarshal(jsonState, &tables)
+
+		return rawSnapshot{Tables: tables}, err
+	}
+
+	var versioned rawSnapshot
+
+	err := json.Unmarshal(jsonState, &versioned)
+
+	return versioned, err
+}
+
+// MigrateSnapshot upgrades the snapshot to the latest version of the registry.
+// It returns the upgraded snapshot and the version the snapshot had.
+func MigrateSnapshot(jsonState []byte, r *MigrationRegistry) ([]byte, int, error) {
+	state, err := decodeSnapshot(jsonState)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	version := state.Version
+
+	if err = r.Migrate(state.Tables, version); err != nil {
+		return nil, version, err
+	}
+
+	state.Version = r.Latest()
+
+	migrated, err := json.Marshal(state)
+	if err != nil {
+		return nil, version, err
+	}
+
+	return []byte(jsonutils.PrettifyJSON(string(migrated))), version, nil
+}
+
+// MigrateSnapshotFile upgrades the snapshot file in place, keeping up to keep previous
+// versions of the file the same way snapshots do. It returns the version the file had,
+// a file already at the latest version is left untouched.
+func MigrateSnapshotFile(path string, r *MigrationRegistry, keep int) (int, error) {
+	jsonState, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated, version, err := MigrateSnapshot(jsonState, r)
+	if err != nil || version == r.Latest() {
+		return version, err
+	}
+
+	return version, writeSnapshot(path, migrated, keep)
+}
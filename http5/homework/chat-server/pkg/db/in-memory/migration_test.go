@@ -0,0 +1,186 @@
+package in_memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type migratedUser struct {
+	Name  string
+	Email string
+}
+
+// legacyState is a snapshot saved before snapshots had versions, users had a single Login field then.
+const legacyState = `{
+	"people": {
+		"1": {"Login": "first"},
+		"2": {"Login": "second"}
+	}
+}`
+
+func testMigrations(t *testing.T) *MigrationRegistry {
+	t.Helper()
+
+	registry, err := NewMigrationRegistry(
+		Migration{
+			Version: 2,
+			Name:    "split login",
+			Up: func(tables SnapshotTables) error {
+				return tables.MapRows("users", func(row map[string]any) error {
+					login, ok := row["Login"].(string)
+					if !ok {
+						return errors.New("no login")
+					}
+
+					delete(row, "Login")
+
+					row["Name"] = login
+					row["Email"] = login + "@mail.com"
+
+					return nil
+				})
+			},
+		},
+		Migration{
+			Version: 1,
+			Name:    "rename people",
+			Up: func(tables SnapshotTables) error {
+				tables.RenameTable("people", "users")
+				return nil
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return registry
+}
+
+func TestMigrationsUpgradeLegacySnapshot(t *testing.T) {
+	opts := []Option{WithTableSchema("users", migratedUser{}), WithMigrations(testMigrations(t))}
+
+	db, _, err := NewInMemDBFromJSON(context.Background(), legacyState, "", opts...)
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	got, err := db.GetRow("users", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := migratedUser{Name: "second", Email: "second@mail.com"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, got)
+	}
+
+	if _, err = db.GetTable("people"); !errors.Is(err, ErrNotExistedTable) {
+		t.Fatalf("expected renamed table to be gone, got %v", err)
+	}
+}
+
+func TestSnapshotsAreSavedWithLatestVersion(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "db_state.json")
+	opts := []Option{WithTableSchema("users", migratedUser{}), WithMigrations(testMigrations(t))}
+
+	db, _, err := NewInMemDBFromJSON(context.Background(), legacyState, savePath, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonState, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved snapshot[json.RawMessage]
+
+	if err = json.Unmarshal(jsonState, &saved); err != nil || saved.Version != 2 {
+		t.Fatalf("expected snapshot of version 2, got %s (%v)", jsonState, err)
+	}
+
+	// the saved snapshot is restored as is, migrations are not applied twice
+	restored := restoreFromFiles(t, savePath, opts...)
+
+	if got, err := restored.GetRow("users", "1"); err != nil || got.(migratedUser).Name != "first" {
+		t.Fatalf("expected first user, got %#v (%v)", got, err)
+	}
+}
+
+func TestSnapshotOfUnknownVersionIsRejected(t *testing.T) {
+	state := `{"version": 3, "tables": {}}`
+
+	_, _, err := NewInMemDBFromJSON(context.Background(), state, "", WithMigrations(testMigrations(t)))
+	if !errors.Is(err, ErrSnapshotVersion) {
+		t.Fatalf("expected ErrSnapshotVersion, got %v", err)
+	}
+
+	_, _, err = NewInMemDBFromJSON(context.Background(), state, "")
+	if !errors.Is(err, ErrSnapshotVersion) {
+		t.Fatalf("expected ErrSnapshotVersion without migrations, got %v", err)
+	}
+}
+
+func TestFailedMigrationIsReported(t *testing.T) {
+	state := `{"version": 1, "tables": {"users": {"1": {"Name": "first"}}}}`
+
+	_, _, err := NewInMemDBFromJSON(context.Background(), state, "", WithMigrations(testMigrations(t)))
+	if !errors.Is(err, ErrMigrationFailed) || !strings.Contains(err.Error(), "split login") {
+		t.Fatalf("expected ErrMigrationFailed naming the migration, got %v", err)
+	}
+}
+
+func TestMigrationRegistryRejectsGaps(t *testing.T) {
+	noop := func(SnapshotTables) error { return nil }
+
+	_, err := NewMigrationRegistry(Migration{Version: 1, Up: noop}, Migration{Version: 3, Up: noop})
+	if !errors.Is(err, ErrInvalidMigration) {
+		t.Fatalf("expected ErrInvalidMigration for a missing version, got %v", err)
+	}
+
+	_, err = NewMigrationRegistry(Migration{Version: 1})
+	if !errors.Is(err, ErrInvalidMigration) {
+		t.Fatalf("expected ErrInvalidMigration without Up, got %v", err)
+	}
+}
+
+func TestMigrateSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_state.json")
+
+	if err := os.WriteFile(path, []byte(legacyState), writePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := testMigrations(t)
+
+	version, err := MigrateSnapshotFile(path, registry, 1)
+	if err != nil || version != 0 {
+		t.Fatalf("expected file of version 0 to be migrated, got version %d (%v)", version, err)
+	}
+
+	// the migrated file is at the latest version, so no migration runs again on restore
+	db := restoreFromFiles(t, path, WithTableSchema("users", migratedUser{}), WithMigrations(registry))
+
+	if got, err := db.GetRow("users", "1"); err != nil || got.(migratedUser).Email != "first@mail.com" {
+		t.Fatalf("expected migrated user, got %#v (%v)", got, err)
+	}
+
+	if previous, err := os.ReadFile(snapshotVersionPath(path, 1)); err != nil || string(previous) != legacyState {
+		t.Fatalf("expected previous version of the file to be kept, got %q (%v)", previous, err)
+	}
+
+	if version, err = MigrateSnapshotFile(path, registry, 1); err != nil || version != 2 {
+		t.Fatalf("expected file to be at version 2 already, got version %d (%v)", version, err)
+	}
+}
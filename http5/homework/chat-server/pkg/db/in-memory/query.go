@@ -0,0 +1,234 @@
+package in_memory
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// LessFunc reports whether row a goes before row b.
+type LessFunc func(a, b any) bool
+
+type Query struct {
+	// Where filters rows, every row matches if it is nil.
+	Where func(row any) bool
+	// Index and IndexValue narrow the scan down to rows having the value in the index.
+	Index      string
+	IndexValue string
+	// OrderBy sorts the matched rows, insertion order is kept if it is nil.
+	OrderBy LessFunc
+	Desc    bool
+	// After is the identifier of the last row of the previous page, rows up to it are skipped.
+	After  string
+	Offset int
+	// Limit of zero means no limit.
+	Limit int
+}
+
+type QueryResult struct {
+	Rows []any
+	// NextCursor is the identifier of the last returned row, it is empty if no more rows match.
+	NextCursor string
+}
+
+type queryRow struct {
+	key string
+	row any
+}
+
+// Query returns the page of rows matching the query. The whole query runs under the read lock
+// of the table, so the page is consistent even if the table is written concurrently.
+// Rows in insertion order are scanned only until the page is full, while sorted rows, or rows
+// in reverse insertion order, are all collected and sorted before the page is cut out of them.
+func (db *InMemDB) Query(table string, q Query) (QueryResult, error) {
+	sh, unlock, err := db.lockShard(table, false)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	defer unlock()
+
+	p := newPage(q)
+
+	if q.OrderBy == nil && !q.Desc {
+		if err = sh.scan(q, p.add); err != nil {
+			return QueryResult{}, err
+		}
+
+		return p.result()
+	}
+
+	var rows []queryRow
+
+	err = sh.scan(q, func(r queryRow) bool {
+		rows = append(rows, r)
+		return true
+	})
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	switch {
+	case q.OrderBy != nil && q.Desc:
+		sort.SliceStable(rows, func(i, j int) bool { return q.OrderBy(rows[j].row, rows[i].row) })
+	case q.OrderBy != nil:
+		sort.SliceStable(rows, func(i, j int) bool { return q.OrderBy(rows[i].row, rows[j].row) })
+	default:
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	for _, r := range rows {
+		if !p.add(r) {
+			break
+		}
+	}
+
+	return p.result()
+}
+
+// page cuts the page out of rows given in their final order.
+type page struct {
+	after string
+	// skip is the number of rows left to skip, a negative offset skips none
+	skip  int
+	limit int
+
+	rows []queryRow
+	more bool
+}
+
+func newPage(q Query) *page {
+	return &page{after: q.After, skip: max(q.Offset, 0), limit: q.Limit}
+}
+
+// add reports false once the page is full and a row follows it, no more rows are needed then.
+func (p *page) add(r queryRow) bool {
+	switch {
+	case p.after != "":
+		if r.key == p.after {
+			p.after = ""
+		}
+	case p.skip > 0:
+		p.skip--
+	case p.limit > 0 && len(p.rows) == p.limit:
+		p.more = true
+		return false
+	default:
+		p.rows = append(p.rows, r)
+	}
+
+	return true
+}
+
+func (p *page) result() (QueryResult, error) {
+	// the row of the cursor was never reached
+	if p.after != "" {
+		return QueryResult{}, ErrInvalidCursor
+	}
+
+	res := QueryResult{Rows: make([]any, 0, len(p.rows))}
+
+	for _, r := range p.rows {
+		res.Rows = append(res.Rows, r.row)
+	}
+
+	if p.more && len(p.rows) > 0 {
+		res.NextCursor = p.rows[len(p.rows)-1].key
+	}
+
+	return res, nil
+}
+
+// scan calls fn for the rows matching the query in insertion order, or in the order of the index,
+// until it returns false.
+func (sh *shard) scan(q Query, fn func(r queryRow) bool) error {
+	t := sh.rows
+
+	matches := func(row any) bool { return q.Where == nil || q.Where(row) }
+
+	if q.Index == "" {
+		return t.Range(func(key string, row any) bool {
+			if matches(row) {
+				return fn(queryRow{key: key, row: row})
+			}
+
+			return true
+		})
+	}
+
+	idx, err := sh.getIndex(q.Index)
+	if err != nil {
+		return err
+	}
+
+	ids, exists := idx.entries[q.IndexValue]
+	if !exists {
+		return nil
+	}
+
+	for pair := ids.Oldest(); pair != nil; pair = pair.Next() {
+		row, _, err := t.Get(pair.Key)
+		if err != nil {
+			return err
+		}
+
+		if matches(row) && !fn(queryRow{key: pair.Key, row: row}) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// FieldLess orders rows by the value of the struct field. Fields of integer, float,
+// string and time.Time types are supported, rows without the field go first.
+func FieldLess(field string) LessFunc {
+	return func(a, b any) bool {
+		va, vb := fieldValue(a, field), fieldValue(b, field)
+
+		switch {
+		case !va.IsValid():
+			return vb.IsValid()
+		case !vb.IsValid() || va.Type() != vb.Type():
+			return false
+		}
+
+		if ta, ok := va.Interface().(time.Time); ok {
+			tb, _ := vb.Interface().(time.Time)
+			return ta.Before(tb)
+		}
+
+		switch va.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return va.Int() < vb.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return va.Uint() < vb.Uint()
+		case reflect.Float32, reflect.Float64:
+			return va.Float() < vb.Float()
+		case reflect.String:
+			return va.String() < vb.String()
+		default:
+			return false
+		}
+	}
+}
+
+func fieldValue(row any, field string) reflect.Value {
+	v := reflect.ValueOf(row)
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+
+	return v.FieldByName(field)
+}
@@ -0,0 +1,190 @@
+package in_memory
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+type queryTestRow struct {
+	Author string
+	Rank   int
+}
+
+func initQueryDB(t *testing.T) *InMemDB {
+	t.Helper()
+
+	db, _ := NewInMemDB(context.Background(), "")
+
+	db.CreateTable("posts")
+
+	ranks := []int{5, 3, 9, 1, 7, 3}
+
+	for i, rank := range ranks {
+		author := "first"
+		if i%2 == 1 {
+			author = "second"
+		}
+
+		if err := db.AddRow("posts", strconv.Itoa(i+1), queryTestRow{Author: author, Rank: rank}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+func ranksOf(rows []any) []int {
+	ranks := make([]int, 0, len(rows))
+
+	for _, row := range rows {
+		ranks = append(ranks, row.(queryTestRow).Rank)
+	}
+
+	return ranks
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestQueryFiltersAndOrders(t *testing.T) {
+	db := initQueryDB(t)
+
+	res, err := db.Query("posts", Query{
+		Where:   func(row any) bool { return row.(queryTestRow).Author == "first" },
+		OrderBy: FieldLess("Rank"),
+		Desc:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ranks := ranksOf(res.Rows); !equalInts(ranks, []int{9, 7, 5}) {
+		t.Fatalf("expected ranks of first author in descending order, got %v", ranks)
+	}
+
+	if res.NextCursor != "" {
+		t.Fatalf("expected no cursor on the last page, got %q", res.NextCursor)
+	}
+}
+
+func TestQueryPaging(t *testing.T) {
+	db := initQueryDB(t)
+
+	q := Query{OrderBy: FieldLess("Rank"), Limit: 4}
+
+	res, err := db.Query("posts", q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// equal ranks keep insertion order
+	if ranks := ranksOf(res.Rows); !equalInts(ranks, []int{1, 3, 3, 5}) || res.NextCursor != "1" {
+		t.Fatalf("unexpected first page %v with cursor %q", ranks, res.NextCursor)
+	}
+
+	q.After = res.NextCursor
+
+	res, err = db.Query("posts", q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ranks := ranksOf(res.Rows); !equalInts(ranks, []int{7, 9}) || res.NextCursor != "" {
+		t.Fatalf("unexpected second page %v with cursor %q", ranks, res.NextCursor)
+	}
+
+	res, err = db.Query("posts", Query{Offset: 4, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ranks := ranksOf(res.Rows); !equalInts(ranks, []int{7, 3}) {
+		t.Fatalf("expected rows past offset in insertion order, got %v", ranks)
+	}
+
+	if _, err = db.Query("posts", Query{After: "100"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected invalid cursor, got %v", err)
+	}
+}
+
+func TestQueryNegativeOffset(t *testing.T) {
+	db := initQueryDB(t)
+
+	res, err := db.Query("posts", Query{Offset: -3, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ranks := ranksOf(res.Rows); !equalInts(ranks, []int{5, 3}) || res.NextCursor != "2" {
+		t.Fatalf("expected negative offset to skip no rows, got %v with cursor %q", ranks, res.NextCursor)
+	}
+}
+
+func TestQueryStopsScanOnceInsertionOrderedPageIsFull(t *testing.T) {
+	db := initQueryDB(t)
+
+	scanned := 0
+
+	res, err := db.Query("posts", Query{
+		Where: func(any) bool {
+			scanned++
+			return true
+		},
+		Limit: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ranks := ranksOf(res.Rows); !equalInts(ranks, []int{5, 3}) || res.NextCursor != "2" {
+		t.Fatalf("unexpected page %v with cursor %q", ranks, res.NextCursor)
+	}
+
+	// the page and the row telling that more rows follow
+	if scanned != 3 {
+		t.Fatalf("expected 3 rows to be scanned, got %d", scanned)
+	}
+}
+
+func TestQueryByIndex(t *testing.T) {
+	db := initQueryDB(t)
+
+	authorKey := func(row any) (string, bool) {
+		r, ok := row.(queryTestRow)
+		return r.Author, ok
+	}
+
+	if err := db.CreateIndex("posts", IndexSpec{Name: "author_idx", Key: authorKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.Query("posts", Query{
+		Index:      "author_idx",
+		IndexValue: "second",
+		Where:      func(row any) bool { return row.(queryTestRow).Rank > 1 },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ranks := ranksOf(res.Rows); !equalInts(ranks, []int{3, 3}) {
+		t.Fatalf("expected matching rows of second author, got %v", ranks)
+	}
+
+	if _, err = db.Query("posts", Query{Index: "missing_idx"}); !errors.Is(err, ErrNotExistedIndex) {
+		t.Fatalf("expected missing index error, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package in_memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// WithTableSchema declares the row type of the table. Rows of the table are
+// restored from snapshots and the write-ahead log as values of this type,
+// and rows of any other type are rejected on write.
+func WithTableSchema(table string, row any) Option {
+	return func(db *InMemDB) {
+		db.schemas[table] = reflect.TypeOf(row)
+	}
+}
+
+func (db *InMemDB) checkRowType(table string, row any) error {
+	typ, declared := db.schemas[table]
+	if !declared || reflect.TypeOf(row) == typ {
+		return nil
+	}
+
+	return fmt.Errorf("%w: table %s expects %v, got %T", ErrInvalidRowType, table, typ, row)
+}
+
+func (db *InMemDB) decodeRow(table string, raw json.RawMessage) (any, error) {
+	typ, declared := db.schemas[table]
+	if !declared {
+		var row any
+
+		err := json.Unmarshal(raw, &row)
+
+		return row, err
+	}
+
+	row := reflect.New(typ)
+
+	if err := json.Unmarshal(raw, row.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: table %s: %w", ErrInvalidRowType, table, err)
+	}
+
+	return row.Elem().Interface(), nil
+}
+
+// decodeTables decodes the tables of the snapshot along with their saved counters.
+func (db *InMemDB) decodeTables(jsonState string) (map[string]Table, map[string]int, error) {
+	state, err := decodeSnapshot([]byte(jsonState))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = db.migrations.Migrate(state.Tables, state.Version); err != nil {
+		return nil, nil, err
+	}
+
+	tables := make(map[string]Table, len(state.Tables))
+
+	for name, rawTable := range state.Tables {
+		table := newMemTable()
+
+		for pair := rawTable.Oldest(); pair != nil; pair = pair.Next() {
+			row, err := db.decodeRow(name, pair.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			table.Set(pair.Key, row)
+		}
+
+		tables[name] = table
+	}
+
+	return tables, state.Counters, nil
+}
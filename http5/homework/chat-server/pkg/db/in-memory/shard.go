@@ -0,0 +1,138 @@
+package in_memory
+
+import (
+	"sort"
+	"sync"
+)
+
+// shard is a table together with everything describing it. Its lock guards all of it,
+// so writes to one table do not block the others. The set of shards is guarded by the
+// catalog lock of the database, which is taken for reading by every row operation and
+// for writing only by CreateTable, DropTable and Clear.
+type shard struct {
+	m sync.RWMutex
+
+	name    string
+	rows    Table
+	counter int
+	// sequence is the last identifier allocated by Tx.NextID
+	sequence int
+	indexes  map[string]*index
+
+	// versions are sequence numbers of the last writes, transactions compare
+	// them to find out what was changed concurrently
+	version  uint64
+	versions map[string]uint64
+	// created is the sequence number of the write that created the table
+	created uint64
+
+	// inserted numbers rows in the order they were added, a row dropped after a snapshot
+	// is put back in its place by it when the table is read as of the snapshot
+	inserted map[string]uint64
+	order    uint64
+	// history keeps the values rows and the counter had before writes made after the oldest
+	// snapshot of a running transaction, it is empty while no transaction runs
+	history  map[string][]rowVersion
+	counters []counterVersion
+
+	// events of the current write, they are published once it is committed
+	events []Event
+}
+
+func newShard(name string, rows Table, indexes map[string]*index) *shard {
+	sh := &shard{
+		name:     name,
+		rows:     rows,
+		indexes:  make(map[string]*index, len(indexes)),
+		versions: make(map[string]uint64),
+		inserted: make(map[string]uint64),
+		history:  make(map[string][]rowVersion),
+	}
+
+	// rows restored from a snapshot or an engine are numbered in their order
+	_ = rows.Range(func(key string, _ any) bool {
+		sh.order++
+		sh.inserted[key] = sh.order
+
+		return true
+	})
+
+	// declarations of indexes outlive recreation of the table
+	for indexName, idx := range indexes {
+		sh.indexes[indexName] = newIndex(idx.spec)
+	}
+
+	return sh
+}
+
+// lockShard takes the catalog lock for reading and the lock of the table, for writing if write is set.
+func (db *InMemDB) lockShard(table string, write bool) (*shard, func(), error) {
+	db.m.RLock()
+
+	sh, exists := db.shards[table]
+	if !exists {
+		db.m.RUnlock()
+		return nil, nil, ErrNotExistedTable
+	}
+
+	if write {
+		sh.m.Lock()
+
+		return sh, func() {
+			sh.m.Unlock()
+			db.m.RUnlock()
+		}, nil
+	}
+
+	sh.m.RLock()
+
+	return sh, func() {
+		sh.m.RUnlock()
+		db.m.RUnlock()
+	}, nil
+}
+
+// lockShardsNotLocking locks the existing tables out of the given ones, those in written for writing.
+// Tables are always locked in the order of their names, so two writers never wait for each other in a circle.
+// The catalog lock must be held.
+func (db *InMemDB) lockShardsNotLocking(tables []string, written map[string]bool) func() {
+	names := make([]string, 0, len(tables))
+	seen := make(map[string]bool, len(tables))
+
+	for _, name := range tables {
+		if _, exists := db.shards[name]; exists && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if written[name] {
+			db.shards[name].m.Lock()
+		} else {
+			db.shards[name].m.RLock()
+		}
+	}
+
+	return func() {
+		for i := len(names) - 1; i >= 0; i-- {
+			if written[names[i]] {
+				db.shards[names[i]].m.Unlock()
+			} else {
+				db.shards[names[i]].m.RUnlock()
+			}
+		}
+	}
+}
+
+func (db *InMemDB) shardNames() []string {
+	names := make([]string, 0, len(db.shards))
+
+	for name := range db.shards {
+		names = append(names, name)
+	}
+
+	return names
+}
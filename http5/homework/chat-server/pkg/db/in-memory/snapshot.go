@@ -0,0 +1,244 @@
+package in_memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	jsonutils "github.com/ew0s/ewos-to-go-hw/http5/homework/chat-server/pkg/utils/json"
+)
+
+type SnapshotConfig struct {
+	// Interval is how often the state is saved if anything changed since the last snapshot.
+	Interval time.Duration
+	// DirtyThreshold is the number of writes that triggers a snapshot before Interval elapses.
+	DirtyThreshold int64
+	// Keep is the number of previous snapshot versions kept next to the current one,
+	// they are named after the save path with .1, .2, ... suffixes, .1 being the latest.
+	Keep int
+	// OnError is called when a background snapshot fails.
+	OnError func(err error)
+}
+
+// WithSnapshots makes the database save its state to the save path in background
+// instead of only when its context is done.
+func WithSnapshots(cfg SnapshotConfig) Option {
+	return func(db *InMemDB) {
+		db.snapshotCfg = cfg
+	}
+}
+
+// Snapshot saves the current state to the save path right away and compacts the storage engine.
+// Without a save path only the engine is compacted, which is enough for engines storing rows on disk.
+func (db *InMemDB) Snapshot() error {
+	return db.save(db.savePath)
+}
+
+func (db *InMemDB) markDirty() {
+	dirty := db.dirty.Add(1)
+
+	if db.snapshotCfg.DirtyThreshold > 0 && dirty >= db.snapshotCfg.DirtyThreshold {
+		select {
+		case db.snapshotReq <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (db *InMemDB) runSnapshotter(ctx context.Context) {
+	defer close(db.snapshotterDone)
+
+	var tick <-chan time.Time
+
+	if db.snapshotCfg.Interval > 0 {
+		ticker := time.NewTicker(db.snapshotCfg.Interval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			if db.dirty.Load() == 0 {
+				continue
+			}
+		case <-db.snapshotReq:
+		}
+
+		if err := db.Snapshot(); err != nil && db.snapshotCfg.OnError != nil {
+			db.snapshotCfg.OnError(err)
+		}
+	}
+}
+
+func (db *InMemDB) save(path string) error {
+	db.snapshotMu.Lock()
+	defer db.snapshotMu.Unlock()
+
+	db.m.RLock()
+
+	unlock := db.lockShardsNotLocking(db.shardNames(), nil)
+
+	var (
+		bytes []byte
+		err   error
+	)
+
+	if path != "" {
+		bytes, err = db.marshalStateNotLocking()
+	}
+
+	// the engine is compacted under the locks of all tables, so no write is half applied to it
+	if err == nil && path == db.savePath {
+		for _, sh := range db.shards {
+			if counted, ok := sh.rows.(countedTable); ok {
+				counted.SetCounter(sh.counter)
+			}
+		}
+
+		err = db.engine.Compact()
+	}
+
+	// the log position and the dirty counter are read under the same locks as the state,
+	// so writes made while the snapshot is written stay in the log and keep the db dirty
+	dirty := db.dirty.Load()
+
+	var walSeq uint64
+
+	if db.wal != nil {
+		walSeq = db.wal.lastSeq()
+	}
+
+	unlock()
+	db.m.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		db.dirty.Add(-dirty)
+		return nil
+	}
+
+	if err = writeSnapshot(path, []byte(jsonutils.PrettifyJSON(string(bytes))), db.snapshotCfg.Keep); err != nil {
+		return err
+	}
+
+	if path != db.savePath {
+		return nil
+	}
+
+	db.dirty.Add(-dirty)
+
+	if db.wal != nil {
+		return db.wal.compact(walSeq)
+	}
+
+	return nil
+}
+
+// marshalStateNotLocking encodes all tables and their counters along with the snapshot version,
+// the caller holds locks of all of them.
+func (db *InMemDB) marshalStateNotLocking() ([]byte, error) {
+	state := snapshot[Table]{
+		Version:  db.migrations.Latest(),
+		Tables:   make(map[string]Table, len(db.shards)),
+		Counters: make(map[string]int, len(db.shards)),
+	}
+
+	for name, sh := range db.shards {
+		state.Tables[name] = sh.rows
+		state.Counters[name] = sh.counter
+	}
+
+	return json.Marshal(state)
+}
+
+// writeSnapshot replaces the file at path atomically: the data is written to a
+// temporary file first, so a crash never leaves a half-written snapshot behind.
+func writeSnapshot(path string, data []byte, keep int) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), writePerm); err != nil {
+		return err
+	}
+
+	if err = rotateSnapshots(path, keep); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// rotateSnapshots shifts previous versions of the snapshot by one. The current
+// snapshot is hard linked, not moved, so the path is never left without a file.
+func rotateSnapshots(path string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err := os.Remove(snapshotVersionPath(path, keep)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for version := keep - 1; version > 0; version-- {
+		err := os.Rename(snapshotVersionPath(path, version), snapshotVersionPath(path, version+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Link(path, snapshotVersionPath(path, 1))
+}
+
+func snapshotVersionPath(path string, version int) string {
+	return fmt.Sprintf("%s.%d", path, version)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,195 @@
+package in_memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func addMessages(t *testing.T, db *InMemDB, from, to int) {
+	t.Helper()
+
+	for i := from; i <= to; i++ {
+		if err := db.AddRow("messages", strconv.Itoa(i), "message "+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func restoreFromFiles(t *testing.T, savePath string, opts ...Option) *InMemDB {
+	t.Helper()
+
+	jsonState, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _, err := NewInMemDBFromJSON(context.Background(), string(jsonState), "", opts...)
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	return db
+}
+
+func TestSnapshotOnDirtyThreshold(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "db_state.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	db, savedChan := NewInMemDB(ctx, savePath, WithSnapshots(SnapshotConfig{DirtyThreshold: 3}))
+
+	defer func() {
+		cancel()
+		<-savedChan
+	}()
+
+	db.CreateTable("messages")
+	addMessages(t, db, 1, 2)
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	for {
+		if _, err := os.Stat(savePath); err == nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("snapshot was not taken after reaching dirty threshold")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	count, err := restoreFromFiles(t, savePath).GetRowsCount("messages")
+	if err != nil || count != 2 {
+		t.Fatalf("expected 2 rows in snapshot, got %v (%v)", count, err)
+	}
+}
+
+func TestSnapshotKeepsVersions(t *testing.T) {
+	dir := t.TempDir()
+	savePath := filepath.Join(dir, "db_state.json")
+
+	db, _ := NewInMemDB(context.Background(), savePath, WithSnapshots(SnapshotConfig{Keep: 2}))
+
+	db.CreateTable("messages")
+
+	for i := 1; i <= 4; i++ {
+		addMessages(t, db, i, i)
+
+		if err := db.Snapshot(); err != nil {
+			t.Fatalf("cannot take snapshot: %v", err)
+		}
+	}
+
+	expectedCounts := map[string]int{
+		savePath:                         4,
+		snapshotVersionPath(savePath, 1): 3,
+		snapshotVersionPath(savePath, 2): 2,
+	}
+
+	for path, expected := range expectedCounts {
+		count, err := restoreFromFiles(t, path).GetRowsCount("messages")
+		if err != nil || count != expected {
+			t.Fatalf("expected %d rows in %s, got %v (%v)", expected, path, count, err)
+		}
+	}
+
+	if _, err := os.Stat(snapshotVersionPath(savePath, 3)); err == nil {
+		t.Fatal("snapshot older than kept versions was not removed")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != len(expectedCounts) {
+		t.Fatalf("expected only snapshot files in dir, got %d entries", len(entries))
+	}
+}
+
+func TestSnapshotCompactsWAL(t *testing.T) {
+	dir := t.TempDir()
+	savePath := filepath.Join(dir, "db_state.json")
+	walPath := filepath.Join(dir, "db_state.wal")
+
+	wal := openTestWAL(t, walPath)
+	db, _ := NewInMemDB(context.Background(), savePath, WithWAL(wal))
+
+	db.CreateTable("messages")
+	addMessages(t, db, 1, 3)
+
+	if err := db.Snapshot(); err != nil {
+		t.Fatalf("cannot take snapshot: %v", err)
+	}
+
+	addMessages(t, db, 4, 4)
+
+	// process dies after the snapshot
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := 0
+
+	wal = openTestWAL(t, walPath)
+	if _, err := wal.scan(func(walRecord, int64, int64) error { records++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if records != 1 {
+		t.Fatalf("expected only the write after snapshot in wal, got %d records", records)
+	}
+
+	count, err := restoreFromFiles(t, savePath, WithWAL(wal)).GetRowsCount("messages")
+	if err != nil || count != 4 {
+		t.Fatalf("expected 4 rows after restore, got %v (%v)", count, err)
+	}
+}
+
+func TestSnapshotKeepsCounters(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "db_state.json")
+
+	db, _ := NewInMemDB(context.Background(), savePath)
+
+	db.CreateTable("messages")
+	addMessages(t, db, 1, 3)
+
+	// the deleted row is the last one, so the counter is above every key left
+	if err := db.DropRow("messages", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := restoreFromFiles(t, savePath)
+
+	counter, err := restored.GetTableCounter("messages")
+	if err != nil || counter != 3 {
+		t.Fatalf("expected counter 3, got %d (%v)", counter, err)
+	}
+
+	if err = restored.AddRow("messages", strconv.Itoa(counter+1), "message 4"); err != nil {
+		t.Fatalf("cannot add row after restart: %v", err)
+	}
+}
+
+func TestSnapshotWithoutCountersCountsPastHighestKey(t *testing.T) {
+	old := `{"version": 0, "tables": {"messages": {"1": "message 1", "5": "message 5"}}}`
+
+	db, _, err := NewInMemDBFromJSON(context.Background(), old, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if counter, _ := db.GetTableCounter("messages"); counter != 5 {
+		t.Fatalf("expected counter 5, got %d", counter)
+	}
+}
@@ -0,0 +1,187 @@
+package in_memory
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+type TTLConfig struct {
+	// TTL is how long a row lives after its last write. Write times are not persisted,
+	// so rows restored from a snapshot live TTL after the restore.
+	TTL time.Duration
+	// ExpiresAt returns the expiry time stored in the row itself, it takes precedence over TTL.
+	// Rows for which it returns false fall back to TTL. Expiry times taken from rows survive restarts.
+	ExpiresAt func(row any) (time.Time, bool)
+}
+
+// WithTableTTL makes rows of the table expire. Expired rows are removed by a background janitor
+// the same way DropRow does it, so until the janitor gets to them they are still visible.
+func WithTableTTL(table string, cfg TTLConfig) Option {
+	return func(db *InMemDB) {
+		db.ttls[table] = cfg
+	}
+}
+
+// WithJanitorInterval sets how often the janitor looks for expired rows, every second by default.
+func WithJanitorInterval(interval time.Duration) Option {
+	return func(db *InMemDB) {
+		db.janitorInterval = interval
+	}
+}
+
+type expiry struct {
+	at    time.Time
+	table string
+	key   string
+	// version of the row the expiry was scheduled for, a rewritten row gets a new expiry
+	version uint64
+}
+
+type expiryQueue []expiry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *expiryQueue) Push(x any) {
+	*q = append(*q, x.(expiry))
+}
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return last
+}
+
+// scheduleExpiryNotLocking requires the table to be locked for writing.
+func (db *InMemDB) scheduleExpiryNotLocking(sh *shard, identifier string, row any) {
+	cfg, exists := db.ttls[sh.name]
+	if !exists {
+		return
+	}
+
+	at, ok := time.Time{}, false
+
+	if cfg.ExpiresAt != nil {
+		at, ok = cfg.ExpiresAt(row)
+	}
+
+	if !ok && cfg.TTL > 0 {
+		at, ok = time.Now().Add(cfg.TTL), true
+	}
+
+	if !ok {
+		return
+	}
+
+	db.expiriesM.Lock()
+	defer db.expiriesM.Unlock()
+
+	heap.Push(&db.expiries, expiry{at: at, table: sh.name, key: identifier, version: sh.versions[identifier]})
+}
+
+// scheduleTablesNotLocking schedules expiry of rows restored from a snapshot or an engine.
+func (db *InMemDB) scheduleTablesNotLocking() error {
+	for table := range db.ttls {
+		sh, exists := db.shards[table]
+		if !exists {
+			continue
+		}
+
+		err := sh.rows.Range(func(key string, row any) bool {
+			db.scheduleExpiryNotLocking(sh, key, row)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *InMemDB) runJanitor(ctx context.Context) {
+	defer close(db.janitorDone)
+
+	ticker := time.NewTicker(db.janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.evictExpired(time.Now())
+		}
+	}
+}
+
+// evictExpired removes rows expired by now and returns their number.
+func (db *InMemDB) evictExpired(now time.Time) int {
+	evicted := 0
+
+	for _, exp := range db.popExpired(now) {
+		removed, err := db.evict(exp)
+		if err != nil {
+			// the row is tried again on the next run
+			db.expiriesM.Lock()
+			heap.Push(&db.expiries, exp)
+			db.expiriesM.Unlock()
+
+			continue
+		}
+
+		if removed {
+			evicted++
+		}
+	}
+
+	return evicted
+}
+
+func (db *InMemDB) popExpired(now time.Time) []expiry {
+	db.expiriesM.Lock()
+	defer db.expiriesM.Unlock()
+
+	var expired []expiry
+
+	for db.expiries.Len() > 0 && !db.expiries[0].at.After(now) {
+		expired = append(expired, heap.Pop(&db.expiries).(expiry))
+	}
+
+	return expired
+}
+
+// evict removes the row unless it was written after the expiry was scheduled.
+func (db *InMemDB) evict(exp expiry) (bool, error) {
+	sh, unlock, err := db.lockShard(exp.table, true)
+	if err != nil {
+		return false, nil
+	}
+
+	defer unlock()
+
+	_, exists, err := sh.rows.Get(exp.key)
+	if err != nil {
+		return false, err
+	}
+
+	if !exists || sh.versions[exp.key] != exp.version {
+		return false, nil
+	}
+
+	if err = db.recordWrite(OpDropRow, exp.table, exp.key, nil); err != nil {
+		return false, err
+	}
+
+	if err = db.deleteRowNotLocking(sh, exp.key, db.seq.Add(1)); err != nil {
+		return false, err
+	}
+
+	db.publishEventsNotLocking(sh)
+
+	return true, nil
+}
@@ -0,0 +1,115 @@
+package in_memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type expiringRow struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+func rowExpiresAt(row any) (time.Time, bool) {
+	r, ok := row.(expiringRow)
+	return r.ExpiresAt, ok && !r.ExpiresAt.IsZero()
+}
+
+func TestTableTTLEvictsExpiredRows(t *testing.T) {
+	db, _ := NewInMemDB(context.Background(), "", WithTableTTL("messages", TTLConfig{TTL: time.Minute}))
+
+	db.CreateTable("messages")
+	addMessages(t, db, 1, 2)
+
+	sub := db.Subscribe("messages", SubscriptionConfig{})
+	defer sub.Close()
+
+	if evicted := db.evictExpired(time.Now()); evicted != 0 {
+		t.Fatalf("expected no rows to expire yet, %d evicted", evicted)
+	}
+
+	if evicted := db.evictExpired(time.Now().Add(2 * time.Minute)); evicted != 2 {
+		t.Fatalf("expected both rows to expire, %d evicted", evicted)
+	}
+
+	if count, _ := db.GetRowsCount("messages"); count != 0 {
+		t.Fatalf("expired rows were not removed, got %d rows", count)
+	}
+
+	if event := receiveEvent(t, sub); event.Type != EventDelete || event.Key != "1" {
+		t.Fatalf("expected delete event for expired row, got %+v", event)
+	}
+}
+
+func TestRowExpiryFollowsWrites(t *testing.T) {
+	db, _ := NewInMemDB(context.Background(), "", WithTableTTL("sessions", TTLConfig{ExpiresAt: rowExpiresAt}))
+
+	db.CreateTable("sessions")
+
+	now := time.Now()
+
+	if err := db.AddRow("sessions", "1", expiringRow{Value: "short", ExpiresAt: now.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AddRow("sessions", "2", expiringRow{Value: "forever"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// prolonged row must outlive its first expiry time
+	if err := db.AlterRow("sessions", "1", expiringRow{Value: "prolonged", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if evicted := db.evictExpired(now.Add(time.Minute)); evicted != 0 {
+		t.Fatalf("expected prolonged row to survive, %d evicted", evicted)
+	}
+
+	if evicted := db.evictExpired(now.Add(2 * time.Hour)); evicted != 1 {
+		t.Fatalf("expected only prolonged row to expire, %d evicted", evicted)
+	}
+
+	if _, err := db.GetRow("sessions", "1"); !errors.Is(err, ErrNotExistedRow) {
+		t.Fatalf("expected expired row to be removed, got %v", err)
+	}
+
+	if _, err := db.GetRow("sessions", "2"); err != nil {
+		t.Fatalf("row without expiry must stay, got %v", err)
+	}
+}
+
+func TestJanitorEvictsRestoredRows(t *testing.T) {
+	state := `{"sessions": {"1": {"Value": "expired", "ExpiresAt": "2000-01-01T00:00:00Z"}}}`
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	db, savedChan, err := NewInMemDBFromJSON(ctx, state, "",
+		WithTableSchema("sessions", expiringRow{}),
+		WithTableTTL("sessions", TTLConfig{ExpiresAt: rowExpiresAt}),
+		WithJanitorInterval(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		cancel()
+		<-savedChan
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	for {
+		if count, _ := db.GetRowsCount("sessions"); count == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not evict expired row")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
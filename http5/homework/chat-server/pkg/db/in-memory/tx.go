@@ -0,0 +1,735 @@
+package in_memory
+
+import (
+	"errors"
+	"fmt"
+)
+
+const maxTxAttempts = 5
+
+type Transaction interface {
+	AddRow(table string, identifier string, row any) error
+	AlterRow(table string, identifier string, newRow any) error
+	DropRow(table string, identifier string) error
+	GetRow(table string, identifier string) (any, error)
+	GetAllRows(table string, offset, limit int) ([]any, error)
+	GetRowByIndex(table, index, value string) (any, error)
+	GetTableCounter(table string) (int, error)
+	NextID(table string) (int, error)
+
+	Commit() error
+	Rollback()
+}
+
+type undoEntry struct {
+	table   string
+	key     string
+	old     any
+	existed bool
+	// next is the key of the row that followed a dropped row, its position is restored by it
+	next     string
+	hasNext  bool
+	inserted uint64
+}
+
+// undoLog reverts applied writes, together with the counters of the tables they changed.
+type undoLog struct {
+	entries  []undoEntry
+	counters map[string]int
+	// seq is the number of the reverted writes
+	seq uint64
+}
+
+// Tx is an optimistic transaction with snapshot isolation. Writes are buffered and applied at once
+// on Commit, so other readers never see a part of them. Reads see the database as of the snapshot taken
+// by Begin: writes committed after it are not seen, the rows they replaced are kept for the transaction
+// until it ends, so a transaction must always be ended by Commit or Rollback.
+// Everything the transaction read is validated on Commit as well, and if any of it was changed
+// after the snapshot, Commit fails with ErrTxConflict and nothing is applied.
+// Tables are not versioned: reading a table created after the snapshot fails with ErrTxConflict,
+// and a table dropped after it is not found.
+type Tx struct {
+	db       *InMemDB
+	snapshot uint64
+
+	rowReads     map[string]map[string]bool
+	tableReads   map[string]bool
+	counterReads map[string]int
+
+	writes []Write
+	// the latest buffered state of the rows written by the transaction
+	overlay map[string]map[string]Write
+	// number of rows added to each table, every one of them increments the table counter
+	added map[string]int
+
+	done bool
+}
+
+func (db *InMemDB) Begin() Transaction {
+	return &Tx{
+		db:           db,
+		snapshot:     db.takeSnapshot(),
+		rowReads:     make(map[string]map[string]bool),
+		tableReads:   make(map[string]bool),
+		counterReads: make(map[string]int),
+		overlay:      make(map[string]map[string]Write),
+		added:        make(map[string]int),
+	}
+}
+
+// Tx runs fn in a transaction and commits it if fn returns no error.
+// On conflict with a concurrent write fn is run again, so it must not have side effects outside the transaction.
+func (db *InMemDB) Tx(fn func(tx Transaction) error) error {
+	var err error
+
+	for attempt := 0; attempt < maxTxAttempts; attempt++ {
+		tx := db.Begin()
+
+		if err = fn(tx); err != nil {
+			tx.Rollback()
+
+			// a table created after the snapshot cannot be read, a new snapshot will have it
+			if errors.Is(err, ErrTxConflict) {
+				continue
+			}
+
+			return err
+		}
+
+		if err = tx.Commit(); !errors.Is(err, ErrTxConflict) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (tx *Tx) checkActive() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	return nil
+}
+
+func (tx *Tx) readRow(table, identifier string) (any, bool, error) {
+	if w, ok := tx.overlay[table][identifier]; ok {
+		return w.Row, w.Op != OpDropRow, nil
+	}
+
+	sh, unlock, err := tx.lockShard(table)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer unlock()
+
+	if tx.rowReads[table] == nil {
+		tx.rowReads[table] = make(map[string]bool)
+	}
+
+	tx.rowReads[table][identifier] = true
+
+	return sh.rowAt(identifier, tx.snapshot)
+}
+
+// lockShard locks the table for reading as of the snapshot.
+func (tx *Tx) lockShard(table string) (*shard, func(), error) {
+	sh, unlock, err := tx.db.lockShard(table, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if sh.created > tx.snapshot {
+		unlock()
+		return nil, nil, fmt.Errorf("%w: table %s was created after the transaction began", ErrTxConflict, table)
+	}
+
+	return sh, unlock, nil
+}
+
+func (tx *Tx) write(op WriteOp, table, identifier string, row any) {
+	w := Write{Op: op, Table: table, Key: identifier, Row: row}
+
+	tx.writes = append(tx.writes, w)
+
+	if tx.overlay[table] == nil {
+		tx.overlay[table] = make(map[string]Write)
+	}
+
+	tx.overlay[table][identifier] = w
+
+	if op == OpAddRow {
+		tx.added[table]++
+	}
+}
+
+func (tx *Tx) AddRow(table string, identifier string, row any) error {
+	if err := tx.checkActive(); err != nil {
+		return err
+	}
+
+	_, exists, err := tx.readRow(table, identifier)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrExistingKey
+	}
+
+	if err = tx.db.checkRowType(table, row); err != nil {
+		return err
+	}
+
+	tx.write(OpAddRow, table, identifier, row)
+
+	return nil
+}
+
+func (tx *Tx) AlterRow(table string, identifier string, newRow any) error {
+	if err := tx.checkActive(); err != nil {
+		return err
+	}
+
+	_, exists, err := tx.readRow(table, identifier)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotExistedRow
+	}
+
+	if err = tx.db.checkRowType(table, newRow); err != nil {
+		return err
+	}
+
+	tx.write(OpAlterRow, table, identifier, newRow)
+
+	return nil
+}
+
+func (tx *Tx) DropRow(table string, identifier string) error {
+	if err := tx.checkActive(); err != nil {
+		return err
+	}
+
+	if _, _, err := tx.readRow(table, identifier); err != nil {
+		return err
+	}
+
+	tx.write(OpDropRow, table, identifier, nil)
+
+	return nil
+}
+
+func (tx *Tx) GetRow(table string, identifier string) (any, error) {
+	if err := tx.checkActive(); err != nil {
+		return nil, err
+	}
+
+	row, exists, err := tx.readRow(table, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrNotExistedRow
+	}
+
+	return row, nil
+}
+
+func (tx *Tx) GetAllRows(table string, offset, limit int) ([]any, error) {
+	if err := tx.checkActive(); err != nil {
+		return nil, err
+	}
+
+	sh, unlock, err := tx.lockShard(table)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.tableReads[table] = true
+
+	overlay := tx.overlay[table]
+	rows := make([]any, 0, sh.rows.Len())
+
+	err = sh.rangeAt(tx.snapshot, func(key string, row any) bool {
+		w, written := overlay[key]
+
+		switch {
+		case !written:
+			rows = append(rows, row)
+		case w.Op != OpDropRow:
+			rows = append(rows, w.Row)
+		}
+
+		return true
+	})
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	// rows added by the transaction follow the committed ones
+	appended := make(map[string]bool)
+
+	for _, w := range tx.writes {
+		if w.Table != table || w.Op != OpAddRow || appended[w.Key] {
+			continue
+		}
+
+		if _, committed, err := sh.rowAt(w.Key, tx.snapshot); err != nil || committed {
+			continue
+		}
+
+		if latest := overlay[w.Key]; latest.Op != OpDropRow {
+			rows = append(rows, latest.Row)
+			appended[w.Key] = true
+		}
+	}
+
+	unlock()
+
+	// offset and limit mean the same as for InMemDB.GetAllRows, a limit that is not positive takes all rows
+	offset = max(offset, 0)
+
+	if offset >= len(rows) {
+		return []any{}, nil
+	}
+
+	if limit <= 0 || limit > len(rows)-offset {
+		limit = len(rows) - offset
+	}
+
+	return rows[offset : offset+limit], nil
+}
+
+func (tx *Tx) GetRowByIndex(table, index, value string) (any, error) {
+	if err := tx.checkActive(); err != nil {
+		return nil, err
+	}
+
+	sh, unlock, err := tx.lockShard(table)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := sh.getIndex(index)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	tx.tableReads[table] = true
+
+	committedKey, _, err := sh.keyByIndexAt(idx, value, tx.snapshot)
+
+	unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// rows written by the transaction shadow the committed ones
+	for _, w := range tx.overlay[table] {
+		if w.Op == OpDropRow {
+			continue
+		}
+
+		if key, ok := idx.spec.Key(w.Row); ok && key == value {
+			return w.Row, nil
+		}
+	}
+
+	if committedKey == "" {
+		return nil, ErrNotExistedRow
+	}
+
+	if _, written := tx.overlay[table][committedKey]; written {
+		return nil, ErrNotExistedRow
+	}
+
+	row, _, err := tx.readRow(table, committedKey)
+
+	return row, err
+}
+
+// GetTableCounter returns the counter of the table as if the transaction was already committed.
+func (tx *Tx) GetTableCounter(table string) (int, error) {
+	if err := tx.checkActive(); err != nil {
+		return -1, err
+	}
+
+	sh, unlock, err := tx.lockShard(table)
+	if err != nil {
+		return -1, err
+	}
+
+	counter := sh.counterAt(tx.snapshot)
+	tx.counterReads[table] = counter
+
+	unlock()
+
+	return counter + tx.added[table], nil
+}
+
+// NextID allocates the next identifier of the table. Identifiers are allocated under the lock
+// of the table and are not validated on Commit, so concurrent transactions never conflict on them.
+// An identifier of a transaction that was not committed is not reused.
+func (tx *Tx) NextID(table string) (int, error) {
+	if err := tx.checkActive(); err != nil {
+		return -1, err
+	}
+
+	sh, unlock, err := tx.db.lockShard(table, true)
+	if err != nil {
+		return -1, err
+	}
+
+	defer unlock()
+
+	// rows added with keys of their own move the counter past the allocated identifiers
+	sh.sequence = max(sh.sequence, sh.counter) + 1
+
+	return sh.sequence, nil
+}
+
+// keys returns the keys of the rows of the table as of the snapshot, with the writes of the transaction.
+func (tx *Tx) keys(table string) ([]string, error) {
+	if err := tx.checkActive(); err != nil {
+		return nil, err
+	}
+
+	sh, unlock, err := tx.lockShard(table)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	tx.tableReads[table] = true
+
+	overlay := tx.overlay[table]
+	keys := make([]string, 0, sh.rows.Len())
+
+	err = sh.rangeAt(tx.snapshot, func(key string, _ any) bool {
+		if w, written := overlay[key]; !written || w.Op != OpDropRow {
+			keys = append(keys, key)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, w := range overlay {
+		if _, committed, err := sh.rowAt(key, tx.snapshot); err == nil && !committed && w.Op != OpDropRow {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// setCounter sets the counter of the table on Commit, after the rows the transaction added counted themselves.
+func (tx *Tx) setCounter(table string, counter int) {
+	tx.writes = append(tx.writes, Write{Op: opSetCounter, Table: table, Row: counter})
+
+	// the table is locked for writing on Commit even if no row of it is written
+	if tx.overlay[table] == nil {
+		tx.overlay[table] = make(map[string]Write)
+	}
+}
+
+func (tx *Tx) Rollback() {
+	if !tx.done {
+		tx.done = true
+		tx.db.releaseSnapshot(tx.snapshot)
+	}
+}
+
+// Commit logs the writes first and applies them only once they are logged, like single writes are.
+func (tx *Tx) Commit() error {
+	if err := tx.checkActive(); err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// a transaction writing nothing has read a consistent snapshot, there is nothing to validate
+	if len(tx.writes) == 0 {
+		return nil
+	}
+
+	db := tx.db
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	written := make(map[string]bool, len(tx.overlay))
+
+	for table := range tx.overlay {
+		written[table] = true
+	}
+
+	unlock := db.lockShardsNotLocking(tx.tables(), written)
+	defer unlock()
+
+	if err := tx.validateNotLocking(); err != nil {
+		return err
+	}
+
+	if err := db.checkWritesNotLocking(tx.writes); err != nil {
+		return err
+	}
+
+	if err := db.recordTx(tx.writes); err != nil {
+		return err
+	}
+
+	// all writes of the transaction share a number, so a snapshot sees either all of them or none
+	if err := db.applyWritesNotLocking(tx.writes, db.seq.Add(1)); err != nil {
+		tx.eachWrittenShard(db.discardEventsNotLocking)
+		return err
+	}
+
+	tx.eachWrittenShard(db.publishEventsNotLocking)
+
+	return nil
+}
+
+// tables returns names of all tables the transaction read or wrote.
+func (tx *Tx) tables() []string {
+	tables := make([]string, 0, len(tx.tableReads)+len(tx.rowReads)+len(tx.counterReads)+len(tx.overlay))
+
+	for table := range tx.tableReads {
+		tables = append(tables, table)
+	}
+
+	for table := range tx.rowReads {
+		tables = append(tables, table)
+	}
+
+	for table := range tx.counterReads {
+		tables = append(tables, table)
+	}
+
+	for table := range tx.overlay {
+		tables = append(tables, table)
+	}
+
+	return tables
+}
+
+func (tx *Tx) eachWrittenShard(fn func(sh *shard)) {
+	for table := range tx.overlay {
+		if sh, exists := tx.db.shards[table]; exists {
+			fn(sh)
+		}
+	}
+}
+
+// validateNotLocking checks that nothing the transaction read was changed after the snapshot.
+func (tx *Tx) validateNotLocking() error {
+	db := tx.db
+
+	for table := range tx.tableReads {
+		if sh, exists := db.shards[table]; !exists || sh.version > tx.snapshot {
+			return fmt.Errorf("%w: table %s was changed", ErrTxConflict, table)
+		}
+	}
+
+	for table, counter := range tx.counterReads {
+		if sh, exists := db.shards[table]; !exists || sh.counter != counter {
+			return fmt.Errorf("%w: counter of table %s was changed", ErrTxConflict, table)
+		}
+	}
+
+	for table, rows := range tx.rowReads {
+		sh, exists := db.shards[table]
+		if !exists || sh.created > tx.snapshot {
+			return fmt.Errorf("%w: table %s was dropped", ErrTxConflict, table)
+		}
+
+		for key := range rows {
+			if sh.versions[key] > tx.snapshot {
+				return fmt.Errorf("%w: row %s of table %s was changed", ErrTxConflict, key, table)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkWritesNotLocking checks the writes against unique indexes as if they were applied one by one,
+// so that writes are logged only when they can be applied.
+func (db *InMemDB) checkWritesNotLocking(writes []Write) error {
+	// the latest of the writes checked so far by table and key
+	written := make(map[string]map[string]Write)
+
+	for _, w := range writes {
+		if w.Op == opSetCounter {
+			continue
+		}
+
+		sh, err := db.getShardNotLocking(w.Table)
+		if err != nil {
+			return err
+		}
+
+		if written[w.Table] == nil {
+			written[w.Table] = make(map[string]Write)
+		}
+
+		if w.Op != OpDropRow {
+			for name, idx := range sh.indexes {
+				if value, dup := idx.conflictAfter(w.Key, w.Row, written[w.Table]); dup {
+					return &UniqueViolationError{Table: w.Table, Index: name, Value: value}
+				}
+			}
+		}
+
+		written[w.Table][w.Key] = w
+	}
+
+	return nil
+}
+
+// applyWritesNotLocking applies the writes numbered by seq one by one and rolls the applied ones back
+// if any of them fails. Constraints are checked before, so only the engine may fail them.
+func (db *InMemDB) applyWritesNotLocking(writes []Write, seq uint64) error {
+	undo := undoLog{entries: make([]undoEntry, 0, len(writes)), counters: make(map[string]int), seq: seq}
+
+	for _, w := range writes {
+		if sh, exists := db.shards[w.Table]; exists {
+			if _, saved := undo.counters[w.Table]; !saved {
+				undo.counters[w.Table] = sh.counter
+			}
+		}
+
+		// counters are restored by the undo log on their own
+		if w.Op == opSetCounter {
+			if err := db.setCounterNotLocking(w.Table, w.Row, seq); err != nil {
+				db.undoNotLocking(undo)
+				return err
+			}
+
+			continue
+		}
+
+		entry, err := db.applyWriteNotLocking(w, seq)
+		if err != nil {
+			db.undoNotLocking(undo)
+			return err
+		}
+
+		undo.entries = append(undo.entries, entry)
+	}
+
+	return nil
+}
+
+func (db *InMemDB) applyWriteNotLocking(w Write, seq uint64) (undoEntry, error) {
+	sh, err := db.getShardNotLocking(w.Table)
+	if err != nil {
+		return undoEntry{}, err
+	}
+
+	old, existed, err := sh.rows.Get(w.Key)
+	if err != nil {
+		return undoEntry{}, err
+	}
+
+	entry := undoEntry{table: w.Table, key: w.Key, existed: existed, old: old, inserted: sh.inserted[w.Key]}
+
+	if existed {
+		entry.next, entry.hasNext = sh.rows.Next(w.Key)
+	}
+
+	switch w.Op {
+	case OpAddRow, OpAlterRow:
+		if err = db.setRowNotLocking(sh, w.Key, w.Row, seq); err != nil {
+			return undoEntry{}, err
+		}
+	case OpDropRow:
+		if err = db.deleteRowNotLocking(sh, w.Key, seq); err != nil {
+			return undoEntry{}, err
+		}
+	default:
+		return undoEntry{}, fmt.Errorf("unknown operation %q", w.Op)
+	}
+
+	return entry, nil
+}
+
+func (db *InMemDB) setCounterNotLocking(table string, counter any, seq uint64) error {
+	sh, err := db.getShardNotLocking(table)
+	if err != nil {
+		return err
+	}
+
+	value, ok := counter.(int)
+	if !ok {
+		return fmt.Errorf("invalid counter %v of table %s", counter, table)
+	}
+
+	db.keepCounterNotLocking(sh, seq)
+	sh.counter = value
+
+	return nil
+}
+
+// undoNotLocking numbers the writes it reverts like the writes themselves, so snapshots taken
+// before them keep seeing the rows as they were and later ones see the restored rows.
+func (db *InMemDB) undoNotLocking(undo undoLog) {
+	for i := len(undo.entries) - 1; i >= 0; i-- {
+		entry := undo.entries[i]
+		sh := db.shards[entry.table]
+
+		// undo restores rows the engine has just given back, so it has nothing left to fail on
+		if !entry.existed {
+			_ = db.deleteRowNotLocking(sh, entry.key, undo.seq)
+			continue
+		}
+
+		_, present, _ := sh.rows.Get(entry.key)
+
+		_ = db.setRowNotLocking(sh, entry.key, entry.old, undo.seq)
+
+		if !present {
+			if entry.hasNext {
+				_ = sh.rows.MoveBefore(entry.key, entry.next)
+			}
+
+			sh.inserted[entry.key] = entry.inserted
+		}
+	}
+
+	// restoring dropped rows counts them as added again
+	for table, counter := range undo.counters {
+		db.shards[table].counter = counter
+	}
+}
+
+// recordTx logs all writes of a transaction as a single record, so the log never holds a part of it.
+func (db *InMemDB) recordTx(writes []Write) error {
+	if db.wal != nil {
+		if err := db.wal.appendTx(writes); err != nil {
+			return err
+		}
+	}
+
+	if err := db.engine.Persist(writes); err != nil {
+		return err
+	}
+
+	for range writes {
+		db.markDirty()
+	}
+
+	return nil
+}
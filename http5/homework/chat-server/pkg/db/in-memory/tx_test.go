@@ -0,0 +1,503 @@
+package in_memory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func initTxDB(t *testing.T, opts ...Option) *InMemDB {
+	t.Helper()
+
+	db, _ := NewInMemDB(context.Background(), "", opts...)
+
+	db.CreateTable("users")
+	db.CreateTable("messages")
+
+	if err := db.AddRow("users", "1", "first@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AddRow("users", "2", "second@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestTxCommitAppliesAllWrites(t *testing.T) {
+	db := initTxDB(t)
+
+	tx := db.Begin()
+
+	if err := tx.AddRow("messages", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.DropRow("users", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if row, err := tx.GetRow("messages", "1"); err != nil || row != "hello" {
+		t.Fatalf("transaction should see its own writes, got %v (%v)", row, err)
+	}
+
+	if rows, err := tx.GetAllRows("users", 0, 10); err != nil || len(rows) != 1 {
+		t.Fatalf("transaction should not see rows it dropped, got %v (%v)", rows, err)
+	}
+
+	if _, err := db.GetRow("messages", "1"); !errors.Is(err, ErrNotExistedRow) {
+		t.Fatalf("uncommitted write is visible outside of transaction: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("cannot commit: %v", err)
+	}
+
+	if row, err := db.GetRow("messages", "1"); err != nil || row != "hello" {
+		t.Fatalf("committed write is not visible, got %v (%v)", row, err)
+	}
+
+	if _, err := db.GetRow("users", "2"); !errors.Is(err, ErrNotExistedRow) {
+		t.Fatalf("committed drop is not visible: %v", err)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expected ErrTxDone on second commit, got %v", err)
+	}
+}
+
+func TestTxRollbackDiscardsWrites(t *testing.T) {
+	db := initTxDB(t)
+
+	tx := db.Begin()
+
+	if err := tx.AddRow("messages", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.Rollback()
+
+	if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expected ErrTxDone on commit after rollback, got %v", err)
+	}
+
+	if count, _ := db.GetRowsCount("messages"); count != 0 {
+		t.Fatalf("rolled back write was applied, got %d rows", count)
+	}
+}
+
+func TestTxConflict(t *testing.T) {
+	db := initTxDB(t)
+
+	tx := db.Begin()
+
+	if _, err := tx.GetRow("users", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.AddRow("messages", "1", "hello first"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DropRow("users", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, ErrTxConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+
+	if count, _ := db.GetRowsCount("messages"); count != 0 {
+		t.Fatalf("conflicting transaction was applied, got %d rows", count)
+	}
+}
+
+func TestTxFailedCommitLeavesNoTrace(t *testing.T) {
+	db := initTxDB(t)
+
+	if err := db.CreateIndex("users", IndexSpec{Name: emailIndex, Unique: true, Key: emailKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+
+	if err := tx.DropRow("users", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.AddRow("users", "3", "third@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// conflicts with the row added by the same transaction
+	if err := tx.AlterRow("users", "2", "third@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("expected unique violation, got %v", err)
+	}
+
+	rows, err := db.GetAllRows("users", 0, 10)
+	if err != nil || len(rows) != 2 || rows[0] != "first@mail.com" || rows[1] != "second@mail.com" {
+		t.Fatalf("expected table to be left as before commit, got %v (%v)", rows, err)
+	}
+
+	if counter, _ := db.GetTableCounter("users"); counter != 2 {
+		t.Fatalf("expected counter to be left as before commit, got %d", counter)
+	}
+
+	if _, err = db.GetRowByIndex("users", emailIndex, "third@mail.com"); !errors.Is(err, ErrNotExistedRow) {
+		t.Fatalf("expected index to be left as before commit, got %v", err)
+	}
+}
+
+func TestTxUnloggedCommitLeavesNoTrace(t *testing.T) {
+	wal := openTestWAL(t, filepath.Join(t.TempDir(), "db.wal"))
+	db := initTxDB(t, WithWAL(wal))
+
+	// every append to a closed log fails
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+
+	if err := tx.DropRow("users", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.AddRow("users", "3", "third@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+
+	rows, err := db.GetAllRows("users", 0, 10)
+	if err != nil || len(rows) != 2 || rows[0] != "first@mail.com" || rows[1] != "second@mail.com" {
+		t.Fatalf("expected table to be left as before commit, got %v (%v)", rows, err)
+	}
+
+	// the dropped row restored by the rollback must not be counted as added again
+	if counter, _ := db.GetTableCounter("users"); counter != 2 {
+		t.Fatalf("expected counter to be left as before commit, got %d", counter)
+	}
+}
+
+func TestTxNextIDNeverConflicts(t *testing.T) {
+	db := initTxDB(t)
+
+	const writers = 20
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, writers)
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			errs <- db.Tx(func(tx Transaction) error {
+				id, err := tx.NextID("messages")
+				if err != nil {
+					return err
+				}
+
+				return tx.AddRow("messages", strconv.Itoa(id), "hello")
+			})
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if count, _ := db.GetRowsCount("messages"); count != writers {
+		t.Fatalf("expected %d rows, got %d", writers, count)
+	}
+
+	// identifiers follow the rows already added
+	id, err := db.Begin().NextID("users")
+	if err != nil || id != 3 {
+		t.Fatalf("expected next id 3, got %d (%v)", id, err)
+	}
+}
+
+func TestTxCounterReachesIdentifiersOfRolledBackTx(t *testing.T) {
+	db := initTxDB(t)
+
+	skipped := db.Begin()
+
+	if _, err := skipped.NextID("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	skipped.Rollback()
+
+	err := db.Tx(func(tx Transaction) error {
+		id, err := tx.NextID("users")
+		if err != nil {
+			return err
+		}
+
+		return tx.AddRow("users", strconv.Itoa(id), "fourth@mail.com")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no row has a numeric key above the counter
+	if counter, _ := db.GetTableCounter("users"); counter != 4 {
+		t.Fatalf("expected counter 4, got %d", counter)
+	}
+}
+
+func TestTxRetriedOnConflict(t *testing.T) {
+	db := initTxDB(t)
+
+	const writers = 20
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, writers)
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			errs <- db.Tx(func(tx Transaction) error {
+				counter, err := tx.GetTableCounter("messages")
+				if err != nil {
+					return err
+				}
+
+				return tx.AddRow("messages", strconv.Itoa(counter+1), "hello")
+			})
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	failed := 0
+
+	for err := range errs {
+		if err != nil && !errors.Is(err, ErrTxConflict) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err != nil {
+			failed++
+		}
+	}
+
+	if count, _ := db.GetRowsCount("messages"); count != writers-failed {
+		t.Fatalf("expected %d rows, got %d", writers-failed, count)
+	}
+}
+
+func TestTxReplayedFromWAL(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "db.wal")
+
+	wal := openTestWAL(t, walPath)
+	db := initTxDB(t, WithWAL(wal))
+
+	err := db.Tx(func(tx Transaction) error {
+		if err := tx.AddRow("messages", "1", "hello"); err != nil {
+			return err
+		}
+
+		return tx.AlterRow("users", "1", "renamed@mail.com")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _, err := NewInMemDBFromJSON(context.Background(), emptyState, "", WithWAL(openTestWAL(t, walPath)))
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	if row, err := restored.GetRow("messages", "1"); err != nil || row != "hello" {
+		t.Fatalf("expected row added in transaction, got %v (%v)", row, err)
+	}
+
+	if row, err := restored.GetRow("users", "1"); err != nil || row != "renamed@mail.com" {
+		t.Fatalf("expected row altered in transaction, got %v (%v)", row, err)
+	}
+}
+
+func TestTxReadsSnapshot(t *testing.T) {
+	db := initTxDB(t)
+
+	if err := db.CreateIndex("users", IndexSpec{Name: emailIndex, Unique: true, Key: emailKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	// committed after the snapshot of the transaction
+	if err := db.DropRow("users", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AlterRow("users", "2", "renamed@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AddRow("users", "3", "third@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if row, err := tx.GetRow("users", "1"); err != nil || row != "first@mail.com" {
+		t.Fatalf("expected dropped row as of snapshot, got %v (%v)", row, err)
+	}
+
+	if _, err := tx.GetRow("users", "3"); !errors.Is(err, ErrNotExistedRow) {
+		t.Fatalf("expected row added after snapshot to be missing, got %v", err)
+	}
+
+	rows, err := tx.GetAllRows("users", 0, 0)
+	if err != nil || len(rows) != 2 || rows[0] != "first@mail.com" || rows[1] != "second@mail.com" {
+		t.Fatalf("expected rows as of snapshot, got %v (%v)", rows, err)
+	}
+
+	if row, err := tx.GetRowByIndex("users", emailIndex, "second@mail.com"); err != nil || row != "second@mail.com" {
+		t.Fatalf("expected row by index as of snapshot, got %v (%v)", row, err)
+	}
+
+	if counter, err := tx.GetTableCounter("users"); err != nil || counter != 2 {
+		t.Fatalf("expected counter as of snapshot, got %d (%v)", counter, err)
+	}
+
+	if err = tx.AddRow("messages", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tx.Commit(); !errors.Is(err, ErrTxConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+}
+
+func TestTxReadOnlyCommitNeverConflicts(t *testing.T) {
+	db := initTxDB(t)
+
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	if _, err := tx.GetRow("users", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.GetTableCounter("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AlterRow("users", "1", "renamed@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("expected read-only transaction to commit, got %v", err)
+	}
+}
+
+func TestTxGetAllRowsOffsetAndLimit(t *testing.T) {
+	db := initTxDB(t)
+
+	tests := []struct {
+		name          string
+		offset, limit int
+	}{
+		{name: "all rows", offset: 0, limit: 0},
+		{name: "negative offset", offset: -1, limit: 1},
+		{name: "negative limit", offset: 1, limit: -1},
+		{name: "past the end", offset: 5, limit: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := db.GetAllRows("users", tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tx := db.Begin()
+			defer tx.Rollback()
+
+			rows, err := tx.GetAllRows("users", tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(rows) != len(expected) {
+				t.Fatalf("expected %v, got %v", expected, rows)
+			}
+
+			for i := range rows {
+				if rows[i] != expected[i] {
+					t.Fatalf("expected %v, got %v", expected, rows)
+				}
+			}
+		})
+	}
+}
+
+func TestTxViolatingCommitIsNotLogged(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "db.wal")
+
+	wal := openTestWAL(t, walPath)
+	db := initTxDB(t, WithWAL(wal))
+
+	if err := db.CreateIndex("users", IndexSpec{Name: emailIndex, Unique: true, Key: emailKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+
+	if err := tx.AddRow("messages", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.AlterRow("users", "2", "first@mail.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("expected unique violation, got %v", err)
+	}
+
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// indexes are not logged, so the replayed log would apply the transaction if it held it
+	restored, _, err := NewInMemDBFromJSON(context.Background(), emptyState, "", WithWAL(openTestWAL(t, walPath)))
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	if _, err = restored.GetRow("messages", "1"); !errors.Is(err, ErrNotExistedRow) {
+		t.Fatalf("expected failed transaction to be left out of the log, got %v", err)
+	}
+}
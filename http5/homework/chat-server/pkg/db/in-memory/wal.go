@@ -0,0 +1,482 @@
+package in_memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs the log after every appended record.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs the log in background once per WALConfig.SyncInterval.
+	SyncInterval
+	// SyncNever leaves flushing of the log to the operating system.
+	SyncNever
+)
+
+type WALConfig struct {
+	Path         string
+	Policy       SyncPolicy
+	SyncInterval time.Duration
+}
+
+const (
+	// opTx groups writes of a transaction into a single record.
+	opTx WriteOp = "tx"
+	// opSetCounter sets the counter of a table to the number stored as its row.
+	opSetCounter WriteOp = "set_counter"
+)
+
+type walRecord struct {
+	Seq   uint64          `json:"seq"`
+	Op    WriteOp         `json:"op"`
+	Table string          `json:"table,omitempty"`
+	Key   string          `json:"key,omitempty"`
+	Row   json.RawMessage `json:"row,omitempty"`
+	Ops   []walRecord     `json:"ops,omitempty"`
+}
+
+// WAL is an append-only log of InMemDB writes. Every record is one JSON line,
+// so a record torn by a crash is detected and cut off when the log is opened.
+// Only the last record can be torn, a broken record anywhere else fails the open with ErrCorruptedWAL.
+type WAL struct {
+	cfg  WALConfig
+	file *os.File
+	seq  uint64
+	// size is the offset the next record is appended at
+	size int64
+
+	// err is sticky: once a write failed, the log can no longer be trusted
+	// and every following append returns the same error.
+	err   error
+	dirty bool
+
+	stop chan struct{}
+	done chan struct{}
+
+	m sync.RWMutex
+}
+
+func OpenWAL(cfg WALConfig) (*WAL, error) {
+	if cfg.Policy == SyncInterval && cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = defaultWALSyncInterval
+	}
+
+	file, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_RDWR, writePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	wal := WAL{
+		cfg:  cfg,
+		file: file,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	validSize, err := wal.scan(func(rec walRecord, _, _ int64) error {
+		// compaction may leave records out of order, the next record follows the latest one
+		wal.seq = max(wal.seq, rec.Seq)
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// cut off the torn tail left by a crash in the middle of an append
+	if err = file.Truncate(validSize); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err = file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	wal.size = validSize
+
+	if cfg.Policy == SyncInterval {
+		go wal.syncLoop()
+	} else {
+		close(wal.done)
+	}
+
+	return &wal, nil
+}
+
+// scan reads records from the beginning of the log and returns the size of its valid prefix.
+// Along with every record fn gets its offset and size in the log.
+func (w *WAL) scan(fn func(rec walRecord, offset, size int64) error) (int64, error) {
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(w.file)
+
+	var validSize int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a line without trailing newline was not fully written
+			return validSize, nil
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		var rec walRecord
+
+		if err = json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			// only the last record may be torn, a broken record followed by others means
+			// the log is corrupted, and cutting it off there would lose the records after it
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				return validSize, nil
+			}
+
+			return 0, fmt.Errorf("%w: record at %d: %w", ErrCorruptedWAL, validSize, err)
+		}
+
+		if err = fn(rec, validSize, int64(len(line))); err != nil {
+			return 0, fmt.Errorf("%w: record %d: %w", ErrCorruptedWAL, rec.Seq, err)
+		}
+
+		validSize += int64(len(line))
+	}
+}
+
+func (w *WAL) replay(apply func(rec walRecord) error) error {
+	return w.replayAt(func(rec walRecord, _, _ int64) error {
+		return apply(rec)
+	})
+}
+
+// replayAt is replay passing the offset and size of every record along with it.
+func (w *WAL) replayAt(apply func(rec walRecord, offset, size int64) error) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	_, err := w.scan(apply)
+
+	if _, seekErr := w.file.Seek(0, io.SeekEnd); seekErr != nil && err == nil {
+		err = seekErr
+	}
+
+	return err
+}
+
+// append writes the record at the end of the log and returns its offset and size.
+func (w *WAL) append(rec walRecord) (int64, int64, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.err != nil {
+		return 0, 0, w.err
+	}
+
+	rec.Seq = w.seq + 1
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	line = append(line, '\n')
+
+	if _, err = w.file.Write(line); err != nil {
+		w.err = err
+		return 0, 0, err
+	}
+
+	offset := w.size
+
+	w.seq = rec.Seq
+	w.size += int64(len(line))
+
+	switch w.cfg.Policy {
+	case SyncAlways:
+		if err = w.file.Sync(); err != nil {
+			w.err = err
+			return 0, 0, err
+		}
+	case SyncInterval:
+		w.dirty = true
+	case SyncNever:
+	}
+
+	return offset, int64(len(line)), nil
+}
+
+// readAt reads back the record appended at offset.
+func (w *WAL) readAt(offset, size int64) (walRecord, error) {
+	w.m.RLock()
+	defer w.m.RUnlock()
+
+	return w.readAtNotLocking(offset, size)
+}
+
+func (w *WAL) readAtNotLocking(offset, size int64) (walRecord, error) {
+	line := make([]byte, size)
+
+	if _, err := w.file.ReadAt(line, offset); err != nil {
+		return walRecord{}, err
+	}
+
+	var rec walRecord
+
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return walRecord{}, fmt.Errorf("%w: record at %d: %w", ErrCorruptedWAL, offset, err)
+	}
+
+	return rec, nil
+}
+
+func newRowRecord(op WriteOp, table, key string, row any) (walRecord, error) {
+	rec := walRecord{Op: op, Table: table, Key: key}
+
+	if row != nil {
+		encoded, err := json.Marshal(row)
+		if err != nil {
+			return walRecord{}, err
+		}
+
+		rec.Row = encoded
+	}
+
+	return rec, nil
+}
+
+func (w *WAL) appendRow(op WriteOp, table, key string, row any) error {
+	rec, err := newRowRecord(op, table, key, row)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = w.append(rec)
+
+	return err
+}
+
+func newTxRecord(writes []Write) (walRecord, error) {
+	rec := walRecord{Op: opTx, Ops: make([]walRecord, 0, len(writes))}
+
+	for _, write := range writes {
+		op, err := newRowRecord(write.Op, write.Table, write.Key, write.Row)
+		if err != nil {
+			return walRecord{}, err
+		}
+
+		rec.Ops = append(rec.Ops, op)
+	}
+
+	return rec, nil
+}
+
+func (w *WAL) appendTx(writes []Write) error {
+	rec, err := newTxRecord(writes)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = w.append(rec)
+
+	return err
+}
+
+func (w *WAL) lastSeq() uint64 {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.seq
+}
+
+// compact drops records up to seq once they are covered by a snapshot.
+func (w *WAL) compact(seq uint64) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if seq >= w.seq {
+		return w.truncate()
+	}
+
+	return w.rewriteAfter(seq)
+}
+
+func (w *WAL) truncate() error {
+	if err := w.file.Truncate(0); err != nil {
+		w.err = err
+		return err
+	}
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		w.err = err
+		return err
+	}
+
+	w.dirty = false
+	w.size = 0
+
+	return w.file.Sync()
+}
+
+// rewriteAfter replaces the log with a copy holding only records after seq.
+func (w *WAL) rewriteAfter(seq uint64) error {
+	return w.rewrite(func(emit func(rec walRecord) (int64, int64, error)) error {
+		_, err := w.scan(func(rec walRecord, _, _ int64) error {
+			if rec.Seq <= seq {
+				return nil
+			}
+
+			_, _, err := emit(rec)
+
+			return err
+		})
+
+		return err
+	})
+}
+
+// rewrite replaces the log with a copy holding the records passed to emit by fill.
+// emit returns the offset and size of the record in the new log. fill may read the
+// current log, which is left untouched if anything fails. The log must be locked.
+func (w *WAL) rewrite(fill func(emit func(rec walRecord) (int64, int64, error)) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(w.cfg.Path), filepath.Base(w.cfg.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+
+	var size int64
+
+	err = fill(func(rec walRecord) (int64, int64, error) {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		line = append(line, '\n')
+
+		if _, err = writer.Write(line); err != nil {
+			return 0, 0, err
+		}
+
+		offset := size
+		size += int64(len(line))
+
+		return offset, int64(len(line)), nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		// the log itself is untouched, so it stays usable
+		_, seekErr := w.file.Seek(0, io.SeekEnd)
+		w.err = seekErr
+
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), writePerm); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), w.cfg.Path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(w.cfg.Path, os.O_RDWR, writePerm)
+	if err != nil {
+		w.err = err
+		return err
+	}
+
+	if _, err = file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		w.err = err
+
+		return err
+	}
+
+	w.file.Close()
+	w.file = file
+	w.size = size
+	w.dirty = false
+
+	return nil
+}
+
+func (w *WAL) syncLoop() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.m.Lock()
+
+			if w.dirty && w.err == nil {
+				if err := w.file.Sync(); err != nil {
+					w.err = err
+				}
+
+				w.dirty = false
+			}
+
+			w.m.Unlock()
+		}
+	}
+}
+
+func (w *WAL) Close() error {
+	close(w.stop)
+	<-w.done
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	syncErr := w.file.Sync()
+	closeErr := w.file.Close()
+
+	if w.err == nil {
+		w.err = os.ErrClosed
+	}
+
+	if syncErr != nil {
+		return syncErr
+	}
+
+	return closeErr
+}
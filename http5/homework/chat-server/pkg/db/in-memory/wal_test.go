@@ -0,0 +1,273 @@
+package in_memory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const emptyState = "{}"
+
+func openTestWAL(t *testing.T, path string) *WAL {
+	t.Helper()
+
+	wal, err := OpenWAL(WALConfig{Path: path, Policy: SyncAlways})
+	if err != nil {
+		t.Fatalf("cannot open wal: %v", err)
+	}
+
+	return wal
+}
+
+func TestWALReplayedAfterCrash(t *testing.T) {
+	ctx := context.Background()
+	walPath := filepath.Join(t.TempDir(), "db.wal")
+
+	wal := openTestWAL(t, walPath)
+	db, _ := NewInMemDB(ctx, "", WithWAL(wal))
+
+	db.CreateTable("messages")
+
+	if err := db.AddRow("messages", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AddRow("messages", "2", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AlterRow("messages", "1", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DropRow("messages", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// process dies without saving a snapshot
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _, err := NewInMemDBFromJSON(ctx, emptyState, "", WithWAL(openTestWAL(t, walPath)))
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	row, err := restored.GetRow("messages", "1")
+	if err != nil || row != "hi" {
+		t.Fatalf("expected altered row, got %v (%v)", row, err)
+	}
+
+	if _, err = restored.GetRow("messages", "2"); err == nil {
+		t.Fatal("dropped row restored")
+	}
+
+	counter, err := restored.GetTableCounter("messages")
+	if err != nil || counter != 2 {
+		t.Fatalf("expected counter 2, got %v (%v)", counter, err)
+	}
+}
+
+func TestWALTornTailIgnored(t *testing.T) {
+	ctx := context.Background()
+	walPath := filepath.Join(t.TempDir(), "db.wal")
+
+	wal := openTestWAL(t, walPath)
+	db, _ := NewInMemDB(ctx, "", WithWAL(wal))
+
+	db.CreateTable("messages")
+
+	if err := db.AddRow("messages", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, writePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = file.WriteString(`{"seq":3,"op":"add_row","tab`); err != nil {
+		t.Fatal(err)
+	}
+
+	file.Close()
+
+	wal = openTestWAL(t, walPath)
+
+	restored, _, err := NewInMemDBFromJSON(ctx, emptyState, "", WithWAL(wal))
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	if err = restored.AddRow("messages", "2", "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _, err = NewInMemDBFromJSON(ctx, emptyState, "", WithWAL(openTestWAL(t, walPath)))
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	count, err := restored.GetRowsCount("messages")
+	if err != nil || count != 2 {
+		t.Fatalf("expected 2 rows, got %v (%v)", count, err)
+	}
+}
+
+func TestSaveTruncatesWAL(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "db.wal")
+	savePath := filepath.Join(dir, "db.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	db, savedChan := NewInMemDB(ctx, savePath, WithWAL(openTestWAL(t, walPath)))
+
+	db.CreateTable("messages")
+
+	if err := db.AddRow("messages", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	if res := <-savedChan; res != "ok" {
+		t.Fatalf("cannot save db: %v", res)
+	}
+
+	info, err := os.Stat(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 0 {
+		t.Fatalf("expected empty wal after save, got %d bytes", info.Size())
+	}
+}
+
+func TestWALCorruptedInTheMiddleNotTruncated(t *testing.T) {
+	ctx := context.Background()
+	walPath := filepath.Join(t.TempDir(), "db.wal")
+
+	wal := openTestWAL(t, walPath)
+	db, _ := NewInMemDB(ctx, "", WithWAL(wal))
+
+	db.CreateTable("messages")
+
+	for _, key := range []string{"1", "2", "3"} {
+		if err := db.AddRow("messages", key, "hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	lines[2] = "{broken\n"
+
+	corrupted := strings.Join(lines, "")
+
+	if err = os.WriteFile(walPath, []byte(corrupted), writePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = OpenWAL(WALConfig{Path: walPath, Policy: SyncAlways}); !errors.Is(err, ErrCorruptedWAL) {
+		t.Fatalf("expected %v, got %v", ErrCorruptedWAL, err)
+	}
+
+	// the records after the broken one are still there to be recovered by hand
+	if data, err = os.ReadFile(walPath); err != nil || string(data) != corrupted {
+		t.Fatalf("expected the log to be left untouched, got %q (%v)", data, err)
+	}
+}
+
+func TestWALBrokenLastRecordCutOff(t *testing.T) {
+	ctx := context.Background()
+	walPath := filepath.Join(t.TempDir(), "db.wal")
+
+	wal := openTestWAL(t, walPath)
+	db, _ := NewInMemDB(ctx, "", WithWAL(wal))
+
+	db.CreateTable("messages")
+
+	if err := db.AddRow("messages", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, writePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = file.WriteString("{broken\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	file.Close()
+
+	restored, _, err := NewInMemDBFromJSON(ctx, emptyState, "", WithWAL(openTestWAL(t, walPath)))
+	if err != nil {
+		t.Fatalf("cannot restore db: %v", err)
+	}
+
+	if count, err := restored.GetRowsCount("messages"); err != nil || count != 1 {
+		t.Fatalf("expected 1 row, got %v (%v)", count, err)
+	}
+}
+
+func TestSchemaChangeReportsFailedLog(t *testing.T) {
+	wal := openTestWAL(t, filepath.Join(t.TempDir(), "db.wal"))
+	db, _ := NewInMemDB(context.Background(), "", WithWAL(wal))
+
+	if err := db.CreateTable("messages"); err != nil {
+		t.Fatal(err)
+	}
+
+	// every append to a closed log fails
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTable("users"); err == nil {
+		t.Fatal("expected creating a table to fail")
+	}
+
+	if _, err := db.GetTable("users"); !errors.Is(err, ErrNotExistedTable) {
+		t.Fatalf("expected the table not to be created, got %v", err)
+	}
+
+	if err := db.DropTable("messages"); err == nil {
+		t.Fatal("expected dropping a table to fail")
+	}
+
+	if err := db.Clear(); err == nil {
+		t.Fatal("expected clearing the database to fail")
+	}
+
+	if _, err := db.GetTable("messages"); err != nil {
+		t.Fatalf("expected the table to be kept, got %v", err)
+	}
+}
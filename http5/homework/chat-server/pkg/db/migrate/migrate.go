@@ -0,0 +1,126 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidMigrationName = errors.New("migration file name must start with its version, e.g. 0001_init.sql")
+
+type migration struct {
+	version int
+	name    string
+}
+
+// Up applies the .sql files of fsys that were not applied yet, in the order of their versions.
+// A file name starts with the version of its migration: 0001_init.sql, 0002_add_rooms.sql.
+// Every migration runs in its own transaction together with the record of it in schema_migrations.
+func Up(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	migrations, err := list(fsys)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		if err = apply(ctx, db, fsys, m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func list(fsys fs.FS) ([]migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(names))
+
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, name)
+		}
+
+		migrations = append(migrations, migration{version: version, name: name})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+
+	for rows.Next() {
+		var version int
+
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+func apply(ctx context.Context, db *sql.DB, fsys fs.FS, m migration) error {
+	script, err := fs.ReadFile(fsys, m.name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// rolling back a committed transaction is a no-op
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+
+	// the version is inlined, placeholders differ between SQL dialects
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO schema_migrations (version) VALUES (%d)`, m.version)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}